@@ -0,0 +1,178 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// The asciicast format recordings are written in, see https://docs.asciinema.org/manual/asciicast/v2/.
+const castVersion = 2
+
+// Header is the first line of an asciicast recording.
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Command   string            `json:"command,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Event is something which happened in a recording, Time seconds after it started: output when Type is "o".
+type Event struct {
+	Time float64
+	Type string
+	Data string
+}
+
+// MarshalJSON writes the event as asciicast does, [time, type, data].
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.Time, e.Type, e.Data})
+}
+
+// UnmarshalJSON reads an event written by MarshalJSON.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var fields []interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 3 {
+		return fmt.Errorf("audit: an event has %d fields, want 3", len(fields))
+	}
+	var ok [3]bool
+	e.Time, ok[0] = fields[0].(float64)
+	e.Type, ok[1] = fields[1].(string)
+	e.Data, ok[2] = fields[2].(string)
+	if !ok[0] || !ok[1] || !ok[2] {
+		return fmt.Errorf("audit: invalid event %s", data)
+	}
+	return nil
+}
+
+// Recorder writes an asciicast recording of the output written to it.
+type Recorder struct {
+	w     io.Writer
+	start time.Time
+
+	mu      sync.Mutex
+	pending []byte
+	err     error
+}
+
+// NewRecorder writes header, with the version and timestamp filled in, to w and returns a Recorder of the output
+// which follows.
+func NewRecorder(w io.Writer, header Header) (*Recorder, error) {
+	r := &Recorder{w: w, start: time.Now()}
+	header.Version = castVersion
+	if header.Timestamp == 0 {
+		header.Timestamp = r.start.Unix()
+	}
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Write records p as output at the time it is written. It never fails, so as not to interrupt the session being
+// recorded; the first error is returned by Close instead.
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.Output(time.Since(r.start), p)
+	return len(p), nil
+}
+
+// Output records p as output at the given time since the recording started. A character split between calls is
+// held back until it is whole, as events are UTF-8 strings.
+func (r *Recorder) Output(at time.Duration, p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data := append(r.pending, p...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	r.pending = append([]byte(nil), data[cut:]...)
+	if cut > 0 {
+		r.event(Event{at.Seconds(), "o", string(data[:cut])})
+	}
+}
+
+func (r *Recorder) event(e Event) {
+	if r.err != nil {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err == nil {
+		_, err = r.w.Write(append(data, '\n'))
+	}
+	r.err = err
+}
+
+// Close records any output held back and returns the first error writing the recording, without closing the
+// underlying writer.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) > 0 {
+		r.event(Event{time.Since(r.start).Seconds(), "o", string(r.pending)})
+		r.pending = nil
+	}
+	return r.err
+}
+
+// Replay writes the output of the recording read from r to w with the timing it was recorded with, sped up by
+// speed and with pauses of more than maxIdle cut short to maxIdle, if it is not 0.
+func Replay(r io.Reader, w io.Writer, speed float64, maxIdle time.Duration) (*Header, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("audit: the recording is empty")
+	}
+	header := new(Header)
+	if err := json.Unmarshal(scanner.Bytes(), header); err != nil {
+		return nil, fmt.Errorf("audit: invalid recording header: %v", err)
+	}
+	if header.Version != castVersion {
+		return nil, fmt.Errorf("audit: unsupported asciicast version %d", header.Version)
+	}
+	if speed <= 0 {
+		speed = 1
+	}
+
+	last := 0.0
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return header, err
+		}
+		pause := time.Duration((e.Time - last) / speed * float64(time.Second))
+		if maxIdle > 0 && pause > maxIdle {
+			pause = maxIdle
+		}
+		time.Sleep(pause)
+		last = e.Time
+		if e.Type == "o" {
+			if _, err := io.WriteString(w, e.Data); err != nil {
+				return header, err
+			}
+		}
+	}
+	return header, scanner.Err()
+}
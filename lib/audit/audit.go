@@ -0,0 +1,157 @@
+// Package audit keeps an append-only log of the sessions opened on devices, who opened them and what they ran, along
+// with recordings of their output in asciicast v2 format, which asciinema can also play.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The events logged for a session. A session is logged when it starts, so that it is known to have been opened on
+// the device however it ends, and again when it ends.
+const (
+	EventStart = "start"
+	EventEnd   = "end"
+)
+
+// Entry is a session opened on a device, one line of the log. A session which is still open, or whose end was never
+// logged because unified was interrupted, has a zero End and an ExitCode of -1.
+type Entry struct {
+	ID             string    `json:"id"`
+	Event          string    `json:"event,omitempty"`
+	Kind           string    `json:"kind"`
+	Operator       string    `json:"operator"`
+	ControllerUser string    `json:"controller_user"`
+	Controller     string    `json:"controller"`
+	Site           string    `json:"site"`
+	Device         string    `json:"device"`
+	MacAddress     string    `json:"mac"`
+	IP             string    `json:"ip"`
+	Command        string    `json:"command"`
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	ExitCode       int       `json:"exit_code"`
+	Error          string    `json:"error,omitempty"`
+
+	// Recording is the path of the recording of the session relative to the log, empty when it was not recorded.
+	Recording string `json:"recording,omitempty"`
+}
+
+// Duration is how long the session lasted.
+func (e Entry) Duration() time.Duration {
+	return e.End.Sub(e.Start)
+}
+
+// NewID returns an ID for a session on the device with the given MAC address starting at start, which sorts by
+// time and, as it is used to name the recording, is safe in a file name.
+func NewID(start time.Time, mac string) string {
+	if hw, err := net.ParseMAC(mac); err == nil {
+		mac = hw.String()
+	}
+	return start.UTC().Format("20060102T150405.000Z") + "-" + strings.Replace(mac, ":", "", -1)
+}
+
+// Log is the audit log in a directory, audit.log, alongside the recordings directory.
+type Log struct {
+	Dir string
+	mu  sync.Mutex
+}
+
+// Path is the path of the log file.
+func (l *Log) Path() string {
+	return filepath.Join(l.Dir, "audit.log")
+}
+
+// RecordingPath returns the path to record the session with the given ID to, and that relative to the log.
+func (l *Log) RecordingPath(id string) (string, string) {
+	rel := filepath.Join("recordings", id+".cast")
+	return filepath.Join(l.Dir, rel), rel
+}
+
+// Append adds e to the end of the log as a line of JSON. The file is only ever opened for appending, and is only
+// readable by its owner.
+func (l *Log) Append(e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(l.Dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.Path(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	// A single write keeps lines whole when other processes are appending too.
+	_, err = f.Write(append(data, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Entries reads the log, oldest first, with the end of a session replacing its start. A missing log is empty.
+func (l *Log) Entries() ([]Entry, error) {
+	f, err := os.Open(l.Path())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("audit: %s:%d: %v", l.Path(), n, err)
+		}
+		if i, ok := index[e.ID]; ok {
+			entries[i] = e
+			continue
+		}
+		index[e.ID] = len(entries)
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Find returns the entry whose ID is or starts with id, failing if there is none or more than one.
+func (l *Log) Find(id string) (*Entry, error) {
+	entries, err := l.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var found []Entry
+	for _, e := range entries {
+		if e.ID == id {
+			return &e, nil
+		}
+		if strings.HasPrefix(e.ID, id) {
+			found = append(found, e)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("audit: no session %s in %s", id, l.Path())
+	case 1:
+		return &found[0], nil
+	}
+	return nil, fmt.Errorf("audit: %s is ambiguous, it matches %d sessions", id, len(found))
+}
@@ -0,0 +1,110 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	log := &Log{Dir: dir}
+
+	if entries, err := log.Entries(); err != nil || len(entries) != 0 {
+		t.Fatalf("Entries() of a new log = %v, %v, want none", entries, err)
+	}
+	start := time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+	first := Entry{ID: NewID(start, "80:2A:A8:00:00:01"), Kind: "ssh", Operator: "alice", Device: "uap1",
+		MacAddress: "80:2a:a8:00:00:01", Start: start, End: start.Add(time.Minute)}
+	second := first
+	second.ID, second.Kind, second.Command, second.ExitCode = NewID(start.Add(time.Hour), first.MacAddress), "exec",
+		"uptime", 1
+	started, interrupted := first, second
+	started.Event, started.End, started.ExitCode = EventStart, time.Time{}, -1
+	interrupted.ID, interrupted.Event, interrupted.End, interrupted.ExitCode = NewID(start.Add(2*time.Hour),
+		first.MacAddress), EventStart, time.Time{}, -1
+	first.Event, second.Event = EventEnd, EventEnd
+	for _, e := range []Entry{started, second, first, interrupted} {
+		if err := log.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if first.ID != "20180301T120000.000Z-802aa8000001" {
+		t.Errorf("NewID() = %s, want the time and MAC address", first.ID)
+	}
+	entries, err := log.Entries()
+	if err != nil || len(entries) != 3 || entries[1].Command != "uptime" || entries[0].Duration() != time.Minute {
+		t.Fatalf("Entries() = %v, %v, want the three sessions with the first ended", entries, err)
+	}
+	if e := entries[2]; e.Event != EventStart || !e.End.IsZero() || e.ExitCode != -1 {
+		t.Errorf("Entries()[2] = %+v, want the interrupted session still started", e)
+	}
+	if info, err := os.Stat(log.Path()); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("the log is %v, %v, want it readable only by its owner", info.Mode(), err)
+	}
+
+	if e, err := log.Find("20180301T13"); err != nil || e.ID != second.ID {
+		t.Errorf("Find() by prefix = %v, %v, want the second session", e, err)
+	}
+	if e, err := log.Find(first.ID); err != nil || e.Event != EventEnd {
+		t.Errorf("Find() of a session which ended = %v, %v, want its end", e, err)
+	}
+	if _, err := log.Find("20180301"); err == nil {
+		t.Error("Find() of an ambiguous prefix did not fail")
+	}
+	if _, err := log.Find("2019"); err == nil {
+		t.Error("Find() of a missing session did not fail")
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	r, err := NewRecorder(&buf, Header{Width: 80, Height: 24, Command: "top"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "é" is split between writes, which must not leave invalid UTF-8 in the recording.
+	r.Write([]byte("caf\xc3"))
+	r.Write([]byte("\xa9\r\n"))
+	r.Output(2*time.Second, []byte("done"))
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var header Header
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil || header.Version != 2 || header.Width != 80 ||
+		header.Timestamp == 0 {
+		t.Errorf("header = %s, %v, want version 2, 80 wide and a timestamp", lines[0], err)
+	}
+	var output string
+	for _, line := range lines[1:] {
+		var e Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil || e.Type != "o" {
+			t.Fatalf("event %s = %v, want output", line, err)
+		}
+		output += e.Data
+	}
+	if output != "café\r\ndone" {
+		t.Errorf("recorded output = %q, want café done", output)
+	}
+
+	var replayed bytes.Buffer
+	start := time.Now()
+	if _, err := Replay(&buf, &replayed, 1, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if replayed.String() != output || time.Since(start) > time.Second {
+		t.Errorf("Replay() = %q after %s, want the output with the pause cut short", replayed.String(),
+			time.Since(start))
+	}
+}
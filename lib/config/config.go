@@ -0,0 +1,445 @@
+// Package config exports the configuration of a UniFi site as YAML, and plans and applies the changes needed to
+// bring a site in line with such a file.
+//
+// Objects are identified by name, or devices by MAC address, rather than by the IDs the Controller gives them, so
+// a file can be applied to another site or to a rebuilt Controller. References between objects, such as the user
+// group of a WLAN or the port profile of a switch port, are likewise written as names e.g. usergroup: Default
+// rather than usergroup_id: 58def75ce4b0dfb95e1163ac.
+package config
+
+import (
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"context"
+	"encoding/json"
+	"fmt"
+	yaml2 "github.com/ghodss/yaml"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The sections of a configuration file, in the order objects are created and updated. Objects are deleted in the
+// reverse order so nothing is deleted while still referenced.
+const (
+	UserGroups     = "user_groups"
+	Networks       = "networks"
+	FirewallGroups = "firewall_groups"
+	PortProfiles   = "port_profiles"
+	WLANs          = "wlans"
+	FirewallRules  = "firewall_rules"
+	Devices        = "devices"
+)
+
+// Object is a single object of a configuration file e.g. a WLAN.
+type Object map[string]interface{}
+
+// Config is the desired configuration of a site. A section which is missing is left alone entirely, while the
+// objects of a section which is present are created, updated and deleted to match it.
+type Config struct {
+	UserGroups     []Object `json:"user_groups,omitempty"`
+	Networks       []Object `json:"networks,omitempty"`
+	FirewallGroups []Object `json:"firewall_groups,omitempty"`
+	PortProfiles   []Object `json:"port_profiles,omitempty"`
+	WLANs          []Object `json:"wlans,omitempty"`
+	FirewallRules  []Object `json:"firewall_rules,omitempty"`
+	Devices        []Object `json:"devices,omitempty"`
+}
+
+// reference is a field holding the ID, or IDs, of other objects, which is written in a file as their name(s).
+type reference struct {
+	field string
+	name  string
+	kind  string
+	many  bool
+}
+
+// kind describes how the objects of a section are stored on the Controller.
+type kind struct {
+	name       string
+	collection string
+	// The field identifying an object within the section.
+	key string
+	// The only fields managed, or nil to manage all of them.
+	fields []string
+	// Devices can only be updated as they are adopted rather than created.
+	updateOnly bool
+	refs       []reference
+	// A field holding a list of objects with references of their own e.g. port_overrides.
+	nested     string
+	nestedRefs []reference
+}
+
+var kinds = []kind{
+	{name: UserGroups, collection: "usergroup", key: "name"},
+	{name: Networks, collection: "networkconf", key: "name"},
+	{name: FirewallGroups, collection: "firewallgroup", key: "name"},
+	{name: PortProfiles, collection: "portconf", key: "name", refs: []reference{
+		{field: "native_networkconf_id", name: "native_network", kind: Networks},
+		{field: "voice_networkconf_id", name: "voice_network", kind: Networks},
+		{field: "tagged_networkconf_ids", name: "tagged_networks", kind: Networks, many: true},
+	}},
+	{name: WLANs, collection: "wlanconf", key: "name", refs: []reference{
+		{field: "usergroup_id", name: "usergroup", kind: UserGroups},
+		{field: "networkconf_id", name: "network", kind: Networks},
+	}},
+	{name: FirewallRules, collection: "firewallrule", key: "name", refs: []reference{
+		{field: "src_firewallgroup_ids", name: "src_firewall_groups", kind: FirewallGroups, many: true},
+		{field: "dst_firewallgroup_ids", name: "dst_firewall_groups", kind: FirewallGroups, many: true},
+		{field: "src_networkconf_id", name: "src_network", kind: Networks},
+		{field: "dst_networkconf_id", name: "dst_network", kind: Networks},
+	}},
+	{name: Devices, collection: "device", key: "mac", fields: []string{"mac", "name", "port_overrides"},
+		updateOnly: true, nested: "port_overrides", nestedRefs: []reference{
+			{field: "portconf_id", name: "port_profile", kind: PortProfiles},
+		}},
+}
+
+// Fields the Controller maintains itself, which are never exported or compared.
+var ignoredFields = map[string]bool{
+	"_id":            true,
+	"site_id":        true,
+	"attr_hidden":    true,
+	"attr_hidden_id": true,
+	"attr_no_delete": true,
+	"attr_no_edit":   true,
+}
+
+func (c *Config) section(name string) *[]Object {
+	switch name {
+	case UserGroups:
+		return &c.UserGroups
+	case Networks:
+		return &c.Networks
+	case FirewallGroups:
+		return &c.FirewallGroups
+	case PortProfiles:
+		return &c.PortProfiles
+	case WLANs:
+		return &c.WLANs
+	case FirewallRules:
+		return &c.FirewallRules
+	case Devices:
+		return &c.Devices
+	}
+	return nil
+}
+
+var envRef = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// secretPrefix starts the fields the Controller holds secrets in e.g. x_passphrase, x_secret or x_iapp_key.
+const secretPrefix = "x_"
+
+var notVarChar = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// secretVar names the environment variable a secret of an object is exported as e.g. WLANS_OFFICE_PASSPHRASE for
+// the x_passphrase of the WLAN Office.
+func secretVar(section string, key interface{}, field string) string {
+	name := strings.ToUpper(fmt.Sprintf("%s_%v_%s", section, key, strings.TrimPrefix(field, secretPrefix)))
+	return strings.Trim(notVarChar.ReplaceAllString(name, "_"), "_")
+}
+
+// Load parses a configuration file. ${VAR} in a string value is replaced with the value of the environment
+// variable VAR, so secrets such as WLAN passphrases need not be committed alongside the rest of the file. The file
+// is parsed first, so the value is always a string, however it would read as YAML. A section given as an empty list
+// deletes every object of that section.
+func Load(data []byte) (*Config, error) {
+	var sections map[string]interface{}
+	if err := yaml2.Unmarshal(data, &sections); err != nil {
+		return nil, fmt.Errorf("config: %v", err)
+	}
+	var missing []string
+	for name, value := range sections {
+		sections[name] = expandEnv(value, &missing)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("config: the environment variables %v are not set", missing)
+	}
+
+	expanded, err := json.Marshal(sections)
+	if err != nil {
+		return nil, fmt.Errorf("config: %v", err)
+	}
+	c := new(Config)
+	if err := json.Unmarshal(expanded, c); err != nil {
+		return nil, fmt.Errorf("config: %v", err)
+	}
+	for name, value := range sections {
+		s := c.section(name)
+		if s == nil {
+			return nil, fmt.Errorf("config: unknown section %q", name)
+		}
+		if *s == nil && value != nil {
+			*s = []Object{}
+		}
+	}
+	return c, nil
+}
+
+// expandEnv replaces the ${VAR} references in the strings held by v, a value decoded from the file, adding the
+// names of the variables which are not set to missing.
+func expandEnv(v interface{}, missing *[]string) interface{} {
+	switch x := v.(type) {
+	case string:
+		return envRef.ReplaceAllStringFunc(x, func(ref string) string {
+			name := envRef.FindStringSubmatch(ref)[1]
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				*missing = append(*missing, name)
+			}
+			return value
+		})
+	case map[string]interface{}:
+		for k, e := range x {
+			x[k] = expandEnv(e, missing)
+		}
+	case []interface{}:
+		for i, e := range x {
+			x[i] = expandEnv(e, missing)
+		}
+	}
+	return v
+}
+
+// YAML returns the configuration as a YAML document.
+func (c *Config) YAML() ([]byte, error) {
+	return yaml2.Marshal(c)
+}
+
+// State is the configuration of a site as currently held by the Controller.
+type State struct {
+	objects map[string][]unified.RestObject
+}
+
+// Fetch reads the current configuration of the site from the Controller.
+func Fetch(ctx context.Context, rest unified.RestService) (*State, error) {
+	s := &State{objects: make(map[string][]unified.RestObject)}
+	for _, k := range kinds {
+		objs, _, err := rest.List(ctx, k.collection)
+		if err != nil {
+			return nil, fmt.Errorf("config: listing %s: %v", k.name, err)
+		}
+		for _, obj := range objs {
+			if hidden, _ := obj["attr_hidden"].(bool); hidden {
+				continue
+			}
+			if k.name == Devices {
+				if adopted, _ := obj["adopted"].(bool); !adopted {
+					continue
+				}
+			}
+			s.objects[k.name] = append(s.objects[k.name], obj)
+		}
+	}
+	return s, nil
+}
+
+// NewState returns a State holding the given objects of each section, as returned by the Controller.
+func NewState(objects map[string][]unified.RestObject) *State {
+	return &State{objects: objects}
+}
+
+// Export returns the current configuration in the form of a configuration file. Secrets such as WLAN passphrases
+// and RADIUS secrets are written as ${VAR} references to environment variables, named by secretVar, so the file can
+// be committed as it is, unless includeSecrets.
+func (s *State) Export(includeSecrets bool) *Config {
+	c := new(Config)
+	ids := s.ids()
+	for _, k := range kinds {
+		section := c.section(k.name)
+		for _, obj := range s.objects[k.name] {
+			out := k.export(obj, ids)
+			if !includeSecrets {
+				hideSecrets(k, out)
+			}
+			*section = append(*section, out)
+		}
+		sort.SliceStable(*section, func(i, j int) bool {
+			return fmt.Sprint((*section)[i][k.key]) < fmt.Sprint((*section)[j][k.key])
+		})
+	}
+	return c
+}
+
+// ids maps the ID of every object to its name, by section.
+func (s *State) ids() map[string]map[string]string {
+	ids := make(map[string]map[string]string)
+	for _, k := range kinds {
+		ids[k.name] = make(map[string]string)
+		for _, obj := range s.objects[k.name] {
+			ids[k.name][obj.ID()] = obj.Name()
+		}
+	}
+	return ids
+}
+
+// names maps the name of every object to its ID, by section.
+func (s *State) names() map[string]map[string]string {
+	names := make(map[string]map[string]string)
+	for _, k := range kinds {
+		names[k.name] = make(map[string]string)
+		for _, obj := range s.objects[k.name] {
+			names[k.name][obj.Name()] = obj.ID()
+		}
+	}
+	return names
+}
+
+func kindOf(name string) kind {
+	for _, k := range kinds {
+		if k.name == name {
+			return k
+		}
+	}
+	panic("config: unknown kind " + name)
+}
+
+// export converts an object as held by the Controller into its form in a configuration file.
+func (k kind) export(obj unified.RestObject, ids map[string]map[string]string) Object {
+	out := make(Object)
+	for field, value := range obj {
+		if ignoredFields[field] || (k.fields != nil && !contains(k.fields, field)) {
+			continue
+		}
+		out[field] = value
+	}
+	toNames(out, k.refs, ids)
+	if nested, ok := out[k.nested].([]interface{}); ok && k.nested != "" {
+		for _, n := range nested {
+			if m, ok := n.(map[string]interface{}); ok {
+				toNames(m, k.nestedRefs, ids)
+			}
+		}
+	}
+	return out
+}
+
+// hideSecrets replaces the secrets of an exported object with references to environment variables.
+func hideSecrets(k kind, obj Object) {
+	for field, value := range obj {
+		if v, ok := value.(string); ok && v != "" && strings.HasPrefix(field, secretPrefix) {
+			obj[field] = "${" + secretVar(k.name, obj[k.key], field) + "}"
+		}
+	}
+}
+
+// toNames replaces the IDs held by references with the names of the objects referred to. References to objects
+// which cannot be found, such as those outside the sections managed, are left as IDs.
+func toNames(obj map[string]interface{}, refs []reference, ids map[string]map[string]string) {
+	for _, ref := range refs {
+		value, ok := obj[ref.field]
+		if !ok {
+			continue
+		}
+		if !ref.many {
+			if name, found := ids[ref.kind][fmt.Sprint(value)]; found {
+				delete(obj, ref.field)
+				obj[ref.name] = name
+			}
+			continue
+		}
+		list, _ := value.([]interface{})
+		names := make([]interface{}, 0, len(list))
+		for _, id := range list {
+			name, found := ids[ref.kind][fmt.Sprint(id)]
+			if !found {
+				names = nil
+				break
+			}
+			names = append(names, name)
+		}
+		if names != nil {
+			delete(obj, ref.field)
+			obj[ref.name] = names
+		}
+	}
+}
+
+// toIDs replaces the names held by references with the IDs of the objects referred to, failing when one does
+// not exist.
+func toIDs(obj map[string]interface{}, refs []reference, names map[string]map[string]string) error {
+	for _, ref := range refs {
+		value, ok := obj[ref.name]
+		if !ok {
+			continue
+		}
+		lookup := func(name interface{}) (string, error) {
+			id, found := names[ref.kind][fmt.Sprint(name)]
+			if !found {
+				return "", fmt.Errorf("%s %q does not exist", ref.name, name)
+			}
+			return id, nil
+		}
+		delete(obj, ref.name)
+		if !ref.many {
+			id, err := lookup(value)
+			if err != nil {
+				return err
+			}
+			obj[ref.field] = id
+			continue
+		}
+		list, _ := value.([]interface{})
+		ids := make([]interface{}, 0, len(list))
+		for _, name := range list {
+			id, err := lookup(name)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		obj[ref.field] = ids
+	}
+	return nil
+}
+
+// prepare converts fields of an object in a configuration file into the form the Controller expects.
+func (k kind) prepare(obj Object, names map[string]map[string]string) (unified.RestObject, error) {
+	out := make(unified.RestObject)
+	for field, value := range copyValue(map[string]interface{}(obj)).(map[string]interface{}) {
+		out[field] = value
+	}
+	if err := toIDs(out, k.refs, names); err != nil {
+		return nil, err
+	}
+	if nested, ok := out[k.nested].([]interface{}); ok && k.nested != "" {
+		for _, n := range nested {
+			if m, ok := n.(map[string]interface{}); ok {
+				if err := toIDs(m, k.nestedRefs, names); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// copyValue returns a deep copy of a value decoded from JSON.
+func copyValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			m[k] = copyValue(e)
+		}
+		return m
+	case Object:
+		return copyValue(map[string]interface{}(x))
+	case []interface{}:
+		l := make([]interface{}, len(x))
+		for i, e := range x {
+			l[i] = copyValue(e)
+		}
+		return l
+	}
+	return v
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
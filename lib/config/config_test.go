@@ -0,0 +1,236 @@
+package config
+
+import (
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func testState() *State {
+	return NewState(map[string][]unified.RestObject{
+		UserGroups: {
+			{"_id": "g1", "name": "Default", "attr_no_delete": true, "qos_rate_max_down": -1.0},
+			{"_id": "g2", "name": "Slow", "qos_rate_max_down": 1000.0},
+		},
+		Networks: {
+			{"_id": "n1", "name": "LAN", "purpose": "corporate"},
+			{"_id": "n2", "name": "IoT", "purpose": "corporate", "vlan": "20"},
+		},
+		WLANs: {
+			{"_id": "w1", "name": "Office", "site_id": "s1", "usergroup_id": "g1", "networkconf_id": "n1",
+				"x_passphrase": "hunter22", "x_iapp_key": ""},
+		},
+		Devices: {
+			{"_id": "d1", "mac": "f0:9f:c2:00:00:01", "name": "Switch", "model": "US16P150", "port_overrides": []interface{}{
+				map[string]interface{}{"port_idx": 1.0, "portconf_id": "p1"},
+			}},
+		},
+		PortProfiles: {
+			{"_id": "p1", "name": "Trunk", "native_networkconf_id": "n1", "tagged_networkconf_ids": []interface{}{"n2"}},
+		},
+	})
+}
+
+func TestExport(t *testing.T) {
+	c := testState().Export(false)
+
+	want := []Object{{"name": "Office", "usergroup": "Default", "network": "LAN",
+		"x_passphrase": "${WLANS_OFFICE_PASSPHRASE}", "x_iapp_key": ""}}
+	if !reflect.DeepEqual(c.WLANs, want) {
+		t.Errorf("WLANs = %v, want %v", c.WLANs, want)
+	}
+	if secret := testState().Export(true).WLANs[0]["x_passphrase"]; secret != "hunter22" {
+		t.Errorf("x_passphrase with secrets included = %v, want hunter22", secret)
+	}
+	want = []Object{{"name": "Trunk", "native_network": "LAN", "tagged_networks": []interface{}{"IoT"}}}
+	if !reflect.DeepEqual(c.PortProfiles, want) {
+		t.Errorf("PortProfiles = %v, want %v", c.PortProfiles, want)
+	}
+	want = []Object{{"mac": "f0:9f:c2:00:00:01", "name": "Switch", "port_overrides": []interface{}{
+		map[string]interface{}{"port_idx": 1.0, "port_profile": "Trunk"},
+	}}}
+	if !reflect.DeepEqual(c.Devices, want) {
+		t.Errorf("Devices = %v, want %v", c.Devices, want)
+	}
+	if c.UserGroups[0]["name"] != "Default" || c.UserGroups[1]["name"] != "Slow" {
+		t.Errorf("UserGroups are not sorted by name: %v", c.UserGroups)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	if _, err := Load([]byte("wlanz: []")); err == nil {
+		t.Error("Load accepted an unknown section")
+	}
+	if _, err := Load([]byte("wlans:\n- name: Office\n  x_passphrase: ${UNIFIED_TEST_UNSET}")); err == nil {
+		t.Error("Load accepted an unset environment variable")
+	}
+
+	c, err := Load([]byte("networks: []\nwlans:\n- name: Office"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Networks == nil || len(c.Networks) != 0 {
+		t.Errorf("Networks = %#v, want an empty section", c.Networks)
+	}
+	if c.UserGroups != nil {
+		t.Errorf("UserGroups = %#v, want a missing section", c.UserGroups)
+	}
+}
+
+func TestLoadSecrets(t *testing.T) {
+	secrets := []string{"12345678", "yes", "pass #word", "a: b", "[not, a, list]", "0x1F", `"quoted"`}
+	for _, secret := range secrets {
+		os.Setenv("UNIFIED_TEST_PSK", secret)
+		c, err := Load([]byte("wlans:\n- name: Office\n  x_passphrase: ${UNIFIED_TEST_PSK}\n" +
+			"  x_iapp_key: \"key-${UNIFIED_TEST_PSK}\"\n  vlan: 20"))
+		if err != nil {
+			t.Errorf("Load() with the secret %q: %v", secret, err)
+			continue
+		}
+		wlan := c.WLANs[0]
+		if wlan["x_passphrase"] != secret || wlan["x_iapp_key"] != "key-"+secret || wlan["vlan"] != 20.0 {
+			t.Errorf("Load() with the secret %q = %#v, want it as a string", secret, wlan)
+		}
+	}
+	os.Unsetenv("UNIFIED_TEST_PSK")
+}
+
+func TestNewPlan(t *testing.T) {
+	desired, err := Load([]byte(`
+user_groups:
+- name: Default
+networks:
+- name: LAN
+  purpose: corporate
+- name: Guest
+  purpose: guest
+wlans:
+- name: Office
+  usergroup: Default
+  network: LAN
+- name: Guest
+  network: Guest
+devices:
+- mac: F0-9F-C2-00-00-01
+  name: Core Switch
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := NewPlan(desired, testState())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, c := range plan.Changes {
+		got = append(got, c.String())
+	}
+	want := []string{
+		`create networks "Guest"`,
+		`create wlans "Guest"`,
+		`update devices "f0:9f:c2:00:00:01"`,
+		`delete networks "IoT"`,
+		`delete user_groups "Slow"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changes = %q, want %q", got, want)
+	}
+	if got := plan.Summary(); got != "Plan: 2 to create, 1 to update, 2 to delete." {
+		t.Errorf("Summary() = %q", got)
+	}
+
+	if _, err := NewPlan(&Config{Devices: []Object{{"mac": "00:11:22:33:44:55"}}}, testState()); err == nil {
+		t.Error("NewPlan planned to create a device")
+	}
+	if _, err := NewPlan(&Config{WLANs: []Object{{"name": "A"}, {"name": "A"}}}, testState()); err == nil {
+		t.Error("NewPlan accepted a WLAN given twice")
+	}
+
+	state := testState()
+	state.objects[WLANs] = append(state.objects[WLANs], unified.RestObject{"_id": "w2", "name": "Office"})
+	if _, err := NewPlan(&Config{WLANs: []Object{{"name": "Office"}}}, state); err == nil {
+		t.Error("NewPlan accepted a Controller with two WLANs of the same name")
+	}
+}
+
+type fakeRest struct {
+	calls []string
+	fail  string
+}
+
+func (f *fakeRest) List(ctx context.Context, collection string) ([]unified.RestObject, *unified.Response, error) {
+	return nil, nil, nil
+}
+
+func (f *fakeRest) Create(
+	ctx context.Context,
+	collection string,
+	obj unified.RestObject) (unified.RestObject, *unified.Response, error) {
+
+	return f.call("POST", collection, "", obj)
+}
+
+func (f *fakeRest) Update(
+	ctx context.Context,
+	collection string,
+	id string,
+	obj unified.RestObject) (unified.RestObject, *unified.Response, error) {
+
+	return f.call("PUT", collection, id, obj)
+}
+
+func (f *fakeRest) Delete(ctx context.Context, collection string, id string) (*unified.Response, error) {
+	_, resp, err := f.call("DELETE", collection, id, nil)
+	return resp, err
+}
+
+func (f *fakeRest) call(method, collection, id string, obj unified.RestObject) (unified.RestObject, *unified.Response, error) {
+	call := fmt.Sprintf("%s %s/%s %v", method, collection, id, map[string]interface{}(obj))
+	if collection == f.fail {
+		return nil, nil, fmt.Errorf("api.err.Invalid")
+	}
+	f.calls = append(f.calls, call)
+	return unified.RestObject{"_id": "new-" + collection}, nil, nil
+}
+
+func TestApply(t *testing.T) {
+	desired, err := Load([]byte(`
+networks:
+- name: LAN
+- name: IoT
+- name: Guest
+wlans:
+- name: Office
+  network: Guest
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := NewPlan(desired, testState())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rest := &fakeRest{}
+	applied, err := plan.Apply(context.Background(), rest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"POST networkconf/ map[name:Guest]",
+		"PUT wlanconf/w1 map[networkconf_id:new-networkconf]",
+	}
+	if !reflect.DeepEqual(rest.calls, want) || len(applied) != 2 {
+		t.Errorf("calls = %q, want %q", rest.calls, want)
+	}
+
+	rest = &fakeRest{fail: "wlanconf"}
+	applied, err = plan.Apply(context.Background(), rest, nil)
+	if err == nil || len(applied) != 1 {
+		t.Errorf("Apply() = %d applied, %v; want 1 applied and an error", len(applied), err)
+	}
+}
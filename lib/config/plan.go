@@ -0,0 +1,254 @@
+package config
+
+import (
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// The actions of a Change.
+const (
+	Create = "create"
+	Update = "update"
+	Delete = "delete"
+)
+
+// Change is a single change needed to bring the Controller in line with a configuration file.
+type Change struct {
+	Action string
+	Kind   string
+	Name   string
+	Fields []FieldChange
+
+	id      string
+	desired Object
+}
+
+// FieldChange is the old and new value of a field changed by an update, or the value of a field set by a create.
+type FieldChange struct {
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s %s %q", c.Action, c.Kind, c.Name)
+}
+
+func (f FieldChange) String() string {
+	if f.Old == nil {
+		return fmt.Sprintf("%s: %s", f.Field, formatValue(f.New))
+	}
+	return fmt.Sprintf("%s: %s => %s", f.Field, formatValue(f.Old), formatValue(f.New))
+}
+
+func formatValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// Plan is the set of changes needed to bring the Controller in line with a configuration file, in the order they
+// are to be made.
+type Plan struct {
+	Changes []Change
+
+	state *State
+}
+
+// Count returns the number of changes of each action.
+func (p *Plan) Count() (creates, updates, deletes int) {
+	for _, c := range p.Changes {
+		switch c.Action {
+		case Create:
+			creates++
+		case Update:
+			updates++
+		case Delete:
+			deletes++
+		}
+	}
+	return
+}
+
+// Summary describes the number of changes of each action e.g. "Plan: 1 to create, 2 to update, 0 to delete."
+func (p *Plan) Summary() string {
+	creates, updates, deletes := p.Count()
+	return fmt.Sprintf("Plan: %d to create, %d to update, %d to delete.", creates, updates, deletes)
+}
+
+// NewPlan compares the desired configuration with the current state of the Controller and returns the changes
+// needed to make them match. Only the fields given for an object are compared, so any left out keep their current
+// values. Objects of a section given in the file but missing from it are deleted, unless the Controller does not
+// allow them to be e.g. the Default user group.
+func NewPlan(desired *Config, state *State) (*Plan, error) {
+	plan := &Plan{state: state}
+	ids := state.ids()
+	var deletes []Change
+
+	for _, k := range kinds {
+		wanted := *desired.section(k.name)
+		if wanted == nil {
+			continue
+		}
+
+		current := make(map[string]unified.RestObject)
+		for _, obj := range state.objects[k.name] {
+			key := fmt.Sprint(obj[k.key])
+			if _, ok := current[key]; ok {
+				return nil, fmt.Errorf("config: the Controller has more than one of the %s named %q, rename them "+
+					"so they can be told apart", k.name, key)
+			}
+			current[key] = obj
+		}
+
+		seen := make(map[string]bool)
+		for _, obj := range wanted {
+			key, _ := obj[k.key].(string)
+			if key == "" {
+				return nil, fmt.Errorf("config: every one of the %s must have a %s", k.name, k.key)
+			}
+			if k.key == "mac" {
+				mac, err := unified.NormalizeMac(key)
+				if err != nil {
+					return nil, fmt.Errorf("config: %s: %v", k.name, err)
+				}
+				obj = copyValue(obj).(map[string]interface{})
+				obj[k.key], key = mac, mac
+			}
+			if seen[key] {
+				return nil, fmt.Errorf("config: %s %q is given more than once", k.name, key)
+			}
+			seen[key] = true
+
+			existing, ok := current[key]
+			if !ok {
+				if k.updateOnly {
+					return nil, fmt.Errorf("config: %s %q does not exist and cannot be created", k.name, key)
+				}
+				change := Change{Action: Create, Kind: k.name, Name: key, desired: obj}
+				for _, field := range sortedKeys(obj) {
+					if field != k.key {
+						change.Fields = append(change.Fields, FieldChange{Field: field, New: obj[field]})
+					}
+				}
+				plan.Changes = append(plan.Changes, change)
+				continue
+			}
+
+			exported := k.export(existing, ids)
+			change := Change{Action: Update, Kind: k.name, Name: key, id: existing.ID(), desired: make(Object)}
+			for _, field := range sortedKeys(obj) {
+				if field == k.key || equal(obj[field], exported[field]) {
+					continue
+				}
+				change.Fields = append(change.Fields, FieldChange{Field: field, Old: exported[field], New: obj[field]})
+				change.desired[field] = obj[field]
+			}
+			if len(change.Fields) > 0 {
+				plan.Changes = append(plan.Changes, change)
+			}
+		}
+
+		if k.updateOnly {
+			continue
+		}
+		var removed []Change
+		for key, obj := range current {
+			if noDelete, _ := obj["attr_no_delete"].(bool); seen[key] || noDelete {
+				continue
+			}
+			removed = append(removed, Change{Action: Delete, Kind: k.name, Name: key, id: obj.ID()})
+		}
+		sort.Slice(removed, func(i, j int) bool { return removed[i].Name < removed[j].Name })
+		deletes = append(removed, deletes...)
+	}
+
+	plan.Changes = append(plan.Changes, deletes...)
+	return plan, nil
+}
+
+// Apply makes the changes of the plan in order, stopping at the first which fails. progress, if not nil, is called
+// before each change is made. The changes which were made are returned along with any error.
+func (p *Plan) Apply(ctx context.Context, rest unified.RestService, progress func(Change)) ([]Change, error) {
+	names := p.state.names()
+	var applied []Change
+	for _, c := range p.Changes {
+		if progress != nil {
+			progress(c)
+		}
+		k := kindOf(c.Kind)
+		var err error
+		switch c.Action {
+		case Create, Update:
+			var obj unified.RestObject
+			if obj, err = k.prepare(c.desired, names); err != nil {
+				return applied, fmt.Errorf("config: %s: %v", c, err)
+			}
+			if c.Action == Create {
+				var created unified.RestObject
+				if created, _, err = rest.Create(ctx, k.collection, obj); err == nil {
+					names[k.name][c.Name] = created.ID()
+				}
+			} else {
+				_, _, err = rest.Update(ctx, k.collection, c.id, obj)
+			}
+		case Delete:
+			_, err = rest.Delete(ctx, k.collection, c.id)
+		}
+		if err != nil {
+			return applied, fmt.Errorf("config: %s: %v", c, err)
+		}
+		applied = append(applied, c)
+	}
+	return applied, nil
+}
+
+// equal compares two values decoded from JSON or YAML, treating a missing value as equal to an empty one.
+func equal(a, b interface{}) bool {
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+func normalize(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.NewDecoder(bytes.NewReader(b)).Decode(&out); err != nil {
+		return v
+	}
+	switch x := out.(type) {
+	case string:
+		if x == "" {
+			return nil
+		}
+	case []interface{}:
+		if len(x) == 0 {
+			return nil
+		}
+	case map[string]interface{}:
+		if len(x) == 0 {
+			return nil
+		}
+	}
+	return out
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
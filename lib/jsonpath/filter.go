@@ -0,0 +1,214 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The comparison operators, longest first so <= is not mistaken for <.
+var operators = []string{"==", "!=", "<=", ">=", "=~", "<", ">"}
+
+// filter is a parsed [?(...)] expression, any one of whose clauses must match. Every comparison within a
+// clause must match for the clause to.
+type filter struct {
+	clauses [][]comparison
+}
+
+// comparison compares two operands, or tests for the left one being present and neither false nor null when op
+// is empty.
+type comparison struct {
+	left  operand
+	op    string
+	right operand
+	re    *regexp.Regexp
+}
+
+// operand is either a path relative to the element being filtered (or the root) or a literal value.
+type operand struct {
+	path    *path
+	literal interface{}
+}
+
+func parseFilter(expr string) (*filter, error) {
+	f := &filter{}
+	for _, or := range split(expr, "||") {
+		var clause []comparison
+		for _, and := range split(or, "&&") {
+			c, err := parseComparison(strings.TrimSpace(and))
+			if err != nil {
+				return nil, err
+			}
+			clause = append(clause, c)
+		}
+		f.clauses = append(f.clauses, clause)
+	}
+	return f, nil
+}
+
+func parseComparison(expr string) (comparison, error) {
+	for _, op := range operators {
+		parts := split(expr, op)
+		if len(parts) == 1 {
+			continue
+		}
+		if len(parts) != 2 {
+			return comparison{}, fmt.Errorf("jsonpath: invalid filter %q", expr)
+		}
+		left, err := parseOperand(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return comparison{}, err
+		}
+		right, err := parseOperand(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return comparison{}, err
+		}
+		c := comparison{left: left, op: op, right: right}
+		if op == "=~" {
+			pattern, ok := right.literal.(string)
+			if !ok {
+				return comparison{}, fmt.Errorf("jsonpath: =~ requires a quoted regular expression in %q", expr)
+			}
+			if c.re, err = regexp.Compile(pattern); err != nil {
+				return comparison{}, fmt.Errorf("jsonpath: invalid regular expression in %q: %v", expr, err)
+			}
+		}
+		return c, nil
+	}
+
+	left, err := parseOperand(expr)
+	if err != nil {
+		return comparison{}, err
+	}
+	if left.path == nil {
+		return comparison{}, fmt.Errorf("jsonpath: invalid filter %q", expr)
+	}
+	return comparison{left: left}, nil
+}
+
+func parseOperand(expr string) (operand, error) {
+	switch {
+	case expr == "":
+		return operand{}, fmt.Errorf("jsonpath: missing operand in filter")
+	case expr[0] == '@' || expr[0] == '$':
+		p, err := parsePath(expr)
+		return operand{path: p}, err
+	case expr[0] == '"' || expr[0] == '\'':
+		s, err := unquote(expr)
+		return operand{literal: s}, err
+	case expr == "true" || expr == "false":
+		return operand{literal: expr == "true"}, nil
+	case expr == "null":
+		return operand{}, nil
+	}
+	if _, err := strconv.ParseFloat(expr, 64); err != nil {
+		return operand{}, fmt.Errorf("jsonpath: invalid operand %q in filter", expr)
+	}
+	return operand{literal: json.Number(expr)}, nil
+}
+
+func (f *filter) match(root, v interface{}) (bool, error) {
+	for _, clause := range f.clauses {
+		all := true
+		for _, c := range clause {
+			ok, err := c.match(root, v)
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				all = false
+				break
+			}
+		}
+		if all {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c comparison) match(root, v interface{}) (bool, error) {
+	left, found, err := c.left.value(root, v)
+	if err != nil || c.op == "" {
+		return found && left != nil && left != false, err
+	}
+	right, rightFound, err := c.right.value(root, v)
+	if err != nil {
+		return false, err
+	}
+	if !found || !rightFound {
+		return c.op == "!=" && found != rightFound, nil
+	}
+
+	switch c.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "=~":
+		s, ok := left.(string)
+		return ok && c.re.MatchString(s), nil
+	}
+
+	if l, r, ok := numbers(left, right); ok {
+		switch c.op {
+		case "<":
+			return l < r, nil
+		case "<=":
+			return l <= r, nil
+		case ">":
+			return l > r, nil
+		case ">=":
+			return l >= r, nil
+		}
+	}
+	l, lok := left.(string)
+	r, rok := right.(string)
+	if !lok || !rok {
+		return false, nil
+	}
+	switch c.op {
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	case ">=":
+		return l >= r, nil
+	}
+	return false, nil
+}
+
+// value returns the value of the operand for the element v, and whether it was found.
+func (o operand) value(root, v interface{}) (interface{}, bool, error) {
+	if o.path == nil {
+		return o.literal, true, nil
+	}
+	values, err := o.path.eval(root, v)
+	if err != nil || len(values) == 0 {
+		return nil, false, err
+	}
+	return values[0], true, nil
+}
+
+func equal(a, b interface{}) bool {
+	if l, r, ok := numbers(a, b); ok {
+		return l == r
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func numbers(a, b interface{}) (float64, float64, bool) {
+	l, lok := a.(json.Number)
+	r, rok := b.(json.Number)
+	if !lok || !rok {
+		return 0, 0, false
+	}
+	lf, lerr := l.Float64()
+	rf, rerr := r.Float64()
+	return lf, rf, lerr == nil && rerr == nil
+}
@@ -0,0 +1,583 @@
+// Package jsonpath extracts fields from JSON documents using the JSONPath template syntax popularised by kubectl
+// e.g. '{.port_table[?(@.up==false)].name}' or '{range [*]}{.name}{"\t"}{.ip}{"\n"}{end}'.
+//
+// A template is literal text mixed with expressions in braces. An expression is a path, a quoted string literal,
+// or range PATH ... end to repeat the enclosed template for every value the path matches. Paths are evaluated
+// against the current value, or the document root when they start with $, and support
+//
+//	.name or ['name']   a field of an object
+//	..name              a field at any depth
+//	.* or [*]           every element of an array or value of an object
+//	[n]                 an array element, counting from the end when negative
+//	[start:end:step]    a slice of an array
+//	[a,b]               a union of fields or elements
+//	[?(@.up==false)]    the elements matching a filter
+//
+// Filters compare paths and literals with ==, !=, <, <=, >, >= or =~ (a regular expression), combine them with
+// && and ||, and test for a field being present and neither false nor null with a lone path e.g. [?(@.poe_enable)].
+// Fields which are missing match nothing rather than being an error.
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Template is a parsed JSONPath template.
+type Template struct {
+	nodes []node
+}
+
+type node interface{}
+
+type textNode string
+
+type pathNode struct {
+	path *path
+}
+
+type rangeNode struct {
+	path  *path
+	nodes []node
+}
+
+// Parse parses a JSONPath template. A template without any braces is taken to be a single expression, so
+// ".name" is the same as "{.name}".
+func Parse(text string) (*Template, error) {
+	if !strings.Contains(text, "{") {
+		text = "{" + text + "}"
+	}
+
+	root := &rangeNode{}
+	stack := []*rangeNode{root}
+	for len(text) > 0 {
+		open := strings.Index(text, "{")
+		if open < 0 {
+			stack[len(stack)-1].nodes = append(stack[len(stack)-1].nodes, textNode(text))
+			break
+		}
+		if open > 0 {
+			stack[len(stack)-1].nodes = append(stack[len(stack)-1].nodes, textNode(text[:open]))
+		}
+		end, err := closing(text, open, '{', '}')
+		if err != nil {
+			return nil, err
+		}
+		expr := strings.TrimSpace(text[open+1 : end])
+		text = text[end+1:]
+
+		current := stack[len(stack)-1]
+		switch {
+		case expr == "end":
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("jsonpath: {end} without a matching {range}")
+			}
+			stack = stack[:len(stack)-1]
+		case strings.HasPrefix(expr, "range "):
+			p, err := parsePath(strings.TrimSpace(expr[len("range "):]))
+			if err != nil {
+				return nil, err
+			}
+			r := &rangeNode{path: p}
+			current.nodes = append(current.nodes, r)
+			stack = append(stack, r)
+		case strings.HasPrefix(expr, `"`) || strings.HasPrefix(expr, "'"):
+			s, err := unquote(expr)
+			if err != nil {
+				return nil, err
+			}
+			current.nodes = append(current.nodes, textNode(s))
+		default:
+			p, err := parsePath(expr)
+			if err != nil {
+				return nil, err
+			}
+			current.nodes = append(current.nodes, &pathNode{path: p})
+		}
+	}
+	if len(stack) > 1 {
+		return nil, fmt.Errorf("jsonpath: {range} without a matching {end}")
+	}
+	return &Template{nodes: root.nodes}, nil
+}
+
+// Execute writes the template applied to data to w. data is anything encoding/json can marshal.
+func (t *Template) Execute(w io.Writer, data interface{}) error {
+	doc, err := Normalize(data)
+	if err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	if err := execute(buf, t.nodes, doc, doc); err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// Find returns every value the path expression matches in data e.g. Find(device, ".port_table[*].name").
+func Find(data interface{}, expr string) ([]interface{}, error) {
+	p, err := parsePath(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(expr), "{"), "}"))
+	if err != nil {
+		return nil, err
+	}
+	doc, err := Normalize(data)
+	if err != nil {
+		return nil, err
+	}
+	return p.eval(doc, doc)
+}
+
+// Normalize converts data into the generic form produced by decoding JSON i.e. map[string]interface{},
+// []interface{}, string, json.Number, bool and nil, so its fields can be looked up by their JSON names.
+func Normalize(data interface{}) (interface{}, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func execute(buf *bytes.Buffer, nodes []node, root, current interface{}) error {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case textNode:
+			buf.WriteString(string(n))
+		case *pathNode:
+			values, err := n.path.eval(root, current)
+			if err != nil {
+				return err
+			}
+			for i, v := range values {
+				if i > 0 {
+					buf.WriteByte(' ')
+				}
+				s, err := String(v)
+				if err != nil {
+					return err
+				}
+				buf.WriteString(s)
+			}
+		case *rangeNode:
+			values, err := n.path.eval(root, current)
+			if err != nil {
+				return err
+			}
+			for _, v := range values {
+				if err := execute(buf, n.nodes, root, v); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// String formats a value found by a path for display. Strings are printed without quotes, null as an empty
+// string, and objects and arrays as compact JSON.
+func String(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return x, nil
+	case json.Number:
+		return x.String(), nil
+	case bool:
+		return strconv.FormatBool(x), nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+type segmentKind int
+
+const (
+	fieldSegment segmentKind = iota
+	recursiveSegment
+	wildcardSegment
+	indexSegment
+	sliceSegment
+	unionSegment
+	filterSegment
+)
+
+type segment struct {
+	kind   segmentKind
+	name   string
+	index  int
+	slice  [3]*int
+	union  []segment
+	filter *filter
+}
+
+// path is a parsed path expression such as $.port_table[0].name.
+type path struct {
+	root     bool
+	segments []segment
+}
+
+func parsePath(expr string) (*path, error) {
+	p := &path{}
+	s := expr
+	switch {
+	case strings.HasPrefix(s, "$"):
+		p.root = true
+		s = s[1:]
+	case strings.HasPrefix(s, "@"):
+		s = s[1:]
+	}
+
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			if strings.HasPrefix(s, "..") {
+				p.segments = append(p.segments, segment{kind: recursiveSegment})
+				s = s[2:]
+				if len(s) > 0 && s[0] == '[' {
+					continue
+				}
+			} else {
+				s = s[1:]
+			}
+			if strings.HasPrefix(s, "*") {
+				p.segments = append(p.segments, segment{kind: wildcardSegment})
+				s = s[1:]
+				continue
+			}
+			n := 0
+			for n < len(s) && s[n] != '.' && s[n] != '[' {
+				n++
+			}
+			if n > 0 {
+				p.segments = append(p.segments, segment{kind: fieldSegment, name: s[:n]})
+			}
+			s = s[n:]
+		case '[':
+			end, err := closing(s, 0, '[', ']')
+			if err != nil {
+				return nil, err
+			}
+			seg, err := parseBracket(strings.TrimSpace(s[1:end]))
+			if err != nil {
+				return nil, err
+			}
+			p.segments = append(p.segments, seg)
+			s = s[end+1:]
+		default:
+			return nil, fmt.Errorf("jsonpath: unexpected %q in %q", s, expr)
+		}
+	}
+	return p, nil
+}
+
+func parseBracket(expr string) (segment, error) {
+	switch {
+	case expr == "*":
+		return segment{kind: wildcardSegment}, nil
+	case strings.HasPrefix(expr, "?(") && strings.HasSuffix(expr, ")"):
+		f, err := parseFilter(expr[2 : len(expr)-1])
+		if err != nil {
+			return segment{}, err
+		}
+		return segment{kind: filterSegment, filter: f}, nil
+	}
+
+	if parts := split(expr, ","); len(parts) > 1 {
+		seg := segment{kind: unionSegment}
+		for _, part := range parts {
+			s, err := parseBracket(strings.TrimSpace(part))
+			if err != nil {
+				return segment{}, err
+			}
+			seg.union = append(seg.union, s)
+		}
+		return seg, nil
+	}
+
+	if strings.HasPrefix(expr, `"`) || strings.HasPrefix(expr, "'") {
+		name, err := unquote(expr)
+		if err != nil {
+			return segment{}, err
+		}
+		return segment{kind: fieldSegment, name: name}, nil
+	}
+
+	if strings.Contains(expr, ":") {
+		parts := strings.Split(expr, ":")
+		if len(parts) > 3 {
+			return segment{}, fmt.Errorf("jsonpath: invalid slice [%s]", expr)
+		}
+		seg := segment{kind: sliceSegment}
+		for i, part := range parts {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return segment{}, fmt.Errorf("jsonpath: invalid slice [%s]", expr)
+			}
+			seg.slice[i] = &n
+		}
+		return seg, nil
+	}
+
+	n, err := strconv.Atoi(expr)
+	if err != nil {
+		return segment{}, fmt.Errorf("jsonpath: invalid subscript [%s]", expr)
+	}
+	return segment{kind: indexSegment, index: n}, nil
+}
+
+func (p *path) eval(root, current interface{}) ([]interface{}, error) {
+	values := []interface{}{current}
+	if p.root {
+		values = []interface{}{root}
+	}
+	for _, seg := range p.segments {
+		var next []interface{}
+		for _, v := range values {
+			matched, err := seg.apply(root, v)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, matched...)
+		}
+		values = next
+	}
+	return values, nil
+}
+
+func (s segment) apply(root, v interface{}) ([]interface{}, error) {
+	switch s.kind {
+	case fieldSegment:
+		if m, ok := v.(map[string]interface{}); ok {
+			if f, ok := m[s.name]; ok {
+				return []interface{}{f}, nil
+			}
+		}
+		return nil, nil
+	case recursiveSegment:
+		return descendants(v, nil), nil
+	case wildcardSegment:
+		return children(v), nil
+	case indexSegment:
+		a, ok := v.([]interface{})
+		if !ok {
+			return nil, nil
+		}
+		i := s.index
+		if i < 0 {
+			i += len(a)
+		}
+		if i < 0 || i >= len(a) {
+			return nil, nil
+		}
+		return []interface{}{a[i]}, nil
+	case sliceSegment:
+		a, ok := v.([]interface{})
+		if !ok {
+			return nil, nil
+		}
+		return slice(a, s.slice), nil
+	case unionSegment:
+		var matched []interface{}
+		for _, u := range s.union {
+			m, err := u.apply(root, v)
+			if err != nil {
+				return nil, err
+			}
+			matched = append(matched, m...)
+		}
+		return matched, nil
+	case filterSegment:
+		var matched []interface{}
+		for _, c := range children(v) {
+			ok, err := s.filter.match(root, c)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				matched = append(matched, c)
+			}
+		}
+		return matched, nil
+	}
+	return nil, nil
+}
+
+// children returns the elements of an array or the values of an object ordered by key.
+func children(v interface{}) []interface{} {
+	switch x := v.(type) {
+	case []interface{}:
+		return x
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		values := make([]interface{}, len(keys))
+		for i, k := range keys {
+			values[i] = x[k]
+		}
+		return values
+	}
+	return nil
+}
+
+// descendants returns v followed by everything nested within it, depth first.
+func descendants(v interface{}, values []interface{}) []interface{} {
+	values = append(values, v)
+	for _, c := range children(v) {
+		values = descendants(c, values)
+	}
+	return values
+}
+
+func slice(a []interface{}, bounds [3]*int) []interface{} {
+	step := 1
+	if bounds[2] != nil {
+		step = *bounds[2]
+	}
+	if step == 0 {
+		return nil
+	}
+	clamp := func(i int) int {
+		if i < 0 {
+			i += len(a)
+		}
+		if i < 0 {
+			return 0
+		}
+		if i > len(a) {
+			return len(a)
+		}
+		return i
+	}
+
+	var values []interface{}
+	if step > 0 {
+		start, end := 0, len(a)
+		if bounds[0] != nil {
+			start = clamp(*bounds[0])
+		}
+		if bounds[1] != nil {
+			end = clamp(*bounds[1])
+		}
+		for i := start; i < end; i += step {
+			values = append(values, a[i])
+		}
+		return values
+	}
+
+	// Walking backwards, bounds before the start of the array clamp to -1 rather than 0, so the first element is
+	// still included, and those past its end to the last element.
+	clampBack := func(i int) int {
+		if i < 0 {
+			i += len(a)
+		}
+		if i < 0 {
+			return -1
+		}
+		if i >= len(a) {
+			return len(a) - 1
+		}
+		return i
+	}
+	start, end := len(a)-1, -1
+	if bounds[0] != nil {
+		start = clampBack(*bounds[0])
+	}
+	if bounds[1] != nil {
+		end = clampBack(*bounds[1])
+	}
+	for i := start; i > end; i += step {
+		values = append(values, a[i])
+	}
+	return values
+}
+
+// closing returns the index of the bracket closing the one at s[open], skipping over quoted strings and
+// nested brackets.
+func closing(s string, open int, left, right byte) (int, error) {
+	depth := 0
+	var quote byte
+	for i := open; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == left:
+			depth++
+		case c == right:
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("jsonpath: unclosed %q in %q", left, s[open:])
+}
+
+// split splits s around sep wherever it is outside quotes and brackets.
+func split(s, sep string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case depth == 0 && strings.HasPrefix(s[i:], sep):
+			parts = append(parts, s[start:i])
+			start = i + len(sep)
+			i += len(sep) - 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquote removes the single or double quotes around s, interpreting escapes such as \n and \t.
+func unquote(s string) (string, error) {
+	if len(s) < 2 || s[len(s)-1] != s[0] {
+		return "", fmt.Errorf("jsonpath: unterminated string %s", s)
+	}
+	if s[0] == '\'' {
+		s = `"` + strings.Replace(strings.Replace(s[1:len(s)-1], `\'`, `'`, -1), `"`, `\"`, -1) + `"`
+	}
+	unquoted, err := strconv.Unquote(s)
+	if err != nil {
+		return "", fmt.Errorf("jsonpath: invalid string %s", s)
+	}
+	return unquoted, nil
+}
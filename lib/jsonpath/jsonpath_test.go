@@ -0,0 +1,101 @@
+package jsonpath
+
+import (
+	"bytes"
+	"testing"
+)
+
+type port struct {
+	Idx   int    `json:"port_idx"`
+	Name  string `json:"name"`
+	IsUp  bool   `json:"up"`
+	Speed int    `json:"speed"`
+}
+
+type device struct {
+	Name      string `json:"name"`
+	IP        string `json:"ip"`
+	RXBytes   int64  `json:"rx_bytes"`
+	PortTable []port `json:"port_table"`
+}
+
+var sw = device{
+	Name:    "UniFi Switch 8 POE-150W",
+	IP:      "192.168.1.4",
+	RXBytes: 112046410012,
+	PortTable: []port{
+		{Idx: 1, Name: "Port 1", IsUp: true, Speed: 1000},
+		{Idx: 2, Name: "Port 2", IsUp: false},
+		{Idx: 3, Name: "Port 3", IsUp: true, Speed: 100},
+		{Idx: 4, Name: "Port 4", IsUp: false},
+	},
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{`{.name}`, "UniFi Switch 8 POE-150W"},
+		{`.ip`, "192.168.1.4"},
+		{`{.rx_bytes}`, "112046410012"},
+		{`{.port_table[?(@.up==false)].name}`, "Port 2 Port 4"},
+		{`{.port_table[?(@.up && @.speed<1000)].port_idx}`, "3"},
+		{`{.port_table[?(@.speed>=1000 || @.port_idx==4)].port_idx}`, "1 4"},
+		{`{.port_table[?(@.name=~'[34]$')].port_idx}`, "3 4"},
+		{`{.port_table[-1].name}`, "Port 4"},
+		{`{.port_table[1:3].port_idx}`, "2 3"},
+		{`{.port_table[::-2].port_idx}`, "4 2"},
+		{`{.port_table[:-9:-1].port_idx}`, "4 3 2 1"},
+		{`{.port_table[9:1:-1].port_idx}`, "4 3"},
+		{`{.port_table[-9::-1].port_idx}`, ""},
+		{`{.port_table[0,2].speed}`, "1000 100"},
+		{`{.port_table[0]['name','up']}`, "Port 1 true"},
+		{`{..speed}`, "1000 0 100 0"},
+		{`{.port_table[0]}`, `{"name":"Port 1","port_idx":1,"speed":1000,"up":true}`},
+		{`{.serial}`, ""},
+		{`{range .port_table[*]}{.port_idx}{"\t"}{.up}{"\n"}{end}`, "1\ttrue\n2\tfalse\n3\ttrue\n4\tfalse\n"},
+		{`{range .port_table[:2]}{$.name}/{.name} {end}`, "UniFi Switch 8 POE-150W/Port 1 UniFi Switch 8 POE-150W/Port 2 "},
+	}
+
+	for _, test := range tests {
+		tmpl, err := Parse(test.template)
+		if err != nil {
+			t.Errorf("Parse(%s) returned error: %v", test.template, err)
+			continue
+		}
+		buf := new(bytes.Buffer)
+		if err := tmpl.Execute(buf, sw); err != nil {
+			t.Errorf("Execute(%s) returned error: %v", test.template, err)
+			continue
+		}
+		if buf.String() != test.want {
+			t.Errorf("Execute(%s) = %q, want %q", test.template, buf.String(), test.want)
+		}
+	}
+}
+
+func TestFindOnSlice(t *testing.T) {
+	values, err := Find([]device{sw, {Name: "Manse Landing"}}, "[*].name")
+	if err != nil {
+		t.Fatalf("Find returned error: %v", err)
+	}
+	if len(values) != 2 || values[1] != "Manse Landing" {
+		t.Errorf("Find = %v", values)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, template := range []string{
+		`{.name`,
+		`{range .port_table[*]}{.name}`,
+		`{end}`,
+		`{.port_table[x]}`,
+		`{.port_table[?(@.speed > fast)]}`,
+		`{.port_table[?(@.name =~ 1)]}`,
+	} {
+		if _, err := Parse(template); err == nil {
+			t.Errorf("Parse(%s) should return an error", template)
+		}
+	}
+}
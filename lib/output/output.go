@@ -0,0 +1,583 @@
+// Package output renders the results of Unified commands in the format chosen by the user. Any struct, pointer to
+// a struct or slice of structs can be rendered as a table, CSV, TSV, JSON, newline delimited JSON, YAML, through a
+// Go text/template or a JSONPath template, with the columns and sort order selected by name.
+package output
+
+import (
+	"bitbucket.org/ecosse-hosting/unified/lib/jsonpath"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	yaml2 "github.com/ghodss/yaml"
+	"github.com/olekukonko/tablewriter"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// The output formats understood by Render.
+const (
+	Table    = "table"
+	Wide     = "wide"
+	JSON     = "json"
+	YAML     = "yaml"
+	CSV      = "csv"
+	TSV      = "tsv"
+	NDJSON   = "ndjson"
+	Template = "template"
+	JSONPath = "jsonpath"
+)
+
+// Formats lists every output format, as accepted by --output.
+var Formats = []string{Table, Wide, JSON, YAML, CSV, TSV, NDJSON, Template, JSONPath}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Options controls how Render displays its data.
+type Options struct {
+	// One of the output formats e.g. Table or JSON. Defaults to Table.
+	Format string
+
+	// The text/template used by the Template format, executed once per row, or the JSONPath template used by the
+	// JSONPath format, executed once against the whole of the JSON output.
+	Template string
+
+	// Columns to display, in order, matched case insensitively against the field names or JSON names of the
+	// rendered structs. When empty the table format displays DefaultColumns and all other formats every field.
+	Columns []string
+
+	// Columns displayed by the table format when Columns is not set. Wide always displays every field.
+	DefaultColumns []string
+
+	// Column to sort the rows by. Prefix with - to sort in descending order.
+	SortBy string
+
+	// Omit the header row from the table, CSV and TSV formats.
+	NoHeaders bool
+
+	// Formats times for the text formats. Defaults to RFC3339.
+	TimeFormat func(time.Time) string
+
+	// Called with each row displayed by the table formats, returning a function which styles every cell of the
+	// row e.g. in colour, or nil to leave the row as it is.
+	Highlight func(row interface{}) func(string) string
+}
+
+// ParseFormat splits an --output value into the format and its argument e.g. "template={{.Name}}" returns
+// Template and "{{.Name}}" and "jsonpath={.name}" returns JSONPath and "{.name}".
+func ParseFormat(value string) (string, string, error) {
+	format, arg := value, ""
+	if i := strings.Index(value, "="); i >= 0 {
+		format, arg = value[:i], value[i+1:]
+	}
+	format = strings.ToLower(format)
+	for _, f := range Formats {
+		if f == format {
+			if f == Template && arg == "" {
+				return "", "", fmt.Errorf("output: the template format requires a template e.g. template='{{.Name}}'")
+			}
+			if f == JSONPath && arg == "" {
+				return "", "", fmt.Errorf("output: the jsonpath format requires a template e.g. jsonpath='{.name}'")
+			}
+			return format, arg, nil
+		}
+	}
+	return "", "", fmt.Errorf("output: unknown format %q, expected one of %s", value, strings.Join(Formats, ", "))
+}
+
+// column describes a struct field which can be displayed.
+type column struct {
+	name     string
+	jsonName string
+	index    []int
+}
+
+// key is the name of the column in JSON output.
+func (c column) key() string {
+	if c.jsonName != "" {
+		return c.jsonName
+	}
+	return c.name
+}
+
+func (c column) matches(name string) bool {
+	return strings.EqualFold(c.name, name) || (c.jsonName != "" && strings.EqualFold(c.jsonName, name))
+}
+
+// Render writes data to w as described by opts. data is a struct, a pointer to a struct or a slice of either.
+func Render(w io.Writer, data interface{}, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+	format := opts.Format
+	if format == "" {
+		format = Table
+	}
+
+	v := reflect.ValueOf(data)
+	if !v.IsValid() {
+		return nil
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	single := v.Kind() != reflect.Slice && v.Kind() != reflect.Array
+
+	var rows []reflect.Value
+	if single {
+		rows = []reflect.Value{v}
+	} else {
+		for i := 0; i < v.Len(); i++ {
+			rows = append(rows, v.Index(i))
+		}
+	}
+
+	elemType := v.Type()
+	if !single {
+		elemType = elemType.Elem()
+	}
+	for elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return fmt.Errorf("output: cannot render %s", v.Type())
+	}
+	all := columnsOf(elemType, nil)
+
+	if opts.SortBy != "" {
+		if err := sortRows(rows, all, opts.SortBy); err != nil {
+			return err
+		}
+	}
+
+	explicit := len(opts.Columns) > 0
+	names := opts.Columns
+	if !explicit && format == Table {
+		names = opts.DefaultColumns
+	}
+	cols := all
+	if len(names) > 0 {
+		var err error
+		if cols, err = selectColumns(all, names); err != nil {
+			return err
+		}
+	}
+
+	switch format {
+	case Table, Wide:
+		return renderTable(w, rows, cols, opts, format == Wide)
+	case CSV:
+		return renderDelimited(w, rows, cols, opts, ',')
+	case TSV:
+		return renderDelimited(w, rows, cols, opts, '\t')
+	case JSONPath:
+		tmpl, err := jsonpath.Parse(opts.Template)
+		if err != nil {
+			return err
+		}
+		buf := new(bytes.Buffer)
+		if err := tmpl.Execute(buf, document(rows, cols, single, explicit)); err != nil {
+			return err
+		}
+		if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+		_, err = w.Write(buf.Bytes())
+		return err
+	case JSON, YAML:
+		doc := document(rows, cols, single, explicit)
+		buf := new(bytes.Buffer)
+		enc := json.NewEncoder(buf)
+		enc.SetIndent("", "    ")
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+		if format == JSON {
+			_, err := w.Write(buf.Bytes())
+			return err
+		}
+		y, err := yaml2.JSONToYAML(buf.Bytes())
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(y)
+		return err
+	case NDJSON:
+		enc := json.NewEncoder(w)
+		if explicit {
+			for _, m := range rowMaps(rows, cols) {
+				if err := enc.Encode(m); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		for _, row := range rows {
+			if err := enc.Encode(row.Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case Template:
+		tmpl, err := template.New("output").Parse(opts.Template)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			buf := new(bytes.Buffer)
+			if err := tmpl.Execute(buf, row.Interface()); err != nil {
+				return err
+			}
+			if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+				buf.WriteByte('\n')
+			}
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("output: unknown format %q", format)
+}
+
+// document returns what the JSON, YAML and JSONPath formats render: the row, or a slice of every row, limited to
+// the selected columns when they were chosen explicitly.
+func document(rows []reflect.Value, cols []column, single, explicit bool) interface{} {
+	if explicit {
+		maps := rowMaps(rows, cols)
+		if single {
+			return maps[0]
+		}
+		return maps
+	}
+	if single {
+		return rows[0].Interface()
+	}
+	values := make([]interface{}, len(rows))
+	for i, row := range rows {
+		values[i] = row.Interface()
+	}
+	return values
+}
+
+// Columns returns the names of the columns available when rendering data.
+func Columns(data interface{}) []string {
+	t := reflect.TypeOf(data)
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	var names []string
+	for _, c := range columnsOf(t, nil) {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+func renderTable(w io.Writer, rows []reflect.Value, cols []column, opts *Options, wide bool) error {
+	table := tablewriter.NewWriter(w)
+	if !opts.NoHeaders {
+		headers := make([]string, len(cols))
+		for i, c := range cols {
+			headers[i] = c.name
+		}
+		table.SetHeader(headers)
+	}
+	table.SetAutoWrapText(!wide)
+	for _, row := range rows {
+		cells := rowStrings(row, cols, opts)
+		if opts.Highlight != nil {
+			if style := opts.Highlight(row.Interface()); style != nil {
+				for i := range cells {
+					cells[i] = style(cells[i])
+				}
+			}
+		}
+		table.Append(cells)
+	}
+	table.Render()
+	return nil
+}
+
+func renderDelimited(w io.Writer, rows []reflect.Value, cols []column, opts *Options, comma rune) error {
+	enc := csv.NewWriter(w)
+	enc.Comma = comma
+	if !opts.NoHeaders {
+		headers := make([]string, len(cols))
+		for i, c := range cols {
+			headers[i] = c.name
+			if c.jsonName != "" {
+				headers[i] = c.jsonName
+			}
+		}
+		if err := enc.Write(headers); err != nil {
+			return err
+		}
+	}
+	for _, row := range rows {
+		if err := enc.Write(rowStrings(row, cols, opts)); err != nil {
+			return err
+		}
+	}
+	enc.Flush()
+	return enc.Error()
+}
+
+// columnsOf lists the exported fields of t, flattening exported embedded structs. The fields of unexported
+// embedded structs are left out as reflect cannot read them.
+func columnsOf(t reflect.Type, index []int) []column {
+	var cols []column
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		idx := append(append([]int{}, index...), i)
+		jsonName := strings.Split(f.Tag.Get("json"), ",")[0]
+		if jsonName == "-" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && ft.Kind() == reflect.Struct && jsonName == "" && !isTime(ft) {
+			cols = append(cols, columnsOf(ft, idx)...)
+			continue
+		}
+		cols = append(cols, column{name: f.Name, jsonName: jsonName, index: idx})
+	}
+	return cols
+}
+
+func selectColumns(all []column, names []string) ([]column, error) {
+	var cols []column
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		c, ok := findColumn(all, name)
+		if !ok {
+			available := make([]string, len(all))
+			for i, a := range all {
+				available[i] = a.name
+			}
+			return nil, fmt.Errorf("output: unknown column %q, expected one of %s", name,
+				strings.Join(available, ", "))
+		}
+		cols = append(cols, c)
+	}
+	return cols, nil
+}
+
+func findColumn(all []column, name string) (column, bool) {
+	for _, c := range all {
+		if c.matches(name) {
+			return c, true
+		}
+	}
+	return column{}, false
+}
+
+// field returns the value of c in row, or an invalid Value if a nil pointer is in the way.
+func field(row reflect.Value, c column) reflect.Value {
+	v := row
+	for _, i := range c.index {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v
+}
+
+func rowStrings(row reflect.Value, cols []column, opts *Options) []string {
+	values := make([]string, len(cols))
+	for i, c := range cols {
+		values[i] = FormatValue(field(row, c), opts.TimeFormat)
+	}
+	return values
+}
+
+func rowMaps(rows []reflect.Value, cols []column) []map[string]interface{} {
+	maps := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		m := make(map[string]interface{}, len(cols))
+		for _, c := range cols {
+			if v := field(row, c); v.IsValid() {
+				m[c.key()] = v.Interface()
+			} else {
+				m[c.key()] = nil
+			}
+		}
+		maps[i] = m
+	}
+	return maps
+}
+
+// FormatValue formats any value as the text of a single table or CSV cell. Times are formatted by timeFormat, or
+// as RFC3339 when it is nil, lists of simple values are comma separated and everything else is compact JSON.
+func FormatValue(v reflect.Value, timeFormat func(time.Time) string) string {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return ""
+	}
+	if t, ok := timeOf(v); ok {
+		if t.IsZero() {
+			return ""
+		}
+		if timeFormat != nil {
+			return timeFormat(t)
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 {
+			return ""
+		}
+		if isSimple(v.Type().Elem()) {
+			parts := make([]string, v.Len())
+			for i := range parts {
+				parts[i] = FormatValue(v.Index(i), timeFormat)
+			}
+			return strings.Join(parts, ",")
+		}
+	}
+
+	if v.CanInterface() {
+		b, err := json.Marshal(v.Interface())
+		if err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+func isSimple(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return isTime(t)
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Interface:
+		return false
+	}
+	return true
+}
+
+// isTime reports whether t is a time.Time or a struct embedding one, such as unifi.Timestamp.
+func isTime(t reflect.Type) bool {
+	if t == timeType {
+		return true
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.Anonymous && f.Type == timeType {
+			return true
+		}
+	}
+	return false
+}
+
+func timeOf(v reflect.Value) (time.Time, bool) {
+	if v.Kind() != reflect.Struct || !isTime(v.Type()) {
+		return time.Time{}, false
+	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time), true
+	}
+	for i := 0; i < v.NumField(); i++ {
+		if f := v.Type().Field(i); f.Anonymous && f.Type == timeType {
+			return v.Field(i).Interface().(time.Time), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func sortRows(rows []reflect.Value, all []column, sortBy string) error {
+	descending := strings.HasPrefix(sortBy, "-")
+	c, ok := findColumn(all, strings.TrimPrefix(sortBy, "-"))
+	if !ok {
+		_, err := selectColumns(all, []string{strings.TrimPrefix(sortBy, "-")})
+		return err
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if descending {
+			return less(field(rows[j], c), field(rows[i], c))
+		}
+		return less(field(rows[i], c), field(rows[j], c))
+	})
+	return nil
+}
+
+// less orders two values of the same field, sorting empty values first.
+func less(a, b reflect.Value) bool {
+	for a.IsValid() && a.Kind() == reflect.Ptr {
+		if a.IsNil() {
+			a = reflect.Value{}
+			break
+		}
+		a = a.Elem()
+	}
+	for b.IsValid() && b.Kind() == reflect.Ptr {
+		if b.IsNil() {
+			b = reflect.Value{}
+			break
+		}
+		b = b.Elem()
+	}
+	if !a.IsValid() || !b.IsValid() {
+		return !a.IsValid() && b.IsValid()
+	}
+	if ta, ok := timeOf(a); ok {
+		tb, _ := timeOf(b)
+		return ta.Before(tb)
+	}
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() < b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() < b.Float()
+	case reflect.Bool:
+		return !a.Bool() && b.Bool()
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return a.Len() < b.Len()
+	}
+	return strings.ToLower(FormatValue(a, nil)) < strings.ToLower(FormatValue(b, nil))
+}
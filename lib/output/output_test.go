@@ -0,0 +1,183 @@
+package output
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+type stamp struct {
+	time.Time
+}
+
+type port struct {
+	Idx   int  `json:"port_idx"`
+	IsUp  bool `json:"up"`
+	Speed int  `json:"speed"`
+}
+
+type device struct {
+	Name    string   `json:"name"`
+	IP      string   `json:"ip"`
+	RXBytes int64    `json:"rx_bytes"`
+	Uptime  uint64   `json:"uptime"`
+	Load    float64  `json:"load"`
+	Tags    []string `json:"tags"`
+	Ports   []port   `json:"port_table"`
+	Network port     `json:"network"`
+	Seen    stamp    `json:"seen"`
+	hidden  string
+}
+
+var devices = []device{
+	{Name: "Manse Landing", IP: "192.168.1.10", RXBytes: 112046410012, Uptime: 86400, Load: 0.25,
+		Tags: []string{"a", "b"}, Ports: []port{{Idx: 1, IsUp: true, Speed: 1000}},
+		Seen: stamp{time.Date(2017, 4, 29, 12, 32, 9, 0, time.UTC)}},
+	{Name: "Manse Hallway", IP: "192.168.1.20", RXBytes: 5, hidden: "secret"},
+}
+
+func TestRenderCSVFormatsEveryFieldType(t *testing.T) {
+	buf := new(bytes.Buffer)
+	err := Render(buf, devices, &Options{Format: CSV})
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 rows, got %q", buf.String())
+	}
+	if want := "name,ip,rx_bytes,uptime,load,tags,port_table,network,seen"; lines[0] != want {
+		t.Errorf("header = %q, want %q", lines[0], want)
+	}
+	want := `Manse Landing,192.168.1.10,112046410012,86400,0.25,"a,b","[{""port_idx"":1,""up"":true,` +
+		`""speed"":1000}]","{""port_idx"":0,""up"":false,""speed"":0}",2017-04-29T12:32:09Z`
+	if lines[1] != want {
+		t.Errorf("row = %q, want %q", lines[1], want)
+	}
+}
+
+func TestRenderColumnsSortAndNoHeaders(t *testing.T) {
+	buf := new(bytes.Buffer)
+	err := Render(buf, devices, &Options{Format: TSV, Columns: []string{"name", "RXBytes"}, SortBy: "rx_bytes",
+		NoHeaders: true})
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	if want := "Manse Hallway\t5\nManse Landing\t112046410012\n"; buf.String() != want {
+		t.Errorf("Render = %q, want %q", buf.String(), want)
+	}
+
+	if err := Render(buf, devices, &Options{Columns: []string{"serial"}}); err == nil {
+		t.Errorf("an unknown column should return an error")
+	}
+}
+
+// Site is embedded in host to check the fields of exported embedded structs are flattened into its columns.
+type Site struct {
+	Site string `json:"site"`
+}
+
+type serial struct {
+	Serial string `json:"serial"`
+}
+
+type host struct {
+	Site
+	serial
+	Name string `json:"name"`
+}
+
+func TestRenderEmbeddedStructs(t *testing.T) {
+	buf := new(bytes.Buffer)
+	hosts := []host{{Site: Site{"office"}, serial: serial{"802AA8C66367"}, Name: "Manse Landing"}}
+	if err := Render(buf, hosts, &Options{Format: CSV}); err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	if want := "site,name\noffice,Manse Landing\n"; buf.String() != want {
+		t.Errorf("Render = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	buf := new(bytes.Buffer)
+	err := Render(buf, &devices[0], &Options{Format: Template, Template: "{{.Name}} {{.IP}}"})
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	if want := "Manse Landing 192.168.1.10\n"; buf.String() != want {
+		t.Errorf("Render = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestRenderJSONPath(t *testing.T) {
+	buf := new(bytes.Buffer)
+	err := Render(buf, devices, &Options{Format: JSONPath, Template: `{[?(@.rx_bytes>5)].name}`})
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	if want := "Manse Landing\n"; buf.String() != want {
+		t.Errorf("Render = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	format, arg, err := ParseFormat("template={{.Name}}")
+	if err != nil || format != Template || arg != "{{.Name}}" {
+		t.Errorf("ParseFormat = %q, %q, %v", format, arg, err)
+	}
+	if _, _, err := ParseFormat("xml"); err == nil {
+		t.Errorf("an unknown format should return an error")
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	w := NewWatcher("name")
+	now := time.Now()
+	_, deltas, err := w.Refresh(devices, []string{"name", "ip"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deltas) != 2 || deltas[0].Change != Added {
+		t.Errorf("first Refresh() deltas = %v, want every row added", deltas)
+	}
+	styled := func(s string) string { return "*" + s }
+	highlight := w.Highlight(map[string]func(string) string{Added: styled, Removed: styled, Changed: styled})
+	if highlight(devices[0]) != nil {
+		t.Error("Highlight() after the first refresh styled a row")
+	}
+
+	next := []device{
+		{Name: "Manse Landing", IP: "192.168.1.11", RXBytes: 1},
+		{Name: "Manse Attic", IP: "192.168.1.30"},
+	}
+	merged, deltas, err := w.Refresh(next, []string{"name", "ip"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range deltas {
+		got = append(got, d.Change+" "+d.Key)
+	}
+	want := "changed Manse Landing,added Manse Attic,removed Manse Hallway"
+	if strings.Join(got, ",") != want {
+		t.Errorf("Refresh() deltas = %q, want %q", got, want)
+	}
+	if ip := deltas[0].Fields["ip"]; ip.Old != "192.168.1.10" || ip.New != "192.168.1.11" || len(deltas[0].Fields) != 1 {
+		t.Errorf("Refresh() fields = %v, want only the IP changed", deltas[0].Fields)
+	}
+	if rows := merged.([]device); len(rows) != 3 || rows[2].Name != "Manse Hallway" {
+		t.Errorf("Refresh() = %v, want the removed row last", rows)
+	}
+	if style := highlight(next[1]); style == nil || style("x") != "*x" {
+		t.Error("Highlight() did not style the added row")
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Render(buf, merged, &Options{Columns: []string{"name"}, Highlight: highlight}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "*Manse Hallway") || strings.Contains(buf.String(), "*NAME") {
+		t.Errorf("Render() with Highlight =\n%s", buf)
+	}
+}
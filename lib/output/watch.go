@@ -0,0 +1,153 @@
+package output
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// The changes a Watcher reports.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Delta is a row which was added, removed or changed between two refreshes of a Watcher.
+type Delta struct {
+	Time   time.Time              `json:"time"`
+	Change string                 `json:"change"`
+	Key    string                 `json:"key"`
+	Fields map[string]FieldChange `json:"fields,omitempty"`
+	Row    interface{}            `json:"row"`
+}
+
+// FieldChange is the old and new value of a column of a changed row, as displayed in a table. Columns are named as
+// in JSON output.
+type FieldChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// Watcher compares the rows of successive runs of the same query, identifying rows by the value of a key column
+// e.g. the MAC address of a device.
+type Watcher struct {
+	key      string
+	previous map[string]watchedRow
+	order    []string
+	changes  map[string]string
+	first    bool
+}
+
+type watchedRow struct {
+	value reflect.Value
+	cells map[string]string
+}
+
+// NewWatcher creates a Watcher identifying rows by the column key.
+func NewWatcher(key string) *Watcher {
+	return &Watcher{key: key}
+}
+
+// Refresh compares data, a slice of structs, with the data of the previous refresh. Only the given columns are
+// compared, or every column when there are none. It returns data with the rows which have since disappeared added
+// to the end, so they can still be displayed, and the deltas. Every row is added on the first refresh.
+func (w *Watcher) Refresh(data interface{}, columns []string, now time.Time) (interface{}, []Delta, error) {
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice {
+		return nil, nil, fmt.Errorf("output: cannot watch %T, expected a slice", data)
+	}
+	elemType := v.Type().Elem()
+	for elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("output: cannot watch %T, expected a slice of structs", data)
+	}
+	all := columnsOf(elemType, nil)
+	key, ok := findColumn(all, w.key)
+	if !ok {
+		return nil, nil, fmt.Errorf("output: unknown key column %q", w.key)
+	}
+	cols := all
+	if len(columns) > 0 {
+		var err error
+		if cols, err = selectColumns(all, columns); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	current := make(map[string]watchedRow, v.Len())
+	order := make([]string, 0, v.Len())
+	changes := make(map[string]string)
+	var deltas []Delta
+	for i := 0; i < v.Len(); i++ {
+		row := v.Index(i)
+		k := FormatValue(field(row, key), nil)
+		cells := make(map[string]string, len(cols))
+		for _, c := range cols {
+			cells[c.key()] = FormatValue(field(row, c), nil)
+		}
+		current[k] = watchedRow{row, cells}
+		order = append(order, k)
+
+		old, existed := w.previous[k]
+		switch {
+		case !existed:
+			changes[k] = Added
+			deltas = append(deltas, Delta{Time: now, Change: Added, Key: k, Row: row.Interface()})
+		default:
+			fields := make(map[string]FieldChange)
+			for _, c := range cols {
+				if old.cells[c.key()] != cells[c.key()] {
+					fields[c.key()] = FieldChange{old.cells[c.key()], cells[c.key()]}
+				}
+			}
+			if len(fields) > 0 {
+				changes[k] = Changed
+				deltas = append(deltas, Delta{Time: now, Change: Changed, Key: k, Fields: fields, Row: row.Interface()})
+			}
+		}
+	}
+
+	// Rows which have disappeared are kept at the end, in the order they were last displayed.
+	merged := reflect.AppendSlice(reflect.MakeSlice(v.Type(), 0, v.Len()), v)
+	for _, k := range w.order {
+		if _, ok := current[k]; !ok {
+			old := w.previous[k]
+			changes[k] = Removed
+			deltas = append(deltas, Delta{Time: now, Change: Removed, Key: k, Row: old.value.Interface()})
+			merged = reflect.Append(merged, old.value)
+		}
+	}
+
+	w.first = w.previous == nil
+	w.previous, w.order, w.changes = current, order, changes
+	return merged.Interface(), deltas, nil
+}
+
+// Highlight returns an Options.Highlight styling the rows which changed in the latest refresh with the style given
+// for the change, e.g. styles[Added] for new rows. Nothing is highlighted after the first refresh, when every row is
+// new.
+func (w *Watcher) Highlight(styles map[string]func(string) string) func(row interface{}) func(string) string {
+	return func(row interface{}) func(string) string {
+		if w.first {
+			return nil
+		}
+		v := reflect.ValueOf(row)
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return nil
+			}
+			v = v.Elem()
+		}
+		key, ok := findColumn(columnsOf(v.Type(), nil), w.key)
+		if !ok {
+			return nil
+		}
+		return styles[w.changes[FormatValue(field(v, key), nil)]]
+	}
+}
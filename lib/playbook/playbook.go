@@ -0,0 +1,312 @@
+// Package playbook runs expect-style playbooks against the shell of a device: steps which send a line and wait for
+// output matching a regular expression, capturing parts of it into variables which later steps may use.
+//
+// A playbook is YAML e.g.
+//
+//	name: Show the channel
+//	timeout: 30s
+//	vars:
+//	  radio: wifi0
+//	steps:
+//	  - expect: '# $'
+//	  - send: iwconfig {{radio}}
+//	  - expect: 'Frequency:(?P<frequency>[0-9.]+) GHz'
+//	    timeout: 10s
+//	  - send: echo {{device}} is on {{frequency}} GHz
+//	  - expect: 'is on ([0-9.]+)'
+//	    capture: [confirmed]
+//	  - send: exit
+package playbook
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ghodss/yaml"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is how long an expect step waits for its output when neither it nor the playbook say.
+const DefaultTimeout = 30 * time.Second
+
+// The output kept while waiting for a match, so a device which never sends what is expected cannot use up memory.
+const maxBuffer = 1 << 20
+
+// Playbook is a list of steps run in order against a shell, along with the defaults of its variables.
+type Playbook struct {
+	Name    string            `json:"name,omitempty"`
+	Timeout string            `json:"timeout,omitempty"`
+	Vars    map[string]string `json:"vars,omitempty"`
+	Steps   []Step            `json:"steps"`
+
+	timeout time.Duration
+}
+
+// Step either sends a line, Send, or waits for output matching the regular expression Expect. The named groups of
+// Expect, and the numbered groups named by Capture in order, are captured into variables. {{name}} in Send or
+// Expect is replaced by the value of the variable, which in Expect is matched literally.
+type Step struct {
+	Send      *string  `json:"send,omitempty"`
+	NoNewline bool     `json:"no_newline,omitempty"`
+	Expect    string   `json:"expect,omitempty"`
+	Capture   []string `json:"capture,omitempty"`
+	Timeout   string   `json:"timeout,omitempty"`
+
+	timeout time.Duration
+}
+
+func (s Step) String() string {
+	if s.Send != nil {
+		return "send " + *s.Send
+	}
+	return "expect " + s.Expect
+}
+
+// StepError is returned when a step of a playbook fails. Step counts from 1.
+type StepError struct {
+	Step        int
+	Description string
+	Err         error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("playbook: step %d, %s: %v", e.Step, e.Description, e.Err)
+}
+
+// TimeoutError is returned by an expect step whose output did not arrive in time. Output is the tail of what was
+// received instead.
+type TimeoutError struct {
+	Timeout time.Duration
+	Output  string
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s, the device last sent %q", e.Timeout, e.Output)
+}
+
+var variable = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// Load reads and checks the playbook in the file at path.
+func Load(path string) (*Playbook, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return p, nil
+}
+
+// Parse reads a playbook from YAML, checking its steps and timeouts are valid.
+func Parse(data []byte) (*Playbook, error) {
+	p := new(Playbook)
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("playbook: %v", err)
+	}
+	if len(p.Steps) == 0 {
+		return nil, fmt.Errorf("playbook: there are no steps")
+	}
+	var err error
+	if p.timeout, err = parseTimeout(p.Timeout, DefaultTimeout); err != nil {
+		return nil, fmt.Errorf("playbook: %v", err)
+	}
+	for i := range p.Steps {
+		s := &p.Steps[i]
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("playbook: step %d: %s", i+1, fmt.Sprintf(format, args...))
+		}
+		switch {
+		case s.Send != nil && s.Expect != "":
+			return nil, fail("give either send or expect, not both")
+		case s.Send == nil && s.Expect == "":
+			return nil, fail("give send or expect")
+		case s.Send != nil && (len(s.Capture) > 0 || s.Timeout != ""):
+			return nil, fail("capture and timeout only apply to expect")
+		}
+		if s.Expect == "" {
+			continue
+		}
+		// Variables are only known when the step runs, but the rest of the expression can be checked now.
+		re, err := regexp.Compile(variable.ReplaceAllString(s.Expect, ""))
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		if len(s.Capture) > re.NumSubexp() {
+			return nil, fail("%d captures but only %d groups in %q", len(s.Capture), re.NumSubexp(), s.Expect)
+		}
+		if s.timeout, err = parseTimeout(s.Timeout, p.timeout); err != nil {
+			return nil, fail("%v", err)
+		}
+	}
+	return p, nil
+}
+
+func parseTimeout(value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q", value)
+	}
+	return d, nil
+}
+
+// Run runs the steps, sending to w and expecting from r, with the playbook's variables overridden by vars. It
+// returns the variables, including those captured, as they were when it finished, with a *StepError if a step
+// failed.
+func (p *Playbook) Run(w io.Writer, r io.Reader, vars map[string]string) (map[string]string, error) {
+	all := make(map[string]string)
+	for k, v := range p.Vars {
+		all[k] = v
+	}
+	for k, v := range vars {
+		all[k] = v
+	}
+
+	out := newReader(r)
+	defer out.stop()
+	for i, s := range p.Steps {
+		if err := runStep(s, w, out, all); err != nil {
+			return all, &StepError{Step: i + 1, Description: s.String(), Err: err}
+		}
+	}
+	return all, nil
+}
+
+func runStep(s Step, w io.Writer, out *reader, vars map[string]string) error {
+	if s.Send != nil {
+		line, err := expand(*s.Send, vars, func(v string) string { return v })
+		if err != nil {
+			return err
+		}
+		if !s.NoNewline {
+			line += "\n"
+		}
+		_, err = io.WriteString(w, line)
+		return err
+	}
+
+	pattern, err := expand(s.Expect, vars, regexp.QuoteMeta)
+	if err != nil {
+		return err
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	match, err := out.expect(re, s.timeout)
+	if err != nil {
+		return err
+	}
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			vars[name] = match[i]
+		}
+	}
+	for i, name := range s.Capture {
+		vars[name] = match[i+1]
+	}
+	return nil
+}
+
+// expand replaces the variables in s with their values, passed through quote.
+func expand(s string, vars map[string]string, quote func(string) string) (string, error) {
+	var missing []string
+	s = variable.ReplaceAllStringFunc(s, func(m string) string {
+		name := variable.FindStringSubmatch(m)[1]
+		v, ok := vars[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return quote(v)
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined variable %s", strings.Join(missing, ", "))
+	}
+	return s, nil
+}
+
+// reader collects the output of the shell in the background so it can be waited for with a timeout.
+type reader struct {
+	chunks chan []byte
+	done   chan bool
+	err    error
+	buf    []byte
+}
+
+func newReader(r io.Reader) *reader {
+	out := &reader{chunks: make(chan []byte), done: make(chan bool)}
+	go func() {
+		defer close(out.chunks)
+		for {
+			b := make([]byte, 4096)
+			n, err := r.Read(b)
+			if n > 0 {
+				select {
+				case out.chunks <- b[:n]:
+				case <-out.done:
+					return
+				}
+			}
+			if err != nil {
+				out.err = err
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func (out *reader) stop() {
+	close(out.done)
+}
+
+// expect waits for output matching re, returning the match and its groups and consuming the output up to its end.
+func (out *reader) expect(re *regexp.Regexp, timeout time.Duration) ([]string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		if m := re.FindSubmatchIndex(out.buf); m != nil {
+			match := make([]string, len(m)/2)
+			for i := range match {
+				if m[2*i] >= 0 {
+					match[i] = string(out.buf[m[2*i]:m[2*i+1]])
+				}
+			}
+			out.buf = out.buf[m[1]:]
+			return match, nil
+		}
+		select {
+		case chunk, ok := <-out.chunks:
+			if !ok {
+				err := out.err
+				if err == nil || err == io.EOF {
+					err = fmt.Errorf("the session ended")
+				}
+				return nil, fmt.Errorf("%v, the device last sent %q", err, tail(out.buf))
+			}
+			out.buf = append(out.buf, chunk...)
+			if len(out.buf) > maxBuffer {
+				out.buf = out.buf[len(out.buf)-maxBuffer/2:]
+			}
+		case <-timer.C:
+			return nil, &TimeoutError{Timeout: timeout, Output: tail(out.buf)}
+		}
+	}
+}
+
+// tail returns the end of the output received, enough to see the prompt or error the device is showing.
+func tail(b []byte) string {
+	const n = 200
+	b = bytes.TrimSpace(b)
+	if len(b) > n {
+		b = b[len(b)-n:]
+	}
+	return string(b)
+}
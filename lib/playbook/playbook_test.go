@@ -0,0 +1,123 @@
+package playbook
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeShell answers each line sent to it by calling reply, until exit, showing a prompt in between.
+func fakeShell(reply func(line string) string) (io.Writer, io.Reader) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	go func() {
+		defer outW.Close()
+		io.WriteString(outW, "BusyBox v1.25.1\nuap1-BZ.v4.0.21# ")
+		lines := bufio.NewScanner(inR)
+		for lines.Scan() {
+			if lines.Text() == "exit" {
+				return
+			}
+			io.WriteString(outW, reply(lines.Text())+"\nuap1-BZ.v4.0.21# ")
+		}
+	}()
+	return inW, outR
+}
+
+func iwconfig(line string) string {
+	switch line {
+	case "iwconfig wifi0":
+		return "wifi0  IEEE 802.11ac  ESSID:\"Office\"\n  Mode:Master  Frequency:5.18 GHz  Access Point: 80:2A:A8:00:00:01"
+	case "hang":
+		time.Sleep(time.Second)
+	}
+	if strings.HasPrefix(line, "echo ") {
+		return strings.TrimPrefix(line, "echo ")
+	}
+	return "sh: " + line + ": not found"
+}
+
+const example = `
+name: Show the channel
+timeout: 5s
+vars:
+  radio: wifi0
+steps:
+  - expect: '# $'
+  - send: iwconfig {{radio}}
+  - expect: 'Frequency:(?P<frequency>[0-9.]+) GHz'
+    timeout: 1s
+  - send: echo {{device}} is on {{frequency}} GHz
+  - expect: '{{device}} is on ([0-9.]+)'
+    capture: [confirmed]
+  - send: exit
+`
+
+func TestRun(t *testing.T) {
+	p, err := Parse([]byte(example))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "Show the channel" || len(p.Steps) != 6 || p.Steps[2].timeout != time.Second ||
+		p.Steps[4].timeout != 5*time.Second {
+		t.Fatalf("Parse() = %+v, want the example", p)
+	}
+
+	w, r := fakeShell(iwconfig)
+	vars, err := p.Run(w, r, map[string]string{"device": "uap1.(lobby)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"radio": "wifi0", "device": "uap1.(lobby)", "frequency": "5.18", "confirmed": "5.18"}
+	if fmt.Sprint(vars) != fmt.Sprint(want) {
+		t.Errorf("Run() = %v, want %v", vars, want)
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	tests := []struct {
+		name, steps string
+		vars        map[string]string
+		step        int
+		want        string
+	}{
+		{"timeout", `[{send: hang}, {expect: 'never', timeout: 50ms}]`, nil, 2, "timed out after 50ms"},
+		{"the session ending", `[{send: exit}, {expect: 'never'}]`, nil, 2, "the session ended"},
+		{"an undefined variable", `[{send: 'iwconfig {{band}}'}]`, nil, 1, "undefined variable band"},
+		{"a variable overridden", `[{expect: '# $'}, {send: 'echo {{radio}}'}, {expect: 'wifi0', timeout: 50ms}]`,
+			map[string]string{"radio": "wifi1"}, 3, "the device last sent \"wifi1"},
+	}
+	for _, test := range tests {
+		p, err := Parse([]byte("vars: {radio: wifi0}\nsteps: " + test.steps))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		w, r := fakeShell(iwconfig)
+		_, err = p.Run(w, r, test.vars)
+		e, ok := err.(*StepError)
+		if !ok || e.Step != test.step || !strings.Contains(e.Error(), test.want) {
+			t.Errorf("%s: Run() = %v, want step %d to fail with %s", test.name, err, test.step, test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, playbook := range []string{
+		"name: nothing to do",
+		"steps: [{send: a, expect: b}]",
+		"steps: [{capture: [a]}]",
+		"steps: [{send: a, timeout: 1s}]",
+		"steps: [{expect: '('}]",
+		"steps: [{expect: 'a', capture: [b]}]",
+		"steps: [{expect: 'a', timeout: soon}]",
+		"timeout: -1s\nsteps: [{expect: a}]",
+		"steps: {send: a}",
+	} {
+		if _, err := Parse([]byte(playbook)); err == nil {
+			t.Errorf("Parse(%q) did not fail", playbook)
+		}
+	}
+}
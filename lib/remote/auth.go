@@ -0,0 +1,101 @@
+package remote
+
+import (
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// Credentials are the ways of logging in to devices. Keys are offered before the password, which is only asked for
+// when a device rejects them.
+type Credentials struct {
+	Signers  []ssh.Signer
+	Password func() (string, error)
+}
+
+// Methods returns the SSH authentication methods for the credentials. Every key is offered by the one method, as
+// the SSH client tries each kind of method only once.
+func (c Credentials) Methods() []ssh.AuthMethod {
+	var methods []ssh.AuthMethod
+	if len(c.Signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(c.Signers...))
+	}
+	if c.Password != nil {
+		methods = append(methods,
+			ssh.PasswordCallback(c.Password),
+			ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				// Devices which only allow keyboard-interactive logins just ask for the password.
+				answers := make([]string, len(questions))
+				for i := range questions {
+					password, err := c.Password()
+					if err != nil {
+						return nil, err
+					}
+					answers[i] = password
+				}
+				return answers, nil
+			}))
+	}
+	return methods
+}
+
+// LoadKey reads the private key in the file at path. passphrase is called to decrypt the key when it is protected
+// by one, and may be nil if no passphrase can be given.
+func LoadKey(path string, passphrase func(path string) ([]byte, error)) (ssh.Signer, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(pem)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok && passphrase != nil {
+		var phrase []byte
+		if phrase, err = passphrase(path); err != nil {
+			return nil, err
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, phrase)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("remote: reading key %s: %v", path, err)
+	}
+	return signer, nil
+}
+
+// DefaultKeyFiles returns the private keys ssh uses by default which exist in ~/.ssh.
+func DefaultKeyFiles() []string {
+	home := os.Getenv("HOME")
+	if home == "" {
+		return nil
+	}
+	var files []string
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		path := filepath.Join(home, ".ssh", name)
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// AgentSigners returns the keys held by the ssh-agent listening on $SSH_AUTH_SOCK, and the connection to it which
+// must stay open while they are used. There are no keys and no error when no agent is running.
+func AgentSigners() ([]ssh.Signer, io.Closer, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil, nil
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("remote: connecting to ssh-agent: %v", err)
+	}
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("remote: listing the keys of ssh-agent: %v", err)
+	}
+	return signers, conn, nil
+}
@@ -0,0 +1,79 @@
+package remote
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key),
+		[]byte("open sesame"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "id_rsa")
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadKey(path, nil); err == nil {
+		t.Error("LoadKey() of an encrypted key without a passphrase did not fail")
+	}
+	if _, err := LoadKey(path, func(string) ([]byte, error) { return []byte("wrong"), nil }); err == nil {
+		t.Error("LoadKey() with the wrong passphrase did not fail")
+	}
+	signer, err := LoadKey(path, func(string) ([]byte, error) { return []byte("open sesame"), nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := newTestServer(t)
+	defer server.Close()
+	server.authorized = signer.PublicKey()
+	config, target := server.config()
+	asked := false
+	config.Auth = Credentials{
+		Signers:  []ssh.Signer{signer},
+		Password: func() (string, error) { asked = true; return "", fmt.Errorf("no password") },
+	}.Methods()
+	if r := config.Exec(target, "echo key", time.Second); r.Err != nil || string(r.Stdout) != "key\n" {
+		t.Errorf("Exec() with a key = %q, %v, want key", r.Stdout, r.Err)
+	}
+	if asked {
+		t.Error("the password was asked for though the key was accepted")
+	}
+}
+
+func TestCredentialsPassword(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	config, target := server.config()
+
+	config.Auth = Credentials{Password: func() (string, error) { return "secret", nil }}.Methods()
+	if r := config.Exec(target, "echo password", time.Second); r.Err != nil {
+		t.Errorf("Exec() with the password failed: %v", r.Err)
+	}
+	config.Auth = Credentials{Password: func() (string, error) { return "wrong", nil }}.Methods()
+	if r := config.Exec(target, "echo password", time.Second); r.Err == nil {
+		t.Error("Exec() with the wrong password did not fail")
+	}
+}
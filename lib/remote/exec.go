@@ -0,0 +1,139 @@
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of running a command on a device.
+type Result struct {
+	Target   Target
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int // -1 when the command never exited, e.g. it could not be started or timed out
+	Duration time.Duration
+	Err      error // why the command could not be run, nil when it ran whatever its exit code
+}
+
+// TimeoutError is returned when a command is still running after its timeout.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("remote: timed out after %s", e.Timeout)
+}
+
+// Run runs command in a new session of client, capturing its output and exit code. The command is killed and the
+// session closed if it is still running after timeout, unless timeout is zero.
+func Run(client *ssh.Client, command string, timeout time.Duration) (r Result) {
+	start := time.Now()
+	r.ExitCode = -1
+	// r is the named result, so the duration is set on what is returned.
+	defer func() { r.Duration = time.Since(start) }()
+
+	session, err := client.NewSession()
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	defer session.Close()
+	var stdout, stderr bytes.Buffer
+	session.Stdout, session.Stderr = &stdout, &stderr
+	if err := session.Start(command); err != nil {
+		r.Err = err
+		return r
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case err = <-done:
+	case <-expired:
+		// Few devices honour signals, so closing the session is what actually ends the wait.
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		<-done
+		err = &TimeoutError{timeout}
+	}
+	r.Stdout, r.Stderr = stdout.Bytes(), stderr.Bytes()
+
+	switch e := err.(type) {
+	case nil:
+		r.ExitCode = 0
+	case *ssh.ExitError:
+		r.ExitCode = e.ExitStatus()
+	default:
+		r.Err = err
+	}
+	return r
+}
+
+// Exec connects to the device t and runs command, as Run.
+func (c Config) Exec(t Target, command string, timeout time.Duration) Result {
+	start := time.Now()
+	client, err := c.Dial(t)
+	if err != nil {
+		return Result{Target: t, ExitCode: -1, Duration: time.Since(start), Err: err}
+	}
+	defer client.Close()
+
+	r := Run(client, command, timeout)
+	r.Target, r.Duration = t, time.Since(start)
+	return r
+}
+
+// ExecAll runs command on each of the targets, on up to workers at once, returning the results in the order of the
+// targets. start, if not nil, is called with the index of each target before connecting to it, and done, if not
+// nil, with its index and result as it arrives, each one at a time.
+func (c Config) ExecAll(
+	targets []Target,
+	command string,
+	timeout time.Duration,
+	workers int,
+	start func(int),
+	done func(int, Result)) []Result {
+
+	results := make([]Result, len(targets))
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if start != nil {
+					mu.Lock()
+					start(i)
+					mu.Unlock()
+				}
+				results[i] = c.Exec(targets[i], command, timeout)
+				if done != nil {
+					mu.Lock()
+					done(i, results[i])
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
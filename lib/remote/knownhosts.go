@@ -0,0 +1,184 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// KnownHosts is the store of the host keys of devices. Unlike ssh's known_hosts it is keyed by the MAC address of
+// each device rather than its address, as devices are often given a different address by DHCP. Each line of the
+// file is a MAC address, or a host name for hosts which are not devices such as the Controller, followed by the key
+// in authorized_keys format.
+type KnownHosts struct {
+	path string
+
+	mu   sync.Mutex
+	keys map[string]ssh.PublicKey
+
+	// TrustOnFirstUse adds the key of a device which is not yet known rather than refusing to connect to it.
+	TrustOnFirstUse bool
+
+	// Trusted, if not nil, is called when a key is added on first use.
+	Trusted func(t Target, key ssh.PublicKey)
+}
+
+// UnknownKeyError is returned when connecting to a device whose host key is not known and TrustOnFirstUse is off.
+type UnknownKeyError struct {
+	Target Target
+	Key    ssh.PublicKey
+}
+
+func (e *UnknownKeyError) Error() string {
+	return fmt.Sprintf("remote: the host key of %s is not known, its fingerprint is %s", e.Target,
+		ssh.FingerprintSHA256(e.Key))
+}
+
+// KeyChangedError is returned when a device presents a different host key to the one it is known by.
+type KeyChangedError struct {
+	Target Target
+	Known  ssh.PublicKey
+	Key    ssh.PublicKey
+}
+
+func (e *KeyChangedError) Error() string {
+	return fmt.Sprintf("remote: THE HOST KEY OF %s HAS CHANGED from %s to %s. The device may have been "+
+		"re-imaged or replaced, or something may be impersonating it; trust the new key only once you know which",
+		e.Target, ssh.FingerprintSHA256(e.Known), ssh.FingerprintSHA256(e.Key))
+}
+
+// OpenKnownHosts loads the known hosts in the file at path. A missing file is taken to be empty.
+func OpenKnownHosts(path string) (*KnownHosts, error) {
+	k := &KnownHosts{path: path, keys: make(map[string]ssh.PublicKey)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return k, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("remote: %s:%d: expected a MAC address followed by a key", path, n)
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(fields[1]))
+		if err != nil {
+			return nil, fmt.Errorf("remote: %s:%d: %v", path, n, err)
+		}
+		k.keys[normalizeMAC(fields[0])] = key
+	}
+	return k, scanner.Err()
+}
+
+// Lookup returns the key the device with the given MAC address is known by.
+func (k *KnownHosts) Lookup(mac string) (ssh.PublicKey, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key, ok := k.keys[normalizeMAC(mac)]
+	return key, ok
+}
+
+// Add trusts key as the host key of the device with the given MAC address, replacing any it was known by.
+func (k *KnownHosts) Add(mac string, key ssh.PublicKey) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[normalizeMAC(mac)] = key
+	return k.save()
+}
+
+// Remove forgets the key of the device with the given MAC address, reporting whether it was known.
+func (k *KnownHosts) Remove(mac string) (bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	mac = normalizeMAC(mac)
+	if _, ok := k.keys[mac]; !ok {
+		return false, nil
+	}
+	delete(k.keys, mac)
+	return true, k.save()
+}
+
+// Callback returns a host key callback accepting only the key the device t is known by, or when it is not known
+// and TrustOnFirstUse is on, any key, which is added.
+func (k *KnownHosts) Callback(t Target) ssh.HostKeyCallback {
+	return func(_ string, _ net.Addr, key ssh.PublicKey) error {
+		known, ok := k.Lookup(t.MacAddress)
+		switch {
+		case ok && bytes.Equal(known.Marshal(), key.Marshal()):
+			return nil
+		case ok:
+			return &KeyChangedError{t, known, key}
+		case !k.TrustOnFirstUse:
+			return &UnknownKeyError{t, key}
+		}
+		if err := k.Add(t.MacAddress, key); err != nil {
+			return err
+		}
+		if k.Trusted != nil {
+			k.Trusted(t, key)
+		}
+		return nil
+	}
+}
+
+// save writes the keys to the file, sorted by MAC address, replacing it only once they are all written.
+func (k *KnownHosts) save() error {
+	macs := make([]string, 0, len(k.keys))
+	for mac := range k.keys {
+		macs = append(macs, mac)
+	}
+	sort.Strings(macs)
+	var buf bytes.Buffer
+	for _, mac := range macs {
+		fmt.Fprintf(&buf, "%s %s", mac, ssh.MarshalAuthorizedKey(k.keys[mac]))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(k.path), 0700); err != nil {
+		return err
+	}
+	tmp := k.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.path)
+}
+
+// normalizeMAC returns the MAC address in the lower case, colon separated form the Controller uses, or a host name
+// in lower case.
+func normalizeMAC(mac string) string {
+	if hw, err := net.ParseMAC(mac); err == nil {
+		return hw.String()
+	}
+	return strings.ToLower(mac)
+}
+
+// HostKey connects to the device t just far enough to learn its host key, without logging in.
+func (c Config) HostKey(t Target) (ssh.PublicKey, error) {
+	var hostKey ssh.PublicKey
+	c.HostKeys, c.HostKeyCallback = nil, func(_ string, _ net.Addr, key ssh.PublicKey) error {
+		hostKey = key
+		return errHostKeyFetched
+	}
+	c.Auth = nil
+	if _, err := c.Dial(t); err != errHostKeyFetched {
+		return nil, err
+	}
+	return hostKey, nil
+}
+
+var errHostKeyFetched = fmt.Errorf("remote: host key fetched")
@@ -0,0 +1,81 @@
+package remote
+
+import (
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKnownHosts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "known_hosts")
+
+	server := newTestServer(t)
+	defer server.Close()
+	config, target := server.config()
+
+	hosts, err := OpenKnownHosts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.HostKeys = hosts
+	if r := config.Exec(target, "echo hi", time.Second); r.Err == nil {
+		t.Error("Exec() of a device whose key is not known did not fail")
+	} else if _, ok := r.Err.(*UnknownKeyError); !ok {
+		t.Errorf("Exec() of a device whose key is not known = %v, want an UnknownKeyError", r.Err)
+	}
+
+	trusted := 0
+	hosts.TrustOnFirstUse = true
+	hosts.Trusted = func(Target, ssh.PublicKey) { trusted++ }
+	if r := config.Exec(target, "echo hi", time.Second); r.Err != nil || trusted != 1 {
+		t.Errorf("Exec() trusting on first use = %v with %d keys trusted, want nil and 1", r.Err, trusted)
+	}
+
+	// The key is kept by MAC address, so the device is still known at another address.
+	if hosts, err = OpenKnownHosts(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := hosts.Lookup("80-2A-A8-00-00-01"); !ok {
+		t.Error("the key trusted on first use was not saved")
+	}
+	config.HostKeys = hosts
+	if r := config.Exec(target, "echo hi", time.Second); r.Err != nil {
+		t.Errorf("Exec() of a known device = %v", r.Err)
+	}
+
+	// Another server stands in for the device being replaced, re-imaged or impersonated.
+	imposter := newTestServer(t)
+	defer imposter.Close()
+	config.Port = imposter.listener.Addr().(*net.TCPAddr).Port
+	hosts.TrustOnFirstUse = true
+	r := config.Exec(target, "echo hi", time.Second)
+	if _, ok := r.Err.(*KeyChangedError); !ok {
+		t.Fatalf("Exec() of a device whose key changed = %v, want a KeyChangedError", r.Err)
+	}
+
+	key, err := config.HostKey(target)
+	if err != nil || string(key.Marshal()) != string(imposter.key.PublicKey().Marshal()) {
+		t.Fatalf("HostKey() = %v, %v, want the key of the server", key, err)
+	}
+	if err := hosts.Add(target.MacAddress, key); err != nil {
+		t.Fatal(err)
+	}
+	if r := config.Exec(target, "echo hi", time.Second); r.Err != nil {
+		t.Errorf("Exec() after trusting the new key = %v", r.Err)
+	}
+	if ok, err := hosts.Remove(target.MacAddress); !ok || err != nil {
+		t.Errorf("Remove() = %v, %v, want true, nil", ok, err)
+	}
+	if ok, _ := hosts.Remove(target.MacAddress); ok {
+		t.Error("Remove() of a device which is not known = true")
+	}
+}
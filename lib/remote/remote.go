@@ -0,0 +1,81 @@
+// Package remote connects to UniFi devices over SSH to run commands on them.
+package remote
+
+import (
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"net"
+	"strconv"
+	"time"
+)
+
+// DefaultPort is the port devices listen for SSH on.
+const DefaultPort = 22
+
+// DefaultDialTimeout is how long to wait for a device to accept a connection and complete the handshake.
+const DefaultDialTimeout = 10 * time.Second
+
+// Config is how to connect and log in to devices. Host keys are checked against HostKeys, or by HostKeyCallback
+// if it is set, and not at all when neither is.
+type Config struct {
+	User            string
+	Port            int
+	Auth            []ssh.AuthMethod
+	HostKeys        *KnownHosts
+	HostKeyCallback ssh.HostKeyCallback
+	DialTimeout     time.Duration
+}
+
+// Target is a device to connect to, named for messages by its name or MAC address.
+type Target struct {
+	Name       string `json:"name"`
+	MacAddress string `json:"mac"`
+	IP         string `json:"ip"`
+}
+
+func (t Target) String() string {
+	if t.Name == "" {
+		return t.MacAddress
+	}
+	return fmt.Sprintf("%s (%s)", t.Name, t.MacAddress)
+}
+
+// Dial connects and logs in to the device t.
+func (c Config) Dial(t Target) (*ssh.Client, error) {
+	if t.IP == "" {
+		return nil, fmt.Errorf("remote: %s has no IP address", t)
+	}
+	port, timeout := c.Port, c.DialTimeout
+	if port == 0 {
+		port = DefaultPort
+	}
+	if timeout == 0 {
+		timeout = DefaultDialTimeout
+	}
+	hostKeyCallback := c.HostKeyCallback
+	switch {
+	case hostKeyCallback != nil:
+	case c.HostKeys != nil:
+		hostKeyCallback = c.HostKeys.Callback(t)
+	default:
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	}
+	var keyErr error
+	client, err := ssh.Dial("tcp", net.JoinHostPort(t.IP, strconv.Itoa(port)), &ssh.ClientConfig{
+		User: c.User,
+		Auth: c.Auth,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			keyErr = hostKeyCallback(hostname, remote, key)
+			return keyErr
+		},
+		Timeout: timeout,
+	})
+	if keyErr != nil {
+		// Returned as is so a changed or unknown key can be told apart from a device which cannot be reached.
+		return nil, keyErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("remote: connecting to %s: %v", t, err)
+	}
+	return client, nil
+}
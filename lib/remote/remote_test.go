@@ -0,0 +1,220 @@
+package remote
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testServer is an SSH server which runs "echo WORDS", "fail CODE", "hang", a shell and the commands of
+// fileCommand, and has an SFTP server unless noSFTP is set, accepting the password "secret"
+// or the authorized key. It forwards ports as directTCPIP and globalRequests do.
+type testServer struct {
+	listener   net.Listener
+	key        ssh.Signer
+	authorized ssh.PublicKey
+	noSFTP     bool
+}
+
+func newTestServer(t *testing.T) *testServer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{listener: listener, key: key}
+	go s.serve()
+	return s
+}
+
+func (s *testServer) Close() { s.listener.Close() }
+
+// config returns a Config and Target to connect to the server with.
+func (s *testServer) config() (Config, Target) {
+	port := s.listener.Addr().(*net.TCPAddr).Port
+	return Config{User: "admin", Port: port, Auth: []ssh.AuthMethod{ssh.Password("secret")}},
+		Target{Name: "test", MacAddress: "80:2a:a8:00:00:01", IP: "127.0.0.1"}
+}
+
+func (s *testServer) serve() {
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(_ ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) != "secret" {
+				return nil, fmt.Errorf("wrong password")
+			}
+			return nil, nil
+		},
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if s.authorized == nil || !bytes.Equal(key.Marshal(), s.authorized.Marshal()) {
+				return nil, fmt.Errorf("unauthorized key")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(s.key)
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			sconn, channels, requests, err := ssh.NewServerConn(conn, config)
+			if err != nil {
+				return
+			}
+			go globalRequests(sconn, requests)
+			for nc := range channels {
+				if nc.ChannelType() == "direct-tcpip" {
+					go directTCPIP(nc)
+					continue
+				}
+				channel, requests, err := nc.Accept()
+				if err != nil {
+					continue
+				}
+				go s.session(channel, requests)
+			}
+		}()
+	}
+}
+
+func (s *testServer) session(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for req := range requests {
+		switch req.Type {
+		case "shell":
+			// The shell echoes what it is sent until the end of its input.
+			req.Reply(true, nil)
+			io.Copy(channel, channel)
+			channel.SendRequest("exit-status", false, []byte{0, 0, 0, 0})
+			return
+		case "subsystem":
+			if string(req.Payload[4:]) != "sftp" || s.noSFTP {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			if server, err := sftp.NewServer(channel); err == nil {
+				server.Serve()
+			}
+			return
+		case "pty-req":
+			req.Reply(true, nil)
+			continue
+		case "exec":
+		default:
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+		command := string(req.Payload[4:])
+		var code uint32
+		switch {
+		case strings.HasPrefix(command, "echo "):
+			io.WriteString(channel, strings.TrimPrefix(command, "echo ")+"\n")
+		case strings.HasPrefix(command, "fail "):
+			io.WriteString(channel.Stderr(), "failed\n")
+			code = uint32(command[5] - '0')
+		case command == "hang":
+			for range requests {
+			}
+			return
+		default:
+			code = s.fileCommand(channel, command)
+		}
+		status := make([]byte, 4)
+		binary.BigEndian.PutUint32(status, code)
+		channel.SendRequest("exit-status", false, status)
+		return
+	}
+}
+
+func TestExec(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	config, target := server.config()
+
+	r := config.Exec(target, "echo hello", time.Second)
+	if r.Err != nil || r.ExitCode != 0 || string(r.Stdout) != "hello\n" {
+		t.Errorf("echo = %q, %d, %v, want hello, 0, nil", r.Stdout, r.ExitCode, r.Err)
+	}
+
+	r = config.Exec(target, "fail 3", time.Second)
+	if r.Err != nil || r.ExitCode != 3 || string(r.Stderr) != "failed\n" {
+		t.Errorf("fail = %q, %d, %v, want failed on stderr, 3, nil", r.Stderr, r.ExitCode, r.Err)
+	}
+
+	r = config.Exec(target, "hang", 100*time.Millisecond)
+	if _, ok := r.Err.(*TimeoutError); !ok || r.ExitCode != -1 {
+		t.Errorf("hang = %d, %v, want -1 and a TimeoutError", r.ExitCode, r.Err)
+	}
+
+	r = config.Exec(Target{MacAddress: target.MacAddress}, "echo hello", time.Second)
+	if r.Err == nil {
+		t.Error("Exec() without an IP address did not fail")
+	}
+}
+
+func TestRun(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	config, target := server.config()
+	client, err := config.Dial(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	r := Run(client, "hang", 100*time.Millisecond)
+	if _, ok := r.Err.(*TimeoutError); !ok || r.Duration < 100*time.Millisecond || r.Duration > 5*time.Second {
+		t.Errorf("hang = %v after %s, want a TimeoutError after 100ms", r.Err, r.Duration)
+	}
+	if r = Run(client, "echo hello", time.Second); r.Err != nil || r.Duration <= 0 {
+		t.Errorf("echo = %v after %s, want it to take some time", r.Err, r.Duration)
+	}
+}
+
+func TestExecAll(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	config, target := server.config()
+
+	targets := make([]Target, 5)
+	for i := range targets {
+		targets[i] = target
+		targets[i].Name = string('a' + rune(i))
+	}
+	started := make([]bool, len(targets))
+	seen := 0
+	results := config.ExecAll(targets, "echo hi", time.Second, 2, func(i int) { started[i] = true },
+		func(i int, r Result) {
+			if !started[i] || r.Target.Name != targets[i].Name {
+				t.Errorf("done(%d, %s) called before start or for the wrong target", i, r.Target.Name)
+			}
+			seen++
+		})
+	if seen != len(targets) {
+		t.Errorf("done called %d times, want %d", seen, len(targets))
+	}
+	for i, r := range results {
+		if r.Target.Name != targets[i].Name || string(r.Stdout) != "hi\n" {
+			t.Errorf("results[%d] = %s %q, want %s hi", i, r.Target.Name, r.Stdout, targets[i].Name)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package remote
+
+import (
+	"golang.org/x/crypto/ssh"
+	"io"
+	"time"
+)
+
+// Shell is a login shell on a device driven by a program rather than a person, such as a playbook. It has a PTY, as
+// the shells and CLIs of devices only prompt on one, which does not echo what is sent so that it is not mistaken for
+// the output. Stdout has the output of the shell and the commands run in it, stderr included.
+type Shell struct {
+	Stdin  io.WriteCloser
+	Stdout io.Reader
+
+	session *ssh.Session
+}
+
+// StartShell starts a login shell in a new session of client.
+func StartShell(client *ssh.Client) (*Shell, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	s := &Shell{session: session}
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          0,
+		ssh.TTY_OP_ISPEED: 38400,
+		ssh.TTY_OP_OSPEED: 38400,
+	}
+	// A wide terminal keeps long lines of output, which are matched against, from being wrapped.
+	if err = session.RequestPty("dumb", 24, 512, modes); err == nil {
+		s.Stdin, err = session.StdinPipe()
+	}
+	if err == nil {
+		s.Stdout, err = session.StdoutPipe()
+	}
+	if err == nil {
+		err = session.Shell()
+	}
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Wait waits up to timeout for the shell to exit, returning its exit code, after closing its input so it knows no
+// more is coming. A shell which has not exited by then is closed. Stdout must be read for the shell to exit.
+func (s *Shell) Wait(timeout time.Duration) (int, error) {
+	s.Stdin.Close()
+	exited := make(chan error, 1)
+	go func() { exited <- s.session.Wait() }()
+	var err error
+	select {
+	case err = <-exited:
+	case <-time.After(timeout):
+		s.session.Close()
+		return -1, &TimeoutError{timeout}
+	}
+	if e, ok := err.(*ssh.ExitError); ok {
+		return e.ExitStatus(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+// Close ends the shell, whether or not it has exited.
+func (s *Shell) Close() error {
+	return s.session.Close()
+}
@@ -0,0 +1,112 @@
+package remote
+
+import (
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// The terminal type requested when $TERM is not set.
+const defaultTerm = "xterm"
+
+// Terminal is the local terminal an interactive session is attached to, normally os.Stdin, os.Stdout and
+// os.Stderr. Out may be wrapped, e.g. to record the session, as the size is taken from In.
+type Terminal struct {
+	In  *os.File
+	Out io.Writer
+	Err io.Writer
+}
+
+// LocalTerminal is the terminal unified is running in.
+func LocalTerminal() Terminal {
+	return Terminal{In: os.Stdin, Out: os.Stdout, Err: os.Stderr}
+}
+
+// IsTerminal reports whether In is a terminal rather than a file or pipe.
+func (t Terminal) IsTerminal() bool {
+	return terminal.IsTerminal(int(t.In.Fd()))
+}
+
+// Size returns the width and height of the terminal, 80x24 when In is not one.
+func (t Terminal) Size() (width, height int) {
+	if w, h, err := terminal.GetSize(int(t.In.Fd())); err == nil && w > 0 && h > 0 {
+		return w, h
+	}
+	return 80, 24
+}
+
+// Run runs command, or a login shell when command is empty, in a new session of client attached to the terminal,
+// returning its exit code. When In is a terminal it is put in raw mode, so keys such as tab and ctrl-c go to the
+// device, a PTY of the same type and size is requested and resized along with the terminal, and the terminal is
+// restored before returning. SIGINT, SIGTERM and SIGHUP received by unified are passed on to the session.
+func (t Terminal) Run(client *ssh.Client, command string) (int, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return -1, err
+	}
+	defer session.Close()
+
+	if t.IsTerminal() {
+		term := os.Getenv("TERM")
+		if term == "" {
+			term = defaultTerm
+		}
+		width, height := t.Size()
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 38400,
+			ssh.TTY_OP_OSPEED: 38400,
+		}
+		if err := session.RequestPty(term, height, width, modes); err != nil {
+			return -1, err
+		}
+		state, err := terminal.MakeRaw(int(t.In.Fd()))
+		if err != nil {
+			return -1, err
+		}
+		defer terminal.Restore(int(t.In.Fd()), state)
+
+		stop := t.watchSize(func(width, height int) { session.WindowChange(height, width) })
+		defer stop()
+	}
+	session.Stdin, session.Stdout, session.Stderr = t.In, t.Out, t.Err
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	go func() {
+		for sig := range signals {
+			switch sig {
+			case os.Interrupt:
+				session.Signal(ssh.SIGINT)
+			case syscall.SIGTERM:
+				session.Signal(ssh.SIGTERM)
+				session.Close()
+			case syscall.SIGHUP:
+				session.Signal(ssh.SIGHUP)
+				session.Close()
+			}
+		}
+	}()
+
+	if command == "" {
+		err = session.Shell()
+	} else {
+		err = session.Start(command)
+	}
+	if err != nil {
+		return -1, err
+	}
+	err = session.Wait()
+	if e, ok := err.(*ssh.ExitError); ok {
+		return e.ExitStatus(), nil
+	}
+	if err != nil {
+		// Most likely the session was closed by a signal, or the device went away, before it sent an exit status.
+		return -1, err
+	}
+	return 0, nil
+}
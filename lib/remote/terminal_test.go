@@ -0,0 +1,74 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTerminalRun(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	config, target := server.config()
+	client, err := config.Dial(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// Input from a file rather than a terminal is passed through without a PTY.
+	in, err := ioutil.TempFile("", "remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(in.Name())
+	in.WriteString("show version\n")
+	in.Seek(0, 0)
+	var out, errOut bytes.Buffer
+	term := Terminal{In: in, Out: &out, Err: &errOut}
+	if term.IsTerminal() {
+		t.Fatal("a file is a terminal")
+	}
+	if w, h := term.Size(); w != 80 || h != 24 {
+		t.Errorf("Size() = %dx%d, want 80x24", w, h)
+	}
+
+	code, err := term.Run(client, "")
+	if err != nil || code != 0 || out.String() != "show version\n" {
+		t.Errorf("Run() of a shell = %q, %d, %v, want the input echoed, 0, nil", out.String(), code, err)
+	}
+
+	code, err = term.Run(client, "fail 2")
+	if err != nil || code != 2 || errOut.String() != "failed\n" {
+		t.Errorf("Run() of a command = %q, %d, %v, want failed on stderr, 2, nil", errOut.String(), code, err)
+	}
+}
+
+func TestShell(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	config, target := server.config()
+	client, err := config.Dial(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	shell, err := StartShell(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shell.Close()
+	io.WriteString(shell.Stdin, "show version\n")
+	line, err := bufio.NewReader(shell.Stdout).ReadString('\n')
+	if err != nil || line != "show version\n" {
+		t.Errorf("the shell sent %q, %v, want what it was sent", line, err)
+	}
+	if code, err := shell.Wait(time.Second); err != nil || code != 0 {
+		t.Errorf("Wait() = %d, %v, want 0", code, err)
+	}
+}
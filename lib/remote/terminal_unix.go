@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+package remote
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchSize calls resize with the new size of the terminal whenever it changes, until stop is called.
+func (t Terminal) watchSize(resize func(width, height int)) (stop func()) {
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-winch:
+				resize(t.Size())
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(winch)
+		close(done)
+	}
+}
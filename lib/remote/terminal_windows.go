@@ -0,0 +1,28 @@
+package remote
+
+import "time"
+
+// watchSize calls resize with the new size of the terminal whenever it changes, until stop is called. Windows has
+// no SIGWINCH so the size is polled.
+func (t Terminal) watchSize(resize func(width, height int)) (stop func()) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		width, height := t.Size()
+		for {
+			select {
+			case <-ticker.C:
+				if w, h := t.Size(); w != width || h != height {
+					width, height = w, h
+					resize(w, h)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
@@ -0,0 +1,319 @@
+package remote
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The ways a file is transferred, SCP being used when the device has no SFTP server as many UniFi devices do not.
+const (
+	SFTP = "sftp"
+	SCP  = "scp"
+)
+
+// Progress is told how many bytes of a file of total bytes have been transferred so far.
+type Progress func(done, total int64)
+
+// Transfer is the outcome of copying a file to or from a device.
+type Transfer struct {
+	Method string
+	Size   int64
+	SHA256 string
+
+	// Verified is the command the device confirmed its copy of the file matches with, sha256sum or md5sum, or empty
+	// when it has neither.
+	Verified string
+}
+
+// ChecksumError is returned when the copy of a file on the device does not match what was transferred.
+type ChecksumError struct {
+	Path      string
+	Algorithm string
+	Local     string
+	Remote    string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("remote: the %s of %s is %s on the device but %s locally", e.Algorithm, e.Path, e.Remote,
+		e.Local)
+}
+
+// Pull copies the file at remotePath on the device to w, over SFTP if the device has an SFTP server or else SCP,
+// then checks the checksum of the file on the device matches what was received.
+func Pull(client *ssh.Client, remotePath string, w io.Writer, progress Progress) (*Transfer, error) {
+	sums := newChecksums()
+	w = io.MultiWriter(w, sums)
+
+	t := &Transfer{Method: SFTP}
+	sc, err := sftp.NewClient(client)
+	if err == nil {
+		defer sc.Close()
+		t.Size, err = pullSFTP(sc, remotePath, w, progress)
+	} else {
+		t.Method = SCP
+		t.Size, err = pullSCP(client, remotePath, w, progress)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, verify(client, remotePath, sums, t)
+}
+
+// Push copies the local file to remotePath on the device, over SFTP if the device has an SFTP server or else SCP,
+// then checks the checksum of the copy on the device matches the file. The copy has the same permissions as the
+// file. When remotePath is a directory the file is copied into it.
+func Push(client *ssh.Client, file *os.File, remotePath string, progress Progress) (*Transfer, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	isDir := Run(client, "test -d "+ShellQuote(remotePath), time.Minute).ExitCode == 0
+	if isDir || strings.HasSuffix(remotePath, "/") {
+		remotePath = path.Join(remotePath, info.Name())
+	}
+	sums := newChecksums()
+	r := io.TeeReader(file, sums)
+
+	t := &Transfer{Method: SFTP, Size: info.Size()}
+	sc, err := sftp.NewClient(client)
+	if err == nil {
+		defer sc.Close()
+		err = pushSFTP(sc, r, info, remotePath, progress)
+	} else {
+		t.Method = SCP
+		err = pushSCP(client, r, info, remotePath, progress)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, verify(client, remotePath, sums, t)
+}
+
+func pullSFTP(sc *sftp.Client, remotePath string, w io.Writer, progress Progress) (int64, error) {
+	f, err := sc.Open(remotePath)
+	if err != nil {
+		return 0, fmt.Errorf("remote: %s: %v", remotePath, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return io.Copy(&progressWriter{w: w, total: info.Size(), progress: progress}, f)
+}
+
+func pushSFTP(sc *sftp.Client, r io.Reader, info os.FileInfo, remotePath string, progress Progress) error {
+	f, err := sc.Create(remotePath)
+	if err != nil {
+		return fmt.Errorf("remote: %s: %v", remotePath, err)
+	}
+	_, err = io.Copy(f, &progressReader{r: r, total: info.Size(), progress: progress})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return sc.Chmod(remotePath, info.Mode().Perm())
+}
+
+// pullSCP runs scp -f on the device, the source end of the SCP protocol.
+func pullSCP(client *ssh.Client, remotePath string, w io.Writer, progress Progress) (int64, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+	in, err := session.StdinPipe()
+	if err != nil {
+		return 0, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	out := bufio.NewReader(stdout)
+	if err := session.Start("scp -f " + ShellQuote(remotePath)); err != nil {
+		return 0, err
+	}
+
+	// Each message of the source is acknowledged with a zero byte, starting with a request for the first.
+	in.Write([]byte{0})
+	header, err := scpMessage(out)
+	if err != nil {
+		return 0, err
+	}
+	// C<mode> <size> <name>
+	fields := strings.SplitN(header, " ", 3)
+	if len(fields) != 3 || !strings.HasPrefix(fields[0], "C") {
+		return 0, fmt.Errorf("remote: %s is not a file, scp sent %q", remotePath, header)
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("remote: scp sent an invalid size %q", fields[1])
+	}
+	in.Write([]byte{0})
+
+	n, err := io.CopyN(&progressWriter{w: w, total: size, progress: progress}, out, size)
+	if err != nil {
+		return n, err
+	}
+	if err := scpAck(out); err != nil {
+		return n, err
+	}
+	in.Write([]byte{0})
+	in.Close()
+	return n, session.Wait()
+}
+
+// pushSCP runs scp -t on the device, the sink end of the SCP protocol.
+func pushSCP(client *ssh.Client, r io.Reader, info os.FileInfo, remotePath string, progress Progress) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	in, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	out := bufio.NewReader(stdout)
+	if err := session.Start("scp -t " + ShellQuote(remotePath)); err != nil {
+		return err
+	}
+
+	if err := scpAck(out); err != nil {
+		return err
+	}
+	fmt.Fprintf(in, "C%04o %d %s\n", info.Mode().Perm(), info.Size(), path.Base(remotePath))
+	if err := scpAck(out); err != nil {
+		return err
+	}
+	body := &progressReader{r: r, total: info.Size(), progress: progress}
+	if _, err := io.CopyN(in, body, info.Size()); err != nil {
+		return err
+	}
+	in.Write([]byte{0})
+	if err := scpAck(out); err != nil {
+		return err
+	}
+	in.Close()
+	return session.Wait()
+}
+
+// scpAck reads the reply to an SCP message, a zero byte or a warning or error.
+func scpAck(r *bufio.Reader) error {
+	b, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("remote: scp: %v", err)
+	}
+	if b == 0 {
+		return nil
+	}
+	msg, _ := r.ReadString('\n')
+	return fmt.Errorf("remote: scp: %s", strings.TrimSpace(msg))
+}
+
+// scpMessage reads an SCP message line, failing if it is a warning or error.
+func scpMessage(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("remote: scp: %v", err)
+	}
+	if line[0] == 1 || line[0] == 2 {
+		return "", fmt.Errorf("remote: scp: %s", strings.TrimSpace(line[1:]))
+	}
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+// checksums computes the checksums a device may be able to compare with its copy of a file.
+type checksums struct {
+	sha256, md5 hash.Hash
+}
+
+func newChecksums() *checksums {
+	return &checksums{sha256.New(), md5.New()}
+}
+
+func (c *checksums) Write(p []byte) (int, error) {
+	c.sha256.Write(p)
+	return c.md5.Write(p)
+}
+
+// verify has the device compute the checksum of its copy of the file with sha256sum or, as older firmware has only
+// that, md5sum, failing when it differs.
+func verify(client *ssh.Client, remotePath string, sums *checksums, t *Transfer) error {
+	t.SHA256 = hex.EncodeToString(sums.sha256.Sum(nil))
+	for _, algorithm := range []struct {
+		command string
+		sum     string
+	}{
+		{"sha256sum", t.SHA256},
+		{"md5sum", hex.EncodeToString(sums.md5.Sum(nil))},
+	} {
+		r := Run(client, algorithm.command+" "+ShellQuote(remotePath), time.Minute)
+		fields := strings.Fields(string(r.Stdout))
+		if r.Err != nil || r.ExitCode != 0 || len(fields) == 0 {
+			continue
+		}
+		if fields[0] != algorithm.sum {
+			return &ChecksumError{remotePath, algorithm.command, algorithm.sum, fields[0]}
+		}
+		t.Verified = algorithm.command
+		return nil
+	}
+	return nil
+}
+
+// ShellQuote quotes s as a single argument of a POSIX shell command.
+func ShellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+type progressWriter struct {
+	w        io.Writer
+	done     int64
+	total    int64
+	progress Progress
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.done += int64(n)
+	if p.progress != nil {
+		p.progress(p.done, p.total)
+	}
+	return n, err
+}
+
+type progressReader struct {
+	r        io.Reader
+	done     int64
+	total    int64
+	progress Progress
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+	if p.progress != nil {
+		p.progress(p.done, p.total)
+	}
+	return n, err
+}
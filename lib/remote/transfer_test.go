@@ -0,0 +1,130 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fileCommand runs the commands Pull and Push use on the device, scp -f, scp -t, sha256sum and test -d, against
+// the local file system, returning the exit code.
+func (s *testServer) fileCommand(channel ssh.Channel, command string) uint32 {
+	fields := strings.SplitN(command, " ", 3)
+	arg := strings.Trim(fields[len(fields)-1], "'")
+	in := bufio.NewReader(channel)
+	switch {
+	case strings.HasPrefix(command, "test -d "):
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			return 0
+		}
+		return 1
+	case strings.HasPrefix(command, "sha256sum "):
+		data, err := ioutil.ReadFile(arg)
+		if err != nil {
+			return 1
+		}
+		sum := sha256.Sum256(data)
+		fmt.Fprintf(channel, "%s  %s\n", hex.EncodeToString(sum[:]), arg)
+		return 0
+	case strings.HasPrefix(command, "scp -f "):
+		in.ReadByte()
+		data, err := ioutil.ReadFile(arg)
+		if err != nil {
+			fmt.Fprintf(channel, "\x01scp: %s: No such file or directory\n", arg)
+			return 1
+		}
+		fmt.Fprintf(channel, "C0644 %d %s\n", len(data), filepath.Base(arg))
+		in.ReadByte()
+		channel.Write(append(data, 0))
+		in.ReadByte()
+		return 0
+	case strings.HasPrefix(command, "scp -t "):
+		channel.Write([]byte{0})
+		header, _ := in.ReadString('\n')
+		parts := strings.SplitN(strings.TrimSpace(header), " ", 3)
+		size, _ := strconv.Atoi(parts[1])
+		channel.Write([]byte{0})
+		data := make([]byte, size+1)
+		io.ReadFull(in, data)
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			arg = filepath.Join(arg, parts[2])
+		}
+		ioutil.WriteFile(arg, data[:size], 0644)
+		channel.Write([]byte{0})
+		return 0
+	}
+	return 127
+}
+
+func TestTransfer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	content := bytes.Repeat([]byte("system.cfg\n"), 1000)
+	local := filepath.Join(dir, "system.cfg")
+	if err := ioutil.WriteFile(local, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, method := range []string{SFTP, SCP} {
+		server := newTestServer(t)
+		server.noSFTP = method == SCP
+		config, target := server.config()
+		client, err := config.Dial(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		remoteDir := filepath.Join(dir, method)
+		if err := os.Mkdir(remoteDir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.Open(local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var last int64
+		pushed, err := Push(client, file, remoteDir, func(done, total int64) { last = done })
+		file.Close()
+		if err != nil {
+			t.Fatalf("Push() over %s: %v", method, err)
+		}
+		if pushed.Method != method || pushed.Verified != "sha256sum" || last != int64(len(content)) {
+			t.Errorf("Push() = %+v with %d bytes of progress, want %s verified by sha256sum and %d bytes", pushed,
+				last, method, len(content))
+		}
+
+		var buf bytes.Buffer
+		pulled, err := Pull(client, filepath.Join(remoteDir, "system.cfg"), &buf, nil)
+		if err != nil {
+			t.Fatalf("Pull() over %s: %v", method, err)
+		}
+		if !bytes.Equal(buf.Bytes(), content) || pulled.SHA256 != pushed.SHA256 || pulled.Size != pushed.Size {
+			t.Errorf("Pull() over %s = %+v, want the file pushed", method, pulled)
+		}
+
+		if _, err := Pull(client, filepath.Join(remoteDir, "missing"), ioutil.Discard, nil); err == nil {
+			t.Errorf("Pull() over %s of a missing file did not fail", method)
+		}
+		client.Close()
+		server.Close()
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	if got, want := ShellQuote("/tmp/it's here"), `'/tmp/it'\''s here'`; got != want {
+		t.Errorf("ShellQuote() = %s, want %s", got, want)
+	}
+}
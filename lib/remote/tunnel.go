@@ -0,0 +1,351 @@
+package remote
+
+import (
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The address forwarded ports listen on when a Forward does not give one, as with ssh.
+const defaultBindAddress = "127.0.0.1"
+
+// Forward is a port forwarded through a device: connections to Listen are made to Connect from the other end of
+// the SSH connection. Connect is empty for a SOCKS proxy, where each connection says where it is going.
+type Forward struct {
+	Listen  string
+	Connect string
+}
+
+func (f Forward) String() string {
+	if f.Connect == "" {
+		return f.Listen + " (SOCKS)"
+	}
+	return f.Listen + " -> " + f.Connect
+}
+
+// ParseForward parses a forward given as to ssh -L or -R, [BIND_ADDRESS:]PORT:HOST:HOSTPORT, where the addresses may
+// be IPv6 in brackets e.g. 8080:[fd00::5]:80.
+func ParseForward(spec string) (Forward, error) {
+	fields := splitAddress(spec)
+	switch len(fields) {
+	case 3:
+		fields = append([]string{defaultBindAddress}, fields...)
+	case 4:
+	default:
+		return Forward{}, fmt.Errorf("remote: invalid forward %q, expected [BIND_ADDRESS:]PORT:HOST:HOSTPORT", spec)
+	}
+	for _, port := range []string{fields[1], fields[3]} {
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return Forward{}, fmt.Errorf("remote: invalid port %q in forward %q", port, spec)
+		}
+	}
+	return Forward{Listen: net.JoinHostPort(fields[0], fields[1]), Connect: net.JoinHostPort(fields[2], fields[3])},
+		nil
+}
+
+// ParseDynamic parses a SOCKS proxy given as to ssh -D, [BIND_ADDRESS:]PORT.
+func ParseDynamic(spec string) (Forward, error) {
+	fields := splitAddress(spec)
+	switch len(fields) {
+	case 1:
+		fields = append([]string{defaultBindAddress}, fields...)
+	case 2:
+	default:
+		return Forward{}, fmt.Errorf("remote: invalid SOCKS proxy %q, expected [BIND_ADDRESS:]PORT", spec)
+	}
+	if _, err := strconv.ParseUint(fields[1], 10, 16); err != nil {
+		return Forward{}, fmt.Errorf("remote: invalid port %q in SOCKS proxy %q", fields[1], spec)
+	}
+	return Forward{Listen: net.JoinHostPort(fields[0], fields[1])}, nil
+}
+
+// splitAddress splits spec at the colons which are not inside brackets, removing the brackets.
+func splitAddress(spec string) []string {
+	var fields []string
+	depth, start := 0, 0
+	for i, r := range spec {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ':':
+			if depth == 0 {
+				fields = append(fields, spec[start:i])
+				start = i + 1
+			}
+		}
+	}
+	fields = append(fields, spec[start:])
+	for i, field := range fields {
+		fields[i] = strings.TrimSuffix(strings.TrimPrefix(field, "["), "]")
+	}
+	return fields
+}
+
+// Tunnel forwards the connections accepted by a listener at one end of an SSH connection to the other.
+type Tunnel struct {
+	Forward Forward
+
+	// Errors, if not nil, is told of the connections which could not be forwarded.
+	Errors func(error)
+
+	listener net.Listener
+	dial     func(addr string) (net.Conn, error)
+	socks    bool
+
+	mu     sync.Mutex
+	conns  map[net.Conn]bool
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// LocalForward listens on f.Listen locally and forwards connections to f.Connect from the device, as ssh -L.
+func LocalForward(client *ssh.Client, f Forward) (*Tunnel, error) {
+	listener, err := net.Listen("tcp", f.Listen)
+	if err != nil {
+		return nil, err
+	}
+	return newTunnel(f, listener, dialer(client), false), nil
+}
+
+// RemoteForward listens on f.Listen on the device and forwards connections to f.Connect from here, as ssh -R.
+func RemoteForward(client *ssh.Client, f Forward) (*Tunnel, error) {
+	listener, err := client.Listen("tcp", f.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("remote: the device refused to listen on %s: %v", f.Listen, err)
+	}
+	dial := func(addr string) (net.Conn, error) { return net.DialTimeout("tcp", addr, DefaultDialTimeout) }
+	return newTunnel(f, listener, dial, false), nil
+}
+
+// DynamicForward runs a SOCKS5 proxy on f.Listen locally whose connections are made from the device, as ssh -D.
+func DynamicForward(client *ssh.Client, f Forward) (*Tunnel, error) {
+	listener, err := net.Listen("tcp", f.Listen)
+	if err != nil {
+		return nil, err
+	}
+	return newTunnel(f, listener, dialer(client), true), nil
+}
+
+func dialer(client *ssh.Client) func(string) (net.Conn, error) {
+	return func(addr string) (net.Conn, error) { return client.Dial("tcp", addr) }
+}
+
+func newTunnel(f Forward, listener net.Listener, dial func(string) (net.Conn, error), socks bool) *Tunnel {
+	return &Tunnel{Forward: f, listener: listener, dial: dial, socks: socks, conns: make(map[net.Conn]bool)}
+}
+
+// Addr is the address the tunnel is listening on, which tells the port chosen when f.Listen had port 0.
+func (t *Tunnel) Addr() net.Addr {
+	return t.listener.Addr()
+}
+
+// Serve forwards connections until the tunnel is closed, returning nil, or the listener fails.
+func (t *Tunnel) Serve() error {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			t.mu.Lock()
+			closed := t.closed
+			t.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		if !t.track(conn) {
+			conn.Close()
+			return nil
+		}
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			defer t.untrack(conn)
+			if err := t.forward(conn); err != nil && t.Errors != nil {
+				t.Errors(fmt.Errorf("remote: %s: %v", t.Forward, err))
+			}
+		}()
+	}
+}
+
+// Close stops the tunnel listening and closes the connections being forwarded, waiting for them to finish.
+func (t *Tunnel) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	err := t.listener.Close()
+	for conn := range t.conns {
+		conn.Close()
+	}
+	t.mu.Unlock()
+	t.wg.Wait()
+	return err
+}
+
+// track adds conn to those closed along with the tunnel, reporting false when it is already closed.
+func (t *Tunnel) track(conn net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return false
+	}
+	t.conns[conn] = true
+	return true
+}
+
+func (t *Tunnel) untrack(conn net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.conns, conn)
+	conn.Close()
+}
+
+// forward connects conn to the far end of the tunnel and copies between them until both have finished.
+func (t *Tunnel) forward(conn net.Conn) error {
+	addr := t.Forward.Connect
+	if t.socks {
+		var err error
+		if addr, err = socksRequest(conn); err != nil {
+			return err
+		}
+	}
+	far, err := t.dial(addr)
+	if t.socks {
+		reply := byte(socksSucceeded)
+		if err != nil {
+			reply = socksHostUnreachable
+		}
+		if _, werr := conn.Write([]byte{socksVersion, reply, 0, socksIPv4, 0, 0, 0, 0, 0, 0}); err == nil {
+			err = werr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %v", addr, err)
+	}
+	if !t.track(far) {
+		far.Close()
+		return nil
+	}
+	defer t.untrack(far)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		pipe(far, conn)
+	}()
+	pipe(conn, far)
+	wg.Wait()
+	return nil
+}
+
+// pipe copies from src to dst, then closes dst for writing so the end of the stream is passed on.
+func pipe(dst, src net.Conn) {
+	io.Copy(dst, src)
+	if c, ok := dst.(interface {
+		CloseWrite() error
+	}); ok {
+		c.CloseWrite()
+	} else {
+		dst.Close()
+	}
+}
+
+// The parts of SOCKS5 (RFC 1928) the proxy uses.
+const (
+	socksVersion         = 5
+	socksNoAuth          = 0
+	socksNoMethods       = 0xff
+	socksConnect         = 1
+	socksIPv4            = 1
+	socksDomain          = 3
+	socksIPv6            = 4
+	socksSucceeded       = 0
+	socksHostUnreachable = 4
+	socksBadCommand      = 7
+	socksBadAddress      = 8
+)
+
+// socksRequest negotiates a SOCKS5 CONNECT without authentication with conn, returning the address asked for.
+func socksRequest(conn net.Conn) (string, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	if header[0] != socksVersion {
+		return "", fmt.Errorf("not a SOCKS5 client, version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+	if !strings.ContainsRune(string(methods), socksNoAuth) {
+		conn.Write([]byte{socksVersion, socksNoMethods})
+		return "", fmt.Errorf("the SOCKS client requires authentication")
+	}
+	if _, err := conn.Write([]byte{socksVersion, socksNoAuth}); err != nil {
+		return "", err
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return "", err
+	}
+	if request[1] != socksConnect {
+		conn.Write([]byte{socksVersion, socksBadCommand, 0, socksIPv4, 0, 0, 0, 0, 0, 0})
+		return "", fmt.Errorf("unsupported SOCKS command %d, only CONNECT is", request[1])
+	}
+	var host string
+	switch request[3] {
+	case socksIPv4, socksIPv6:
+		ip := make(net.IP, 4)
+		if request[3] == socksIPv6 {
+			ip = make(net.IP, 16)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case socksDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return "", err
+		}
+		name := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return "", err
+		}
+		host = string(name)
+	default:
+		conn.Write([]byte{socksVersion, socksBadAddress, 0, socksIPv4, 0, 0, 0, 0, 0, 0})
+		return "", fmt.Errorf("unsupported SOCKS address type %d", request[3])
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// KeepAlive sends a keepalive request on client every interval until one fails, when it closes client so that
+// whatever is waiting on the connection learns it has gone.
+func KeepAlive(client *ssh.Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+			client.Close()
+			return
+		}
+	}
+}
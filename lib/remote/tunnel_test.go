@@ -0,0 +1,277 @@
+package remote
+
+import (
+	"encoding/binary"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// directTCPIP makes the connection asked for by a direct-tcpip channel, as for ssh -L.
+func directTCPIP(nc ssh.NewChannel) {
+	var payload struct {
+		Host       string
+		Port       uint32
+		OriginAddr string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(nc.ExtraData(), &payload); err != nil {
+		nc.Reject(ssh.Prohibited, err.Error())
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+	if err != nil {
+		nc.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := nc.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	forwardChannel(channel, conn)
+}
+
+// globalRequests listens as asked for by tcpip-forward requests, as for ssh -R, until the connection is closed.
+func globalRequests(sconn *ssh.ServerConn, requests <-chan *ssh.Request) {
+	for req := range requests {
+		if req.Type != "tcpip-forward" {
+			req.Reply(false, nil)
+			continue
+		}
+		var payload struct {
+			Addr string
+			Port uint32
+		}
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		listener, err := net.Listen("tcp", net.JoinHostPort(payload.Addr, strconv.Itoa(int(payload.Port))))
+		if err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		port := uint32(listener.Addr().(*net.TCPAddr).Port)
+		req.Reply(true, ssh.Marshal(struct{ Port uint32 }{port}))
+		go func() {
+			sconn.Wait()
+			listener.Close()
+		}()
+		go func(addr string) {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				origin := conn.RemoteAddr().(*net.TCPAddr)
+				channel, requests, err := sconn.OpenChannel("forwarded-tcpip", ssh.Marshal(struct {
+					Addr       string
+					Port       uint32
+					OriginAddr string
+					OriginPort uint32
+				}{addr, port, origin.IP.String(), uint32(origin.Port)}))
+				if err != nil {
+					conn.Close()
+					continue
+				}
+				go ssh.DiscardRequests(requests)
+				go forwardChannel(channel, conn)
+			}
+		}(payload.Addr)
+	}
+}
+
+// forwardChannel copies between channel and conn, passing on the end of each stream, until both have ended.
+func forwardChannel(channel ssh.Channel, conn net.Conn) {
+	done := make(chan bool)
+	go func() {
+		io.Copy(channel, conn)
+		channel.CloseWrite()
+		close(done)
+	}()
+	io.Copy(conn, channel)
+	conn.(*net.TCPConn).CloseWrite()
+	<-done
+	conn.Close()
+	channel.Close()
+}
+
+// newEchoServer listens for connections which send back whatever they are sent.
+func newEchoServer(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	return listener
+}
+
+// echo sends a message over conn, closing it for writing, and checks it all comes back.
+func echo(t *testing.T, name string, conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.WriteString(conn, "hello"); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	conn.(*net.TCPConn).CloseWrite()
+	reply, err := ioutil.ReadAll(conn)
+	if err != nil || string(reply) != "hello" {
+		t.Errorf("%s echoed %q, %v, want hello", name, reply, err)
+	}
+}
+
+func dialTestServer(t *testing.T) (*testServer, *ssh.Client) {
+	server := newTestServer(t)
+	config, target := server.config()
+	client, err := config.Dial(target)
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return server, client
+}
+
+func TestParseForward(t *testing.T) {
+	tests := []struct {
+		spec string
+		want Forward
+	}{
+		{"8080:10.0.0.5:80", Forward{"127.0.0.1:8080", "10.0.0.5:80"}},
+		{"0.0.0.0:8080:10.0.0.5:80", Forward{"0.0.0.0:8080", "10.0.0.5:80"}},
+		{"8080:[fd00::5]:80", Forward{"127.0.0.1:8080", "[fd00::5]:80"}},
+		{"[::1]:8080:nas.lan:443", Forward{"[::1]:8080", "nas.lan:443"}},
+	}
+	for _, test := range tests {
+		if got, err := ParseForward(test.spec); err != nil || got != test.want {
+			t.Errorf("ParseForward(%q) = %v, %v, want %v", test.spec, got, err, test.want)
+		}
+	}
+	for _, spec := range []string{"8080", "8080:10.0.0.5", "http:10.0.0.5:80", "8080:10.0.0.5:99999"} {
+		if _, err := ParseForward(spec); err == nil {
+			t.Errorf("ParseForward(%q) did not fail", spec)
+		}
+	}
+
+	if got, err := ParseDynamic("1080"); err != nil || got != (Forward{Listen: "127.0.0.1:1080"}) {
+		t.Errorf("ParseDynamic(1080) = %v, %v, want 127.0.0.1:1080", got, err)
+	}
+	if _, err := ParseDynamic("socks"); err == nil {
+		t.Error("ParseDynamic(socks) did not fail")
+	}
+}
+
+func TestLocalForward(t *testing.T) {
+	server, client := dialTestServer(t)
+	defer server.Close()
+	defer client.Close()
+	backend := newEchoServer(t)
+	defer backend.Close()
+
+	tunnel, err := LocalForward(client, Forward{"127.0.0.1:0", backend.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error)
+	go func() { served <- tunnel.Serve() }()
+
+	conn, err := net.Dial("tcp", tunnel.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo(t, "the local forward", conn)
+
+	// Closing the tunnel closes the connections still open through it too.
+	open, err := net.Dial("tcp", tunnel.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(open, "hi")
+	buf := make([]byte, 2)
+	io.ReadFull(open, buf)
+	tunnel.Close()
+	open.SetDeadline(time.Now().Add(5 * time.Second))
+	if n, err := open.Read(buf); err != io.EOF {
+		t.Errorf("read after Close() = %d, %v, want EOF", n, err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve() = %v after Close(), want nil", err)
+	}
+}
+
+func TestRemoteForward(t *testing.T) {
+	server, client := dialTestServer(t)
+	defer server.Close()
+	defer client.Close()
+	backend := newEchoServer(t)
+	defer backend.Close()
+
+	tunnel, err := RemoteForward(client, Forward{"127.0.0.1:0", backend.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tunnel.Close()
+	go tunnel.Serve()
+
+	// The test server listens for the device on this host, at the port it chose.
+	conn, err := net.Dial("tcp", tunnel.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo(t, "the remote forward", conn)
+}
+
+func TestDynamicForward(t *testing.T) {
+	server, client := dialTestServer(t)
+	defer server.Close()
+	defer client.Close()
+	backend := newEchoServer(t)
+	defer backend.Close()
+	port := make([]byte, 2)
+	binary.BigEndian.PutUint16(port, uint16(backend.Addr().(*net.TCPAddr).Port))
+
+	tunnel, err := DynamicForward(client, Forward{Listen: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tunnel.Close()
+	go tunnel.Serve()
+
+	for _, address := range [][]byte{
+		{socksIPv4, 127, 0, 0, 1},
+		append([]byte{socksDomain, 9}, "localhost"...),
+	} {
+		conn, err := net.Dial("tcp", tunnel.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		conn.Write([]byte{socksVersion, 1, socksNoAuth})
+		method := make([]byte, 2)
+		if _, err := io.ReadFull(conn, method); err != nil || method[1] != socksNoAuth {
+			t.Fatalf("SOCKS method = %v, %v, want no authentication", method, err)
+		}
+		request := append([]byte{socksVersion, socksConnect, 0}, address...)
+		conn.Write(append(request, port...))
+		reply := make([]byte, 10)
+		if _, err := io.ReadFull(conn, reply); err != nil || reply[1] != socksSucceeded {
+			t.Fatalf("SOCKS reply = %v, %v, want success", reply, err)
+		}
+		echo(t, "the SOCKS proxy", conn)
+	}
+}
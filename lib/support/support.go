@@ -0,0 +1,117 @@
+// Package support builds the support bundles Ubiquiti ask for when a ticket is opened about a device: the output of
+// diagnostic commands run on the device along with what the Controller knows of it, in a tar.gz with the secrets
+// such as the inform key and WPA passphrases redacted.
+package support
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"path"
+	"regexp"
+	"time"
+)
+
+// Redacted replaces the value of every secret in a bundle.
+const Redacted = "REDACTED"
+
+// Command is a diagnostic command run on a device, whose output is put in the bundle as Name.
+type Command struct {
+	Name string
+	Run  string
+}
+
+// The commands run on every type of device.
+var commonCommands = []Command{
+	{"info.txt", "mca-cli-op info"},
+	{"mca-dump.json", "mca-dump"},
+	{"messages.txt", "cat /var/log/messages"},
+	{"ifconfig.txt", "ifconfig"},
+	{"dmesg.txt", "dmesg"},
+}
+
+// The commands run on devices of a type as well as the common ones.
+var typeCommands = map[string][]Command{
+	"uap": {
+		{"iwconfig.txt", "iwconfig"},
+	},
+	"usw": {
+		{"swctrl-port.txt", "swctrl port show"},
+		{"swctrl-poe.txt", "swctrl poe show"},
+	},
+	"ugw": {
+		{"routes.txt", "ip route"},
+		{"interfaces.txt", "show interfaces"},
+	},
+}
+
+// Commands returns the commands to run on a device of the given type, uap, usw or ugw.
+func Commands(deviceType string) []Command {
+	commands := append([]Command(nil), commonCommands...)
+	return append(commands, typeCommands[deviceType]...)
+}
+
+// A name holding a secret, in JSON, key=value configuration such as system.cfg and hostapd.conf, or key: value.
+const secretName = `[\w.-]*(?:authkey|passphrase|password|passwd|psk|secret|iapp_key|private_key|token|` +
+	`vwirekey)[\w.-]*`
+
+var (
+	jsonSecret = regexp.MustCompile(`(?i)("` + secretName + `"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	lineSecret = regexp.MustCompile(`(?im)^(\s*` + secretName + `\s*[=:]\s*)(?:"(?:[^"\\\n]|\\.)*"|'[^'\n]*'|\S.*)$`)
+	// key=value configuration held in a JSON string e.g. "mgmt_cfg":"...\nmgmt.authkey=...\n...", whose lines are
+	// separated by an escaped \n.
+	embeddedSecret = regexp.MustCompile(`(?i)((?:"|\\n)` + secretName + ` *= *)(?:[^"\\]|\\[^n])+`)
+)
+
+// Redact replaces the values of the secrets in data, JSON or the text output of a command, with Redacted.
+func Redact(data []byte) []byte {
+	data = jsonSecret.ReplaceAll(data, []byte(`$1"`+Redacted+`"`))
+	data = embeddedSecret.ReplaceAll(data, []byte("${1}"+Redacted))
+	return lineSecret.ReplaceAllFunc(data, func(line []byte) []byte {
+		m := lineSecret.FindSubmatchIndex(line)
+		value := line[m[3]:]
+		// A quoted value keeps its quotes, so the file still reads as it did.
+		if q := value[0]; (q == '"' || q == '\'') && len(value) > 1 && value[len(value)-1] == q {
+			return []byte(string(line[:m[3]]) + string(q) + Redacted + string(q))
+		}
+		return []byte(string(line[:m[3]]) + Redacted)
+	})
+}
+
+// Writer writes a bundle as a tar.gz of files in a single directory, redacting each.
+type Writer struct {
+	dir string
+	gz  *gzip.Writer
+	tar *tar.Writer
+	now time.Time
+}
+
+// NewWriter returns a Writer of a bundle to w whose files are in dir.
+func NewWriter(w io.Writer, dir string) *Writer {
+	gz := gzip.NewWriter(w)
+	return &Writer{dir: dir, gz: gz, tar: tar.NewWriter(gz), now: time.Now()}
+}
+
+// Add adds the file name, with its secrets redacted, to the bundle.
+func (w *Writer) Add(name string, data []byte) error {
+	data = Redact(data)
+	header := &tar.Header{
+		Name:    path.Join(w.dir, name),
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: w.now,
+	}
+	if err := w.tar.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := w.tar.Write(data)
+	return err
+}
+
+// Close finishes the bundle, without closing the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.tar.Close(); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
@@ -0,0 +1,94 @@
+package support
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`{"inform_authkey": "0123abcd", "name": "uap1"}`, `{"inform_authkey": "REDACTED", "name": "uap1"}`},
+		{`{"x_passphrase":"a \"quoted\" key","x_ssh_password":"ubnt"}`,
+			`{"x_passphrase":"REDACTED","x_ssh_password":"REDACTED"}`},
+		{`{"x_ssh_auth_password_enabled": true}`, `{"x_ssh_auth_password_enabled": true}`},
+		{"aaa.1.wpa.psk=hunter22\nwireless.1.ssid=Office", "aaa.1.wpa.psk=REDACTED\nwireless.1.ssid=Office"},
+		{"  wpa_passphrase = hunter22\n", "  wpa_passphrase = REDACTED\n"},
+		{"radius_secret: s3cret", "radius_secret: REDACTED"},
+		{`wpa_passphrase="secret123"`, `wpa_passphrase="REDACTED"`},
+		{`password: "quoted pw"`, `password: "REDACTED"`},
+		{`  psk = 'it''s'` + "\nssid=Office", `  psk = 'REDACTED'` + "\nssid=Office"},
+		{`secret="unterminated`, `secret=REDACTED`},
+		{`{"mgmt_cfg":"mgmt.is_default=false\nmgmt.authkey=deadbeef\nmgmt.cfgversion=abc"}`,
+			`{"mgmt_cfg":"mgmt.is_default=false\nmgmt.authkey=REDACTED\nmgmt.cfgversion=abc"}`},
+		{`{"wlan_cfg":"wpa.psk=hunter\"22\nwireless.1.ssid=Office","name":"uap1"}`,
+			`{"wlan_cfg":"wpa.psk=REDACTED\nwireless.1.ssid=Office","name":"uap1"}`},
+		{`{"x_vwirekey": "0123abcd"}`, `{"x_vwirekey": "REDACTED"}`},
+		{"mesh.vwirekey=0123abcd", "mesh.vwirekey=REDACTED"},
+		{"eth0      Link encap:Ethernet  HWaddr 80:2A:A8:00:00:01", "eth0      Link encap:Ethernet  HWaddr 80:2A:A8:00:00:01"},
+	}
+	for _, test := range tests {
+		if got := string(Redact([]byte(test.in))); got != test.want {
+			t.Errorf("Redact(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	names := func(commands []Command) string {
+		var names []string
+		for _, c := range commands {
+			names = append(names, c.Name)
+		}
+		return strings.Join(names, " ")
+	}
+	if got := names(Commands("uap")); !strings.Contains(got, "mca-dump.json") || !strings.Contains(got, "iwconfig.txt") {
+		t.Errorf("Commands(uap) = %s, want the common commands and iwconfig", got)
+	}
+	if got := names(Commands("usw")); strings.Contains(got, "iwconfig") {
+		t.Errorf("Commands(usw) = %s, want no iwconfig", got)
+	}
+	if got := names(Commands("unknown")); got != names(commonCommands) {
+		t.Errorf("Commands(unknown) = %s, want %s", got, names(commonCommands))
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, "support-uap1")
+	if err := w.Add("device.json", []byte(`{"inform_authkey": "0123abcd"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add("dmesg.txt", []byte("booted\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := tar.NewReader(gz)
+	files := make(map[string]string)
+	for {
+		header, err := r.Next()
+		if err != nil {
+			break
+		}
+		data, _ := ioutil.ReadAll(r)
+		files[header.Name] = string(data)
+	}
+	if got := files["support-uap1/device.json"]; got != `{"inform_authkey": "REDACTED"}` {
+		t.Errorf("device.json = %q, want the inform key redacted", got)
+	}
+	if got := files["support-uap1/dmesg.txt"]; got != "booted\n" {
+		t.Errorf("dmesg.txt = %q, want booted", got)
+	}
+}
@@ -0,0 +1,190 @@
+// Package top builds the full screen dashboard of unified top, displaying the devices, busiest clients, latest
+// events and open alarms of a site and refreshing them on an interval.
+package top
+
+import (
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Data is everything the dashboard displays, fetched afresh on every refresh.
+type Data struct {
+	Devices []unified.Device
+	Clients []unified.User
+	Events  []unified.Event
+	Alarms  []unified.Alarm
+	Fetched time.Time
+	Err     error
+}
+
+// Actions are what can be done to the selected device from the dashboard.
+type Actions struct {
+	Locate  func(mac string, on bool) error
+	Restart func(mac string) error
+}
+
+// Table is a pane of the dashboard as rows of cells under a header.
+type Table struct {
+	Title  string
+	Header []string
+	Rows   [][]string
+}
+
+// Devices tabulates the devices, ordered by name, giving their state, clients, uptime, load and temperature.
+func Devices(devices []unified.Device) Table {
+	sorted := make([]unified.Device, len(devices))
+	copy(sorted, devices)
+	SortDevices(sorted)
+
+	t := Table{Title: "Devices", Header: []string{"NAME", "TYPE", "STATE", "CLIENTS", "UPTIME", "CPU", "MEM", "TEMP"}}
+	for _, d := range sorted {
+		temp := ""
+		if d.GeneralTemperature > 0 {
+			temp = fmt.Sprintf("%d°C", d.GeneralTemperature)
+		}
+		if d.IsOverHeating {
+			temp += "!"
+		}
+		t.Rows = append(t.Rows, []string{
+			deviceName(d),
+			d.Type,
+			unified.StateName(d.State),
+			strconv.Itoa(d.NumSta),
+			uptime(d.Uptime),
+			percent(d.SystemStats.CPU),
+			percent(d.SystemStats.Mem),
+			temp,
+		})
+	}
+	return t
+}
+
+// SortDevices orders devices by name, the order the Devices pane lists them in.
+func SortDevices(devices []unified.Device) {
+	sort.SliceStable(devices, func(i, j int) bool {
+		return strings.ToLower(deviceName(devices[i])) < strings.ToLower(deviceName(devices[j]))
+	})
+}
+
+// TopClients tabulates the n clients with the highest throughput, busiest first.
+func TopClients(clients []unified.User, n int) Table {
+	sorted := make([]unified.User, len(clients))
+	copy(sorted, clients)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].RxBytesRate+sorted[i].TxBytesRate > sorted[j].RxBytesRate+sorted[j].TxBytesRate
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+
+	t := Table{Title: "Top Clients", Header: []string{"NAME", "IP", "RX", "TX"}}
+	for _, c := range sorted {
+		name := c.Name
+		if name == "" {
+			name = c.Hostname
+		}
+		if name == "" {
+			name = c.MacAddress
+		}
+		t.Rows = append(t.Rows, []string{
+			name,
+			c.IP,
+			unified.FormatRate(float64(c.RxBytesRate)),
+			unified.FormatRate(float64(c.TxBytesRate)),
+		})
+	}
+	return t
+}
+
+// Events tabulates the events, newest first.
+func Events(events []unified.Event) Table {
+	sorted := make([]unified.Event, len(events))
+	copy(sorted, events)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].DateTime.After(sorted[j].DateTime.Time) })
+
+	t := Table{Title: "Events", Header: []string{"WHEN", "MESSAGE"}}
+	for _, e := range sorted {
+		t.Rows = append(t.Rows, []string{e.DateTime.Ago(), e.Message})
+	}
+	return t
+}
+
+// Alarms tabulates the alarms which have not been archived, newest first.
+func Alarms(alarms []unified.Alarm) Table {
+	var open []unified.Alarm
+	for _, a := range alarms {
+		if !a.Archived {
+			open = append(open, a)
+		}
+	}
+	sort.SliceStable(open, func(i, j int) bool { return open[i].When().After(open[j].When()) })
+
+	t := Table{Title: "Alarms", Header: []string{"WHEN", "MESSAGE"}}
+	for _, a := range open {
+		t.Rows = append(t.Rows, []string{unified.Timestamp{Time: a.When()}.Ago(), a.Message})
+	}
+	return t
+}
+
+// Ports tabulates the port table of a switch.
+func Ports(device unified.Device) Table {
+	t := Table{
+		Title:  "Ports of " + deviceName(device),
+		Header: []string{"PORT", "NAME", "LINK", "POE", "RX", "TX", "ERRORS", "UPLINK"},
+	}
+	for _, p := range device.Ports {
+		link := "down"
+		if p.IsUp {
+			link = fmt.Sprintf("%d", p.PortSpeed)
+			if p.IsFullDuplexEnabled {
+				link += " FD"
+			} else {
+				link += " HD"
+			}
+		}
+		poe := ""
+		if p.IsPOEEnabled {
+			poe = p.POEPower + "W"
+		}
+		uplink := ""
+		if p.IsUplink {
+			uplink = "yes"
+		}
+		t.Rows = append(t.Rows, []string{
+			strconv.Itoa(p.PortIdx),
+			p.Name,
+			link,
+			poe,
+			unified.FormatRate(float64(p.RXBytesR)),
+			unified.FormatRate(float64(p.TXBytesR)),
+			strconv.FormatInt(p.RXErrors+p.TXErrors, 10),
+			uplink,
+		})
+	}
+	return t
+}
+
+func deviceName(d unified.Device) string {
+	if d.Name != "" {
+		return d.Name
+	}
+	return d.MacAddress
+}
+
+func uptime(seconds int64) string {
+	if seconds <= 0 {
+		return ""
+	}
+	return unified.HumanizeDuration(time.Duration(seconds) * time.Second)
+}
+
+func percent(n unified.Number) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.0f%%", float64(n))
+}
@@ -0,0 +1,46 @@
+package top
+
+import (
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"reflect"
+	"testing"
+)
+
+func TestDevices(t *testing.T) {
+	devices := []unified.Device{
+		{Name: "switch", Type: "usw", State: 1, NumSta: 4, Uptime: 90000, GeneralTemperature: 51, IsOverHeating: true,
+			SystemStats: unified.SystemStats{CPU: 12.4, Mem: 40}},
+		{MacAddress: "80:2a:a8:c6:63:67", Type: "uap", State: 0},
+	}
+	got := Devices(devices).Rows
+	want := [][]string{
+		{"80:2a:a8:c6:63:67", "uap", "disconnected", "0", "", "", "", ""},
+		{"switch", "usw", "connected", "4", "1d", "12%", "40%", "51°C!"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Devices() = %q, want %q", got, want)
+	}
+}
+
+func TestTopClients(t *testing.T) {
+	clients := []unified.User{
+		{Name: "quiet", RxBytesRate: 10},
+		{Hostname: "busy", RxBytesRate: 1000, TxBytesRate: 500},
+		{MacAddress: "00:11:22:33:44:55", TxBytesRate: 100},
+	}
+	var got []string
+	for _, row := range TopClients(clients, 2).Rows {
+		got = append(got, row[0])
+	}
+	if want := []string{"busy", "00:11:22:33:44:55"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("TopClients() = %q, want %q", got, want)
+	}
+}
+
+func TestAlarms(t *testing.T) {
+	alarms := []unified.Alarm{{Message: "archived", Archived: true}, {Message: "open"}}
+	rows := Alarms(alarms).Rows
+	if len(rows) != 1 || rows[0][1] != "open" {
+		t.Errorf("Alarms() = %q, want only the open alarm", rows)
+	}
+}
@@ -0,0 +1,319 @@
+package top
+
+import (
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"fmt"
+	"github.com/nsf/termbox-go"
+	"time"
+)
+
+// The number of clients listed in the Top Clients pane.
+const topClients = 20
+
+const helpLine = "↑/↓ select  enter ports  l locate  r restart  space refresh  q quit"
+
+// Dashboard is the full screen UI of unified top.
+type Dashboard struct {
+	title    string
+	fetch    func() *Data
+	actions  Actions
+	interval time.Duration
+
+	data     *Data
+	devices  []unified.Device // in the order the Devices pane lists them
+	selected int
+	ports    bool // whether the port table of the selected device is displayed
+	offset   int  // of the port table, when it does not fit the screen
+	confirm  string
+	onYes    func()
+	status   string
+	locating map[string]bool
+
+	fetching bool
+	fetched  chan *Data
+	messages chan string
+}
+
+// New creates a dashboard titled title, displaying what fetch returns every interval.
+func New(title string, fetch func() *Data, actions Actions, interval time.Duration) *Dashboard {
+	return &Dashboard{
+		title:    title,
+		fetch:    fetch,
+		actions:  actions,
+		interval: interval,
+		data:     &Data{},
+		locating: make(map[string]bool),
+		fetched:  make(chan *Data, 1),
+		messages: make(chan string, 1),
+	}
+}
+
+// Run takes over the terminal until the user quits, restoring it before returning.
+func (d *Dashboard) Run() error {
+	if err := termbox.Init(); err != nil {
+		return err
+	}
+	defer termbox.Close()
+
+	events := make(chan termbox.Event)
+	go func() {
+		for {
+			events <- termbox.PollEvent()
+		}
+	}()
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	d.refresh()
+	for {
+		d.draw()
+		select {
+		case ev := <-events:
+			switch ev.Type {
+			case termbox.EventError:
+				return ev.Err
+			case termbox.EventKey:
+				if d.key(ev) {
+					return nil
+				}
+			}
+		case <-ticker.C:
+			d.refresh()
+		case data := <-d.fetched:
+			d.fetching = false
+			d.update(data)
+		case msg := <-d.messages:
+			d.status = msg
+		}
+	}
+}
+
+// refresh fetches the data in the background, unless the previous fetch has yet to finish.
+func (d *Dashboard) refresh() {
+	if d.fetching {
+		return
+	}
+	d.fetching = true
+	go func() { d.fetched <- d.fetch() }()
+}
+
+func (d *Dashboard) update(data *Data) {
+	if data.Err != nil {
+		d.data.Err = data.Err
+		return
+	}
+	var mac string
+	if d.selected < len(d.devices) {
+		mac = d.devices[d.selected].MacAddress
+	}
+	d.data = data
+	d.devices = make([]unified.Device, len(data.Devices))
+	copy(d.devices, data.Devices)
+	SortDevices(d.devices)
+
+	// Keep the same device selected as the list changes around it.
+	d.selected = 0
+	for i, dev := range d.devices {
+		if dev.MacAddress == mac {
+			d.selected = i
+		}
+	}
+}
+
+// key handles a key press, reporting whether to quit.
+func (d *Dashboard) key(ev termbox.Event) bool {
+	if d.confirm != "" {
+		if ev.Ch == 'y' || ev.Ch == 'Y' {
+			d.onYes()
+		} else {
+			d.status = "Cancelled"
+		}
+		d.confirm, d.onYes = "", nil
+		return false
+	}
+
+	switch {
+	case ev.Key == termbox.KeyCtrlC || ev.Ch == 'q':
+		return true
+	case ev.Key == termbox.KeyEsc:
+		if !d.ports {
+			return true
+		}
+		d.ports = false
+	case ev.Key == termbox.KeyArrowUp || ev.Ch == 'k':
+		if d.ports {
+			d.offset = max(d.offset-1, 0)
+		} else {
+			d.selected = max(d.selected-1, 0)
+		}
+	case ev.Key == termbox.KeyArrowDown || ev.Ch == 'j':
+		if d.ports {
+			d.offset++
+		} else {
+			d.selected = max(min(d.selected+1, len(d.devices)-1), 0)
+		}
+	case ev.Key == termbox.KeyEnter:
+		if dev, ok := d.current(); ok {
+			if len(dev.Ports) == 0 {
+				d.status = deviceName(dev) + " has no port table"
+			} else {
+				d.ports, d.offset = true, 0
+			}
+		}
+	case ev.Key == termbox.KeySpace:
+		d.refresh()
+	case ev.Ch == 'l':
+		if dev, ok := d.current(); ok {
+			on := !d.locating[dev.MacAddress]
+			d.locating[dev.MacAddress] = on
+			d.run(func() error { return d.actions.Locate(dev.MacAddress, on) },
+				fmt.Sprintf("Locating %s %s", deviceName(dev), onOff(on)))
+		}
+	case ev.Ch == 'r':
+		if dev, ok := d.current(); ok {
+			d.confirm = fmt.Sprintf("Restart %s? (y/n)", deviceName(dev))
+			d.onYes = func() {
+				d.run(func() error { return d.actions.Restart(dev.MacAddress) }, "Restarting "+deviceName(dev))
+			}
+		}
+	}
+	return false
+}
+
+// run carries out an action in the background, displaying done or the error when it finishes.
+func (d *Dashboard) run(action func() error, done string) {
+	d.status = done + "..."
+	go func() {
+		if err := action(); err != nil {
+			d.messages <- "Error: " + err.Error()
+			return
+		}
+		d.messages <- done
+	}()
+}
+
+func (d *Dashboard) current() (unified.Device, bool) {
+	if d.selected >= len(d.devices) {
+		return unified.Device{}, false
+	}
+	return d.devices[d.selected], true
+}
+
+func (d *Dashboard) draw() {
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	w, h := termbox.Size()
+
+	header := d.title
+	if !d.data.Fetched.IsZero() {
+		header += "  refreshed " + d.data.Fetched.Format("15:04:05")
+	}
+	if d.data.Err != nil {
+		header += "  " + d.data.Err.Error()
+	}
+	text(0, 0, w, header, termbox.ColorBlack, termbox.ColorWhite)
+
+	footer, fg := helpLine, termbox.ColorDefault
+	switch {
+	case d.confirm != "":
+		footer, fg = d.confirm, termbox.ColorYellow|termbox.AttrBold
+	case d.status != "":
+		footer = d.status + "  |  " + helpLine
+	}
+	text(0, h-1, w, footer, fg, termbox.ColorDefault)
+
+	if dev, ok := d.current(); ok && d.ports {
+		drawTable(0, 1, w, h-2, Ports(dev), -1, d.offset)
+		termbox.Flush()
+		return
+	}
+
+	top := (h - 2) / 2
+	left := w * 3 / 5
+	drawTable(0, 1, left, top, Devices(d.devices), d.selected, 0)
+	drawTable(left+1, 1, w-left-1, top, TopClients(d.data.Clients, topClients), -1, 0)
+	drawTable(0, top+1, left, h-2-top, Events(d.data.Events), -1, 0)
+	drawTable(left+1, top+1, w-left-1, h-2-top, Alarms(d.data.Alarms), -1, 0)
+	termbox.Flush()
+}
+
+// drawTable draws t within the given box, highlighting the selected row and scrolling so it is in view, or
+// otherwise starting from row offset.
+func drawTable(x, y, w, h int, t Table, selected, offset int) {
+	if w <= 0 || h <= 2 {
+		return
+	}
+	text(x, y, w, fmt.Sprintf("%s (%d)", t.Title, len(t.Rows)), termbox.ColorCyan|termbox.AttrBold,
+		termbox.ColorDefault)
+
+	widths := make([]int, len(t.Header))
+	for i, head := range t.Header {
+		widths[i] = len([]rune(head))
+	}
+	for _, row := range t.Rows {
+		for i, cell := range row {
+			if n := len([]rune(cell)); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	line := func(cells []string) string {
+		var s string
+		for i, cell := range cells {
+			if i < len(cells)-1 {
+				cell = fmt.Sprintf("%-*s ", widths[i], cell)
+			}
+			s += cell
+		}
+		return s
+	}
+	text(x, y+1, w, line(t.Header), termbox.ColorDefault|termbox.AttrBold, termbox.ColorDefault)
+
+	visible := h - 2
+	if selected >= 0 {
+		offset = 0
+		if selected >= visible {
+			offset = selected - visible + 1
+		}
+	}
+	offset = max(min(offset, len(t.Rows)-visible), 0)
+	for i := 0; i < visible && offset+i < len(t.Rows); i++ {
+		fg, bg := termbox.ColorDefault, termbox.ColorDefault
+		if offset+i == selected {
+			fg, bg = termbox.ColorBlack, termbox.ColorGreen
+		}
+		text(x, y+2+i, w, line(t.Rows[offset+i]), fg, bg)
+	}
+}
+
+// text draws s at x, y, cut off or padded to w cells.
+func text(x, y, w int, s string, fg, bg termbox.Attribute) {
+	runes := []rune(s)
+	for i := 0; i < w; i++ {
+		ch := ' '
+		if i < len(runes) {
+			ch = runes[i]
+		}
+		termbox.SetCell(x+i, y, ch, fg, bg)
+	}
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
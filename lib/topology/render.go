@@ -0,0 +1,195 @@
+package topology
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The formats a topology can be rendered in.
+const (
+	Tree    = "tree"
+	DOT     = "dot"
+	Mermaid = "mermaid"
+	JSON    = "json"
+)
+
+// Formats lists the supported formats.
+var Formats = []string{Tree, DOT, Mermaid, JSON}
+
+// Render writes the graph below roots to w in the given format. highlight, if not nil, is applied to the problems
+// found with a link in the tree format e.g. to colour them.
+func Render(w io.Writer, roots []*Node, format string, highlight func(string) string) error {
+	switch format {
+	case Tree:
+		return renderTree(w, roots, highlight)
+	case DOT:
+		return renderDOT(w, roots)
+	case Mermaid:
+		return renderMermaid(w, roots)
+	case JSON:
+		b, err := json.MarshalIndent(roots, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	}
+	return fmt.Errorf("unknown topology format %q, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+func renderTree(w io.Writer, roots []*Node, highlight func(string) string) error {
+	if highlight == nil {
+		highlight = func(s string) string { return s }
+	}
+	var buf bytes.Buffer
+	var walk func(n *Node, prefix, branch, indent string)
+	walk = func(n *Node, prefix, branch, indent string) {
+		buf.WriteString(prefix + branch + n.Label())
+		if n.Link != nil {
+			if link := n.Link.String(); link != "" {
+				buf.WriteString(" [" + link + "]")
+			}
+			if len(n.Link.Warnings) > 0 {
+				buf.WriteString(" " + highlight("!! "+strings.Join(n.Link.Warnings, ", ")))
+			}
+		}
+		if len(n.BlockedPorts) > 0 {
+			buf.WriteString(" " + highlight("!! STP blocking ports "+joinInts(n.BlockedPorts)))
+		}
+		buf.WriteString("\n")
+		for i, c := range n.Children {
+			if i == len(n.Children)-1 {
+				walk(c, prefix+indent, "└── ", "    ")
+			} else {
+				walk(c, prefix+indent, "├── ", "│   ")
+			}
+		}
+	}
+	for _, r := range roots {
+		walk(r, "", "", "")
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func renderDOT(w io.Writer, roots []*Node) error {
+	var buf bytes.Buffer
+	buf.WriteString("digraph topology {\n")
+	buf.WriteString("    rankdir=TB;\n")
+	buf.WriteString("    node [shape=box, style=rounded];\n")
+	each(roots, nil, func(n, parent *Node) {
+		attrs := []string{"label=" + quote(nodeLines(n, `\n`))}
+		if n.IsClient() {
+			attrs = append(attrs, "shape=ellipse")
+		}
+		if len(n.BlockedPorts) > 0 {
+			attrs = append(attrs, "color=orange")
+		}
+		fmt.Fprintf(&buf, "    %s [%s];\n", quote(n.MacAddress), strings.Join(attrs, ", "))
+		if parent == nil {
+			return
+		}
+		var edge []string
+		if label := n.Link.String(); label != "" {
+			edge = append(edge, "label="+quote(label))
+		}
+		if n.Link.Wireless {
+			edge = append(edge, "style=dashed")
+		}
+		if len(n.Link.Warnings) > 0 {
+			edge = append(edge, "color=red", "penwidth=2", "xlabel="+quote(strings.Join(n.Link.Warnings, ", ")))
+		}
+		fmt.Fprintf(&buf, "    %s -> %s [%s];\n", quote(parent.MacAddress), quote(n.MacAddress), strings.Join(edge, ", "))
+	})
+	buf.WriteString("}\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func renderMermaid(w io.Writer, roots []*Node) error {
+	var buf bytes.Buffer
+	buf.WriteString("graph TD\n")
+	ids := make(map[*Node]string)
+	var warned, blocked []string
+	links := 0
+	each(roots, nil, func(n, parent *Node) {
+		id := fmt.Sprintf("n%d", len(ids))
+		ids[n] = id
+		open, close := "[", "]"
+		if n.IsClient() {
+			open, close = "(", ")"
+		}
+		fmt.Fprintf(&buf, "    %s%s\"%s\"%s\n", id, open, mermaidEscape(nodeLines(n, "<br/>")), close)
+		if len(n.BlockedPorts) > 0 {
+			blocked = append(blocked, id)
+		}
+		if parent == nil {
+			return
+		}
+		arrow := "-->"
+		if n.Link.Wireless {
+			arrow = "-.->"
+		}
+		label := n.Link.String()
+		if len(n.Link.Warnings) > 0 {
+			label = strings.TrimPrefix(label+", "+strings.Join(n.Link.Warnings, ", "), ", ")
+			warned = append(warned, fmt.Sprint(links))
+		}
+		if label != "" {
+			fmt.Fprintf(&buf, "    %s %s|\"%s\"| %s\n", ids[parent], arrow, mermaidEscape(label), id)
+		} else {
+			fmt.Fprintf(&buf, "    %s %s %s\n", ids[parent], arrow, id)
+		}
+		links++
+	})
+	if len(warned) > 0 {
+		fmt.Fprintf(&buf, "    linkStyle %s stroke:red,stroke-width:3px\n", strings.Join(warned, ","))
+	}
+	if len(blocked) > 0 {
+		fmt.Fprintf(&buf, "    style %s stroke:orange,stroke-width:3px\n", strings.Join(blocked, ","))
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// each calls fn with every node below roots, parents before their children.
+func each(nodes []*Node, parent *Node, fn func(n, parent *Node)) {
+	for _, n := range nodes {
+		fn(n, parent)
+		each(n.Children, n, fn)
+	}
+}
+
+// nodeLines describes a node over several lines separated by sep, for the graphical formats.
+func nodeLines(n *Node, sep string) string {
+	lines := []string{n.Name}
+	details := strings.TrimSpace(n.Type + " " + n.Model)
+	if n.IP != "" {
+		details += " " + n.IP
+	}
+	lines = append(lines, details)
+	if len(n.BlockedPorts) > 0 {
+		lines = append(lines, "STP blocking ports "+joinInts(n.BlockedPorts))
+	}
+	return strings.Join(lines, sep)
+}
+
+// quote quotes s as a DOT string, leaving the \n line breaks of labels alone.
+func quote(s string) string {
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
+
+func mermaidEscape(s string) string {
+	return strings.Replace(s, `"`, "#quot;", -1)
+}
+
+func joinInts(ints []int) string {
+	s := make([]string, len(ints))
+	for i, n := range ints {
+		s[i] = fmt.Sprint(n)
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,275 @@
+// Package topology builds the graph of how the devices and clients of a UniFi site are wired together, from the
+// uplink and downlink tables of the devices and the station data of the clients, and renders it as an ASCII tree,
+// Graphviz DOT, Mermaid or JSON.
+package topology
+
+import (
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The speed, in Mbps, below which a link between two devices is highlighted.
+const gigabit = 1000
+
+// Node is a device or client of the site along with everything connected through it.
+type Node struct {
+	Name       string `json:"name"`
+	MacAddress string `json:"mac"`
+	Type       string `json:"type"`
+	Model      string `json:"model,omitempty"`
+	IP         string `json:"ip,omitempty"`
+	// The link to the node this is connected through, nil for the roots of the graph.
+	Link *Link `json:"link,omitempty"`
+	// The ports of a switch which STP is blocking.
+	BlockedPorts []int   `json:"stp_blocked_ports,omitempty"`
+	Children     []*Node `json:"children,omitempty"`
+}
+
+// Link is how a node is connected to its parent.
+type Link struct {
+	// The port of the parent the node is connected to, 0 when not known or wireless.
+	ParentPort int      `json:"parent_port,omitempty"`
+	Speed      int      `json:"speed,omitempty"`
+	FullDuplex bool     `json:"full_duplex"`
+	Wireless   bool     `json:"wireless,omitempty"`
+	Essid      string   `json:"essid,omitempty"`
+	STPState   string   `json:"stp_state,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"`
+}
+
+// IsClient reports whether the node is a client rather than a UniFi device.
+func (n *Node) IsClient() bool {
+	return n.Type == "client"
+}
+
+// Label describes the node e.g. "Core Switch (usw US16P150, 192.168.1.2)".
+func (n *Node) Label() string {
+	details := []string{n.Type}
+	if n.Model != "" {
+		details[0] += " " + n.Model
+	}
+	if n.IP != "" {
+		details = append(details, n.IP)
+	}
+	return fmt.Sprintf("%s (%s)", n.Name, strings.Join(details, ", "))
+}
+
+// String describes the link e.g. "port 3, 1 Gbps" or "wifi Office".
+func (l *Link) String() string {
+	if l.Wireless {
+		if l.Essid == "" {
+			return "wifi"
+		}
+		return "wifi " + l.Essid
+	}
+	var parts []string
+	if l.ParentPort > 0 {
+		parts = append(parts, fmt.Sprintf("port %d", l.ParentPort))
+	}
+	if l.Speed > 0 {
+		parts = append(parts, FormatSpeed(l.Speed))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// FormatSpeed formats a speed in Mbps e.g. "100 Mbps" or "10 Gbps".
+func FormatSpeed(mbps int) string {
+	if mbps >= 1000 && mbps%1000 == 0 {
+		return fmt.Sprintf("%d Gbps", mbps/1000)
+	}
+	return fmt.Sprintf("%d Mbps", mbps)
+}
+
+// isBlocked reports whether an STP state means the port is not forwarding.
+func isBlocked(state string) bool {
+	switch strings.ToLower(state) {
+	case "blocking", "discarding", "broken":
+		return true
+	}
+	return false
+}
+
+// Build works out how the devices and clients are connected, returning the nodes which are not connected through
+// any other, normally just the gateway. A device's parent is taken from the downlink table of the device it is
+// connected to, falling back to its own uplink. Clients are connected to the switch port or AP given by their
+// station data, and those without either are left out.
+func Build(devices []unified.Device, clients []unified.User) []*Node {
+	nodes := make(map[string]*Node)
+	ports := make(map[string]map[int]unified.PortTable)
+	for _, d := range devices {
+		key := macKey(d.MacAddress)
+		name := d.Name
+		if name == "" {
+			name = d.MacAddress
+		}
+		n := &Node{Name: name, MacAddress: d.MacAddress, Type: d.Type, Model: d.Model, IP: d.IP}
+		ports[key] = make(map[int]unified.PortTable)
+		for _, p := range d.Ports {
+			ports[key][p.PortIdx] = p
+			if isBlocked(p.STPState) {
+				n.BlockedPorts = append(n.BlockedPorts, p.PortIdx)
+			}
+		}
+		nodes[key] = n
+	}
+
+	parents := make(map[string]string)
+	for _, d := range devices {
+		for _, down := range d.DownLinks {
+			child := macKey(down.MacAddress)
+			if _, ok := nodes[child]; !ok || parents[child] != "" {
+				continue
+			}
+			parents[child] = macKey(d.MacAddress)
+			nodes[child].Link = wiredLink(down.PortIdx, down.Speed, down.IsFullDuplex, ports[macKey(d.MacAddress)])
+		}
+	}
+	for _, d := range devices {
+		key, parent := macKey(d.MacAddress), macKey(d.Uplink.UplinkMacAddress)
+		if _, ok := nodes[parent]; !ok || parents[key] != "" || parent == key {
+			continue
+		}
+		parents[key] = parent
+		nodes[key].Link = wiredLink(d.Uplink.UplinkRemotePort, d.Uplink.Speed, d.Uplink.IsFullDuplex, ports[parent])
+	}
+	breakCycles(parents)
+	for key, n := range nodes {
+		if _, ok := parents[key]; !ok {
+			n.Link = nil
+		}
+	}
+
+	for _, c := range clients {
+		key := macKey(c.MacAddress)
+		if _, ok := nodes[key]; ok {
+			continue
+		}
+		n := &Node{Name: c.DisplayName(), MacAddress: c.MacAddress, Type: "client", IP: c.IP}
+		switch {
+		case c.IsWired && nodes[macKey(c.SwitchMacAddress)] != nil:
+			parent := macKey(c.SwitchMacAddress)
+			port := ports[parent][c.SwitchPort]
+			n.Link = wiredLink(c.SwitchPort, port.PortSpeed, port.IsFullDuplexEnabled, ports[parent])
+			parents[key] = parent
+		case !c.IsWired && nodes[macKey(c.APMacAddress)] != nil:
+			n.Link = &Link{Wireless: true, Essid: c.Essid, FullDuplex: true}
+			parents[key] = macKey(c.APMacAddress)
+		default:
+			continue
+		}
+		nodes[key] = n
+	}
+
+	var roots []*Node
+	for key, n := range nodes {
+		if parent, ok := parents[key]; ok {
+			nodes[parent].Children = append(nodes[parent].Children, n)
+		} else {
+			roots = append(roots, n)
+		}
+	}
+	for _, n := range nodes {
+		n.warn()
+		sortNodes(n.Children)
+	}
+	sortNodes(roots)
+	return roots
+}
+
+// wiredLink describes a wired link to port of a device whose port table is given.
+func wiredLink(port, speed int, fullDuplex bool, table map[int]unified.PortTable) *Link {
+	l := &Link{ParentPort: port, Speed: speed, FullDuplex: fullDuplex}
+	if p, ok := table[port]; ok {
+		l.STPState = p.STPState
+		if l.Speed == 0 {
+			l.Speed, l.FullDuplex = p.PortSpeed, p.IsFullDuplexEnabled
+		}
+	}
+	return l
+}
+
+// warn records what is wrong with the link to a node: half-duplex, less than a gigabit between devices or the
+// port it is connected to being blocked by STP.
+func (n *Node) warn() {
+	l := n.Link
+	if l == nil || l.Wireless {
+		return
+	}
+	if !l.FullDuplex && l.Speed > 0 {
+		l.Warnings = append(l.Warnings, "half-duplex")
+	}
+	if !n.IsClient() && l.Speed > 0 && l.Speed < gigabit {
+		l.Warnings = append(l.Warnings, "sub-gigabit")
+	}
+	if isBlocked(l.STPState) {
+		l.Warnings = append(l.Warnings, "STP "+strings.ToLower(l.STPState))
+	}
+}
+
+// breakCycles removes the parent of a device which would otherwise be its own ancestor, which can only come from
+// inconsistent data, making it a root.
+func breakCycles(parents map[string]string) {
+	keys := make([]string, 0, len(parents))
+	for k := range parents {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, start := range keys {
+		seen := map[string]bool{start: true}
+		for key := parents[start]; key != ""; key = parents[key] {
+			if key == start {
+				delete(parents, start)
+				break
+			}
+			if seen[key] {
+				// start leads into a cycle without being part of it, which is broken when its turn comes.
+				break
+			}
+			seen[key] = true
+		}
+	}
+}
+
+// sortNodes orders devices before clients, then gateways, switches and APs, then by port and name.
+func sortNodes(nodes []*Node) {
+	rank := func(n *Node) int {
+		switch n.Type {
+		case "ugw":
+			return 0
+		case "usw":
+			return 1
+		case "uap":
+			return 2
+		case "client":
+			return 4
+		}
+		return 3
+	}
+	port := func(n *Node) int {
+		if n.Link == nil {
+			return 0
+		}
+		return n.Link.ParentPort
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		if rank(a) != rank(b) {
+			return rank(a) < rank(b)
+		}
+		if port(a) != port(b) {
+			return port(a) < port(b)
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+}
+
+// macKey normalizes a MAC address so differently formatted addresses compare equal, or returns "" if invalid.
+func macKey(mac string) string {
+	mac, err := unified.NormalizeMac(mac)
+	if err != nil {
+		return ""
+	}
+	return mac
+}
@@ -0,0 +1,93 @@
+package topology
+
+import (
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testSite() ([]unified.Device, []unified.User) {
+	devices := []unified.Device{
+		{MacAddress: "80:2a:a8:00:00:01", Name: "Gateway", Type: "ugw", DownLinks: []unified.DownLinkTable{
+			{MacAddress: "f0:9f:c2:00:00:02", PortIdx: 1, Speed: 1000, IsFullDuplex: true},
+		}},
+		{MacAddress: "f0:9f:c2:00:00:02", Name: "Switch", Type: "usw", Model: "US16P150",
+			DownLinks: []unified.DownLinkTable{
+				{MacAddress: "80:2a:a8:00:00:03", PortIdx: 5, Speed: 100, IsFullDuplex: true},
+			},
+			Ports: []unified.PortTable{
+				{PortIdx: 5, PortSpeed: 100, IsFullDuplexEnabled: true, STPState: "forwarding"},
+				{PortIdx: 7, PortSpeed: 100, STPState: "forwarding"},
+				{PortIdx: 9, PortSpeed: 1000, IsFullDuplexEnabled: true, STPState: "blocking"},
+			}},
+		{MacAddress: "80:2A:A8:00:00:03", Name: "Landing", Type: "uap",
+			Uplink: unified.Uplink{UplinkMacAddress: "f0:9f:c2:00:00:02", UplinkRemotePort: 5}},
+	}
+	clients := []unified.User{
+		{MacAddress: "00:11:22:33:44:01", Hostname: "printer", IsWired: true, SwitchMacAddress: "f0:9f:c2:00:00:02",
+			SwitchPort: 7},
+		{MacAddress: "00:11:22:33:44:02", Name: "Phone", APMacAddress: "80:2a:a8:00:00:03", Essid: "Office"},
+		{MacAddress: "00:11:22:33:44:03", Name: "Nowhere"},
+	}
+	return devices, clients
+}
+
+func TestBuild(t *testing.T) {
+	roots := Build(testSite())
+	if len(roots) != 1 || roots[0].Name != "Gateway" {
+		t.Fatalf("Build() roots = %v, want just the Gateway", roots)
+	}
+	sw := roots[0].Children[0]
+	if sw.Name != "Switch" || len(sw.Children) != 2 || sw.Link.ParentPort != 1 {
+		t.Fatalf("Switch = %+v, want it on port 1 of the Gateway with 2 children", sw)
+	}
+	if len(sw.BlockedPorts) != 1 || sw.BlockedPorts[0] != 9 {
+		t.Errorf("BlockedPorts = %v, want [9]", sw.BlockedPorts)
+	}
+
+	ap, printer := sw.Children[0], sw.Children[1]
+	if ap.Name != "Landing" || strings.Join(ap.Link.Warnings, ",") != "sub-gigabit" {
+		t.Errorf("Landing link = %+v, want a sub-gigabit warning", ap.Link)
+	}
+	if printer.Name != "printer" || strings.Join(printer.Link.Warnings, ",") != "half-duplex" {
+		t.Errorf("printer link = %+v, want a half-duplex warning", printer.Link)
+	}
+	if len(ap.Children) != 1 || ap.Children[0].Name != "Phone" || !ap.Children[0].Link.Wireless {
+		t.Errorf("Landing children = %v, want the Phone connected wirelessly", ap.Children)
+	}
+}
+
+func TestBuildBreaksCycles(t *testing.T) {
+	devices := []unified.Device{
+		{MacAddress: "00:00:00:00:00:01", Name: "A", Uplink: unified.Uplink{UplinkMacAddress: "00:00:00:00:00:02"}},
+		{MacAddress: "00:00:00:00:00:02", Name: "B", Uplink: unified.Uplink{UplinkMacAddress: "00:00:00:00:00:01"}},
+	}
+	roots := Build(devices, nil)
+	if len(roots) != 1 || len(roots[0].Children) != 1 || roots[0].Link != nil {
+		t.Errorf("Build() = %v, want one root with one child", roots)
+	}
+}
+
+func TestRenderTree(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Render(&buf, Build(testSite()), Tree, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := `Gateway (ugw)
+└── Switch (usw US16P150) [port 1, 1 Gbps] !! STP blocking ports 9
+    ├── Landing (uap) [port 5, 100 Mbps] !! sub-gigabit
+    │   └── Phone (client) [wifi Office]
+    └── printer (client) [port 7, 100 Mbps] !! half-duplex
+`
+	if got := buf.String(); got != want {
+		t.Errorf("tree =\n%s\nwant\n%s", got, want)
+	}
+
+	for _, format := range []string{DOT, Mermaid, JSON} {
+		buf.Reset()
+		if err := Render(&buf, Build(testSite()), format, nil); err != nil || buf.Len() == 0 {
+			t.Errorf("Render(%s) = %v with %d bytes", format, err, buf.Len())
+		}
+	}
+}
@@ -9,14 +9,17 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/fatih/structs"
 	"strconv"
+	"time"
 )
 
 // AlarmsService is an interface for interfacing with the Alarm
 // endpoints of the UniFi API
 // See: https://developers.digitalocean.com/documentation/v2/#account
 type AlarmsService interface {
-	List(context.Context, *ListOptions) ([]Alarm, *Response, error)
+	List(context.Context, *QueryOptions) ([]Alarm, *Response, error)
 	Get(context.Context, int) (*Alarm, *Response, error)
+	Archive(context.Context, string) (*UniFiCmdResp, *Response, error)
+	ArchiveAll(context.Context) (*UniFiCmdResp, *Response, error)
 }
 
 // AlarmsServiceOp handles communication with the Alarm related methods of
@@ -37,47 +40,48 @@ type alarmRoot struct {
 
 // Alarm represents a UniFi Network Alarm
 type Alarm struct {
-	UUID           string `json:"_id"`
-	Archived       bool   `json:"archived,omitempty"`
-	DateTime       string `json:"datetime,omitempty"`
-	Essid          string `json:"essid,omitempty"`
-	HandledAdminId string `json:"handled_admin_id,omitempty"`
-	HandledTime    string `json:"handled_time,omitempty"`
-	Key            string `json:"key,omitempty"`
-	MacAddress     string `json:"mac,omitempty"`
-	Message        string `json:"msg,omitempty"`
-	Occurs         int    `json:"occurs,omitempty"`
-	SiteId         string `json:"site_id,omitempty"`
-	SubSystem      string `json:"subsystem,omitempty"`
-	//Time            *Timestamp  `json:"time,omitempty"`
+	UUID           string    `json:"_id"`
+	Archived       bool      `json:"archived,omitempty"`
+	DateTime       Timestamp `json:"datetime,omitempty" structs:",omitnested"`
+	Essid          string    `json:"essid,omitempty"`
+	HandledAdminId string    `json:"handled_admin_id,omitempty"`
+	HandledTime    Timestamp `json:"handled_time,omitempty" structs:",omitnested"`
+	Key            string    `json:"key,omitempty"`
+	MacAddress     string    `json:"mac,omitempty"`
+	Message        string    `json:"msg,omitempty"`
+	Occurs         int       `json:"occurs,omitempty"`
+	SiteId         string    `json:"site_id,omitempty"`
+	SubSystem      string    `json:"subsystem,omitempty"`
+	Time           Timestamp `json:"time,omitempty" structs:",omitnested"`
 	//EmailVerified   bool   `json:"email_verified,omitempty"`
 	//Status          string `json:"status,omitempty"`
 	//StatusMessage   string `json:"status_message,omitempty"`
 }
 
-// List all alarms
-func (s *AlarmsServiceOp) List(ctx context.Context, opt *ListOptions) ([]Alarm, *Response, error) {
-	//path := alarmsBasePath
-	path := *s.buildURL()
-	path, err := addOptions(path, opt)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	req, err := s.client.NewRequest(ctx, "GET", path, nil)
-	if err != nil {
-		return nil, nil, err
-	}
+// AlarmCmd is a command sent to the event manager of the UniFi Controller to handle alarms.
+type AlarmCmd struct {
+	Cmd  string `json:"cmd"`
+	UUID string `json:"_id,omitempty"`
+}
 
+// List the alarms matching opt. The controller is queried a page at a time until it has no more alarms to return
+// and the client side filter in opt is applied to each page. A nil opt lists all alarms.
+func (s *AlarmsServiceOp) List(ctx context.Context, opt *QueryOptions) ([]Alarm, *Response, error) {
 	root := new(alarmsRoot)
-	resp, err := s.client.Do(req, root)
-
+	resp, err := s.client.query(ctx, *s.buildURL(), opt, func(result json.RawMessage, f ListFilter) (bool, error) {
+		var alarm Alarm
+		if err := json.Unmarshal(result, &alarm); err != nil {
+			return false, err
+		}
+		if !f.match(alarm.Key, alarm.SubSystem, alarm.Essid, alarm.When(), alarm.MacAddress) {
+			return false, nil
+		}
+		root.Alarms = append(root.Alarms, alarm)
+		return true, nil
+	})
 	if err != nil {
 		return nil, resp, err
 	}
-	//if l := root.Links; l != nil {
-	//	resp.Links = l
-	//}
 
 	if s.client.Options.DbUsage.DbUsageEnabled {
 
@@ -85,7 +89,7 @@ func (s *AlarmsServiceOp) List(ctx context.Context, opt *ListOptions) ([]Alarm,
 	}
 
 	//log.Debug(root.Alarms)
-	return root.Alarms, resp, err
+	return root.Alarms, resp, nil
 }
 
 //
@@ -198,6 +202,30 @@ func (s *AlarmsServiceOp) Get(ctx context.Context, uuid int) (*Alarm, *Response,
 	return root.Alarm, resp, err
 }
 
+// Archive an alarm by its unique UUID, marking it as handled by the logged in admin.
+func (s *AlarmsServiceOp) Archive(ctx context.Context, uuid string) (*UniFiCmdResp, *Response, error) {
+	if uuid == "" {
+		return nil, nil, NewArgError("uuid", "cannot be empty")
+	}
+
+	alarmCmd := &AlarmCmd{Cmd: "archive-alarm", UUID: uuid}
+	return s.client.sendCmd(ctx, "POST", *s.client.buildURL(evtMgrCmdBasePath), alarmCmd)
+}
+
+// Archive every alarm on the site.
+func (s *AlarmsServiceOp) ArchiveAll(ctx context.Context) (*UniFiCmdResp, *Response, error) {
+	alarmCmd := &AlarmCmd{Cmd: "archive-all-alarms"}
+	return s.client.sendCmd(ctx, "POST", *s.client.buildURL(evtMgrCmdBasePath), alarmCmd)
+}
+
+// When returns the time the alarm was raised, preferring the millisecond precision time over datetime.
+func (r Alarm) When() time.Time {
+	if !r.Time.IsZero() {
+		return r.Time.Time
+	}
+	return r.DateTime.Time
+}
+
 func (r Alarm) String() string {
 	return Stringify(r)
 }
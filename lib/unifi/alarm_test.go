@@ -0,0 +1,47 @@
+package unifi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestAlarmsArchive(t *testing.T) {
+	var path string
+	var cmd map[string]string
+	c, done := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.Method + " " + r.URL.Path
+		cmd = nil
+		if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+		fmt.Fprint(w, `{"meta": {"rc": "ok"}, "data": []}`)
+	})
+	defer done()
+
+	resp, _, err := c.Alarms.Archive(ctx, "5a9ef0c4e4b0c26d3f8fcd0e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"cmd": "archive-alarm", "_id": "5a9ef0c4e4b0c26d3f8fcd0e"}
+	if path != "POST /api/s/office/cmd/evtmgr" || fmt.Sprint(cmd) != fmt.Sprint(want) || resp.Meta.Status != "ok" {
+		t.Errorf("Archive() sent %s %v and returned %q, want POST /api/s/office/cmd/evtmgr %v and ok", path, cmd,
+			resp.Meta.Status, want)
+	}
+
+	resp, _, err = c.Alarms.ArchiveAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{"cmd": "archive-all-alarms"}
+	if path != "POST /api/s/office/cmd/evtmgr" || fmt.Sprint(cmd) != fmt.Sprint(want) || resp.Meta.Status != "ok" {
+		t.Errorf("ArchiveAll() sent %s %v and returned %q, want POST /api/s/office/cmd/evtmgr %v and ok", path,
+			cmd, resp.Meta.Status, want)
+	}
+
+	path = ""
+	if _, _, err := c.Alarms.Archive(ctx, ""); err == nil || path != "" {
+		t.Errorf("Archive() of an empty UUID should return an error without a request, sent %q", path)
+	}
+}
@@ -3,7 +3,6 @@ package unifi
 import (
 	"context"
 	"fmt"
-	"os"
 )
 
 // AuthenticateService is an interface for interfacing with the Authentication
@@ -50,10 +49,7 @@ func (s *AuthenticateServiceOp) Login(ctx context.Context, username string, pass
 	responseRoot := new(authenticationRoot)
 	resp, err := s.client.Do(req, responseRoot)
 	if err != nil {
-
-		fmt.Println("unified - Controller - Authentication failure !")
-		os.Exit(-999)
-		return nil, resp, err
+		return nil, resp, fmt.Errorf("unified - Controller - Authentication failure ! %v", err)
 	}
 
 	return responseRoot.Authentication, resp, err
@@ -20,6 +20,9 @@ type DevicesService interface {
 	GetByMac(context.Context, string) (*Device, *Response, error)
 	GetIPFromMac(ctx context.Context, mac string) (string, error)
 	GetUUIDFromMac(ctx context.Context, mac string) (string, error)
+	Resolve(context.Context, string) (*Device, *Response, error)
+	Restart(context.Context, string) (*UniFiCmdResp, *Response, error)
+	Adopt(context.Context, string) (*UniFiCmdResp, *Response, error)
 }
 
 // DevicesServiceOp handles communication with the Device related methods of
@@ -67,7 +70,9 @@ type Device struct {
 	MacAddress             string          `json:"mac,omitempty"`
 	Name                   string          `json:"name,omitempty"`
 	Model                  string          `json:"model,omitempty"`
+	NumSta                 int             `json:"num_sta,omitempty"`
 	KnownCfgVersion        string          `json:"known_cfgversion,omitempty"`
+	LastSeen               Timestamp       `json:"last_seen,omitempty" structs:",omitnested"`
 	LEDOverride            string          `json:"led_override,omitempty"`
 	IsLocating             bool            `json:"locating,omitempty"`
 	IsOverHeating          bool            `json:"overheating,omitempty"`
@@ -78,10 +83,21 @@ type Device struct {
 	State                  int             `json:"state,omitempty"`
 	STPPriority            string          `json:"stp_priority,omitempty"`
 	STPVersion             string          `json:"stp_version,omitempty"`
+	SystemStats            SystemStats     `json:"system-stats,omitempty"`
 	Type                   string          `json:"type,omitempty"`
+	Uplink                 Uplink          `json:"uplink,omitempty"`
 	UplinkDepth            int             `json:"uplink_depth,omitempty"`
+	Uptime                 int64           `json:"uptime,omitempty"`
 	Version                string          `json:"version,omitempty"`
-	//Time            *Timestamp  `json:"time,omitempty"`
+	Time                   Timestamp       `json:"time,omitempty" structs:",omitnested"`
+}
+
+// SystemStats is the load of a device as percentages, which the Controller sends as strings, and its uptime in
+// seconds.
+type SystemStats struct {
+	CPU    Number `json:"cpu"`
+	Mem    Number `json:"mem"`
+	Uptime Number `json:"uptime"`
 }
 
 type DeviceShort struct {
@@ -115,6 +131,16 @@ type DownLinkTable struct {
 	Speed        int    `json:"speed,omitempty"`
 }
 
+// Uplink describes the link a device uses to reach the gateway.
+type Uplink struct {
+	IsFullDuplex     bool   `json:"full_duplex,omitempty"`
+	PortIdx          int    `json:"port_idx,omitempty"`
+	Speed            int    `json:"speed,omitempty"`
+	Type             string `json:"type,omitempty"`
+	UplinkMacAddress string `json:"uplink_mac,omitempty"`
+	UplinkRemotePort int    `json:"uplink_remote_port,omitempty"`
+}
+
 type EthernetTable struct {
 	MacAddress string `json:"mac"`
 	Name       string `json:"name,omitempty"`
@@ -375,8 +401,12 @@ func (s *DevicesServiceOp) Get(ctx context.Context, id int) (*Device, *Response,
 	return &root.Devices[0], resp, err
 }
 
-// Get an Device by ID.
+// Get an Device by MAC address, in any notation accepted by NormalizeMac.
 func (s *DevicesServiceOp) GetByMac(ctx context.Context, mac string) (*Device, *Response, error) {
+	mac, err := NormalizeMac(mac)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	if s.client.Options.DbUsage.DbUsageEnabled {
 
@@ -393,6 +423,9 @@ func (s *DevicesServiceOp) GetByMac(ctx context.Context, mac string) (*Device, *
 	if err != nil {
 		return nil, resp, err
 	}
+	if len(root.Devices) == 0 {
+		return nil, resp, &NotFoundError{Kind: "device", Query: mac}
+	}
 
 	return &root.Devices[0], resp, err
 }
@@ -445,6 +478,28 @@ func (d Device) toDeviceShort() DeviceShort {
 	return shortStruct
 }
 
+// Restarts i.e. reboots, a Device of any type.
+// mac is the MAC Address of the Device to restart
+func (s *DevicesServiceOp) Restart(ctx context.Context, mac string) (*UniFiCmdResp, *Response, error) {
+	path := fmt.Sprintf("%s/%s", *s.client.buildURL(devMgrCmdBasePath), mac)
+	cmd := new(UniFiCmd)
+	cmd.MacAddress = mac
+	cmd.Cmd = "restart"
+
+	return s.client.sendCmd(ctx, "POST", path, cmd)
+}
+
+// Adopts a Device which is pending adoption by the Controller.
+// mac is the MAC Address of the Device to adopt
+func (s *DevicesServiceOp) Adopt(ctx context.Context, mac string) (*UniFiCmdResp, *Response, error) {
+	path := fmt.Sprintf("%s/%s", *s.client.buildURL(devMgrCmdBasePath), mac)
+	cmd := new(UniFiCmd)
+	cmd.MacAddress = mac
+	cmd.Cmd = "adopt"
+
+	return s.client.sendCmd(ctx, "POST", path, cmd)
+}
+
 // Return the current IP Address of a Device from it's MAC Address.
 func (s *DevicesServiceOp) GetIPFromMac(ctx context.Context, mac string) (string, error) {
 	device, _, err := s.GetByMac(ctx, mac)
@@ -473,3 +528,28 @@ func (s *DevicesServiceOp) GetState(ctx context.Context, mac string) (string, er
 	return device.State, nil
 }
 */
+
+// StateName describes the state of a device as reported by the Controller e.g. connected or provisioning.
+func StateName(state int) string {
+	switch state {
+	case 0:
+		return "disconnected"
+	case 1:
+		return "connected"
+	case 2:
+		return "pending adoption"
+	case 4:
+		return "upgrading"
+	case 5:
+		return "provisioning"
+	case 6:
+		return "heartbeat missed"
+	case 7:
+		return "adopting"
+	case 9:
+		return "adoption failed"
+	case 11:
+		return "isolated"
+	}
+	return fmt.Sprintf("unknown (%d)", state)
+}
@@ -0,0 +1,220 @@
+package unifi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The status of a device in a Drift.
+const (
+	DriftAdded   = "added"
+	DriftRemoved = "removed"
+	DriftChanged = "changed"
+)
+
+// DeviceSnapshot holds the configuration relevant fields of a device at the time a Snapshot was taken.
+type DeviceSnapshot struct {
+	MacAddress    string          `json:"mac"`
+	Name          string          `json:"name,omitempty"`
+	Model         string          `json:"model,omitempty"`
+	Type          string          `json:"type,omitempty"`
+	ConfigVersion string          `json:"cfgversion,omitempty"`
+	ConfigNetwork ConfigNetwork   `json:"config_network,omitempty"`
+	LEDOverride   string          `json:"led_override,omitempty"`
+	PortOverrides []PortOverrides `json:"port_overrides,omitempty"`
+	STPPriority   string          `json:"stp_priority,omitempty"`
+}
+
+// Snapshot records the configuration of every device of a site at a point in time. A Snapshot saved with a
+// Baseline name can be compared against later by that name.
+type Snapshot struct {
+	Site     string           `json:"site"`
+	Taken    time.Time        `json:"taken"`
+	Baseline string           `json:"baseline,omitempty"`
+	Devices  []DeviceSnapshot `json:"devices"`
+}
+
+// NewSnapshot takes a Snapshot of the given devices of a site, sorted by MAC address.
+func NewSnapshot(site string, devices []Device, taken time.Time) *Snapshot {
+	snap := &Snapshot{Site: site, Taken: taken, Devices: make([]DeviceSnapshot, 0, len(devices))}
+	for _, d := range devices {
+		snap.Devices = append(snap.Devices, DeviceSnapshot{
+			MacAddress:    d.MacAddress,
+			Name:          d.Name,
+			Model:         d.Model,
+			Type:          d.Type,
+			ConfigVersion: d.ConfigVersion,
+			ConfigNetwork: d.ConfigNetwork,
+			LEDOverride:   d.LEDOverride,
+			PortOverrides: d.PortOverrides,
+			STPPriority:   d.STPPriority,
+		})
+	}
+	sort.Slice(snap.Devices, func(i, j int) bool {
+		return macKey(snap.Devices[i].MacAddress) < macKey(snap.Devices[j].MacAddress)
+	})
+	return snap
+}
+
+// FieldDiff is a field of a device which differs between two snapshots e.g. port_overrides[3].portconf_id.
+type FieldDiff struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Drift is a device whose configuration differs between two snapshots.
+type Drift struct {
+	MacAddress string      `json:"mac"`
+	Name       string      `json:"name"`
+	Status     string      `json:"status"`
+	Fields     []FieldDiff `json:"fields,omitempty"`
+	// The admins whose events between the snapshots refer to the device.
+	ChangedBy []string `json:"changed_by,omitempty"`
+}
+
+// Diff compares two snapshots of a site, returning the devices which were added, removed or whose configuration
+// changed between them, sorted by MAC address.
+func Diff(old, new *Snapshot) []Drift {
+	before := make(map[string]DeviceSnapshot)
+	for _, d := range old.Devices {
+		before[macKey(d.MacAddress)] = d
+	}
+	after := make(map[string]DeviceSnapshot)
+	for _, d := range new.Devices {
+		after[macKey(d.MacAddress)] = d
+	}
+
+	var drifts []Drift
+	for key, d := range after {
+		prev, ok := before[key]
+		if !ok {
+			drifts = append(drifts, Drift{MacAddress: d.MacAddress, Name: d.Name, Status: DriftAdded})
+			continue
+		}
+		if fields := diffFields(flattenSnapshot(prev), flattenSnapshot(d)); len(fields) > 0 {
+			drifts = append(drifts, Drift{MacAddress: d.MacAddress, Name: d.Name, Status: DriftChanged, Fields: fields})
+		}
+	}
+	for key, d := range before {
+		if _, ok := after[key]; !ok {
+			drifts = append(drifts, Drift{MacAddress: d.MacAddress, Name: d.Name, Status: DriftRemoved})
+		}
+	}
+	sort.Slice(drifts, func(i, j int) bool { return macKey(drifts[i].MacAddress) < macKey(drifts[j].MacAddress) })
+	return drifts
+}
+
+// Correlate fills in who changed each drifted device from the admin events which occurred after old was taken
+// and up to new being taken. Events record the admin responsible but not always the device, so only those
+// naming the device by MAC address are attributed to it. The admins of every event in the window are returned,
+// sorted and without duplicates.
+func Correlate(drifts []Drift, events []Event, old, new *Snapshot) []string {
+	var admins []string
+	for _, e := range events {
+		when := e.When()
+		if e.Admin == "" || !when.After(old.Taken) || when.After(new.Taken) {
+			continue
+		}
+		admins = appendUnique(admins, e.Admin)
+		for i := range drifts {
+			if e.Refers(drifts[i].MacAddress) {
+				drifts[i].ChangedBy = appendUnique(drifts[i].ChangedBy, e.Admin)
+			}
+		}
+	}
+	sort.Strings(admins)
+	for i := range drifts {
+		sort.Strings(drifts[i].ChangedBy)
+	}
+	return admins
+}
+
+// Refers reports whether the event refers to the device or client with the given MAC address.
+func (e Event) Refers(mac string) bool {
+	key := macKey(mac)
+	for _, m := range []string{e.MacAddress, e.AccessPoint, e.Switch, e.Gateway, e.User, e.Guest} {
+		if m != "" && macKey(m) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, e := range list {
+		if e == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// flattenSnapshot maps every field of a device to its value, with port overrides identified by port number rather
+// than their position so reordering them is not reported as a change.
+func flattenSnapshot(d DeviceSnapshot) map[string]string {
+	d.MacAddress = ""
+	var doc interface{}
+	b, _ := json.Marshal(d)
+	json.Unmarshal(b, &doc)
+	fields := make(map[string]string)
+	flatten("", doc, fields)
+	return fields
+}
+
+func flatten(prefix string, v interface{}, fields map[string]string) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, e := range x {
+			name := k
+			if prefix != "" {
+				name = prefix + "." + k
+			}
+			flatten(name, e, fields)
+		}
+	case []interface{}:
+		for i, e := range x {
+			index := fmt.Sprint(i)
+			if m, ok := e.(map[string]interface{}); ok && m["port_idx"] != nil {
+				index = fmt.Sprint(m["port_idx"])
+			}
+			flatten(fmt.Sprintf("%s[%s]", prefix, index), e, fields)
+		}
+	default:
+		fields[prefix] = fmt.Sprint(x)
+	}
+}
+
+func diffFields(old, new map[string]string) []FieldDiff {
+	var diffs []FieldDiff
+	for field, value := range new {
+		if old[field] != value {
+			diffs = append(diffs, FieldDiff{Field: field, Old: old[field], New: value})
+		}
+	}
+	for field, value := range old {
+		if _, ok := new[field]; !ok {
+			diffs = append(diffs, FieldDiff{Field: field, Old: value})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return fieldLess(diffs[i].Field, diffs[j].Field) })
+	return diffs
+}
+
+// fieldLess orders field names with port numbers compared numerically e.g. port_overrides[2] before [10].
+func fieldLess(a, b string) bool {
+	pa, pb := strings.SplitN(a, "[", 2), strings.SplitN(b, "[", 2)
+	if pa[0] != pb[0] || len(pa) == 1 || len(pb) == 1 {
+		return a < b
+	}
+	var na, nb int
+	fmt.Sscanf(pa[1], "%d", &na)
+	fmt.Sscanf(pb[1], "%d", &nb)
+	if na != nb {
+		return na < nb
+	}
+	return a < b
+}
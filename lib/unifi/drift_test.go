@@ -0,0 +1,54 @@
+package unifi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	taken := time.Date(2017, 5, 1, 12, 0, 0, 0, time.UTC)
+	old := NewSnapshot("default", []Device{
+		{MacAddress: "f0:9f:c2:00:00:01", Name: "Switch", ConfigVersion: "a", PortOverrides: []PortOverrides{
+			{PortIdx: 2, PortConfId: "p1"},
+			{PortIdx: 10, PortConfId: "p1"},
+		}},
+		{MacAddress: "80:2a:a8:00:00:02", Name: "Hallway"},
+	}, taken)
+	new := NewSnapshot("default", []Device{
+		{MacAddress: "F0-9F-C2-00-00-01", Name: "Core Switch", ConfigVersion: "b", PortOverrides: []PortOverrides{
+			{PortIdx: 10, PortConfId: "p2"},
+			{PortIdx: 2, PortConfId: "p1"},
+		}},
+		{MacAddress: "80:2a:a8:00:00:03", Name: "Landing"},
+	}, taken.Add(time.Hour))
+
+	drifts := Diff(old, new)
+	if len(drifts) != 3 {
+		t.Fatalf("Diff() returned %d drifts, want 3: %v", len(drifts), drifts)
+	}
+	if drifts[0].Status != DriftRemoved || drifts[1].Status != DriftAdded {
+		t.Errorf("Diff() = %v, want the Hallway removed and the Landing added", drifts)
+	}
+	want := []FieldDiff{
+		{Field: "cfgversion", Old: "a", New: "b"},
+		{Field: "name", Old: "Switch", New: "Core Switch"},
+		{Field: "port_overrides[10].portconf_id", Old: "p1", New: "p2"},
+	}
+	if !reflect.DeepEqual(drifts[2].Fields, want) {
+		t.Errorf("Fields = %v, want %v", drifts[2].Fields, want)
+	}
+
+	events := []Event{
+		{Admin: "alice", Switch: "f0:9f:c2:00:00:01", Time: Timestamp{taken.Add(time.Minute)}},
+		{Admin: "bob", Time: Timestamp{taken.Add(2 * time.Minute)}},
+		{Admin: "carol", Switch: "f0:9f:c2:00:00:01", Time: Timestamp{taken.Add(-time.Minute)}},
+	}
+	admins := Correlate(drifts, events, old, new)
+	if !reflect.DeepEqual(admins, []string{"alice", "bob"}) {
+		t.Errorf("Correlate() = %v, want [alice bob]", admins)
+	}
+	if !reflect.DeepEqual(drifts[2].ChangedBy, []string{"alice"}) {
+		t.Errorf("ChangedBy = %v, want [alice]", drifts[2].ChangedBy)
+	}
+}
@@ -9,13 +9,14 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/fatih/structs"
 	"strconv"
+	"time"
 )
 
 // AccountService is an interface for interfacing with the Account
 // endpoints of the DigitalOcean API
 // See: https://developers.digitalocean.com/documentation/v2/#account
 type EventsService interface {
-	List(context.Context, *ListOptions) ([]Event, *Response, error)
+	List(context.Context, *QueryOptions) ([]Event, *Response, error)
 	Get(context.Context, int) (*Event, *Response, error)
 }
 
@@ -38,76 +39,75 @@ var _ EventsService = &EventsServiceOp{}
 
 // Account represents a DigitalOcean Account
 type Event struct {
-	UUID            string `json:"_id"`
-	Key             string `json:"key"`
-	Message         string `json:"msg"`
-	SiteId          string `json:"site_id"`
-	SubSystem       string `json:"subsystem"`
-	AccessPoint     string `json:"ap,omitempty"`
-	AccessPointName string `json:"ap_name,omitempty"`
-	AccessPointFrom string `json:"ap_from,omitempty"`
-	AccessPointTo   string `json:"ap_to,omitempty"`
-	Admin           string `json:"admin,omitempty"`
-	ByteCount       uint64 `json:"bytes,omitempty"`
-	Channel         string `json:"channel,omitempty"`
-	ChannelFrom     string `json:"channel_from,omitempty"`
-	ChannelTo       string `json:"channel_to,omitempty"`
-	DateTime        string `json:"datetime,omitempty"`
-	Duration        int    `json:"duration,omitempty"`
-	Essid           string `json:"essid,omitempty"`
-	Gateway         string `json:"gateway,omitempty"`
-	GatewayName     string `json:"gateway_name,omitempty"`
-	Guest           string `json:"guest,omitempty"`
-	Hostname        string `json:"hostname,omitempty"`
-	IpAddress       string `json:"ip,omitempty"`
-	IsAdmin         bool   `json:"is_admin,omitempty"`
-	MacAddress      string `json:"mac,omitempty"`
-	Minutes         string `json:"minutes,omitempty"`
-	Network         string `json:"network,omitempty"`
-	NumSta          int    `json:"num_sta,omitempty"`
-	Radio           string `json:"radio,omitempty"`
-	RadioFrom       string `json:"radio_from,omitempty"`
-	RadioTo         string `json:"radio_to,omitempty"`
-	Ssid            string `json:"ssid,omitempty"`
-	Switch          string `json:"sw,omitempty"`
-	SwitchName      string `json:"sw_name,omitempty"`
-	VersionFrom     string `json:"version_from,omitempty"`
-	VersionTo       string `json:"version_to,omitempty"`
-	VouchersCreated string `json:"num,omitempty"`
-	User            string `json:"user,omitempty"`
-	//Time            *Timestamp  `json:"time,omitempty"`
+	UUID            string    `json:"_id"`
+	Key             string    `json:"key"`
+	Message         string    `json:"msg"`
+	SiteId          string    `json:"site_id"`
+	SubSystem       string    `json:"subsystem"`
+	AccessPoint     string    `json:"ap,omitempty"`
+	AccessPointName string    `json:"ap_name,omitempty"`
+	AccessPointFrom string    `json:"ap_from,omitempty"`
+	AccessPointTo   string    `json:"ap_to,omitempty"`
+	Admin           string    `json:"admin,omitempty"`
+	ByteCount       uint64    `json:"bytes,omitempty"`
+	Channel         string    `json:"channel,omitempty"`
+	ChannelFrom     string    `json:"channel_from,omitempty"`
+	ChannelTo       string    `json:"channel_to,omitempty"`
+	DateTime        Timestamp `json:"datetime,omitempty" structs:",omitnested"`
+	Duration        int       `json:"duration,omitempty"`
+	Essid           string    `json:"essid,omitempty"`
+	Gateway         string    `json:"gateway,omitempty"`
+	GatewayName     string    `json:"gateway_name,omitempty"`
+	Guest           string    `json:"guest,omitempty"`
+	Hostname        string    `json:"hostname,omitempty"`
+	IpAddress       string    `json:"ip,omitempty"`
+	IsAdmin         bool      `json:"is_admin,omitempty"`
+	MacAddress      string    `json:"mac,omitempty"`
+	Minutes         string    `json:"minutes,omitempty"`
+	Network         string    `json:"network,omitempty"`
+	NumSta          int       `json:"num_sta,omitempty"`
+	Radio           string    `json:"radio,omitempty"`
+	RadioFrom       string    `json:"radio_from,omitempty"`
+	RadioTo         string    `json:"radio_to,omitempty"`
+	Ssid            string    `json:"ssid,omitempty"`
+	Switch          string    `json:"sw,omitempty"`
+	SwitchName      string    `json:"sw_name,omitempty"`
+	VersionFrom     string    `json:"version_from,omitempty"`
+	VersionTo       string    `json:"version_to,omitempty"`
+	VouchersCreated string    `json:"num,omitempty"`
+	User            string    `json:"user,omitempty"`
+	Time            Timestamp `json:"time,omitempty" structs:",omitnested"`
 }
 
-// List all alarms
-func (s *EventsServiceOp) List(ctx context.Context, opt *ListOptions) ([]Event, *Response, error) {
-	//path := eventsBasePath
-	path := *s.buildURL()
-	path, err := addOptions(path, opt)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	req, err := s.client.NewRequest(ctx, "GET", path, nil)
-	if err != nil {
-		return nil, nil, err
-	}
-
+// List the events matching opt. The controller is queried a page at a time until it has no more events to return
+// and the client side filter in opt is applied to each page. A nil opt lists the events of the last 30 days.
+func (s *EventsServiceOp) List(ctx context.Context, opt *QueryOptions) ([]Event, *Response, error) {
 	root := new(eventsRoot)
-	resp, err := s.client.Do(req, root)
+	path := *s.client.buildURL(statEventsBasePath)
+	resp, err := s.client.query(ctx, path, opt, func(result json.RawMessage, f ListFilter) (bool, error) {
+		var event Event
+		if err := json.Unmarshal(result, &event); err != nil {
+			return false, err
+		}
+		if !f.match(event.Key, event.SubSystem, event.Essid, event.When(),
+			event.MacAddress, event.AccessPoint, event.Switch, event.Gateway, event.User, event.Guest) {
+			return false, nil
+		}
+		root.Events = append(root.Events, event)
+		return true, nil
+	})
 	if err != nil {
 		return nil, resp, err
 	}
-	//	if l := root.Links; l != nil {
-	//		resp.Links = l
-	//	}
 
 	if s.client.Options.DbUsage.DbUsageEnabled {
 
 		root = EventsDB(s, root)
 	}
 
-	return root.Events, resp, err
+	return root.Events, resp, nil
 }
+
 func EventsDB(s *EventsServiceOp, root *eventsRoot) *eventsRoot {
 	eventsColExists := false
 	var eventsDB *db.Col = nil
@@ -179,6 +179,14 @@ func EventsDB(s *EventsServiceOp, root *eventsRoot) *eventsRoot {
 	return root
 }
 
+// When returns the time the event occurred, preferring the millisecond precision time over datetime.
+func (e Event) When() time.Time {
+	if !e.Time.IsZero() {
+		return e.Time.Time
+	}
+	return e.DateTime.Time
+}
+
 // Get an alarm by ID.
 func (s *EventsServiceOp) Get(ctx context.Context, id int) (*Event, *Response, error) {
 	if id < 1 {
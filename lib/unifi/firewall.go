@@ -0,0 +1,450 @@
+package unifi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The rulesets a FirewallRule belongs to, i.e. the direction of the traffic and the interface it is matched on.
+const (
+	WanIn       = "WAN_IN"
+	WanOut      = "WAN_OUT"
+	WanLocal    = "WAN_LOCAL"
+	LanIn       = "LAN_IN"
+	LanOut      = "LAN_OUT"
+	LanLocal    = "LAN_LOCAL"
+	GuestIn     = "GUEST_IN"
+	GuestOut    = "GUEST_OUT"
+	GuestLocal  = "GUEST_LOCAL"
+	Wan6In      = "WANv6_IN"
+	Wan6Out     = "WANv6_OUT"
+	Wan6Local   = "WANv6_LOCAL"
+	Lan6In      = "LANv6_IN"
+	Lan6Out     = "LANv6_OUT"
+	Lan6Local   = "LANv6_LOCAL"
+	Guest6In    = "GUESTv6_IN"
+	Guest6Out   = "GUESTv6_OUT"
+	Guest6Local = "GUESTv6_LOCAL"
+)
+
+// Rulesets lists every ruleset in the order the Controller displays them.
+var Rulesets = []string{
+	WanIn, WanOut, WanLocal, LanIn, LanOut, LanLocal, GuestIn, GuestOut, GuestLocal,
+	Wan6In, Wan6Out, Wan6Local, Lan6In, Lan6Out, Lan6Local, Guest6In, Guest6Out, Guest6Local,
+}
+
+// The types of a FirewallGroup.
+const (
+	AddressGroup     = "address-group"
+	IPv6AddressGroup = "ipv6-address-group"
+	PortGroup        = "port-group"
+)
+
+// The rule_index user defined rules are numbered from. Rules numbered below 4000 are matched before the predefined
+// rules of the ruleset and those from 4000 after them.
+const FirstRuleIndex = 2000
+
+// FirewallService is an interface for interfacing with the firewall rules and groups of a site.
+type FirewallService interface {
+	ListRules(ctx context.Context) ([]FirewallRule, *Response, error)
+	CreateRule(ctx context.Context, rule *FirewallRule) (*FirewallRule, *Response, error)
+	UpdateRule(ctx context.Context, rule *FirewallRule) (*FirewallRule, *Response, error)
+	DeleteRule(ctx context.Context, id string) (*Response, error)
+	ListGroups(ctx context.Context) ([]FirewallGroup, *Response, error)
+	CreateGroup(ctx context.Context, group *FirewallGroup) (*FirewallGroup, *Response, error)
+	UpdateGroup(ctx context.Context, group *FirewallGroup) (*FirewallGroup, *Response, error)
+	DeleteGroup(ctx context.Context, id string) (*Response, error)
+}
+
+// FirewallServiceOp handles communication with the firewallrule and firewallgroup collections of the UniFi API.
+type FirewallServiceOp struct {
+	client *UniFiClient
+}
+
+var _ FirewallService = &FirewallServiceOp{}
+
+// FirewallRule is a rule of a ruleset, matched against traffic in order of RuleIndex.
+type FirewallRule struct {
+	ID                    string   `json:"_id,omitempty"`
+	SiteId                string   `json:"site_id,omitempty"`
+	Name                  string   `json:"name"`
+	Ruleset               string   `json:"ruleset"`
+	RuleIndex             int      `json:"rule_index"`
+	Action                string   `json:"action"`
+	IsEnabled             bool     `json:"enabled"`
+	IsLogging             bool     `json:"logging"`
+	Protocol              string   `json:"protocol"`
+	ProtocolMatchExcepted bool     `json:"protocol_match_excepted"`
+	IcmpTypeName          string   `json:"icmp_typename,omitempty"`
+	IPSec                 string   `json:"ipsec"`
+	StateEstablished      bool     `json:"state_established"`
+	StateInvalid          bool     `json:"state_invalid"`
+	StateNew              bool     `json:"state_new"`
+	StateRelated          bool     `json:"state_related"`
+	SrcFirewallGroupIds   []string `json:"src_firewallgroup_ids"`
+	SrcMacAddress         string   `json:"src_mac_address"`
+	SrcAddress            string   `json:"src_address"`
+	SrcNetworkConfId      string   `json:"src_networkconf_id"`
+	SrcNetworkConfType    string   `json:"src_networkconf_type"`
+	SrcPort               string   `json:"src_port,omitempty"`
+	DstFirewallGroupIds   []string `json:"dst_firewallgroup_ids"`
+	DstAddress            string   `json:"dst_address"`
+	DstNetworkConfId      string   `json:"dst_networkconf_id"`
+	DstNetworkConfType    string   `json:"dst_networkconf_type"`
+	DstPort               string   `json:"dst_port,omitempty"`
+}
+
+// FirewallGroup is a named list of addresses or ports which rules can match against.
+type FirewallGroup struct {
+	ID           string   `json:"_id,omitempty"`
+	SiteId       string   `json:"site_id,omitempty"`
+	Name         string   `json:"name"`
+	GroupType    string   `json:"group_type"`
+	GroupMembers []string `json:"group_members"`
+}
+
+type firewallRulesRoot struct {
+	Rules []FirewallRule `json:"data"`
+}
+
+type firewallGroupsRoot struct {
+	Groups []FirewallGroup `json:"data"`
+}
+
+// States lists the connection states the rule matches e.g. [new established], none meaning all of them.
+func (r FirewallRule) States() []string {
+	var states []string
+	for _, s := range []struct {
+		name string
+		set  bool
+	}{
+		{"new", r.StateNew},
+		{"established", r.StateEstablished},
+		{"related", r.StateRelated},
+		{"invalid", r.StateInvalid},
+	} {
+		if s.set {
+			states = append(states, s.name)
+		}
+	}
+	return states
+}
+
+// SetStates sets the connection states the rule matches from names such as new or established.
+func (r *FirewallRule) SetStates(states []string) error {
+	r.StateNew, r.StateEstablished, r.StateRelated, r.StateInvalid = false, false, false, false
+	for _, s := range states {
+		switch strings.ToLower(strings.TrimSpace(s)) {
+		case "new":
+			r.StateNew = true
+		case "established":
+			r.StateEstablished = true
+		case "related":
+			r.StateRelated = true
+		case "invalid":
+			r.StateInvalid = true
+		case "":
+		default:
+			return NewArgError("state", fmt.Sprintf("%q is not one of new, established, related or invalid", s))
+		}
+	}
+	return nil
+}
+
+// Validate checks the rule has the fields the Controller requires, filling in the defaults of those left empty.
+func (r *FirewallRule) Validate() error {
+	if r.Name == "" {
+		return NewArgError("name", "cannot be empty")
+	}
+	if !isRuleset(r.Ruleset) {
+		return NewArgError("ruleset", fmt.Sprintf("%q is not one of %s", r.Ruleset, strings.Join(Rulesets, ", ")))
+	}
+	switch r.Action {
+	case "accept", "drop", "reject":
+	default:
+		return NewArgError("action", fmt.Sprintf("%q is not one of accept, drop or reject", r.Action))
+	}
+	if r.Protocol == "" {
+		r.Protocol = "all"
+	}
+	if r.SrcNetworkConfType == "" {
+		r.SrcNetworkConfType = "NETv4"
+	}
+	if r.DstNetworkConfType == "" {
+		r.DstNetworkConfType = "NETv4"
+	}
+	if r.SrcFirewallGroupIds == nil {
+		r.SrcFirewallGroupIds = []string{}
+	}
+	if r.DstFirewallGroupIds == nil {
+		r.DstFirewallGroupIds = []string{}
+	}
+	for _, ports := range []string{r.SrcPort, r.DstPort} {
+		if _, err := parsePorts(ports); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks the group has a name, a known type and members of that type.
+func (g *FirewallGroup) Validate() error {
+	if g.Name == "" {
+		return NewArgError("name", "cannot be empty")
+	}
+	if g.GroupMembers == nil {
+		g.GroupMembers = []string{}
+	}
+	switch g.GroupType {
+	case PortGroup:
+		_, err := parsePorts(strings.Join(g.GroupMembers, ","))
+		return err
+	case AddressGroup, IPv6AddressGroup:
+		for _, m := range g.GroupMembers {
+			if _, err := parseAddress(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return NewArgError("group_type", fmt.Sprintf("%q is not one of %s, %s or %s",
+		g.GroupType, AddressGroup, IPv6AddressGroup, PortGroup))
+}
+
+func isRuleset(ruleset string) bool {
+	for _, r := range Rulesets {
+		if r == ruleset {
+			return true
+		}
+	}
+	return false
+}
+
+// SortRules orders rules by ruleset, in the order of Rulesets, then by rule_index.
+func SortRules(rules []FirewallRule) {
+	order := make(map[string]int)
+	for i, r := range Rulesets {
+		order[r] = i
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Ruleset != rules[j].Ruleset {
+			return order[rules[i].Ruleset] < order[rules[j].Ruleset]
+		}
+		return rules[i].RuleIndex < rules[j].RuleIndex
+	})
+}
+
+// NextRuleIndex returns the rule_index which appends a rule to the end of the user defined rules of a ruleset.
+func NextRuleIndex(rules []FirewallRule, ruleset string) int {
+	next := FirstRuleIndex
+	for _, r := range rules {
+		if r.Ruleset == ruleset && r.RuleIndex >= next && r.RuleIndex < 4000 {
+			next = r.RuleIndex + 1
+		}
+	}
+	return next
+}
+
+// ResolveRule returns the rule identified by query, which may be its ID, its name, or its rule_index optionally
+// prefixed with the ruleset e.g. LAN_IN:2001.
+func ResolveRule(query string, rules []FirewallRule) (*FirewallRule, error) {
+	var matches []int
+	for i, r := range rules {
+		if r.ID == query {
+			return &rules[i], nil
+		}
+		index := strconv.Itoa(r.RuleIndex)
+		if strings.EqualFold(r.Name, query) || query == index || strings.EqualFold(query, r.Ruleset+":"+index) {
+			matches = append(matches, i)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, &NotFoundError{Kind: "firewall rule", Query: query}
+	case 1:
+		return &rules[matches[0]], nil
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%q matches %d firewall rules, use one of:", query, len(matches))
+	for _, i := range matches {
+		fmt.Fprintf(&buf, "\n  %s:%d %s (%s)", rules[i].Ruleset, rules[i].RuleIndex, rules[i].Name, rules[i].ID)
+	}
+	return nil, fmt.Errorf("%s", buf.String())
+}
+
+// ResolveGroup returns the group identified by its ID or name.
+func ResolveGroup(query string, groups []FirewallGroup) (*FirewallGroup, error) {
+	for i, g := range groups {
+		if g.ID == query || strings.EqualFold(g.Name, query) {
+			return &groups[i], nil
+		}
+	}
+	return nil, &NotFoundError{Kind: "firewall group", Query: query}
+}
+
+// MoveRule works out the updates which move the rule with the given id to position (counting from 0) among the
+// rules of its ruleset, reusing the rule_index values the ruleset already has. The Controller rejects two rules
+// sharing a rule_index, so the rule is first parked after the end of the ruleset, the rules in between shuffled
+// along one at a time, and the rule then put in its place. The updates are to be made in the order returned.
+func MoveRule(rules []FirewallRule, id string, position int) ([]FirewallRule, error) {
+	var moving *FirewallRule
+	for i := range rules {
+		if rules[i].ID == id {
+			moving = &rules[i]
+		}
+	}
+	if moving == nil {
+		return nil, &NotFoundError{Kind: "firewall rule", Query: id}
+	}
+
+	var ruleset []FirewallRule
+	for _, r := range rules {
+		if r.Ruleset == moving.Ruleset {
+			ruleset = append(ruleset, r)
+		}
+	}
+	SortRules(ruleset)
+	from := -1
+	for i, r := range ruleset {
+		if r.ID == id {
+			from = i
+		}
+	}
+	if position < 0 {
+		position = 0
+	}
+	if position >= len(ruleset) {
+		position = len(ruleset) - 1
+	}
+	if position == from {
+		return nil, nil
+	}
+
+	park := *moving
+	park.RuleIndex = ruleset[len(ruleset)-1].RuleIndex + 1
+	updates := []FirewallRule{park}
+	if position < from {
+		for i := from - 1; i >= position; i-- {
+			r := ruleset[i]
+			r.RuleIndex = ruleset[i+1].RuleIndex
+			updates = append(updates, r)
+		}
+	} else {
+		for i := from + 1; i <= position; i++ {
+			r := ruleset[i]
+			r.RuleIndex = ruleset[i-1].RuleIndex
+			updates = append(updates, r)
+		}
+	}
+	final := *moving
+	final.RuleIndex = ruleset[position].RuleIndex
+	return append(updates, final), nil
+}
+
+// ListRules lists the firewall rules of the site.
+func (s *FirewallServiceOp) ListRules(ctx context.Context) ([]FirewallRule, *Response, error) {
+	root := new(firewallRulesRoot)
+	resp, err := s.client.sendRest(ctx, "GET", "firewallrule", "", nil, root)
+	if err != nil {
+		return nil, resp, err
+	}
+	SortRules(root.Rules)
+	return root.Rules, resp, nil
+}
+
+// CreateRule creates a firewall rule, returning it as stored by the Controller.
+func (s *FirewallServiceOp) CreateRule(ctx context.Context, rule *FirewallRule) (*FirewallRule, *Response, error) {
+	if err := rule.Validate(); err != nil {
+		return nil, nil, err
+	}
+	root := new(firewallRulesRoot)
+	resp, err := s.client.sendRest(ctx, "POST", "firewallrule", "", rule, root)
+	return firstRule(root, resp, err)
+}
+
+// UpdateRule replaces the firewall rule with the ID of rule.
+func (s *FirewallServiceOp) UpdateRule(ctx context.Context, rule *FirewallRule) (*FirewallRule, *Response, error) {
+	if rule.ID == "" {
+		return nil, nil, NewArgError("id", "cannot be empty")
+	}
+	if err := rule.Validate(); err != nil {
+		return nil, nil, err
+	}
+	root := new(firewallRulesRoot)
+	resp, err := s.client.sendRest(ctx, "PUT", "firewallrule", rule.ID, rule, root)
+	return firstRule(root, resp, err)
+}
+
+// DeleteRule deletes the firewall rule with the given ID.
+func (s *FirewallServiceOp) DeleteRule(ctx context.Context, id string) (*Response, error) {
+	if id == "" {
+		return nil, NewArgError("id", "cannot be empty")
+	}
+	return s.client.sendRest(ctx, "DELETE", "firewallrule", id, nil, nil)
+}
+
+// ListGroups lists the firewall groups of the site.
+func (s *FirewallServiceOp) ListGroups(ctx context.Context) ([]FirewallGroup, *Response, error) {
+	root := new(firewallGroupsRoot)
+	resp, err := s.client.sendRest(ctx, "GET", "firewallgroup", "", nil, root)
+	if err != nil {
+		return nil, resp, err
+	}
+	sort.Slice(root.Groups, func(i, j int) bool { return root.Groups[i].Name < root.Groups[j].Name })
+	return root.Groups, resp, nil
+}
+
+// CreateGroup creates a firewall group, returning it as stored by the Controller.
+func (s *FirewallServiceOp) CreateGroup(ctx context.Context, group *FirewallGroup) (*FirewallGroup, *Response, error) {
+	if err := group.Validate(); err != nil {
+		return nil, nil, err
+	}
+	root := new(firewallGroupsRoot)
+	resp, err := s.client.sendRest(ctx, "POST", "firewallgroup", "", group, root)
+	return firstGroup(root, resp, err)
+}
+
+// UpdateGroup replaces the firewall group with the ID of group.
+func (s *FirewallServiceOp) UpdateGroup(ctx context.Context, group *FirewallGroup) (*FirewallGroup, *Response, error) {
+	if group.ID == "" {
+		return nil, nil, NewArgError("id", "cannot be empty")
+	}
+	if err := group.Validate(); err != nil {
+		return nil, nil, err
+	}
+	root := new(firewallGroupsRoot)
+	resp, err := s.client.sendRest(ctx, "PUT", "firewallgroup", group.ID, group, root)
+	return firstGroup(root, resp, err)
+}
+
+// DeleteGroup deletes the firewall group with the given ID. The Controller refuses while a rule still uses it.
+func (s *FirewallServiceOp) DeleteGroup(ctx context.Context, id string) (*Response, error) {
+	if id == "" {
+		return nil, NewArgError("id", "cannot be empty")
+	}
+	return s.client.sendRest(ctx, "DELETE", "firewallgroup", id, nil, nil)
+}
+
+func firstRule(root *firewallRulesRoot, resp *Response, err error) (*FirewallRule, *Response, error) {
+	if err != nil {
+		return nil, resp, err
+	}
+	if len(root.Rules) == 0 {
+		return nil, resp, fmt.Errorf("unifi: the Controller returned no firewall rule")
+	}
+	return &root.Rules[0], resp, nil
+}
+
+func firstGroup(root *firewallGroupsRoot, resp *Response, err error) (*FirewallGroup, *Response, error) {
+	if err != nil {
+		return nil, resp, err
+	}
+	if len(root.Groups) == 0 {
+		return nil, resp, fmt.Errorf("unifi: the Controller returned no firewall group")
+	}
+	return &root.Groups[0], resp, nil
+}
@@ -0,0 +1,310 @@
+package unifi
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Shadow is a firewall rule which can never match as an earlier rule of the same ruleset matches all of the
+// traffic it would.
+type Shadow struct {
+	Rule FirewallRule
+	By   FirewallRule
+}
+
+// Redundant reports whether the shadowing rule takes the same action, so removing the shadowed rule changes
+// nothing, rather than the shadowed rule's action never being taken.
+func (s Shadow) Redundant() bool {
+	return s.Rule.Action == s.By.Action
+}
+
+func (s Shadow) String() string {
+	verdict := "can never match"
+	if s.Redundant() {
+		verdict = "is redundant"
+	}
+	return fmt.Sprintf("%s:%d %q %s, rule %d %q (%s) matches everything it would first",
+		s.Rule.Ruleset, s.Rule.RuleIndex, s.Rule.Name, verdict, s.By.RuleIndex, s.By.Name, s.By.Action)
+}
+
+// FindShadowed returns the enabled rules which can never match because an earlier enabled rule of the same
+// ruleset covers everything they would match. networks maps the ID of each network to its ip_subnet
+// e.g. 192.168.1.1/24, letting rules matching a network be compared with those matching addresses. Rules are only
+// reported when coverage can be proven, so rules referring to unknown groups or networks are given the benefit of
+// the doubt.
+func FindShadowed(rules []FirewallRule, groups []FirewallGroup, networks map[string]string) []Shadow {
+	sorted := make([]FirewallRule, len(rules))
+	copy(sorted, rules)
+	SortRules(sorted)
+
+	byID := make(map[string]FirewallGroup)
+	for _, g := range groups {
+		byID[g.ID] = g
+	}
+
+	var shadows []Shadow
+	for i, rule := range sorted {
+		if !rule.IsEnabled {
+			continue
+		}
+		for _, earlier := range sorted[:i] {
+			if earlier.IsEnabled && earlier.Ruleset == rule.Ruleset && covers(earlier, rule, byID, networks) {
+				shadows = append(shadows, Shadow{Rule: rule, By: earlier})
+				break
+			}
+		}
+	}
+	return shadows
+}
+
+// covers reports whether rule a matches all the traffic rule b does.
+func covers(a, b FirewallRule, groups map[string]FirewallGroup, networks map[string]string) bool {
+	if !protocolCovers(a, b) || !statesCover(a, b) {
+		return false
+	}
+	if a.IcmpTypeName != "" && a.IcmpTypeName != b.IcmpTypeName {
+		return false
+	}
+	if a.IPSec != "" && a.IPSec != b.IPSec {
+		return false
+	}
+	return a.source(groups, networks).covers(b.source(groups, networks)) &&
+		a.destination(groups, networks).covers(b.destination(groups, networks))
+}
+
+func (r FirewallRule) source(groups map[string]FirewallGroup, networks map[string]string) endpoint {
+	return newEndpoint(r.SrcFirewallGroupIds, r.SrcAddress, r.SrcMacAddress, r.SrcNetworkConfId,
+		r.SrcNetworkConfType, r.SrcPort, groups, networks)
+}
+
+func (r FirewallRule) destination(groups map[string]FirewallGroup, networks map[string]string) endpoint {
+	return newEndpoint(r.DstFirewallGroupIds, r.DstAddress, "", r.DstNetworkConfId,
+		r.DstNetworkConfType, r.DstPort, groups, networks)
+}
+
+func protocolCovers(a, b FirewallRule) bool {
+	if a.ProtocolMatchExcepted || b.ProtocolMatchExcepted {
+		return a.ProtocolMatchExcepted == b.ProtocolMatchExcepted && a.Protocol == b.Protocol
+	}
+	switch {
+	case a.Protocol == "" || a.Protocol == "all" || a.Protocol == b.Protocol:
+		return true
+	case a.Protocol == "tcp_udp":
+		return b.Protocol == "tcp" || b.Protocol == "udp"
+	}
+	return false
+}
+
+// statesCover compares the connection states matched, a rule without any matching every state.
+func statesCover(a, b FirewallRule) bool {
+	as, bs := a.States(), b.States()
+	if len(as) == 0 {
+		return true
+	}
+	if len(bs) == 0 {
+		return false
+	}
+	for _, s := range bs {
+		found := false
+		for _, t := range as {
+			found = found || s == t
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// endpoint is the source or destination of a rule. Each list of addresses is a separate condition which must all
+// hold, nil ports match any port and unknown is set when a group or network could not be resolved.
+type endpoint struct {
+	addrs   [][]addrRange
+	ports   []portRange
+	mac     string
+	network string
+	unknown bool
+}
+
+func newEndpoint(
+	groupIDs []string,
+	address, mac, networkID, networkType, ports string,
+	groups map[string]FirewallGroup,
+	networks map[string]string) endpoint {
+
+	var e endpoint
+	for _, id := range groupIDs {
+		g, ok := groups[id]
+		if !ok {
+			e.unknown = true
+			continue
+		}
+		if g.GroupType == PortGroup {
+			p, err := parsePorts(strings.Join(g.GroupMembers, ","))
+			e.unknown = e.unknown || err != nil
+			e.ports = append(e.ports, p...)
+			continue
+		}
+		var addrs []addrRange
+		for _, m := range g.GroupMembers {
+			r, err := parseAddress(m)
+			e.unknown = e.unknown || err != nil
+			addrs = append(addrs, r)
+		}
+		e.addrs = append(e.addrs, addrs)
+	}
+	if address != "" {
+		r, err := parseAddress(address)
+		e.unknown = e.unknown || err != nil
+		e.addrs = append(e.addrs, []addrRange{r})
+	}
+	if networkID != "" {
+		if r, ok := networkRange(networks[networkID], networkType); ok {
+			e.addrs = append(e.addrs, []addrRange{r})
+		} else {
+			e.network = networkID + "/" + networkType
+		}
+	}
+	if ports != "" {
+		p, err := parsePorts(ports)
+		e.unknown = e.unknown || err != nil
+		e.ports = append(e.ports, p...)
+	}
+	e.mac = strings.ToLower(mac)
+	return e
+}
+
+// covers reports whether e matches everything o does.
+func (e endpoint) covers(o endpoint) bool {
+	if e.unknown || o.unknown {
+		return len(e.addrs) == 0 && e.ports == nil && e.mac == "" && e.network == "" && !e.unknown
+	}
+	if e.mac != "" && e.mac != o.mac {
+		return false
+	}
+	if e.network != "" && e.network != o.network {
+		return false
+	}
+	if e.ports != nil && (o.ports == nil || !portsWithin(o.ports, e.ports)) {
+		return false
+	}
+	for _, cond := range e.addrs {
+		within := false
+		for _, other := range o.addrs {
+			within = within || addrsWithin(other, cond)
+		}
+		if !within {
+			return false
+		}
+	}
+	return true
+}
+
+type portRange struct{ lo, hi int }
+
+// parsePorts parses ports such as 80,443,8000-8080, an empty string meaning any port.
+func parsePorts(s string) ([]portRange, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var ranges []portRange
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(part), "-", 2)
+		lo, err := strconv.Atoi(bounds[0])
+		hi := lo
+		if err == nil && len(bounds) == 2 {
+			hi, err = strconv.Atoi(bounds[1])
+		}
+		if err != nil || lo < 1 || hi > 65535 || lo > hi {
+			return nil, NewArgError("port", fmt.Sprintf("%q is not a port or range of ports e.g. 80 or 8000-8080", part))
+		}
+		ranges = append(ranges, portRange{lo, hi})
+	}
+	return ranges, nil
+}
+
+// portsWithin reports whether every port of inner is among outer.
+func portsWithin(inner, outer []portRange) bool {
+	for _, in := range inner {
+		for p := in.lo; p <= in.hi; p++ {
+			found := false
+			for _, out := range outer {
+				if p >= out.lo && p <= out.hi {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+type addrRange struct{ lo, hi net.IP }
+
+// parseAddress parses an IP address, a CIDR or a range of addresses such as 10.0.0.1-10.0.0.9.
+func parseAddress(s string) (addrRange, error) {
+	s = strings.TrimSpace(s)
+	if _, n, err := net.ParseCIDR(s); err == nil {
+		return cidrRange(n), nil
+	}
+	bounds := strings.SplitN(s, "-", 2)
+	lo := net.ParseIP(strings.TrimSpace(bounds[0]))
+	hi := lo
+	if len(bounds) == 2 {
+		hi = net.ParseIP(strings.TrimSpace(bounds[1]))
+	}
+	if lo == nil || hi == nil || bytes.Compare(lo.To16(), hi.To16()) > 0 {
+		return addrRange{}, NewArgError("address", fmt.Sprintf("%q is not an address, CIDR or range of addresses", s))
+	}
+	return addrRange{lo.To16(), hi.To16()}, nil
+}
+
+func cidrRange(n *net.IPNet) addrRange {
+	lo := n.IP.Mask(n.Mask)
+	hi := make(net.IP, len(lo))
+	for i := range lo {
+		hi[i] = lo[i] | ^n.Mask[i]
+	}
+	return addrRange{lo.To16(), hi.To16()}
+}
+
+// networkRange converts the ip_subnet of a network, e.g. 192.168.1.1/24, into the addresses matched by a rule
+// referring to it: the whole subnet for NETv4 or just the gateway address for ADDRv4.
+func networkRange(subnet, networkType string) (addrRange, bool) {
+	ip, n, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return addrRange{}, false
+	}
+	if networkType == "ADDRv4" {
+		return addrRange{ip.To16(), ip.To16()}, true
+	}
+	return cidrRange(n), true
+}
+
+// addrsWithin reports whether every address of inner falls within one of the ranges of outer.
+func addrsWithin(inner, outer []addrRange) bool {
+	for _, in := range inner {
+		found := false
+		for _, out := range outer {
+			if bytes.Compare(in.lo, out.lo) >= 0 && bytes.Compare(in.hi, out.hi) <= 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// rangesOverlap reports whether any address falls within both a and b.
+func rangesOverlap(a, b addrRange) bool {
+	return bytes.Compare(a.lo, b.hi) <= 0 && bytes.Compare(b.lo, a.hi) <= 0
+}
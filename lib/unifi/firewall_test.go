@@ -0,0 +1,93 @@
+package unifi
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestFindShadowed(t *testing.T) {
+	groups := []FirewallGroup{
+		{ID: "g1", Name: "Servers", GroupType: AddressGroup, GroupMembers: []string{"10.0.0.0/24"}},
+		{ID: "g2", Name: "Web", GroupType: PortGroup, GroupMembers: []string{"80", "443"}},
+	}
+	networks := map[string]string{"n1": "192.168.1.1/24"}
+	rule := func(index int, name, action string) FirewallRule {
+		return FirewallRule{ID: name, Name: name, Ruleset: LanIn, RuleIndex: index, Action: action, IsEnabled: true,
+			Protocol: "all"}
+	}
+
+	broad := rule(2000, "drop servers", "drop")
+	broad.DstFirewallGroupIds = []string{"g1"}
+	web := rule(2001, "allow web", "accept")
+	web.Protocol, web.DstAddress, web.DstPort = "tcp", "10.0.0.5", "443"
+	other := rule(2002, "allow other", "accept")
+	other.DstAddress = "10.0.1.5"
+	lan := rule(2003, "drop lan", "drop")
+	lan.SrcNetworkConfId, lan.SrcNetworkConfType = "n1", "NETv4"
+	host := rule(2004, "drop host", "drop")
+	host.SrcAddress = "192.168.1.20"
+	established := rule(2005, "allow established", "accept")
+	established.StateEstablished = true
+	unknown := rule(1999, "unknown group", "accept")
+	unknown.SrcFirewallGroupIds = []string{"missing"}
+	disabled := rule(1998, "disabled", "drop")
+	disabled.IsEnabled = false
+
+	shadows := FindShadowed(
+		[]FirewallRule{established, host, lan, other, web, broad, unknown, disabled}, groups, networks)
+	var got []string
+	for _, s := range shadows {
+		got = append(got, s.Rule.Name+" < "+s.By.Name)
+	}
+	want := []string{"allow web < drop servers", "drop host < drop lan"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindShadowed() = %q, want %q", got, want)
+	}
+	if shadows[0].Redundant() || !shadows[1].Redundant() {
+		t.Errorf("Redundant() = %v, %v; want false, true", shadows[0].Redundant(), shadows[1].Redundant())
+	}
+}
+
+func TestMoveRule(t *testing.T) {
+	rules := []FirewallRule{
+		{ID: "a", Ruleset: LanIn, RuleIndex: 2000},
+		{ID: "b", Ruleset: LanIn, RuleIndex: 2001},
+		{ID: "x", Ruleset: WanIn, RuleIndex: 2002},
+		{ID: "c", Ruleset: LanIn, RuleIndex: 2005},
+	}
+	updates, err := MoveRule(rules, "c", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, u := range updates {
+		got = append(got, fmt.Sprintf("%s=%d", u.ID, u.RuleIndex))
+	}
+	want := []string{"c=2006", "b=2005", "a=2001", "c=2000"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MoveRule() = %v, want %v", got, want)
+	}
+
+	if updates, _ := MoveRule(rules, "a", 0); len(updates) != 0 {
+		t.Errorf("MoveRule() to the same place = %v, want nothing", updates)
+	}
+	if _, err := MoveRule(rules, "missing", 0); err == nil {
+		t.Error("MoveRule() of a missing rule succeeded")
+	}
+}
+
+func TestNextRuleIndex(t *testing.T) {
+	rules := []FirewallRule{
+		{Ruleset: LanIn, RuleIndex: 2000},
+		{Ruleset: LanIn, RuleIndex: 2003},
+		{Ruleset: LanIn, RuleIndex: 4000},
+		{Ruleset: WanIn, RuleIndex: 2010},
+	}
+	if got := NextRuleIndex(rules, LanIn); got != 2004 {
+		t.Errorf("NextRuleIndex(LAN_IN) = %d, want 2004", got)
+	}
+	if got := NextRuleIndex(rules, GuestIn); got != FirstRuleIndex {
+		t.Errorf("NextRuleIndex(GUEST_IN) = %d, want %d", got, FirstRuleIndex)
+	}
+}
@@ -0,0 +1,300 @@
+package unifi
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HealthService is an interface for interfacing with the health and system information of a site.
+type HealthService interface {
+	Subsystems(ctx context.Context) ([]Subsystem, *Response, error)
+	SysInfo(ctx context.Context) (*SysInfo, *Response, error)
+}
+
+// HealthServiceOp handles communication with the stat/health and stat/sysinfo endpoints of the UniFi API.
+type HealthServiceOp struct {
+	client *UniFiClient
+}
+
+var _ HealthService = &HealthServiceOp{}
+
+// Number is a number the UniFi Controller sends as either a JSON number or a string, e.g. the CPU usage in
+// gw_system-stats. null or an empty string leaves zero.
+type Number float64
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (n *Number) UnmarshalJSON(data []byte) error {
+	str := strings.Trim(string(data), `"`)
+	if str == "" || str == "null" {
+		*n = 0
+		return nil
+	}
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return fmt.Errorf("unifi: invalid number %s", data)
+	}
+	*n = Number(f)
+	return nil
+}
+
+// Subsystem is the health of one part of a site as reported by stat/health: wan, www, wlan, lan or vpn. Which
+// fields are set depends on the subsystem.
+type Subsystem struct {
+	Name            string `json:"subsystem"`
+	Status          string `json:"status"`
+	NumUser         int    `json:"num_user,omitempty"`
+	NumGuest        int    `json:"num_guest,omitempty"`
+	NumAdopted      int    `json:"num_adopted,omitempty"`
+	NumDisconnected int    `json:"num_disconnected,omitempty"`
+	NumPending      int    `json:"num_pending,omitempty"`
+	NumAP           int    `json:"num_ap,omitempty"`
+	NumSwitch       int    `json:"num_sw,omitempty"`
+	NumGateway      int    `json:"num_gw,omitempty"`
+	TxBytesRate     Number `json:"tx_bytes-r,omitempty"`
+	RxBytesRate     Number `json:"rx_bytes-r,omitempty"`
+
+	// wan
+	WanIP          string      `json:"wan_ip,omitempty"`
+	ISPName        string      `json:"isp_name,omitempty"`
+	ISPOrg         string      `json:"isp_organization,omitempty"`
+	Gateways       []string    `json:"gateways,omitempty"`
+	GatewayName    string      `json:"gw_name,omitempty"`
+	GatewayVersion string      `json:"gw_version,omitempty"`
+	GatewayStats   SystemStats `json:"gw_system-stats"`
+
+	// www
+	Latency       Number `json:"latency,omitempty"`
+	Uptime        Number `json:"uptime,omitempty"`
+	Drops         Number `json:"drops,omitempty"`
+	XputUp        Number `json:"xput_up,omitempty"`
+	XputDown      Number `json:"xput_down,omitempty"`
+	SpeedtestPing Number `json:"speedtest_ping,omitempty"`
+
+	// lan
+	LanIP string `json:"lan_ip,omitempty"`
+
+	// vpn
+	RemoteUserEnabled   bool `json:"remote_user_enabled,omitempty"`
+	RemoteUserNumActive int  `json:"remote_user_num_active,omitempty"`
+	SiteToSiteEnabled   bool `json:"site_to_site_enabled,omitempty"`
+}
+
+// SysInfo is the information about the UniFi Controller reported by stat/sysinfo.
+type SysInfo struct {
+	Name             string `json:"name"`
+	Hostname         string `json:"hostname"`
+	Version          string `json:"version"`
+	Build            string `json:"build"`
+	Timezone         string `json:"timezone"`
+	Uptime           Number `json:"uptime,omitempty"`
+	UpdateAvailable  bool   `json:"update_available"`
+	UpdateDownloaded bool   `json:"update_downloaded"`
+}
+
+type subsystemsRoot struct {
+	Subsystems []Subsystem `json:"data"`
+}
+
+type sysInfoRoot struct {
+	SysInfo []SysInfo `json:"data"`
+}
+
+// HealthState is the outcome of assessing a subsystem, its value being the exit code a Nagios plugin reports it
+// with.
+type HealthState int
+
+// The states of a subsystem, in the order Nagios plugins number them.
+const (
+	HealthOK HealthState = iota
+	HealthWarning
+	HealthCritical
+	HealthUnknown
+)
+
+func (s HealthState) String() string {
+	switch s {
+	case HealthOK:
+		return "OK"
+	case HealthWarning:
+		return "WARNING"
+	case HealthCritical:
+		return "CRITICAL"
+	}
+	return "UNKNOWN"
+}
+
+// Worse reports whether s is a more severe state than t, UNKNOWN ranking between WARNING and CRITICAL.
+func (s HealthState) Worse(t HealthState) bool {
+	rank := map[HealthState]int{HealthOK: 0, HealthWarning: 1, HealthUnknown: 2, HealthCritical: 3}
+	return rank[s] > rank[t]
+}
+
+// HealthThresholds are the limits beyond which a subsystem reported ok is still taken to be degraded. Zero
+// disables a limit.
+type HealthThresholds struct {
+	Latency float64 // milliseconds from the gateway to the internet
+	CPU     float64 // percentage of the gateway CPU in use
+	Mem     float64 // percentage of the gateway memory in use
+}
+
+// Assessment is the state of a subsystem with the reasons for anything other than OK.
+type Assessment struct {
+	Subsystem string
+	State     HealthState
+	Problems  []string
+}
+
+// Assess works out the state of each subsystem from the status the Controller reports for it and the thresholds.
+// Subsystems whose status is unknown, such as vpn when no VPN is configured, are OK as there is nothing to check.
+func Assess(subsystems []Subsystem, t HealthThresholds) []Assessment {
+	var assessments []Assessment
+	for _, s := range subsystems {
+		a := Assessment{Subsystem: s.Name}
+		switch s.Status {
+		case "ok", "unknown", "":
+		case "warning":
+			a.State = HealthWarning
+			a.Problems = append(a.Problems, s.Name+" status is warning")
+		default:
+			a.State = HealthCritical
+			a.Problems = append(a.Problems, fmt.Sprintf("%s status is %s", s.Name, s.Status))
+		}
+		if s.NumDisconnected > 0 {
+			a.warn(fmt.Sprintf("%d %s device(s) disconnected", s.NumDisconnected, s.Name))
+		}
+		if t.Latency > 0 && float64(s.Latency) > t.Latency {
+			a.warn(fmt.Sprintf("latency %gms above %gms", s.Latency, t.Latency))
+		}
+		if t.CPU > 0 && float64(s.GatewayStats.CPU) > t.CPU {
+			a.warn(fmt.Sprintf("gateway CPU %g%% above %g%%", s.GatewayStats.CPU, t.CPU))
+		}
+		if t.Mem > 0 && float64(s.GatewayStats.Mem) > t.Mem {
+			a.warn(fmt.Sprintf("gateway memory %g%% above %g%%", s.GatewayStats.Mem, t.Mem))
+		}
+		assessments = append(assessments, a)
+	}
+	return assessments
+}
+
+func (a *Assessment) warn(problem string) {
+	if HealthWarning.Worse(a.State) {
+		a.State = HealthWarning
+	}
+	a.Problems = append(a.Problems, problem)
+}
+
+// Worst returns the most severe state of the assessments, OK if there are none.
+func Worst(assessments []Assessment) HealthState {
+	worst := HealthOK
+	for _, a := range assessments {
+		if a.State.Worse(worst) {
+			worst = a.State
+		}
+	}
+	return worst
+}
+
+// Summary describes the subsystem in a line e.g. "81.2.3.4 (BT), UGW3 4.4.44, CPU 5% mem 38%, up 12d".
+func (s Subsystem) Summary() string {
+	var parts []string
+	add := func(format string, args ...interface{}) { parts = append(parts, fmt.Sprintf(format, args...)) }
+	switch s.Name {
+	case "wan":
+		isp := s.ISPName
+		if isp == "" {
+			isp = s.ISPOrg
+		}
+		if isp != "" {
+			add("%s (%s)", s.WanIP, isp)
+		} else if s.WanIP != "" {
+			add("%s", s.WanIP)
+		}
+		if s.GatewayName != "" {
+			add("%s %s", s.GatewayName, s.GatewayVersion)
+		}
+		if s.GatewayStats.Uptime > 0 {
+			add("CPU %g%% mem %g%%, up %s", s.GatewayStats.CPU, s.GatewayStats.Mem,
+				HumanizeDuration(time.Duration(s.GatewayStats.Uptime)*time.Second))
+		}
+	case "www":
+		if s.Status != "unknown" {
+			add("latency %gms", s.Latency)
+		}
+		if s.Uptime > 0 {
+			add("up %s", HumanizeDuration(time.Duration(s.Uptime)*time.Second))
+		}
+		if s.XputDown > 0 || s.XputUp > 0 {
+			add("speedtest %g/%g Mbps", s.XputDown, s.XputUp)
+		}
+		if s.Drops > 0 {
+			add("%g drops", s.Drops)
+		}
+	case "wlan", "lan":
+		devices, kind := s.NumAP, "APs"
+		if s.Name == "lan" {
+			devices, kind = s.NumSwitch, "switches"
+		}
+		add("%d %s (%d disconnected, %d pending)", devices, kind, s.NumDisconnected, s.NumPending)
+		add("%d clients, %d guests", s.NumUser, s.NumGuest)
+	case "vpn":
+		if s.RemoteUserEnabled {
+			add("remote user %d active", s.RemoteUserNumActive)
+		}
+		if s.SiteToSiteEnabled {
+			add("site-to-site enabled")
+		}
+	}
+	if s.RxBytesRate > 0 || s.TxBytesRate > 0 {
+		add("rx %s tx %s", FormatRate(float64(s.RxBytesRate)), FormatRate(float64(s.TxBytesRate)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// FormatRate formats a rate in bytes per second as bits per second e.g. "12.5 Mbps".
+func FormatRate(bytesPerSecond float64) string {
+	bits := bytesPerSecond * 8
+	for _, unit := range []string{"bps", "kbps", "Mbps", "Gbps"} {
+		if bits < 1000 || unit == "Gbps" {
+			if unit == "bps" {
+				return fmt.Sprintf("%.0f %s", bits, unit)
+			}
+			return fmt.Sprintf("%.1f %s", bits, unit)
+		}
+		bits /= 1000
+	}
+	return ""
+}
+
+// Subsystems lists the health of each subsystem of the site.
+func (s *HealthServiceOp) Subsystems(ctx context.Context) ([]Subsystem, *Response, error) {
+	req, err := s.client.NewRequest(ctx, "GET", *s.client.buildURL(statHealthBasePath), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	root := new(subsystemsRoot)
+	resp, err := s.client.Do(req, root)
+	if err != nil {
+		return nil, resp, err
+	}
+	return root.Subsystems, resp, nil
+}
+
+// SysInfo returns the information about the Controller, such as its version and whether an update is available.
+func (s *HealthServiceOp) SysInfo(ctx context.Context) (*SysInfo, *Response, error) {
+	req, err := s.client.NewRequest(ctx, "GET", *s.client.buildURL(statSysInfoBasePath), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	root := new(sysInfoRoot)
+	resp, err := s.client.Do(req, root)
+	if err != nil {
+		return nil, resp, err
+	}
+	if len(root.SysInfo) == 0 {
+		return nil, resp, fmt.Errorf("unifi: the Controller returned no sysinfo")
+	}
+	return &root.SysInfo[0], resp, nil
+}
@@ -0,0 +1,51 @@
+package unifi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestAssess(t *testing.T) {
+	var subsystems []Subsystem
+	data := `[
+		{"subsystem": "wan", "status": "ok", "gw_system-stats": {"cpu": "91.5", "mem": "40", "uptime": "86400"}},
+		{"subsystem": "www", "status": "ok", "latency": 12},
+		{"subsystem": "wlan", "status": "warning", "num_ap": 3, "num_disconnected": 1},
+		{"subsystem": "lan", "status": "error"},
+		{"subsystem": "vpn", "status": "unknown"}
+	]`
+	if err := json.Unmarshal([]byte(data), &subsystems); err != nil {
+		t.Fatal(err)
+	}
+	if got := subsystems[0].GatewayStats.CPU; got != 91.5 {
+		t.Errorf("gw_system-stats cpu = %v, want 91.5", got)
+	}
+
+	assessments := Assess(subsystems, HealthThresholds{Latency: 10, CPU: 90})
+	var got []HealthState
+	for _, a := range assessments {
+		got = append(got, a.State)
+	}
+	want := []HealthState{HealthWarning, HealthWarning, HealthWarning, HealthCritical, HealthOK}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Assess() = %v, want %v", got, want)
+	}
+	if n := len(assessments[2].Problems); n != 2 {
+		t.Errorf("wlan problems = %q, want the status and the disconnected AP", assessments[2].Problems)
+	}
+	if worst := Worst(assessments); worst != HealthCritical {
+		t.Errorf("Worst() = %v, want CRITICAL", worst)
+	}
+	if worst := Worst(assessments[4:]); worst != HealthOK {
+		t.Errorf("Worst() of vpn = %v, want OK", worst)
+	}
+}
+
+func TestFormatRate(t *testing.T) {
+	for rate, want := range map[float64]string{0: "0 bps", 100: "800 bps", 1562500: "12.5 Mbps", 2.5e9: "20.0 Gbps"} {
+		if got := FormatRate(rate); got != want {
+			t.Errorf("FormatRate(%v) = %q, want %q", rate, got, want)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package unifi
 
 const (
 	devMgrCmdBasePath = "/cmd/devmgr"
+	evtMgrCmdBasePath = "/cmd/evtmgr"
 	cmdStaMgrCmdBasePath = "/cmd/stamgr"
+	restBasePath = "/rest"
 	restDeviceCmdBasePath = "/rest/device"
 	stateDeviceBasePath = "/stat/device"
 	updDeviceCmdBasePath = "/upd/device"
@@ -10,4 +12,10 @@ const (
 	logoutBasePath = "/api/logoff"
 	eventsBasePath = "/list/event"
 	alarmsBasePath = "/list/alarm"
+	statEventsBasePath = "/stat/event"
+	statStaBasePath = "/stat/sta"
+	listUserBasePath = "/list/user"
+	statHealthBasePath = "/stat/health"
+	statSysInfoBasePath = "/stat/sysinfo"
+	getSettingBasePath = "/get/setting"
 )
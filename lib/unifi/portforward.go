@@ -0,0 +1,242 @@
+package unifi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// PortForwardService is an interface for interfacing with the port forwards of the gateway of a site.
+type PortForwardService interface {
+	List(ctx context.Context) ([]PortForward, *Response, error)
+	Create(ctx context.Context, forward *PortForward) (*PortForward, *Response, error)
+	Update(ctx context.Context, forward *PortForward) (*PortForward, *Response, error)
+	Delete(ctx context.Context, id string) (*Response, error)
+}
+
+// PortForwardServiceOp handles communication with the portforward collection of the UniFi API.
+type PortForwardServiceOp struct {
+	client *UniFiClient
+}
+
+var _ PortForwardService = &PortForwardServiceOp{}
+
+// PortForward forwards traffic arriving at the WAN of the gateway on DstPort to FwdPort of the host Fwd.
+type PortForward struct {
+	ID        string `json:"_id,omitempty"`
+	SiteId    string `json:"site_id,omitempty"`
+	Name      string `json:"name"`
+	IsEnabled bool   `json:"enabled"`
+	IsLogging bool   `json:"log"`
+	Interface string `json:"pfwd_interface"`
+	Protocol  string `json:"proto"`
+	Src       string `json:"src"`
+	DstPort   string `json:"dst_port"`
+	Fwd       string `json:"fwd"`
+	FwdPort   string `json:"fwd_port"`
+}
+
+type portForwardsRoot struct {
+	Forwards []PortForward `json:"data"`
+}
+
+// Validate checks the forward has the fields the Controller requires, filling in the defaults of those left empty.
+func (f *PortForward) Validate() error {
+	if f.Name == "" {
+		return NewArgError("name", "cannot be empty")
+	}
+	if f.Interface == "" {
+		f.Interface = "wan"
+	}
+	switch f.Interface {
+	case "wan", "wan2", "both":
+	default:
+		return NewArgError("pfwd_interface", fmt.Sprintf("%q is not one of wan, wan2 or both", f.Interface))
+	}
+	if f.Protocol == "" {
+		f.Protocol = "tcp_udp"
+	}
+	switch f.Protocol {
+	case "tcp", "udp", "tcp_udp":
+	default:
+		return NewArgError("proto", fmt.Sprintf("%q is not one of tcp, udp or tcp_udp", f.Protocol))
+	}
+	if f.Src == "" {
+		f.Src = "any"
+	}
+	if f.Src != "any" {
+		if _, err := parseAddress(f.Src); err != nil {
+			return err
+		}
+	}
+
+	dst, err := parsePorts(f.DstPort)
+	if err != nil {
+		return err
+	}
+	if len(dst) == 0 {
+		return NewArgError("dst_port", "cannot be empty")
+	}
+	if f.FwdPort == "" {
+		f.FwdPort = f.DstPort
+	}
+	fwd, err := parsePorts(f.FwdPort)
+	if err != nil {
+		return err
+	}
+	if len(fwd) != 1 || (fwd[0].lo != fwd[0].hi && countPorts(fwd) != countPorts(dst)) {
+		return NewArgError("fwd_port", fmt.Sprintf("%q must be a single port or a range the size of %q",
+			f.FwdPort, f.DstPort))
+	}
+	if ip := net.ParseIP(f.Fwd); ip == nil || ip.To4() == nil {
+		return NewArgError("fwd", fmt.Sprintf("%q is not an IPv4 address", f.Fwd))
+	}
+	return nil
+}
+
+// CheckPortForward checks forward, which must already be valid, against the site: the host forwarded to must be on
+// one of the networks, given as a map of ID to ip_subnet as returned by Subnets, and no other enabled forward may
+// already claim any of the same ports, protocols, interfaces and sources.
+func CheckPortForward(forward PortForward, forwards []PortForward, networks map[string]string) error {
+	if !onNetwork(forward.Fwd, networks) {
+		return NewArgError("fwd", fmt.Sprintf("%s is not on any of the networks of the site", forward.Fwd))
+	}
+	if !forward.IsEnabled {
+		return nil
+	}
+	for _, other := range forwards {
+		if other.ID == forward.ID || !other.IsEnabled || !forward.overlaps(other) {
+			continue
+		}
+		return fmt.Errorf("%s port %s on %s conflicts with the port forward %q (%s port %s on %s)",
+			forward.Protocol, forward.DstPort, forward.Interface,
+			other.Name, other.Protocol, other.DstPort, other.Interface)
+	}
+	return nil
+}
+
+// overlaps reports whether some connection would match both f and o.
+func (f PortForward) overlaps(o PortForward) bool {
+	if f.Protocol != o.Protocol && f.Protocol != "tcp_udp" && o.Protocol != "tcp_udp" {
+		return false
+	}
+	if f.Interface != o.Interface && f.Interface != "both" && o.Interface != "both" {
+		return false
+	}
+	if f.Src != o.Src && f.Src != "any" && o.Src != "any" {
+		a, errA := parseAddress(f.Src)
+		b, errB := parseAddress(o.Src)
+		if errA == nil && errB == nil && !rangesOverlap(a, b) {
+			return false
+		}
+	}
+	a, errA := parsePorts(f.DstPort)
+	b, errB := parsePorts(o.DstPort)
+	if errA != nil || errB != nil {
+		return false
+	}
+	for _, x := range a {
+		for _, y := range b {
+			if x.lo <= y.hi && y.lo <= x.hi {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func countPorts(ranges []portRange) int {
+	n := 0
+	for _, r := range ranges {
+		n += r.hi - r.lo + 1
+	}
+	return n
+}
+
+// onNetwork reports whether the address ip falls within one of networks, a map of ID to ip_subnet.
+func onNetwork(ip string, networks map[string]string) bool {
+	addr, err := parseAddress(ip)
+	if err != nil {
+		return false
+	}
+	for _, subnet := range networks {
+		if r, ok := networkRange(subnet, "NETv4"); ok && addrsWithin([]addrRange{addr}, []addrRange{r}) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolvePortForward returns the port forward identified by its ID, name or destination port.
+func ResolvePortForward(query string, forwards []PortForward) (*PortForward, error) {
+	var matches []int
+	for i, f := range forwards {
+		if f.ID == query {
+			return &forwards[i], nil
+		}
+		if strings.EqualFold(f.Name, query) || f.DstPort == query {
+			matches = append(matches, i)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, &NotFoundError{Kind: "port forward", Query: query}
+	case 1:
+		return &forwards[matches[0]], nil
+	}
+	return nil, fmt.Errorf("%q matches %d port forwards, use the ID of one", query, len(matches))
+}
+
+// List lists the port forwards of the site, ordered by name.
+func (s *PortForwardServiceOp) List(ctx context.Context) ([]PortForward, *Response, error) {
+	root := new(portForwardsRoot)
+	resp, err := s.client.sendRest(ctx, "GET", "portforward", "", nil, root)
+	if err != nil {
+		return nil, resp, err
+	}
+	sort.Slice(root.Forwards, func(i, j int) bool { return root.Forwards[i].Name < root.Forwards[j].Name })
+	return root.Forwards, resp, nil
+}
+
+// Create creates a port forward, returning it as stored by the Controller.
+func (s *PortForwardServiceOp) Create(ctx context.Context, forward *PortForward) (*PortForward, *Response, error) {
+	if err := forward.Validate(); err != nil {
+		return nil, nil, err
+	}
+	root := new(portForwardsRoot)
+	resp, err := s.client.sendRest(ctx, "POST", "portforward", "", forward, root)
+	return firstPortForward(root, resp, err)
+}
+
+// Update replaces the port forward with the ID of forward.
+func (s *PortForwardServiceOp) Update(ctx context.Context, forward *PortForward) (*PortForward, *Response, error) {
+	if forward.ID == "" {
+		return nil, nil, NewArgError("id", "cannot be empty")
+	}
+	if err := forward.Validate(); err != nil {
+		return nil, nil, err
+	}
+	root := new(portForwardsRoot)
+	resp, err := s.client.sendRest(ctx, "PUT", "portforward", forward.ID, forward, root)
+	return firstPortForward(root, resp, err)
+}
+
+// Delete deletes the port forward with the given ID.
+func (s *PortForwardServiceOp) Delete(ctx context.Context, id string) (*Response, error) {
+	if id == "" {
+		return nil, NewArgError("id", "cannot be empty")
+	}
+	return s.client.sendRest(ctx, "DELETE", "portforward", id, nil, nil)
+}
+
+func firstPortForward(root *portForwardsRoot, resp *Response, err error) (*PortForward, *Response, error) {
+	if err != nil {
+		return nil, resp, err
+	}
+	if len(root.Forwards) == 0 {
+		return nil, resp, fmt.Errorf("unifi: the Controller returned no port forward")
+	}
+	return &root.Forwards[0], resp, nil
+}
@@ -0,0 +1,58 @@
+package unifi
+
+import "testing"
+
+func TestCheckPortForward(t *testing.T) {
+	networks := map[string]string{"n1": "192.168.1.1/24"}
+	forwards := []PortForward{
+		{ID: "web", Name: "Web", IsEnabled: true, Interface: "wan", Protocol: "tcp", Src: "any", DstPort: "80,443"},
+		{ID: "off", Name: "Off", IsEnabled: false, Interface: "wan", Protocol: "tcp_udp", Src: "any", DstPort: "22"},
+		{ID: "vpn", Name: "VPN", IsEnabled: true, Interface: "wan2", Protocol: "udp", Src: "any", DstPort: "1194"},
+	}
+	tests := []struct {
+		name    string
+		forward PortForward
+		ok      bool
+	}{
+		{"free port", PortForward{DstPort: "8080"}, true},
+		{"overlapping range", PortForward{DstPort: "400-500"}, false},
+		{"disabled forward", PortForward{DstPort: "22"}, true},
+		{"other protocol", PortForward{DstPort: "443", Protocol: "udp"}, true},
+		{"other interface", PortForward{DstPort: "1194", Protocol: "udp"}, true},
+		{"both interfaces", PortForward{DstPort: "1194", Interface: "both"}, false},
+		{"itself", PortForward{ID: "web", DstPort: "80"}, true},
+		{"off network", PortForward{DstPort: "8080", Fwd: "10.0.0.5"}, false},
+	}
+	for _, test := range tests {
+		f := test.forward
+		f.Name, f.IsEnabled = test.name, true
+		if f.Fwd == "" {
+			f.Fwd = "192.168.1.20"
+		}
+		if err := f.Validate(); err != nil {
+			t.Fatalf("%s: Validate() = %v", test.name, err)
+		}
+		if err := CheckPortForward(f, forwards, networks); (err == nil) != test.ok {
+			t.Errorf("%s: CheckPortForward() = %v, want ok %v", test.name, err, test.ok)
+		}
+	}
+}
+
+func TestPortForwardValidate(t *testing.T) {
+	tests := []struct {
+		dst, fwd string
+		ok       bool
+	}{
+		{"8000-8010", "9000-9010", true},
+		{"8000-8010", "9000", true},
+		{"8000-8010", "9000-9005", false},
+		{"70000", "", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		f := PortForward{Name: "test", Fwd: "192.168.1.20", DstPort: test.dst, FwdPort: test.fwd}
+		if err := f.Validate(); (err == nil) != test.ok {
+			t.Errorf("Validate() of %q to %q = %v, want ok %v", test.dst, test.fwd, err, test.ok)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package unifi
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+)
+
+// The number of results requested per page when QueryOptions.Limit is not set.
+const defaultQueryLimit = 1000
+
+// QueryOptions specifies the parameters understood by the alarm and event queries of the UniFi Controller, along
+// with a client side Filter applied to the results. Queries are paged using Start & Limit until the controller
+// has no more results to return.
+type QueryOptions struct {
+	// Only return results from the last Within hours.
+	Within int `json:"within,omitempty"`
+
+	// Offset of the first result to return.
+	Start int `json:"_start"`
+
+	// The number of results to request per page. Defaults to defaultQueryLimit.
+	Limit int `json:"_limit,omitempty"`
+
+	// Sort order of the results. Defaults to "-time" i.e. newest first.
+	Sort string `json:"_sort,omitempty"`
+
+	// When set only alarms with a matching archived state are returned.
+	Archived *bool `json:"archived,omitempty"`
+
+	// Stop once this many results have passed the Filter. 0 means no limit.
+	Max int `json:"-"`
+
+	// Client side filter applied to every result returned by the controller.
+	Filter ListFilter `json:"-"`
+}
+
+// ListFilter holds the client side filters applied to alarms and events. Empty fields match everything.
+type ListFilter struct {
+	// Key to match e.g. EVT_GW_WANTransition. Shell style wildcards are allowed.
+	Key string
+
+	// Subsystem to match e.g. wlan, lan or www.
+	SubSystem string
+
+	// MAC Address of a device or client the alarm or event refers to.
+	MacAddress string
+
+	// ESSID of the wireless network the alarm or event refers to.
+	Essid string
+
+	// Only match results at or after Since.
+	Since time.Time
+
+	// Only match results before Until.
+	Until time.Time
+}
+
+// firstPage returns a copy of q, which may be nil, with the defaults filled in ready to request the first page.
+func (q *QueryOptions) firstPage() *QueryOptions {
+	page := new(QueryOptions)
+	if q != nil {
+		*page = *q
+	}
+	if page.Limit <= 0 {
+		page.Limit = defaultQueryLimit
+	}
+	if page.Sort == "" {
+		page.Sort = "-time"
+	}
+	return page
+}
+
+// nextPage moves q past a page which returned n results, of which fresh had not been seen on an earlier page,
+// and reports whether there may be more results to fetch. A short page or a page without anything new (which
+// happens when the controller ignores _start) ends the query.
+func (q *QueryOptions) nextPage(n int, fresh int) bool {
+	if n < q.Limit || fresh == 0 {
+		return false
+	}
+	q.Start += n
+	return true
+}
+
+// full reports whether collected results are enough to satisfy Max.
+func (q *QueryOptions) full(collected int) bool {
+	return q.Max > 0 && collected >= q.Max
+}
+
+// query posts opt to path a page at a time until the controller has no more results to return or opt.Max of them
+// have been kept. Each result is passed to keep once, however many pages it turns up on, which decodes it and
+// reports whether it passed the filter.
+func (c *UniFiClient) query(ctx context.Context, path string, opt *QueryOptions,
+	keep func(result json.RawMessage, f ListFilter) (bool, error)) (*Response, error) {
+	q := opt.firstPage()
+	seen := make(map[string]bool)
+	kept := 0
+	for {
+		req, err := c.NewRequest(ctx, "POST", path, q)
+		if err != nil {
+			return nil, err
+		}
+
+		page := new(struct {
+			Results []json.RawMessage `json:"data"`
+		})
+		resp, err := c.Do(req, page)
+		if err != nil {
+			return resp, err
+		}
+
+		fresh := 0
+		for _, result := range page.Results {
+			var id struct {
+				UUID string `json:"_id"`
+			}
+			if err := json.Unmarshal(result, &id); err != nil {
+				return resp, err
+			}
+			if seen[id.UUID] {
+				continue
+			}
+			seen[id.UUID] = true
+			fresh++
+			matched, err := keep(result, q.Filter)
+			if err != nil {
+				return resp, err
+			}
+			if matched {
+				kept++
+			}
+			if q.full(kept) {
+				return resp, nil
+			}
+		}
+		if !q.nextPage(len(page.Results), fresh) {
+			return resp, nil
+		}
+	}
+}
+
+func (f ListFilter) match(key string, subSystem string, essid string, when time.Time, macs ...string) bool {
+	if f.Key != "" {
+		matched, err := path.Match(strings.ToUpper(f.Key), strings.ToUpper(key))
+		if err != nil || !matched {
+			return false
+		}
+	}
+	if f.SubSystem != "" && !strings.EqualFold(f.SubSystem, subSystem) {
+		return false
+	}
+	if f.Essid != "" && f.Essid != essid {
+		return false
+	}
+	if f.MacAddress != "" {
+		found := false
+		for _, mac := range macs {
+			if mac != "" && macKey(mac) == macKey(f.MacAddress) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !f.Since.IsZero() && (when.IsZero() || when.Before(f.Since)) {
+		return false
+	}
+	if !f.Until.IsZero() && (when.IsZero() || !when.Before(f.Until)) {
+		return false
+	}
+	return true
+}
+
+// macKey reduces a MAC Address to lower case hex digits so differently formatted addresses can be compared.
+func macKey(mac string) string {
+	return strings.ToLower(strings.NewReplacer(":", "", "-", "", ".", "").Replace(mac))
+}
@@ -0,0 +1,184 @@
+package unifi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFirstPage(t *testing.T) {
+	tests := []struct {
+		opt         *QueryOptions
+		limit       int
+		sort        string
+		start, want int
+	}{
+		{nil, defaultQueryLimit, "-time", 0, 0},
+		{&QueryOptions{Limit: -1}, defaultQueryLimit, "-time", 0, 0},
+		{&QueryOptions{Limit: 50, Sort: "time", Start: 100, Max: 10}, 50, "time", 100, 10},
+	}
+	for _, test := range tests {
+		page := test.opt.firstPage()
+		if page.Limit != test.limit || page.Sort != test.sort || page.Start != test.start || page.Max != test.want {
+			t.Errorf("firstPage(%+v) = %+v, want limit %d, sort %s, start %d and max %d", test.opt, page,
+				test.limit, test.sort, test.start, test.want)
+		}
+	}
+
+	opt := &QueryOptions{}
+	opt.firstPage().Start = 10
+	if opt.Start != 0 || opt.Limit != 0 {
+		t.Errorf("firstPage() changed the options it copied: %+v", opt)
+	}
+}
+
+func TestNextPage(t *testing.T) {
+	tests := []struct {
+		name      string
+		n, fresh  int
+		more      bool
+		nextStart int
+	}{
+		{"a full page", 10, 10, true, 20},
+		{"a full page partly seen before", 10, 3, true, 20},
+		{"a short page", 9, 9, false, 10},
+		{"an empty page", 0, 0, false, 10},
+		{"a page of results already seen", 10, 0, false, 10},
+	}
+	for _, test := range tests {
+		q := &QueryOptions{Start: 10, Limit: 10}
+		if more := q.nextPage(test.n, test.fresh); more != test.more || q.Start != test.nextStart {
+			t.Errorf("%s: nextPage() = %v with start %d, want %v with start %d", test.name, more, q.Start,
+				test.more, test.nextStart)
+		}
+	}
+}
+
+// queryServer returns a client for a controller holding total alarms and events, newest first, which ignores
+// _start when ignoreStart, along with the _start of each page requested of it.
+func queryServer(t *testing.T, total int, ignoreStart bool) (*UniFiClient, *[]int, func()) {
+	var starts []int
+	c, done := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var q QueryOptions
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+			t.Errorf("%s %s: %v", r.Method, r.URL.Path, err)
+		}
+		starts = append(starts, q.Start)
+		if ignoreStart {
+			q.Start = 0
+		}
+		var data []string
+		for i := q.Start; i < total && i < q.Start+q.Limit; i++ {
+			subsystem := "lan"
+			if i%2 == 1 {
+				subsystem = "wlan"
+			}
+			data = append(data, fmt.Sprintf(`{"_id": "%d", "key": "EVT_%d", "subsystem": "%s"}`, i, i, subsystem))
+		}
+		fmt.Fprintf(w, `{"meta": {"rc": "ok"}, "data": [%s]}`, strings.Join(data, ","))
+	})
+	return c, &starts, done
+}
+
+func TestQueryPaging(t *testing.T) {
+	tests := []struct {
+		opt         QueryOptions
+		total       int
+		ignoreStart bool
+		keys        []string
+		starts      []int
+	}{
+		{QueryOptions{Limit: 10}, 0, false, nil, []int{0}},
+		{QueryOptions{Limit: 10}, 25, false, keys(0, 25, 1), []int{0, 10, 20}},
+		// An exact multiple of the limit needs an empty page to know there are no more.
+		{QueryOptions{Limit: 10}, 30, false, keys(0, 30, 1), []int{0, 10, 20, 30}},
+		{QueryOptions{Limit: 10}, 30, true, keys(0, 10, 1), []int{0, 10}},
+		{QueryOptions{Limit: 10, Start: 20}, 25, false, keys(20, 25, 1), []int{20}},
+		{QueryOptions{Limit: 10, Max: 15}, 100, false, keys(0, 15, 1), []int{0, 10}},
+		{QueryOptions{Limit: 10, Max: 10}, 100, false, keys(0, 10, 1), []int{0}},
+		{QueryOptions{Limit: 10, Max: 50}, 25, false, keys(0, 25, 1), []int{0, 10, 20}},
+		{QueryOptions{Limit: 10, Max: 6, Filter: ListFilter{SubSystem: "wlan"}}, 100, false, keys(1, 13, 2),
+			[]int{0, 10}},
+	}
+	for _, test := range tests {
+		c, starts, done := queryServer(t, test.total, test.ignoreStart)
+		alarms, _, err := c.Alarms.List(ctx, &test.opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, a := range alarms {
+			got = append(got, a.Key)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.keys) || fmt.Sprint(*starts) != fmt.Sprint(test.starts) {
+			t.Errorf("listing alarms with %+v from %d (ignoring _start %v) returned %v requesting pages %v, "+
+				"want %v requesting pages %v", test.opt, test.total, test.ignoreStart, got, *starts, test.keys,
+				test.starts)
+		}
+
+		*starts = nil
+		events, _, err := c.Events.List(ctx, &test.opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = nil
+		for _, e := range events {
+			got = append(got, e.Key)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.keys) || fmt.Sprint(*starts) != fmt.Sprint(test.starts) {
+			t.Errorf("listing events with %+v from %d (ignoring _start %v) returned %v requesting pages %v, "+
+				"want %v requesting pages %v", test.opt, test.total, test.ignoreStart, got, *starts, test.keys,
+				test.starts)
+		}
+		done()
+	}
+}
+
+// keys returns the keys of every step-th result queryServer holds from first up to but not including last.
+func keys(first, last, step int) []string {
+	var keys []string
+	for i := first; i < last; i += step {
+		keys = append(keys, fmt.Sprintf("EVT_%d", i))
+	}
+	return keys
+}
+
+func TestListFilterMatch(t *testing.T) {
+	when := time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		filter ListFilter
+		macs   []string
+		want   bool
+	}{
+		{ListFilter{}, nil, true},
+		{ListFilter{Key: "EVT_WU_*"}, nil, true},
+		{ListFilter{Key: "evt_wu_connected"}, nil, true},
+		{ListFilter{Key: "EVT_GW_*"}, nil, false},
+		{ListFilter{Key: "["}, nil, false},
+		{ListFilter{SubSystem: "WLAN"}, nil, true},
+		{ListFilter{SubSystem: "lan"}, nil, false},
+		{ListFilter{Essid: "Office"}, nil, true},
+		{ListFilter{Essid: "office"}, nil, false},
+		{ListFilter{MacAddress: "80-2A-A8-00-00-01"}, []string{"", "80:2a:a8:00:00:01"}, true},
+		{ListFilter{MacAddress: "80:2a:a8:00:00:02"}, []string{"80:2a:a8:00:00:01"}, false},
+		{ListFilter{MacAddress: "80:2a:a8:00:00:01"}, nil, false},
+		{ListFilter{Since: when}, nil, true},
+		{ListFilter{Since: when.Add(time.Second)}, nil, false},
+		{ListFilter{Until: when.Add(time.Second)}, nil, true},
+		{ListFilter{Until: when}, nil, false},
+		{ListFilter{Since: when.Add(-time.Hour), Until: when.Add(time.Hour)}, nil, true},
+	}
+	for _, test := range tests {
+		got := test.filter.match("EVT_WU_Connected", "wlan", "Office", when, test.macs...)
+		if got != test.want {
+			t.Errorf("%+v.match(%v) = %v, want %v", test.filter, test.macs, got, test.want)
+		}
+	}
+
+	if (ListFilter{Since: when}).match("EVT_WU_Connected", "wlan", "Office", time.Time{}) {
+		t.Error("a result without a time matched --since")
+	}
+}
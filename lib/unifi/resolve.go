@@ -0,0 +1,229 @@
+package unifi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Short MAC addresses must have at least this many hex digits to be matched against the start or end of a MAC.
+const minMacFragment = 4
+
+// NormalizeMac returns mac in the lowercase, colon separated form used by the UniFi Controller e.g.
+// 80:2a:a8:d9:c5:21. Any of the usual notations are accepted i.e. 802aa8d9c521, 80-2A-A8-D9-C5-21 or
+// 802a.a8d9.c521.
+func NormalizeMac(mac string) (string, error) {
+	key := macKey(strings.TrimSpace(mac))
+	if len(key) != 12 || !isHex(key) {
+		return "", NewArgError("mac", fmt.Sprintf("%q is not a MAC address", mac))
+	}
+	var buf bytes.Buffer
+	for i := 0; i < 12; i += 2 {
+		if i > 0 {
+			buf.WriteByte(':')
+		}
+		buf.WriteString(key[i : i+2])
+	}
+	return buf.String(), nil
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// Candidate is something a query can be resolved to, identified by its name, IP, serial and MAC address.
+type Candidate struct {
+	Name       string
+	IP         string
+	Serial     string
+	MacAddress string
+}
+
+func (c Candidate) String() string {
+	details := []string{c.MacAddress}
+	if c.IP != "" {
+		details = append(details, c.IP)
+	}
+	if c.Serial != "" {
+		details = append(details, c.Serial)
+	}
+	name := c.Name
+	if name == "" {
+		name = "(unnamed)"
+	}
+	return fmt.Sprintf("%s (%s)", name, strings.Join(details, ", "))
+}
+
+// NotFoundError is returned when a query matches no device or client.
+type NotFoundError struct {
+	Kind  string
+	Query string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("no %s matches %q", e.Kind, e.Query)
+}
+
+// AmbiguousError is returned when a query matches more than one device or client, listing them so the user can
+// choose between them.
+type AmbiguousError struct {
+	Kind    string
+	Query   string
+	Matches []Candidate
+}
+
+func (e *AmbiguousError) Error() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%q matches %d %ss, use one of:", e.Query, len(e.Matches), e.Kind)
+	for _, m := range e.Matches {
+		buf.WriteString("\n  ")
+		buf.WriteString(m.String())
+	}
+	return buf.String()
+}
+
+// Resolve returns the index of the candidate identified by query, which may be a MAC address in any notation, a
+// name, an IP, a serial, the last (or first) 4 or more hex digits of a MAC address, or part of a name. Exact
+// matches are preferred over partial ones, so "Manse Hallway" is not ambiguous with "Manse Hallway 2". kind
+// describes the candidates in errors e.g. "device".
+func Resolve(kind, query string, candidates []Candidate) (int, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return -1, NewArgError(kind, "cannot be empty")
+	}
+	mac, macErr := NormalizeMac(query)
+	fragment := macKey(strings.ToLower(query))
+
+	tiers := []func(c Candidate) bool{
+		func(c Candidate) bool {
+			return macErr == nil && macKey(c.MacAddress) == macKey(mac)
+		},
+		func(c Candidate) bool {
+			return strings.EqualFold(c.Name, query) || c.IP == query ||
+				(c.Serial != "" && strings.EqualFold(c.Serial, query))
+		},
+		func(c Candidate) bool {
+			key := macKey(c.MacAddress)
+			return macErr != nil && len(fragment) >= minMacFragment && isHex(fragment) &&
+				(strings.HasSuffix(key, fragment) || strings.HasPrefix(key, fragment))
+		},
+		func(c Candidate) bool {
+			return strings.Contains(strings.ToLower(c.Name), strings.ToLower(query))
+		},
+	}
+
+	for _, match := range tiers {
+		var matched []int
+		for i, c := range candidates {
+			if match(c) {
+				matched = append(matched, i)
+			}
+		}
+		switch len(matched) {
+		case 0:
+			continue
+		case 1:
+			return matched[0], nil
+		default:
+			err := &AmbiguousError{Kind: kind, Query: query}
+			for _, i := range matched {
+				err.Matches = append(err.Matches, candidates[i])
+			}
+			return -1, err
+		}
+	}
+	return -1, &NotFoundError{Kind: kind, Query: query}
+}
+
+// DeviceCandidates returns the devices as candidates for Resolve.
+func DeviceCandidates(devices []Device) []Candidate {
+	candidates := make([]Candidate, len(devices))
+	for i, d := range devices {
+		candidates[i] = Candidate{Name: d.Name, IP: d.IP, Serial: d.Serial, MacAddress: d.MacAddress}
+	}
+	return candidates
+}
+
+// UserCandidates returns the clients as candidates for Resolve.
+func UserCandidates(users []User) []Candidate {
+	candidates := make([]Candidate, len(users))
+	for i, u := range users {
+		candidates[i] = Candidate{Name: u.DisplayName(), IP: u.IP, MacAddress: u.MacAddress}
+	}
+	return candidates
+}
+
+// Resolve returns the device identified by query, as described by the package level Resolve.
+func (s *DevicesServiceOp) Resolve(ctx context.Context, query string) (*Device, *Response, error) {
+	if mac, err := NormalizeMac(query); err == nil {
+		return s.GetByMac(ctx, mac)
+	}
+
+	devices, resp, err := s.List(ctx, nil)
+	if err != nil {
+		return nil, resp, err
+	}
+	i, err := Resolve("device", query, DeviceCandidates(devices))
+	if err != nil {
+		return nil, resp, err
+	}
+	return &devices[i], resp, nil
+}
+
+// ListAll lists both the known clients and those currently connected, the latter providing their IP.
+func (s *UsersServiceOp) ListAll(ctx context.Context) ([]User, *Response, error) {
+	users, resp, err := s.List(ctx, nil)
+	if err != nil {
+		return nil, resp, err
+	}
+	active, resp, err := s.ListActive(ctx, nil)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	byMac := make(map[string]int)
+	for i, u := range users {
+		byMac[macKey(u.MacAddress)] = i
+	}
+	for _, a := range active {
+		if i, ok := byMac[macKey(a.MacAddress)]; ok {
+			users[i].IP = a.IP
+			continue
+		}
+		byMac[macKey(a.MacAddress)] = len(users)
+		users = append(users, a)
+	}
+	return users, resp, nil
+}
+
+// Resolve returns the client identified by query, as described by the package level Resolve. A full MAC address
+// which has never been seen by the Controller still resolves so it can be blocked ahead of time.
+func (s *UsersServiceOp) Resolve(ctx context.Context, query string) (*User, *Response, error) {
+	users, resp, err := s.ListAll(ctx)
+	if err != nil {
+		return nil, resp, err
+	}
+	user, err := ResolveUser(query, users)
+	return user, resp, err
+}
+
+// ResolveUser returns the client in users identified by query, or a new one for a full MAC address which is not
+// among them.
+func ResolveUser(query string, users []User) (*User, error) {
+	i, err := Resolve("client", query, UserCandidates(users))
+	if _, ok := err.(*NotFoundError); ok {
+		if mac, macErr := NormalizeMac(query); macErr == nil {
+			return &User{MacAddress: mac}, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &users[i], nil
+}
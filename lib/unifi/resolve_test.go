@@ -0,0 +1,64 @@
+package unifi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeMac(t *testing.T) {
+	for _, mac := range []string{"802aa8d9c521", "80-2A-A8-D9-C5-21", "802a.a8d9.c521", " 80:2a:a8:d9:c5:21 "} {
+		got, err := NormalizeMac(mac)
+		if err != nil {
+			t.Errorf("NormalizeMac(%q) returned error: %v", mac, err)
+			continue
+		}
+		if want := "80:2a:a8:d9:c5:21"; got != want {
+			t.Errorf("NormalizeMac(%q) = %q, want %q", mac, got, want)
+		}
+	}
+	for _, mac := range []string{"", "802aa8d9c5", "802aa8d9c52g", "80:2a:a8:d9:c5:21:00"} {
+		if _, err := NormalizeMac(mac); err == nil {
+			t.Errorf("NormalizeMac(%q) should return an error", mac)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	candidates := []Candidate{
+		{Name: "Manse Landing", IP: "192.168.1.10", Serial: "802AA8C66367", MacAddress: "80:2a:a8:c6:63:67"},
+		{Name: "Manse Hallway", IP: "192.168.1.20", Serial: "802AA8D9C521", MacAddress: "80:2a:a8:d9:c5:21"},
+		{Name: "Manse Hallway 2", IP: "192.168.1.21", Serial: "F09FC22010D1", MacAddress: "f0:9f:c2:20:10:d1"},
+	}
+	tests := map[string]int{
+		"80-2A-A8-D9-C5-21": 1,
+		"manse hallway":     1,
+		"192.168.1.21":      2,
+		"802aa8c66367":      0,
+		"10d1":              2,
+		"f09f":              2,
+		"Landing":           0,
+	}
+	for query, want := range tests {
+		got, err := Resolve("device", query, candidates)
+		if err != nil {
+			t.Errorf("Resolve(%q) returned error: %v", query, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Resolve(%q) = %d, want %d", query, got, want)
+		}
+	}
+
+	_, err := Resolve("device", "Manse", candidates)
+	ambiguous, ok := err.(*AmbiguousError)
+	if !ok || len(ambiguous.Matches) != 3 {
+		t.Fatalf("Resolve(Manse) should be ambiguous between 3 devices, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "Manse Hallway 2 (f0:9f:c2:20:10:d1, 192.168.1.21, F09FC22010D1)") {
+		t.Errorf("AmbiguousError should list the matches, got %q", err.Error())
+	}
+
+	if _, err := Resolve("device", "Orangery", candidates); err == nil {
+		t.Errorf("Resolve(Orangery) should return an error")
+	}
+}
@@ -0,0 +1,130 @@
+package unifi
+
+import (
+	"context"
+	"fmt"
+)
+
+// RestService is an interface for interfacing with the generic /rest collections of a site e.g. wlanconf,
+// networkconf or portconf. Objects are handled as maps so every field round trips unchanged, whatever the version
+// of the UniFi Controller.
+type RestService interface {
+	List(ctx context.Context, collection string) ([]RestObject, *Response, error)
+	Create(ctx context.Context, collection string, obj RestObject) (RestObject, *Response, error)
+	Update(ctx context.Context, collection string, id string, obj RestObject) (RestObject, *Response, error)
+	Delete(ctx context.Context, collection string, id string) (*Response, error)
+}
+
+// RestServiceOp handles communication with the /rest collections of the UniFi API.
+type RestServiceOp struct {
+	client *UniFiClient
+}
+
+var _ RestService = &RestServiceOp{}
+
+// RestObject is an object of a /rest collection as returned by the UniFi Controller.
+type RestObject map[string]interface{}
+
+type restRoot struct {
+	Data []RestObject `json:"data"`
+}
+
+// ID returns the _id the UniFi Controller identifies the object by.
+func (o RestObject) ID() string {
+	id, _ := o["_id"].(string)
+	return id
+}
+
+// Name returns the name of the object, if it has one.
+func (o RestObject) Name() string {
+	name, _ := o["name"].(string)
+	return name
+}
+
+// Subnets maps the _id of each of the networks of a networkconf collection to its ip_subnet e.g. 192.168.1.1/24,
+// leaving out those without one such as the WAN.
+func Subnets(networks []RestObject) map[string]string {
+	subnets := make(map[string]string)
+	for _, n := range networks {
+		if subnet, ok := n["ip_subnet"].(string); ok && subnet != "" {
+			subnets[n.ID()] = subnet
+		}
+	}
+	return subnets
+}
+
+// List all the objects of a collection.
+func (s *RestServiceOp) List(ctx context.Context, collection string) ([]RestObject, *Response, error) {
+	return s.send(ctx, "GET", collection, "", nil)
+}
+
+// Create an object in a collection, returning it as stored by the Controller i.e. with its _id.
+func (s *RestServiceOp) Create(ctx context.Context, collection string, obj RestObject) (RestObject, *Response, error) {
+	objs, resp, err := s.send(ctx, "POST", collection, "", obj)
+	return first(collection, objs, resp, err)
+}
+
+// Update the object of a collection with the given id. Fields missing from obj are left unchanged.
+func (s *RestServiceOp) Update(
+	ctx context.Context,
+	collection string,
+	id string,
+	obj RestObject) (RestObject, *Response, error) {
+
+	if id == "" {
+		return nil, nil, NewArgError("id", "cannot be empty")
+	}
+	objs, resp, err := s.send(ctx, "PUT", collection, id, obj)
+	return first(collection, objs, resp, err)
+}
+
+// Delete the object of a collection with the given id.
+func (s *RestServiceOp) Delete(ctx context.Context, collection string, id string) (*Response, error) {
+	if id == "" {
+		return nil, NewArgError("id", "cannot be empty")
+	}
+	_, resp, err := s.send(ctx, "DELETE", collection, id, nil)
+	return resp, err
+}
+
+func (s *RestServiceOp) send(
+	ctx context.Context,
+	method, collection, id string,
+	body interface{}) ([]RestObject, *Response, error) {
+
+	root := new(restRoot)
+	resp, err := s.client.sendRest(ctx, method, collection, id, body, root)
+	if err != nil {
+		return nil, resp, err
+	}
+	return root.Data, resp, err
+}
+
+// sendRest makes a request of an object of a /rest collection, or the collection itself when id is empty, decoding
+// the response into root.
+func (c *UniFiClient) sendRest(
+	ctx context.Context,
+	method, collection, id string,
+	body interface{},
+	root interface{}) (*Response, error) {
+
+	path := fmt.Sprintf("%s/%s", *c.buildURL(restBasePath), collection)
+	if id != "" {
+		path = fmt.Sprintf("%s/%s", path, id)
+	}
+	req, err := c.NewRequest(ctx, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req, root)
+}
+
+func first(collection string, objs []RestObject, resp *Response, err error) (RestObject, *Response, error) {
+	if err != nil {
+		return nil, resp, err
+	}
+	if len(objs) == 0 {
+		return nil, resp, fmt.Errorf("unifi: the Controller returned no %s", collection)
+	}
+	return objs[0], resp, nil
+}
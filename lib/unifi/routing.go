@@ -0,0 +1,199 @@
+package unifi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// The types of a Route.
+const (
+	NextHopRoute   = "nexthop-route"
+	InterfaceRoute = "interface-route"
+	BlackholeRoute = "blackhole"
+)
+
+// RouteService is an interface for interfacing with the static routes of the gateway of a site.
+type RouteService interface {
+	List(ctx context.Context) ([]Route, *Response, error)
+	Create(ctx context.Context, route *Route) (*Route, *Response, error)
+	Update(ctx context.Context, route *Route) (*Route, *Response, error)
+	Delete(ctx context.Context, id string) (*Response, error)
+}
+
+// RouteServiceOp handles communication with the routing collection of the UniFi API.
+type RouteServiceOp struct {
+	client *UniFiClient
+}
+
+var _ RouteService = &RouteServiceOp{}
+
+// Route is a static route sending traffic for Network to NextHop or out of Interface, or dropping it for a
+// blackhole route.
+type Route struct {
+	ID        string `json:"_id,omitempty"`
+	SiteId    string `json:"site_id,omitempty"`
+	Name      string `json:"name"`
+	IsEnabled bool   `json:"enabled"`
+	Type      string `json:"type"`
+	RouteType string `json:"static-route_type"`
+	Network   string `json:"static-route_network"`
+	NextHop   string `json:"static-route_nexthop,omitempty"`
+	Interface string `json:"static-route_interface,omitempty"`
+	Distance  int    `json:"static-route_distance,omitempty"`
+}
+
+type routesRoot struct {
+	Routes []Route `json:"data"`
+}
+
+// Target returns where the route sends traffic, i.e. its next hop, its interface or blackhole.
+func (r Route) Target() string {
+	switch r.RouteType {
+	case NextHopRoute:
+		return r.NextHop
+	case InterfaceRoute:
+		return r.Interface
+	}
+	return r.RouteType
+}
+
+// Validate checks the route has the fields the Controller requires, filling in the defaults of those left empty.
+func (r *Route) Validate() error {
+	if r.Name == "" {
+		return NewArgError("name", "cannot be empty")
+	}
+	r.Type = "static-route"
+	ip, network, err := net.ParseCIDR(r.Network)
+	if err != nil || ip.To4() == nil {
+		return NewArgError("static-route_network", fmt.Sprintf("%q is not an IPv4 CIDR e.g. 10.1.0.0/16", r.Network))
+	}
+	if !ip.Equal(network.IP) {
+		return NewArgError("static-route_network", fmt.Sprintf("%q has host bits set, did you mean %s?",
+			r.Network, network))
+	}
+	if r.Distance == 0 {
+		r.Distance = 1
+	}
+	if r.Distance < 1 || r.Distance > 255 {
+		return NewArgError("static-route_distance", fmt.Sprintf("%d is not between 1 and 255", r.Distance))
+	}
+	switch r.RouteType {
+	case NextHopRoute:
+		if hop := net.ParseIP(r.NextHop); hop == nil || hop.To4() == nil {
+			return NewArgError("static-route_nexthop", fmt.Sprintf("%q is not an IPv4 address", r.NextHop))
+		}
+		r.Interface = ""
+	case InterfaceRoute:
+		if r.Interface == "" {
+			return NewArgError("static-route_interface", "cannot be empty for an interface route")
+		}
+		r.NextHop = ""
+	case BlackholeRoute:
+		r.NextHop, r.Interface = "", ""
+	default:
+		return NewArgError("static-route_type", fmt.Sprintf("%q is not one of %s, %s or %s",
+			r.RouteType, NextHopRoute, InterfaceRoute, BlackholeRoute))
+	}
+	return nil
+}
+
+// CheckRoute checks route, which must already be valid, against the site: it may not route a network of the site,
+// given as a map of ID to ip_subnet as returned by Subnets, elsewhere, its next hop must be reachable on one of the
+// networks, and no other enabled route may already route the same network at the same distance.
+func CheckRoute(route Route, routes []Route, networks map[string]string) error {
+	dst, _ := parseAddress(route.Network)
+	for _, subnet := range networks {
+		if r, ok := networkRange(subnet, "NETv4"); ok && rangesOverlap(dst, r) {
+			return NewArgError("static-route_network", fmt.Sprintf("%s overlaps %s, a network of the site",
+				route.Network, subnet))
+		}
+	}
+	if route.RouteType == NextHopRoute && !onNetwork(route.NextHop, networks) {
+		return NewArgError("static-route_nexthop", fmt.Sprintf("%s is not on any of the networks of the site",
+			route.NextHop))
+	}
+	if !route.IsEnabled {
+		return nil
+	}
+	for _, other := range routes {
+		if other.ID != route.ID && other.IsEnabled && other.Network == route.Network && other.Distance == route.Distance {
+			return fmt.Errorf("%s at distance %d is already routed by %q", route.Network, route.Distance, other.Name)
+		}
+	}
+	return nil
+}
+
+// ResolveRoute returns the static route identified by its ID, name or network.
+func ResolveRoute(query string, routes []Route) (*Route, error) {
+	var matches []int
+	for i, r := range routes {
+		if r.ID == query {
+			return &routes[i], nil
+		}
+		if strings.EqualFold(r.Name, query) || r.Network == query {
+			matches = append(matches, i)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, &NotFoundError{Kind: "route", Query: query}
+	case 1:
+		return &routes[matches[0]], nil
+	}
+	return nil, fmt.Errorf("%q matches %d routes, use the ID of one", query, len(matches))
+}
+
+// List lists the static routes of the site, ordered by name.
+func (s *RouteServiceOp) List(ctx context.Context) ([]Route, *Response, error) {
+	root := new(routesRoot)
+	resp, err := s.client.sendRest(ctx, "GET", "routing", "", nil, root)
+	if err != nil {
+		return nil, resp, err
+	}
+	sort.Slice(root.Routes, func(i, j int) bool { return root.Routes[i].Name < root.Routes[j].Name })
+	return root.Routes, resp, nil
+}
+
+// Create creates a static route, returning it as stored by the Controller.
+func (s *RouteServiceOp) Create(ctx context.Context, route *Route) (*Route, *Response, error) {
+	if err := route.Validate(); err != nil {
+		return nil, nil, err
+	}
+	root := new(routesRoot)
+	resp, err := s.client.sendRest(ctx, "POST", "routing", "", route, root)
+	return firstRoute(root, resp, err)
+}
+
+// Update replaces the static route with the ID of route.
+func (s *RouteServiceOp) Update(ctx context.Context, route *Route) (*Route, *Response, error) {
+	if route.ID == "" {
+		return nil, nil, NewArgError("id", "cannot be empty")
+	}
+	if err := route.Validate(); err != nil {
+		return nil, nil, err
+	}
+	root := new(routesRoot)
+	resp, err := s.client.sendRest(ctx, "PUT", "routing", route.ID, route, root)
+	return firstRoute(root, resp, err)
+}
+
+// Delete deletes the static route with the given ID.
+func (s *RouteServiceOp) Delete(ctx context.Context, id string) (*Response, error) {
+	if id == "" {
+		return nil, NewArgError("id", "cannot be empty")
+	}
+	return s.client.sendRest(ctx, "DELETE", "routing", id, nil, nil)
+}
+
+func firstRoute(root *routesRoot, resp *Response, err error) (*Route, *Response, error) {
+	if err != nil {
+		return nil, resp, err
+	}
+	if len(root.Routes) == 0 {
+		return nil, resp, fmt.Errorf("unifi: the Controller returned no route")
+	}
+	return &root.Routes[0], resp, nil
+}
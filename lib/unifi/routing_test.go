@@ -0,0 +1,35 @@
+package unifi
+
+import "testing"
+
+func TestCheckRoute(t *testing.T) {
+	networks := map[string]string{"n1": "192.168.1.1/24"}
+	routes := []Route{{ID: "r1", Name: "Branch", IsEnabled: true, RouteType: NextHopRoute, Network: "10.1.0.0/16",
+		NextHop: "192.168.1.254", Distance: 1}}
+	tests := []struct {
+		name  string
+		route Route
+		ok    bool
+	}{
+		{"new network", Route{Network: "10.2.0.0/16", RouteType: NextHopRoute, NextHop: "192.168.1.253"}, true},
+		{"same network", Route{Network: "10.1.0.0/16", RouteType: NextHopRoute, NextHop: "192.168.1.253"}, false},
+		{"further distance", Route{Network: "10.1.0.0/16", RouteType: BlackholeRoute, Distance: 200}, true},
+		{"site network", Route{Network: "192.168.0.0/16", RouteType: BlackholeRoute}, false},
+		{"unreachable hop", Route{Network: "10.2.0.0/16", RouteType: NextHopRoute, NextHop: "172.16.0.1"}, false},
+	}
+	for _, test := range tests {
+		r := test.route
+		r.Name, r.IsEnabled = test.name, true
+		if err := r.Validate(); err != nil {
+			t.Fatalf("%s: Validate() = %v", test.name, err)
+		}
+		if err := CheckRoute(r, routes, networks); (err == nil) != test.ok {
+			t.Errorf("%s: CheckRoute() = %v, want ok %v", test.name, err, test.ok)
+		}
+	}
+
+	r := Route{Name: "host bits", Network: "10.1.2.3/16", RouteType: BlackholeRoute}
+	if err := r.Validate(); err == nil {
+		t.Error("Validate() of a network with host bits set succeeded")
+	}
+}
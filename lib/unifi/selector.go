@@ -0,0 +1,129 @@
+package unifi
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// The selector operators, longest first so == is not mistaken for = where both start.
+var selectorOperators = []string{"!=", "!~", "==", "=", "~"}
+
+// Selector picks devices or clients by their fields e.g. "model=U7LT,name~Manse*". Every term must match.
+type Selector []SelectorTerm
+
+// SelectorTerm is a single KEY OP VALUE term of a Selector. OP is = (or ==) for an exact match, ~ for a glob
+// pattern, or != and !~ for their negations. Matching ignores case.
+type SelectorTerm struct {
+	Key   string
+	Op    string
+	Value string
+}
+
+// ParseSelector parses a comma separated list of selector terms.
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		// The first operator in the term splits it, so the value may itself hold one e.g. name=a!=b.
+		i, op := -1, ""
+		for _, o := range selectorOperators {
+			if j := strings.Index(term, o); j >= 0 && (i < 0 || j < i) {
+				i, op = j, o
+			}
+		}
+		if i <= 0 {
+			return nil, NewArgError("selector", fmt.Sprintf("%q is not of the form KEY=VALUE, KEY~PATTERN, "+
+				"KEY!=VALUE or KEY!~PATTERN", term))
+		}
+		t := SelectorTerm{
+			Key:   strings.ToLower(strings.TrimSpace(term[:i])),
+			Op:    op,
+			Value: strings.TrimSpace(term[i+len(op):]),
+		}
+		if t.Op == "==" {
+			t.Op = "="
+		}
+		if t.Op == "~" || t.Op == "!~" {
+			if _, err := path.Match(strings.ToLower(t.Value), ""); err != nil {
+				return nil, NewArgError("selector", fmt.Sprintf("%q is not a valid pattern", t.Value))
+			}
+		}
+		sel = append(sel, t)
+	}
+	if len(sel) == 0 {
+		return nil, NewArgError("selector", "cannot be empty")
+	}
+	return sel, nil
+}
+
+// Matches reports whether fields, keyed by lowercase name, satisfy every term of the selector. A term naming a
+// field which does not exist is an error listing those that do.
+func (sel Selector) Matches(fields map[string]string) (bool, error) {
+	for _, t := range sel {
+		value, ok := fields[t.Key]
+		if !ok {
+			keys := make([]string, 0, len(fields))
+			for k := range fields {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return false, NewArgError("selector", fmt.Sprintf("%q is not one of %s", t.Key, strings.Join(keys, ", ")))
+		}
+		if !t.matches(t.Key, value) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (t SelectorTerm) matches(key, value string) bool {
+	want := strings.ToLower(t.Value)
+	value = strings.ToLower(value)
+	if key == "mac" {
+		want, value = macKey(want), macKey(value)
+	}
+	switch t.Op {
+	case "=":
+		return value == want
+	case "!=":
+		return value != want
+	case "~":
+		ok, _ := path.Match(want, value)
+		return ok
+	case "!~":
+		ok, _ := path.Match(want, value)
+		return !ok
+	}
+	return false
+}
+
+// SelectorFields returns the fields a Selector can match a device by.
+func (d Device) SelectorFields() map[string]string {
+	short := d.toDeviceShort()
+	return map[string]string{
+		"name":    d.Name,
+		"model":   d.Model,
+		"type":    d.Type,
+		"ip":      d.IP,
+		"mac":     d.MacAddress,
+		"serial":  d.Serial,
+		"version": d.Version,
+		"state":   short.State,
+	}
+}
+
+// SelectorFields returns the fields a Selector can match a client by.
+func (r User) SelectorFields() map[string]string {
+	return map[string]string{
+		"name":     r.DisplayName(),
+		"hostname": r.Hostname,
+		"ip":       r.IP,
+		"mac":      r.MacAddress,
+		"oui":      r.OUI,
+	}
+}
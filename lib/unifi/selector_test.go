@@ -0,0 +1,66 @@
+package unifi
+
+import "testing"
+
+func TestSelector(t *testing.T) {
+	fields := map[string]string{"name": "Manse Hallway", "model": "U7LT", "type": "uap", "mac": "80:2a:a8:d9:c5:21"}
+	tests := map[string]bool{
+		"model=U7LT,name~Manse*":  true,
+		"model==u7lt":             true,
+		"model=U7PG2":             false,
+		"name~*Landing":           false,
+		"name!~*Landing,type=uap": true,
+		"model!=U7LT":             false,
+		"mac=80-2A-A8-D9-C5-21":   true,
+	}
+	for selector, want := range tests {
+		sel, err := ParseSelector(selector)
+		if err != nil {
+			t.Errorf("ParseSelector(%q) returned error: %v", selector, err)
+			continue
+		}
+		got, err := sel.Matches(fields)
+		if err != nil {
+			t.Errorf("Matches(%q) returned error: %v", selector, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Matches(%q) = %v, want %v", selector, got, want)
+		}
+	}
+
+	for _, selector := range []string{"", "model", "=U7LT", "name~[Manse"} {
+		if _, err := ParseSelector(selector); err == nil {
+			t.Errorf("ParseSelector(%q) should return an error", selector)
+		}
+	}
+	sel, _ := ParseSelector("colour=blue")
+	if _, err := sel.Matches(fields); err == nil {
+		t.Errorf("Matches should return an error for an unknown field")
+	}
+}
+
+func TestParseSelectorOperator(t *testing.T) {
+	tests := []struct {
+		term           string
+		key, op, value string
+	}{
+		{"name=a!=b", "name", "=", "a!=b"},
+		{"name!=a=b", "name", "!=", "a=b"},
+		{"name~a=b*", "name", "~", "a=b*"},
+		{"name==a~b", "name", "=", "a~b"},
+		{"name!~a!=b", "name", "!~", "a!=b"},
+		{"note=x==y", "note", "=", "x==y"},
+	}
+	for _, test := range tests {
+		sel, err := ParseSelector(test.term)
+		if err != nil {
+			t.Errorf("ParseSelector(%q) returned error: %v", test.term, err)
+			continue
+		}
+		if got := sel[0]; got.Key != test.key || got.Op != test.op || got.Value != test.value {
+			t.Errorf("ParseSelector(%q) = %q %q %q, want %q %q %q", test.term, got.Key, got.Op, got.Value,
+				test.key, test.op, test.value)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package unifi
+
+import (
+	"context"
+	"fmt"
+)
+
+// SettingService is an interface for interfacing with the settings of a site.
+type SettingService interface {
+	Mgmt(ctx context.Context) (*MgmtSetting, *Response, error)
+}
+
+// SettingServiceOp handles communication with the get/setting endpoint of the UniFi API.
+type SettingServiceOp struct {
+	client *UniFiClient
+}
+
+var _ SettingService = &SettingServiceOp{}
+
+// MgmtSetting is the device management setting of a site, including the SSH credentials the Controller provisions
+// its devices with.
+type MgmtSetting struct {
+	ID                     string   `json:"_id"`
+	Key                    string   `json:"key"`
+	SSHEnabled             bool     `json:"x_ssh_enabled"`
+	SSHAuthPasswordEnabled bool     `json:"x_ssh_auth_password_enabled"`
+	SSHUsername            string   `json:"x_ssh_username"`
+	SSHPassword            string   `json:"x_ssh_password"`
+	SSHKeys                []SSHKey `json:"x_ssh_keys,omitempty"`
+}
+
+// SSHKey is a public key the Controller adds to the authorized keys of its devices.
+type SSHKey struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Key     string `json:"key"`
+	Comment string `json:"comment,omitempty"`
+}
+
+type mgmtSettingRoot struct {
+	Settings []MgmtSetting `json:"data"`
+}
+
+// Mgmt returns the device management setting of the site. Reading it needs an admin account of the site, as it
+// holds the SSH password of the devices.
+func (s *SettingServiceOp) Mgmt(ctx context.Context) (*MgmtSetting, *Response, error) {
+	req, err := s.client.NewRequest(ctx, "GET", *s.client.buildURL(getSettingBasePath+"/mgmt"), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	root := new(mgmtSettingRoot)
+	resp, err := s.client.Do(req, root)
+	if err != nil {
+		return nil, resp, err
+	}
+	if len(root.Settings) == 0 {
+		return nil, resp, fmt.Errorf("unifi: the Controller returned no mgmt setting")
+	}
+	return &root.Settings[0], resp, nil
+}
@@ -0,0 +1,132 @@
+package unifi
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/HouzuoGuo/tiedot/db"
+)
+
+// The DB Column snapshots are stored in.
+const snapshotsCol = "Snapshots"
+
+// SnapshotStore keeps the snapshots taken by unified drift in a DB which, unlike the DB used to cache the data
+// retrieved from the Controller, persists between runs.
+type SnapshotStore struct {
+	db  *db.DB
+	col *db.Col
+}
+
+// OpenSnapshotStore opens, creating if need be, the store of snapshots in the directory dir.
+func OpenSnapshotStore(dir string) (*SnapshotStore, error) {
+	snapshotDB, err := db.OpenDB(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !snapshotDB.ColExists(snapshotsCol) {
+		if err := snapshotDB.Create(snapshotsCol); err != nil {
+			snapshotDB.Close()
+			return nil, err
+		}
+	}
+	return &SnapshotStore{db: snapshotDB, col: snapshotDB.Use(snapshotsCol)}, nil
+}
+
+// Close the store.
+func (s *SnapshotStore) Close() error {
+	return s.db.Close()
+}
+
+// Save a snapshot. Saving a baseline replaces any earlier baseline of the same name for the site.
+func (s *SnapshotStore) Save(snap *Snapshot) error {
+	if snap.Baseline != "" {
+		if err := s.each(func(id int, existing *Snapshot) error {
+			if existing.Site == snap.Site && existing.Baseline == snap.Baseline {
+				return s.col.Delete(id)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	var doc map[string]interface{}
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	_, err = s.col.Insert(doc)
+	return err
+}
+
+// Latest returns the most recent snapshot of a site, or nil if none has been taken.
+func (s *SnapshotStore) Latest(site string) (*Snapshot, error) {
+	var latest *Snapshot
+	err := s.each(func(id int, snap *Snapshot) error {
+		if snap.Site == site && (latest == nil || snap.Taken.After(latest.Taken)) {
+			latest = snap
+		}
+		return nil
+	})
+	return latest, err
+}
+
+// Baseline returns the baseline of a site with the given name.
+func (s *SnapshotStore) Baseline(site, name string) (*Snapshot, error) {
+	var baseline *Snapshot
+	err := s.each(func(id int, snap *Snapshot) error {
+		if snap.Site == site && snap.Baseline == name {
+			baseline = snap
+		}
+		return nil
+	})
+	if err == nil && baseline == nil {
+		err = &NotFoundError{Kind: "baseline", Query: name}
+	}
+	return baseline, err
+}
+
+// Baselines returns the baselines saved for a site.
+func (s *SnapshotStore) Baselines(site string) ([]Snapshot, error) {
+	var baselines []Snapshot
+	err := s.each(func(id int, snap *Snapshot) error {
+		if snap.Site == site && snap.Baseline != "" {
+			baselines = append(baselines, *snap)
+		}
+		return nil
+	})
+	return baselines, err
+}
+
+// each calls fn with every snapshot in the store, stopping at the first error.
+func (s *SnapshotStore) each(fn func(id int, snap *Snapshot) error) error {
+	type doc struct {
+		id   int
+		snap *Snapshot
+	}
+	var docs []doc
+	var err error
+	s.col.ForEachDoc(func(id int, data []byte) bool {
+		snap := new(Snapshot)
+		if err = json.Unmarshal(data, snap); err != nil {
+			err = fmt.Errorf("DB: snapshot %d is corrupt: %v", id, err)
+			return false
+		}
+		docs = append(docs, doc{id, snap})
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	// The snapshots are collected first as fn may modify the Column.
+	for _, d := range docs {
+		if err := fn(d.id, d.snap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
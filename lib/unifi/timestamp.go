@@ -1,13 +1,19 @@
 package unifi
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
 	"time"
 )
 
-// Timestamp represents a time that can be unmarshalled from a JSON string
-// formatted as either an RFC3339 or Unix timestamp. All
-// exported methods of time.Time can be called on Timestamp.
+// Unix timestamps with an absolute value at or above this are taken to be in milliseconds. As seconds it would be
+// the year 5138, as milliseconds it is March 1973.
+const millisecondEpochThreshold = 100000000000
+
+// Timestamp represents a time that can be unmarshalled from a JSON string or number formatted as either an RFC3339
+// time or a Unix timestamp in seconds or milliseconds, as the UniFi Controller uses all three. All exported methods
+// of time.Time can be called on Timestamp.
 type Timestamp struct {
 	time.Time
 }
@@ -17,19 +23,82 @@ func (t Timestamp) String() string {
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface.
-// Time is expected in RFC3339 or Unix format.
+// Time is expected in RFC3339 or Unix format, in seconds or milliseconds, and may be quoted. null or an empty
+// string leaves the zero time.
 func (t *Timestamp) UnmarshalJSON(data []byte) error {
-	str := string(data)
-	i, err := strconv.ParseInt(str, 10, 64)
-	if err == nil {
-		t.Time = time.Unix(i, 0)
-	} else {
-		t.Time, err = time.Parse(`"`+time.RFC3339+`"`, str)
+	str := strings.Trim(string(data), `"`)
+	if str == "" || str == "null" {
+		t.Time = time.Time{}
+		return nil
+	}
+	if i, err := strconv.ParseInt(str, 10, 64); err == nil {
+		t.Time = unixTime(i)
+		return nil
+	}
+	if f, err := strconv.ParseFloat(str, 64); err == nil {
+		if f >= millisecondEpochThreshold || f <= -millisecondEpochThreshold {
+			f = f / 1000
+		}
+		sec := int64(f)
+		t.Time = time.Unix(sec, int64((f-float64(sec))*float64(time.Second)))
+		return nil
 	}
-	return err
+	parsed, err := time.Parse(time.RFC3339, str)
+	if err != nil {
+		return fmt.Errorf("unifi: invalid timestamp %s", data)
+	}
+	t.Time = parsed
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface. The zero time is marshalled as null, anything else as
+// an RFC3339 string.
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if t.Time.IsZero() {
+		return []byte("null"), nil
+	}
+	return t.Time.MarshalJSON()
 }
 
 // Equal reports whether t and u are equal based on time.Equal
 func (t Timestamp) Equal(u Timestamp) bool {
 	return t.Time.Equal(u.Time)
 }
+
+// Ago describes how long before now t was in a short human form e.g. "5m ago", or "in 5m" if t is in the future.
+func (t Timestamp) Ago() string {
+	if t.Time.IsZero() {
+		return ""
+	}
+	d := time.Since(t.Time)
+	if d < 0 {
+		return "in " + HumanizeDuration(-d)
+	}
+	if d < time.Second {
+		return "just now"
+	}
+	return HumanizeDuration(d) + " ago"
+}
+
+// HumanizeDuration formats d with its largest whole unit only e.g. 45s, 5m, 3h, 2d or 6w.
+func HumanizeDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int64(d/time.Second))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int64(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int64(d/time.Hour))
+	case d < 14*24*time.Hour:
+		return fmt.Sprintf("%dd", int64(d/(24*time.Hour)))
+	default:
+		return fmt.Sprintf("%dw", int64(d/(7*24*time.Hour)))
+	}
+}
+
+func unixTime(i int64) time.Time {
+	if i >= millisecondEpochThreshold || i <= -millisecondEpochThreshold {
+		return time.Unix(i/1000, (i%1000)*int64(time.Millisecond))
+	}
+	return time.Unix(i, 0)
+}
@@ -0,0 +1,70 @@
+package unifi
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTimestampUnmarshalJSON(t *testing.T) {
+	want := time.Date(2017, 4, 29, 12, 32, 9, 0, time.UTC)
+	tests := []struct {
+		json string
+		want time.Time
+	}{
+		{`1493469129`, want},
+		{`1493469129000`, want},
+		{`1493469129123`, want.Add(123 * time.Millisecond)},
+		{`"1493469129"`, want},
+		{`"2017-04-29T12:32:09Z"`, want},
+		{`"2017-04-29T13:32:09+01:00"`, want},
+		{`null`, time.Time{}},
+		{`""`, time.Time{}},
+	}
+
+	for _, test := range tests {
+		var ts Timestamp
+		if err := json.Unmarshal([]byte(test.json), &ts); err != nil {
+			t.Errorf("Unmarshal(%s) returned error: %v", test.json, err)
+			continue
+		}
+		if !ts.Time.Equal(test.want) {
+			t.Errorf("Unmarshal(%s) = %v, want %v", test.json, ts.Time, test.want)
+		}
+	}
+
+	var ts Timestamp
+	if err := json.Unmarshal([]byte(`"yesterday"`), &ts); err == nil {
+		t.Errorf("Unmarshal of an invalid timestamp should return an error")
+	}
+}
+
+func TestAlarmTimeFields(t *testing.T) {
+	var alarm Alarm
+	data := `{"_id":"590487c9e4b01c675d52a786","datetime":"2017-04-29T12:32:09Z","time":1493469129000,
+		"handled_time":"2017-04-29T21:37:52Z"}`
+	if err := json.Unmarshal([]byte(data), &alarm); err != nil {
+		t.Fatalf("Unmarshal returned error: %v", err)
+	}
+	if !alarm.Time.Equal(alarm.DateTime) {
+		t.Errorf("Time %v and DateTime %v should be equal", alarm.Time, alarm.DateTime)
+	}
+	if !alarm.HandledTime.After(alarm.When()) {
+		t.Errorf("HandledTime %v should be after %v", alarm.HandledTime, alarm.When())
+	}
+}
+
+func TestHumanizeDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		45 * time.Second:    "45s",
+		5 * time.Minute:     "5m",
+		3*time.Hour + 59:    "3h",
+		2 * 24 * time.Hour:  "2d",
+		42 * 24 * time.Hour: "6w",
+	}
+	for d, want := range tests {
+		if got := HumanizeDuration(d); got != want {
+			t.Errorf("HumanizeDuration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
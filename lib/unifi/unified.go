@@ -1,7 +1,6 @@
 package unifi
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -10,7 +9,6 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/google/go-querystring/query"
 	"github.com/logmatic/logmatic-go"
-	"github.com/shiena/ansicolor"
 	headerLink "github.com/tent/http-link-go"
 	"golang.org/x/crypto/ssh"
 	"io"
@@ -18,7 +16,6 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"os/signal"
 	"reflect"
 	"strconv"
 	"net/http/httputil"
@@ -97,6 +94,12 @@ type UniFiClient struct {
 	ClientDevice   ClientService
 	Devices        DevicesService
 	Events         EventsService
+	Firewall       FirewallService
+	Health         HealthService
+	PortForwards   PortForwardService
+	Rest           RestService
+	Routes         RouteService
+	Settings       SettingService
 	Sites          SitesService
 	Users          UsersService
 	UAP            UAPService
@@ -191,6 +194,12 @@ func NewUniFiClient(httpClient *http.Client, options *UnifiedOptions) *UniFiClie
 	c.Authentication = &AuthenticateServiceOp{client: c}
 	c.Devices = &DevicesServiceOp{client: c}
 	c.Events = &EventsServiceOp{client: c}
+	c.Firewall = &FirewallServiceOp{client: c}
+	c.Health = &HealthServiceOp{client: c}
+	c.PortForwards = &PortForwardServiceOp{client: c}
+	c.Rest = &RestServiceOp{client: c}
+	c.Routes = &RouteServiceOp{client: c}
+	c.Settings = &SettingServiceOp{client: c}
 	c.Users = &UsersServiceOp{client: c}
 	c.UAP = &UAPServiceOp{client: c}
 	c.ClientDevice = &ClientServiceOp{client: c}
@@ -295,12 +304,15 @@ func (c *UniFiClient) OnRequestCompleted(rc RequestCompletionCallback) {
 	c.onRequestCompleted = rc
 }
 
+// ConnectToSSHHost prompts for the password of user and connects to host, a HOST:PORT address, returning the
+// connection and a session on it ready to run a command. The caller closes both.
+//
+// Deprecated: the host key is not checked. Use the remote package, which checks it against the known hosts.
 func ConnectToSSHHost(user, host string) (*ssh.Client, *ssh.Session, error) {
 	var pass string
 	fmt.Print("Password: ")
 	fmt.Scanf("%s\n", &pass)
 
-	//var hostKey ssh.PublicKey
 	sshConfig := &ssh.ClientConfig{
 		User:            user,
 		Auth:            []ssh.AuthMethod{ssh.Password(pass)},
@@ -311,65 +323,12 @@ func ConnectToSSHHost(user, host string) (*ssh.Client, *ssh.Session, error) {
 	if err != nil {
 		return nil, nil, err
 	}
-	defer client.Close()
 
 	session, err := client.NewSession()
 	if err != nil {
 		client.Close()
 		return nil, nil, err
 	}
-	defer session.Close()
-
-	// Set IO
-	session.Stdout = ansicolor.NewAnsiColorWriter(os.Stdout)
-	session.Stderr = ansicolor.NewAnsiColorWriter(os.Stderr)
-	in, _ := session.StdinPipe()
-
-	// Set up terminal modes
-	// https://net-ssh.github.io/net-ssh/classes/Net/SSH/Connection/Term.html
-	// https://www.ietf.org/rfc/rfc4254.txt
-	// https://godoc.org/golang.org/x/crypto/ssh
-	// THIS IS THE TITLE
-	// https://pythonhosted.org/ANSIColors-balises/ANSIColors.html
-	modes := ssh.TerminalModes{
-		ssh.ECHO:  0, // Disable echoing
-		ssh.IGNCR: 1, // Ignore CR on input.
-	}
-
-	// Request pseudo terminal
-	//if err := session.RequestPty("xterm", 80, 40, modes); err != nil {
-	//if err := session.RequestPty("xterm-256color", 80, 40, modes); err != nil {
-	if err := session.RequestPty("vt100", 80, 40, modes); err != nil {
-		//if err := session.RequestPty("vt220", 80, 40, modes); err != nil {
-		log.Fatalf("request for pseudo terminal failed: %s", err)
-	}
-
-	// Start remote shell
-	if err := session.Shell(); err != nil {
-		log.Fatalf("failed to start shell: %s", err)
-	}
-
-	// Handle control + C
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func() {
-		for {
-			<-c
-			fmt.Println("^C")
-			fmt.Fprint(in, "\n")
-			//fmt.Fprint(in, '\t')
-		}
-	}()
-
-	//var b []byte = make([]byte, 1)
-
-	// Accepting commands
-	for {
-		reader := bufio.NewReader(os.Stdin)
-		str, _ := reader.ReadString('\n')
-		fmt.Fprint(in, str)
-	}
-
 	return client, session, nil
 }
 
@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 	"time"
@@ -69,3 +70,16 @@ func TestNewRequest(t *testing.T) {
 
 	c.Stop()
 }
+
+// newTestClient returns a client for the site office of a Controller served by handler.
+func newTestClient(t *testing.T, handler http.HandlerFunc) (*UniFiClient, func()) {
+	server := httptest.NewServer(handler)
+	c := NewUniFiClient(server.Client(), &UnifiedOptions{DbUsage: &UnifiedDBOptions{}})
+	base, err := url.Parse(server.URL + "/api/s/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	site := "office"
+	c.BaseURL, c.SiteName = base, &site
+	return c, server.Close
+}
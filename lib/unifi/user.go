@@ -9,14 +9,15 @@ import (
 	"github.com/fatih/structs"
 )
 
-const usersBasePath = "/api/s/default/list/user"
-
 // UsersService is an interface for interfacing with the user
 // endpoints of the UniFi API
 // See: https://developers.digitalocean.com/documentation/v2/#account
 type UsersService interface {
 	List(context.Context, *ListOptions) ([]User, *Response, error)
+	ListActive(context.Context, *ListOptions) ([]User, *Response, error)
+	ListAll(context.Context) ([]User, *Response, error)
 	Get(context.Context, int) (*User, *Response, error)
+	Resolve(context.Context, string) (*User, *Response, error)
 }
 
 // UsersServiceOp handles communication with the User related methods of
@@ -41,15 +42,26 @@ type userRoot struct {
 type User struct {
 	UUID       string `json:"_id"`
 	isGuest    bool   `json:"is_guest,omitempty"`
-	isWired    bool   `json:"is_wired,omitempty"`
+	IsWired    bool   `json:"is_wired,omitempty"`
 	OUI        string `json:"oui,omitempty"`
 	MacAddress string `json:"mac,omitempty"`
 	SiteId     string `json:"site_id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Hostname   string `json:"hostname,omitempty"`
+	IP         string `json:"ip,omitempty"`
+	// Where a connected client is attached, as reported by stat/sta.
+	APMacAddress     string `json:"ap_mac,omitempty"`
+	Essid            string `json:"essid,omitempty"`
+	SwitchMacAddress string `json:"sw_mac,omitempty"`
+	SwitchPort       int    `json:"sw_port,omitempty"`
+	// The current throughput of a connected client in bytes per second.
+	RxBytesRate Number `json:"rx_bytes-r,omitempty"`
+	TxBytesRate Number `json:"tx_bytes-r,omitempty"`
 }
 
 // List all users
 func (s *UsersServiceOp) List(ctx context.Context, opt *ListOptions) ([]User, *Response, error) {
-	path := usersBasePath
+	path := *s.client.buildURL(listUserBasePath)
 	path, err := addOptions(path, opt)
 	if err != nil {
 		return nil, nil, err
@@ -77,6 +89,27 @@ func (s *UsersServiceOp) List(ctx context.Context, opt *ListOptions) ([]User, *R
 	return root.Users, resp, err
 }
 
+// List the clients currently connected to the site.
+func (s *UsersServiceOp) ListActive(ctx context.Context, opt *ListOptions) ([]User, *Response, error) {
+	path := *s.client.buildURL(statStaBasePath)
+	path, err := addOptions(path, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := s.client.NewRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	root := new(usersRoot)
+	resp, err := s.client.Do(req, root)
+	if err != nil {
+		return nil, resp, err
+	}
+	return root.Users, resp, err
+}
+
 func UsersDB(s *UsersServiceOp, root *usersRoot) *usersRoot {
 	usersColExists := false
 	var usersDB *db.Col = nil
@@ -154,7 +187,7 @@ func (s *UsersServiceOp) Get(ctx context.Context, id int) (*User, *Response, err
 		return nil, nil, NewArgError("id", "cannot be less than 1")
 	}
 
-	path := fmt.Sprintf("%s/%d", usersBasePath, id)
+	path := *s.client.buildURLWithId(listUserBasePath, id)
 	req, err := s.client.NewRequest(ctx, "GET", path, nil)
 	if err != nil {
 		return nil, nil, err
@@ -172,3 +205,11 @@ func (s *UsersServiceOp) Get(ctx context.Context, id int) (*User, *Response, err
 func (r User) String() string {
 	return Stringify(r)
 }
+
+// DisplayName returns the alias given to the client on the Controller, or failing that its hostname.
+func (r User) DisplayName() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.Hostname
+}
@@ -0,0 +1,31 @@
+package unifi
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestUsersList(t *testing.T) {
+	var paths []string
+	c, done := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		fmt.Fprint(w, `{"meta": {"rc": "ok"}, "data": [{"_id": "1", "mac": "00:11:22:33:44:55", "name": "laptop"}]}`)
+	})
+	defer done()
+
+	users, _, err := c.Users.List(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Name != "laptop" {
+		t.Errorf("List returned %+v", users)
+	}
+	if _, _, err := c.Users.ListAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/api/s/office/list/user", "/api/s/office/list/user", "/api/s/office/stat/sta"}
+	if fmt.Sprint(paths) != fmt.Sprint(want) {
+		t.Errorf("requested %v, want %v", paths, want)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bitbucket.org/ecosse-hosting/unified/lib/audit"
+	"bitbucket.org/ecosse-hosting/unified/lib/output"
+	"bitbucket.org/ecosse-hosting/unified/lib/remote"
+	"fmt"
+	"github.com/jawher/mow.cli"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// auditFlags holds the options of the commands whose sessions on devices are logged to the audit log.
+type auditFlags struct {
+	dir      *string
+	noRecord *bool
+	log      *audit.Log
+}
+
+// auditSession is a session on a device being logged, and recorded unless --no-record.
+type auditSession struct {
+	flags    *auditFlags
+	entry    audit.Entry
+	file     *os.File
+	recorder *audit.Recorder
+}
+
+// addAuditDirFlag registers the option giving where the audit log is kept on cmd.
+func addAuditDirFlag(cmd *cli.Cmd) *auditFlags {
+	return &auditFlags{
+		dir: cmd.String(cli.StringOpt{
+			Name:   "audit-dir",
+			Value:  filepath.Join(os.Getenv("HOME"), ".unified", "audit"),
+			Desc:   "The directory the audit log of sessions on devices and their recordings are kept in.",
+			EnvVar: "UNIFIED_AUDIT_DIR",
+		}),
+	}
+}
+
+// addAuditFlags registers the audit options of a command which opens sessions on devices on cmd.
+func addAuditFlags(cmd *cli.Cmd) *auditFlags {
+	f := addAuditDirFlag(cmd)
+	f.noRecord = cmd.Bool(cli.BoolOpt{
+		Name: "no-record",
+		Desc: "Only log the session in the audit log, without recording its output.",
+	})
+	return f
+}
+
+func (f *auditFlags) auditLog() *audit.Log {
+	if f.log == nil {
+		f.log = &audit.Log{Dir: *f.dir}
+	}
+	return f.log
+}
+
+// begin starts logging a session of the given kind, ssh or exec, running command on t from start, recording its
+// output as on a terminal of the given size. Problems with the audit log are warned about rather than stopping the
+// session.
+func (f *auditFlags) begin(kind string, t remote.Target, command string, start time.Time,
+	width, height int) *auditSession {
+	s := &auditSession{flags: f, entry: audit.Entry{
+		Event:          audit.EventStart,
+		Kind:           kind,
+		Operator:       operator(),
+		ControllerUser: *cx.UserName,
+		Controller:     cx.BaseURL.Host,
+		Site:           *cx.SiteName,
+		Device:         t.Name,
+		MacAddress:     t.MacAddress,
+		IP:             t.IP,
+		Command:        command,
+		Start:          start,
+		ExitCode:       -1,
+	}}
+	s.entry.ID = audit.NewID(s.entry.Start, t.MacAddress)
+	if f.noRecord == nil || !*f.noRecord {
+		s.record(t, width, height)
+	}
+	s.append()
+	return s
+}
+
+// record starts recording the output of the session on t.
+func (s *auditSession) record(t remote.Target, width, height int) {
+	path, rel := s.flags.auditLog().RecordingPath(s.entry.ID)
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err == nil {
+		s.file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	}
+	if err == nil {
+		title := s.entry.Kind + " " + t.String()
+		if s.entry.Command != "" {
+			title += " " + s.entry.Command
+		}
+		s.recorder, err = audit.NewRecorder(s.file, audit.Header{Width: width, Height: height,
+			Timestamp: s.entry.Start.Unix(), Command: s.entry.Command, Title: title,
+			Env: map[string]string{"TERM": os.Getenv("TERM")}})
+	}
+	if err != nil {
+		warn(fmt.Errorf("cannot record the session: %v", err))
+		if s.file != nil {
+			s.file.Close()
+		}
+		s.file = nil
+		return
+	}
+	s.entry.Recording = rel
+}
+
+// output is where the output of the session is written to record it.
+func (s *auditSession) output() io.Writer {
+	if s.recorder == nil {
+		return ioutil.Discard
+	}
+	return s.recorder
+}
+
+// result records the output of a command run by exec, which is only seen once it has finished, and ends the
+// session.
+func (s *auditSession) result(r remote.Result) {
+	if s.recorder != nil {
+		s.recorder.Output(r.Duration, r.Stdout)
+		s.recorder.Output(r.Duration, r.Stderr)
+	}
+	s.end(r.ExitCode, r.Err)
+}
+
+// end finishes the recording and adds the session to the audit log.
+func (s *auditSession) end(code int, err error) {
+	s.entry.Event, s.entry.End, s.entry.ExitCode = audit.EventEnd, time.Now(), code
+	if err != nil {
+		s.entry.Error = err.Error()
+	}
+	if s.recorder != nil {
+		if rerr := s.recorder.Close(); rerr != nil {
+			warn(fmt.Errorf("cannot record the session: %v", rerr))
+		}
+		s.file.Close()
+	}
+	s.append()
+}
+
+func (s *auditSession) append() {
+	if err := s.flags.auditLog().Append(s.entry); err != nil {
+		warn(fmt.Errorf("cannot add the session to the audit log: %v", err))
+	}
+}
+
+// operator is the local user running unified.
+func operator() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+func cmdAudit(cmd *cli.Cmd) {
+	cmd.Command("ls", "Lists the sessions opened on devices with ssh and exec, oldest first.", cmdAuditList)
+	cmd.Command("replay", "Replays the recording of a session.", cmdAuditReplay)
+}
+
+func cmdAuditList(cmd *cli.Cmd) {
+	flags := addAuditDirFlag(cmd)
+	device := cmd.String(cli.StringOpt{
+		Name: "d device",
+		Desc: "Only list the sessions on devices whose name or MAC address contains this.",
+	})
+	since := cmd.String(cli.StringOpt{
+		Name: "since",
+		Desc: "Only list the sessions started since this long ago e.g. 2h, 7d.",
+	})
+	operatorName := cmd.String(cli.StringOpt{
+		Name: "operator",
+		Desc: "Only list the sessions opened by this local user.",
+	})
+	out := addOutputFlags(cmd, output.Table)
+
+	cmd.Action = func() {
+		var after time.Time
+		if *since != "" {
+			age, err := parseAge(*since)
+			fatalIf(err)
+			after = time.Now().Add(-age)
+		}
+		entries, err := flags.auditLog().Entries()
+		fatalIf(err)
+		query := strings.ToLower(*device)
+		var rows []audit.Entry
+		for _, e := range entries {
+			switch {
+			case e.Start.Before(after):
+			case *operatorName != "" && e.Operator != *operatorName:
+			case query != "" && !strings.Contains(strings.ToLower(e.Device), query) &&
+				!strings.Contains(strings.ToLower(e.MacAddress), query):
+			default:
+				rows = append(rows, e)
+			}
+		}
+		out.banner("unified audit ls")
+		out.render(rows, "ID", "Start", "Operator", "ControllerUser", "Device", "Kind", "Command", "ExitCode")
+	}
+}
+
+func cmdAuditReplay(cmd *cli.Cmd) {
+	cmd.Spec = "[OPTIONS] ID"
+	flags := addAuditDirFlag(cmd)
+	id := cmd.StringArg("ID", "", "The ID of the session, as listed by audit ls, or enough of its start to identify it.")
+	speed := cmd.String(cli.StringOpt{
+		Name:  "speed",
+		Value: "1",
+		Desc:  "Replay this many times faster than the session was recorded e.g. 2 or 0.5.",
+	})
+	idle := cmd.String(cli.StringOpt{
+		Name:  "idle",
+		Value: "2s",
+		Desc:  "Cut pauses in the output longer than this short. 0 keeps them.",
+	})
+
+	cmd.Action = func() {
+		var factor float64
+		_, err := fmt.Sscan(*speed, &factor)
+		if err != nil || factor <= 0 {
+			fatalIf(fmt.Errorf("invalid speed %q", *speed))
+		}
+		maxIdle, err := parseAge(*idle)
+		fatalIf(err)
+		log := flags.auditLog()
+		e, err := log.Find(*id)
+		fatalIf(err)
+		if e.Recording == "" {
+			fatalIf(fmt.Errorf("session %s was not recorded", e.ID))
+		}
+		file, err := os.Open(filepath.Join(log.Dir, e.Recording))
+		fatalIf(err)
+		defer file.Close()
+
+		fmt.Fprintf(os.Stderr, "Replaying %s of %s (%s) by %s at %s, exit code %d\n", e.Kind, e.Device, e.MacAddress,
+			e.Operator, e.Start.In(displayLocation).Format(time.RFC1123), e.ExitCode)
+		_, err = audit.Replay(file, os.Stdout, factor, maxIdle)
+		fatalIf(err)
+	}
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bitbucket.org/ecosse-hosting/unified/lib/output"
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"bufio"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/jawher/mow.cli"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bulkTarget is a device or client a command is run against.
+type bulkTarget struct {
+	Name       string `json:"name"`
+	MacAddress string `json:"mac"`
+	IP         string `json:"ip,omitempty"`
+	Type       string `json:"type,omitempty"`
+}
+
+func (t bulkTarget) String() string {
+	if t.Name == "" {
+		return t.MacAddress
+	}
+	return fmt.Sprintf("%s (%s)", t.Name, t.MacAddress)
+}
+
+// bulkResult is the outcome of running a command against one target.
+type bulkResult struct {
+	Name       string `json:"name"`
+	MacAddress string `json:"mac"`
+	Status     string `json:"status"`
+	Duration   string `json:"duration"`
+	Error      string `json:"error,omitempty"`
+}
+
+// bulkFlags holds the options of the commands which can be run against many devices or clients at once, either
+// named by their argument or picked by a selector, type or file.
+type bulkFlags struct {
+	kind     string
+	devType  string
+	target   *string
+	names    *[]string
+	selector *string
+	typ      *string
+	fromFile *string
+	workers  *int
+	dryRun   *bool
+	confirm  *int
+	yes      *bool
+	out      *outputFlags
+}
+
+// addDeviceBulkFlags registers the DEVICE argument and bulk options on cmd. devType limits the devices to one
+// type e.g. uap, or when empty adds a --type option to do so.
+func addDeviceBulkFlags(cmd *cli.Cmd, devType string) *bulkFlags {
+	f := addBulkFlags(cmd, "device", "DEVICE", deviceArgDesc)
+	f.devType = devType
+	if devType == "" {
+		f.addTypeFlag(cmd)
+	}
+	return f
+}
+
+// addDeviceListFlags registers a DEVICE... argument and the bulk options on cmd, so any number of devices can be
+// named as well as picked by selector, type or file. The caller sets cmd.Spec, which must include [DEVICE...].
+func addDeviceListFlags(cmd *cli.Cmd) *bulkFlags {
+	f := bulkOptions(cmd, "device")
+	f.target = new(string)
+	f.names = cmd.StringsArg("DEVICE", nil, deviceArgDesc)
+	f.addTypeFlag(cmd)
+	return f
+}
+
+func (f *bulkFlags) addTypeFlag(cmd *cli.Cmd) {
+	f.typ = cmd.String(cli.StringOpt{
+		Name: "type",
+		Desc: "Run against every device of a type i.e. uap, usw or ugw.",
+	})
+}
+
+// addClientBulkFlags registers the CLIENT argument and bulk options on cmd.
+func addClientBulkFlags(cmd *cli.Cmd) *bulkFlags {
+	return addBulkFlags(cmd, "client", "CLIENT", clientArgDesc)
+}
+
+func addBulkFlags(cmd *cli.Cmd, kind, arg, argDesc string) *bulkFlags {
+	cmd.Spec = "[OPTIONS] [" + arg + "]"
+	f := bulkOptions(cmd, kind)
+	f.target = cmd.StringArg(arg, "", argDesc)
+	return f
+}
+
+func bulkOptions(cmd *cli.Cmd, kind string) *bulkFlags {
+	return &bulkFlags{
+		kind: kind,
+		selector: cmd.String(cli.StringOpt{
+			Name: "l selector",
+			Desc: "Run against every " + kind + " matching a selector e.g. model=U7LT,name~Manse*. " +
+				"Terms are KEY=VALUE, KEY~PATTERN, KEY!=VALUE or KEY!~PATTERN.",
+		}),
+		fromFile: cmd.String(cli.StringOpt{
+			Name: "f from-file",
+			Desc: "Run against every " + kind + " listed in a file, one per line, or - to read them from stdin.",
+		}),
+		workers: cmd.Int(cli.IntOpt{
+			Name:  "workers",
+			Value: 4,
+			Desc:  "How many " + kind + "s to run the command against at once.",
+		}),
+		dryRun: cmd.Bool(cli.BoolOpt{
+			Name: "n dry-run",
+			Desc: "Lists the " + kind + "s which would be affected without running the command.",
+		}),
+		confirm: cmd.Int(cli.IntOpt{
+			Name:  "confirm",
+			Value: 10,
+			Desc:  "Ask for confirmation when more than this many " + kind + "s would be affected.",
+		}),
+		yes: cmd.Bool(cli.BoolOpt{
+			Name: "yes",
+			Desc: "Do not ask for confirmation however many " + kind + "s would be affected.",
+		}),
+		out: addOutputFlags(cmd, output.Table),
+	}
+}
+
+// isBulk reports whether the command picks its targets by selector, type, file or a list of arguments rather than
+// by its single argument.
+func (f *bulkFlags) isBulk() bool {
+	return *f.selector != "" || *f.fromFile != "" || (f.typ != nil && *f.typ != "") ||
+		(f.names != nil && len(*f.names) > 0)
+}
+
+// run resolves the targets and runs fn against each of them, up to --workers at once. A single target named by
+// the argument just has its status printed, while many report their progress followed by a summary table.
+// action describes fn in prompts and messages e.g. "restart".
+func (f *bulkFlags) run(action string, fn func(t bulkTarget) (string, error)) {
+	targets, err := f.targets()
+	fatalIf(err)
+
+	if *f.dryRun {
+		if f.out.isText() {
+			fmt.Printf("Would %s %d %s(s).\n", action, len(targets), f.kind)
+		}
+		f.out.render(targets, "Name", "MacAddress", "IP", "Type")
+		return
+	}
+
+	if !f.isBulk() {
+		status, err := fn(targets[0])
+		fatalIf(err)
+		fmt.Println(status)
+		return
+	}
+
+	if len(targets) > *f.confirm && !*f.yes {
+		fatalIf(confirm(fmt.Sprintf("%s %d %ss?", action, len(targets), f.kind)))
+	}
+
+	results := make([]bulkResult, len(targets))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done, failed := 0, 0
+	workers := *f.workers
+	if workers < 1 {
+		workers = 1
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				t := targets[i]
+				start := time.Now()
+				status, err := fn(t)
+				r := bulkResult{Name: t.Name, MacAddress: t.MacAddress, Status: status,
+					Duration: time.Since(start).String()}
+				if err != nil {
+					r.Error = err.Error()
+					if r.Status == "" {
+						r.Status = "error"
+					}
+				}
+				results[i] = r
+
+				mu.Lock()
+				done++
+				line := fmt.Sprintf("[%d/%d] %s %s %s", done, len(targets), action, t, r.Status)
+				if err != nil {
+					failed++
+					color.New(color.FgRed).Fprintln(os.Stderr, line+": "+r.Error)
+				} else {
+					fmt.Fprintln(os.Stderr, line)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if f.out.isText() {
+		fmt.Printf("\n%d succeeded, %d failed.\n", len(targets)-failed, failed)
+	}
+	f.out.render(results, "Name", "MacAddress", "Status", "Duration", "Error")
+	if failed > 0 {
+		cli.Exit(1)
+	}
+}
+
+// targets returns the devices or clients the command is to be run against, sorted by name.
+func (f *bulkFlags) targets() ([]bulkTarget, error) {
+	if *f.target != "" && f.isBulk() {
+		return nil, fmt.Errorf("give either a %s or --selector, --from-file or --type, not both", f.kind)
+	}
+	if *f.target == "" && !f.isBulk() {
+		return nil, fmt.Errorf("a %s or one of --selector, --from-file or --type is required", f.kind)
+	}
+
+	var targets []bulkTarget
+	var err error
+	if f.kind == "client" {
+		targets, err = f.clients()
+	} else {
+		targets, err = f.devices()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no %ss match", f.kind)
+	}
+	sort.SliceStable(targets, func(i, j int) bool {
+		return strings.ToLower(targets[i].Name) < strings.ToLower(targets[j].Name)
+	})
+	return targets, nil
+}
+
+func (f *bulkFlags) devices() ([]bulkTarget, error) {
+	if !f.isBulk() {
+		device, _, err := cx.Devices.Resolve(ctx, *f.target)
+		if err != nil {
+			return nil, err
+		}
+		if f.devType != "" && device.Type != f.devType {
+			return nil, fmt.Errorf("%s is a %s not a %s", device.Name, device.Type, f.devType)
+		}
+		return []bulkTarget{deviceTarget(*device)}, nil
+	}
+
+	all, _, err := cx.Devices.List(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	devType := f.devType
+	if f.typ != nil && *f.typ != "" {
+		devType = strings.ToLower(*f.typ)
+	}
+	var devices []unified.Device
+	for _, d := range all {
+		if devType == "" || d.Type == devType {
+			devices = append(devices, d)
+		}
+	}
+
+	var queries []string
+	if f.names != nil {
+		queries = append(queries, *f.names...)
+	}
+	if *f.fromFile != "" {
+		listed, err := readTargets(*f.fromFile)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, listed...)
+	}
+	if len(queries) > 0 {
+		candidates := unified.DeviceCandidates(devices)
+		var listed []unified.Device
+		seen := make(map[string]bool)
+		for _, q := range queries {
+			i, err := unified.Resolve("device", q, candidates)
+			if err != nil {
+				return nil, err
+			}
+			if !seen[devices[i].MacAddress] {
+				seen[devices[i].MacAddress] = true
+				listed = append(listed, devices[i])
+			}
+		}
+		devices = listed
+	}
+
+	var targets []bulkTarget
+	for _, d := range devices {
+		ok, err := f.matches(d.SelectorFields())
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			targets = append(targets, deviceTarget(d))
+		}
+	}
+	return targets, nil
+}
+
+func (f *bulkFlags) clients() ([]bulkTarget, error) {
+	all, _, err := cx.Users.ListAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !f.isBulk() {
+		client, err := unified.ResolveUser(*f.target, all)
+		if err != nil {
+			return nil, err
+		}
+		return []bulkTarget{clientTarget(*client)}, nil
+	}
+
+	clients := all
+	if *f.fromFile != "" {
+		queries, err := readTargets(*f.fromFile)
+		if err != nil {
+			return nil, err
+		}
+		clients = nil
+		seen := make(map[string]bool)
+		for _, q := range queries {
+			client, err := unified.ResolveUser(q, all)
+			if err != nil {
+				return nil, err
+			}
+			if !seen[client.MacAddress] {
+				seen[client.MacAddress] = true
+				clients = append(clients, *client)
+			}
+		}
+	}
+
+	var targets []bulkTarget
+	for _, c := range clients {
+		ok, err := f.matches(c.SelectorFields())
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			targets = append(targets, clientTarget(c))
+		}
+	}
+	return targets, nil
+}
+
+// matches reports whether fields satisfy --selector, if one was given.
+func (f *bulkFlags) matches(fields map[string]string) (bool, error) {
+	if *f.selector == "" {
+		return true, nil
+	}
+	sel, err := unified.ParseSelector(*f.selector)
+	if err != nil {
+		return false, err
+	}
+	return sel.Matches(fields)
+}
+
+func deviceTarget(d unified.Device) bulkTarget {
+	return bulkTarget{Name: d.Name, MacAddress: d.MacAddress, IP: d.IP, Type: d.Type}
+}
+
+func clientTarget(u unified.User) bulkTarget {
+	return bulkTarget{Name: u.DisplayName(), MacAddress: u.MacAddress, IP: u.IP}
+}
+
+// readTargets reads the devices or clients listed one per line in the file at path, or on stdin when path is -.
+// Blank lines and anything following a # are ignored.
+func readTargets(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var targets []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			targets = append(targets, line)
+		}
+	}
+	return targets, scanner.Err()
+}
+
+// confirm asks the user to confirm question on the terminal, which is used rather than stdin as that may be
+// providing the targets. An error is returned when the user declines or there is no terminal to ask on.
+func confirm(question string) error {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("%s re-run with --yes to confirm", question)
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(tty).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return fmt.Errorf("cancelled")
+}
+
+// cmdStatus reduces the result of a Controller command to its status, failing unless the status is ok.
+func cmdStatus(resp *unified.UniFiCmdResp, _ *unified.Response, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	if resp.Meta.Status != "ok" {
+		return resp.Meta.Status, fmt.Errorf("the Controller returned %q", resp.Meta.Status)
+	}
+	return resp.Meta.Status, nil
+}
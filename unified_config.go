@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bitbucket.org/ecosse-hosting/unified/lib/config"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/jawher/mow.cli"
+	"io/ioutil"
+	"os"
+)
+
+// cmdConfig adds the config sub-commands which export a site's configuration as YAML, and plan and apply the
+// changes needed to bring a site in line with such a file.
+func cmdConfig(cmd *cli.Cmd) {
+	cmd.Command("export", "Exports the configuration of the site as YAML.", func(cmd2 *cli.Cmd) {
+		file := cmd2.String(cli.StringOpt{
+			Name:  "f file",
+			Value: "",
+			Desc:  "The file to write to rather than stdout.",
+		})
+		includeSecrets := cmd2.Bool(cli.BoolOpt{
+			Name: "include-secrets",
+			Desc: "Write secrets such as WLAN passphrases as they are, rather than as ${VAR} references to environment " +
+				"variables.",
+		})
+		cmd2.Action = func() {
+			state, err := config.Fetch(ctx, cx.Rest)
+			fatalIf(err)
+			data, err := state.Export(*includeSecrets).YAML()
+			fatalIf(err)
+			if *file == "" {
+				os.Stdout.Write(data)
+				return
+			}
+			fatalIf(ioutil.WriteFile(*file, data, 0600))
+		}
+	})
+
+	cmd.Command("plan", "Shows the changes needed to bring the site in line with a configuration file.", func(cmd2 *cli.Cmd) {
+		cmd2.Spec = "FILE"
+		file := cmd2.StringArg("FILE", "", "The configuration file, or - for stdin.")
+		cmd2.Action = func() {
+			plan := loadPlan(*file)
+			printPlan(plan)
+		}
+	})
+
+	cmd.Command("apply", "Brings the site in line with a configuration file.", func(cmd2 *cli.Cmd) {
+		cmd2.Spec = "[--yes] FILE"
+		yes := cmd2.Bool(cli.BoolOpt{
+			Name:  "yes",
+			Value: false,
+			Desc:  "Apply the changes without asking for confirmation.",
+		})
+		file := cmd2.StringArg("FILE", "", "The configuration file, or - for stdin.")
+		cmd2.Action = func() {
+			plan := loadPlan(*file)
+			printPlan(plan)
+			if len(plan.Changes) == 0 {
+				return
+			}
+			if !*yes {
+				fatalIf(confirm("Apply these changes?"))
+			}
+
+			applied, err := plan.Apply(ctx, cx.Rest, func(c config.Change) {
+				fmt.Fprintf(os.Stderr, "%s...\n", c)
+			})
+			fmt.Printf("Applied %d of %d changes.\n", len(applied), len(plan.Changes))
+			fatalIf(err)
+		}
+	})
+}
+
+// loadPlan reads the configuration file at path and plans the changes needed to apply it to the site.
+func loadPlan(path string) *config.Plan {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	fatalIf(err)
+
+	desired, err := config.Load(data)
+	fatalIf(err)
+	state, err := config.Fetch(ctx, cx.Rest)
+	fatalIf(err)
+	plan, err := config.NewPlan(desired, state)
+	fatalIf(err)
+	return plan
+}
+
+func printPlan(plan *config.Plan) {
+	if len(plan.Changes) == 0 {
+		fmt.Println("No changes. The site matches the configuration.")
+		return
+	}
+	for _, c := range plan.Changes {
+		switch c.Action {
+		case config.Create:
+			color.New(color.FgGreen).Printf("+ %s\n", c)
+		case config.Update:
+			color.New(color.FgYellow).Printf("~ %s\n", c)
+		case config.Delete:
+			color.New(color.FgRed).Printf("- %s\n", c)
+		}
+		for _, f := range c.Fields {
+			fmt.Printf("    %s\n", f)
+		}
+	}
+	fmt.Println()
+	fmt.Println(plan.Summary())
+}
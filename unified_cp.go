@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bitbucket.org/ecosse-hosting/unified/lib/remote"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/jawher/mow.cli"
+	"golang.org/x/crypto/ssh/terminal"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The host of a location naming the Controller rather than a device.
+const controllerHost = "controller"
+
+// location is a SRC or DST of cp, either a local path or HOST:PATH where HOST is a device, controller or empty to
+// stand for the devices picked by selector, type or file.
+type location struct {
+	host   string
+	path   string
+	remote bool
+}
+
+// parseLocation splits s at the colon ending its host, which is the last before any /, so a device may be named by
+// its MAC address e.g. 80:2a:a8:00:00:01:/var/log/messages.
+func parseLocation(s string) location {
+	head := s
+	if i := strings.Index(s, "/"); i >= 0 {
+		head = s[:i]
+	}
+	i := strings.LastIndex(head, ":")
+	if i < 0 {
+		return location{path: s}
+	}
+	return location{host: s[:i], path: s[i+1:], remote: true}
+}
+
+func (l location) String() string {
+	if !l.remote {
+		return l.path
+	}
+	return l.host + ":" + l.path
+}
+
+// copyJob is a file to copy to or from one device.
+type copyJob struct {
+	target remote.Target
+	from   location
+	to     location
+	config remote.Config
+}
+
+// copyResult is the outcome of copying a file, as rendered for -o json, yaml, csv and the like.
+type copyResult struct {
+	Device      string `json:"device"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Method      string `json:"method"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	Verified    string `json:"verified"`
+	Duration    string `json:"duration"`
+	Error       string `json:"error,omitempty"`
+}
+
+func cmdCp(cmd *cli.Cmd) {
+	cmd.Spec = "[OPTIONS] SRC... DST"
+	bulk := bulkOptions(cmd, "device")
+	bulk.target = new(string)
+	bulk.addTypeFlag(cmd)
+	login := addSSHFlags(cmd)
+	srcs := cmd.StringsArg("SRC", nil, "The files to copy, local paths or DEVICE:PATH. controller:PATH is the "+
+		"Controller itself, and :PATH the file on every device picked by --selector, --type or --from-file.")
+	dst := cmd.StringArg("DST", "", "Where to copy to, a local path or DEVICE:PATH. When more than one file is "+
+		"copied from devices each is put in a directory of DST named after its device.")
+	noProgress := cmd.Bool(cli.BoolOpt{
+		Name: "no-progress",
+		Desc: "Do not display the progress of the copy.",
+	})
+
+	cmd.Action = func() {
+		to := parseLocation(*dst)
+		var jobs []copyJob
+		if to.remote {
+			jobs = pushJobs(login, *srcs, to)
+		} else {
+			jobs = pullJobs(bulk, login, *srcs, to)
+		}
+		if *bulk.dryRun {
+			for _, j := range jobs {
+				fmt.Printf("Would copy %s to %s\n", j.from, j.to)
+			}
+			return
+		}
+		if len(jobs) > *bulk.confirm && !*bulk.yes {
+			fatalIf(confirm(fmt.Sprintf("Copy %d files?", len(jobs))))
+		}
+
+		// A progress bar only makes sense for a single file being copied on a terminal.
+		var progress remote.Progress
+		if len(jobs) == 1 && !*noProgress && terminal.IsTerminal(int(os.Stderr.Fd())) {
+			progress = progressBar(jobs[0].from.String())
+		}
+
+		results := make([]copyResult, len(jobs))
+		failed := 0
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		queue := make(chan int)
+		workers := *bulk.workers
+		if workers < 1 {
+			workers = 1
+		}
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range queue {
+					r := runCopy(jobs[i], progress)
+					mu.Lock()
+					results[i] = r
+					if r.Error != "" {
+						failed++
+					}
+					if bulk.out.isText() {
+						printCopyResult(r)
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+		for i := range jobs {
+			queue <- i
+		}
+		close(queue)
+		wg.Wait()
+
+		if !bulk.out.isText() {
+			bulk.out.render(results, "Device", "Source", "Destination", "Size", "Method", "Verified", "Error")
+		} else if len(jobs) > 1 {
+			fmt.Printf("\n%d copied, %d failed.\n", len(jobs)-failed, failed)
+		}
+		if failed > 0 {
+			cli.Exit(1)
+		}
+	}
+}
+
+// pushJobs copies the local files to the one device or the Controller named by to.
+func pushJobs(login *sshFlags, srcs []string, to location) []copyJob {
+	for _, src := range srcs {
+		if parseLocation(src).remote {
+			fatalIf(fmt.Errorf("cannot copy %s to %s, copy from devices to a local path or the other way", src, to))
+		}
+	}
+	if to.host == "" {
+		fatalIf(fmt.Errorf("files are copied to one device at a time, name it e.g. uap1:%s", to.path))
+	}
+	if len(srcs) > 1 && !strings.HasSuffix(to.path, "/") {
+		to.path += "/"
+	}
+
+	target, config := copyTarget(login, to.host)
+	var jobs []copyJob
+	for _, src := range srcs {
+		jobs = append(jobs, copyJob{target: target, from: location{path: src}, to: to, config: config})
+	}
+	return jobs
+}
+
+// pullJobs copies the files from the devices named by srcs, or picked by the bulk options, to the local path to.
+func pullJobs(bulk *bulkFlags, login *sshFlags, srcs []string, to location) []copyJob {
+	var jobs []copyJob
+	var picked []remote.Target
+	for _, src := range srcs {
+		from := parseLocation(src)
+		if !from.remote {
+			fatalIf(fmt.Errorf("cannot copy %s to %s, copy from devices to a local path or the other way", src, to))
+		}
+		if from.host != "" {
+			target, config := copyTarget(login, from.host)
+			jobs = append(jobs, copyJob{target: target, from: from, config: config})
+			continue
+		}
+		if picked == nil {
+			if !bulk.isBulk() {
+				fatalIf(fmt.Errorf("%s names no device, give one or --selector, --type or --from-file", src))
+			}
+			targets, err := bulk.targets()
+			fatalIf(err)
+			for _, t := range targets {
+				picked = append(picked, remoteTarget(t))
+			}
+		}
+		config := login.config()
+		for _, t := range picked {
+			from.host = deviceDir(t)
+			jobs = append(jobs, copyJob{target: t, from: from, config: config})
+		}
+	}
+
+	// The files of many devices, or many files, cannot share one destination, so each device gets a directory.
+	info, err := os.Stat(to.path)
+	isDir := err == nil && info.IsDir()
+	for i := range jobs {
+		dest := to.path
+		switch {
+		case len(jobs) > 1:
+			dest = filepath.Join(to.path, deviceDir(jobs[i].target), filepath.Base(jobs[i].from.path))
+		case isDir || strings.HasSuffix(to.path, "/"):
+			dest = filepath.Join(to.path, filepath.Base(jobs[i].from.path))
+		}
+		jobs[i].to = location{path: dest}
+	}
+	return jobs
+}
+
+// copyTarget resolves the device, or the Controller, named by host and how to log in to it.
+func copyTarget(login *sshFlags, host string) (remote.Target, remote.Config) {
+	if host == controllerHost {
+		name := cx.BaseURL.Hostname()
+		return remote.Target{Name: controllerHost, MacAddress: name, IP: name}, login.controllerConfig()
+	}
+	d := resolveDevice(host)
+	return remote.Target{Name: d.Name, MacAddress: d.MacAddress, IP: d.IP}, login.config()
+}
+
+// deviceDir names the directory the files of a device are put in.
+func deviceDir(t remote.Target) string {
+	name := t.Name
+	if name == "" {
+		name = t.MacAddress
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+func runCopy(j copyJob, progress remote.Progress) copyResult {
+	start := time.Now()
+	r := copyResult{Device: j.target.String(), Source: j.from.String(), Destination: j.to.String()}
+	t, err := copyFile(j, progress)
+	r.Duration = time.Since(start).Round(time.Millisecond).String()
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.Method, r.Size, r.SHA256, r.Verified = t.Method, t.Size, t.SHA256, t.Verified
+	return r
+}
+
+func copyFile(j copyJob, progress remote.Progress) (*remote.Transfer, error) {
+	client, err := j.config.Dial(j.target)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	if j.to.remote {
+		file, err := os.Open(j.from.path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return remote.Push(client, file, j.to.path, progress)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(j.to.path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(j.to.path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := remote.Pull(client, j.from.path, file, progress)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		// Do not leave a partial copy which could be mistaken for the file.
+		os.Remove(j.to.path)
+	}
+	return t, err
+}
+
+func printCopyResult(r copyResult) {
+	if r.Error != "" {
+		color.New(color.FgRed).Fprintf(os.Stderr, "%s -> %s failed: %s\n", r.Source, r.Destination, r.Error)
+		return
+	}
+	verified := "not verified, the device has no sha256sum or md5sum"
+	if r.Verified != "" {
+		verified = "verified by " + r.Verified
+	}
+	fmt.Printf("%s -> %s (%s over %s in %s, %s)\n", r.Source, r.Destination, formatBytes(r.Size), r.Method,
+		r.Duration, verified)
+}
+
+// progressBar returns a Progress redrawing a bar for the file name on stderr.
+func progressBar(name string) remote.Progress {
+	var last time.Time
+	return func(done, total int64) {
+		if time.Since(last) < 100*time.Millisecond && done < total {
+			return
+		}
+		last = time.Now()
+		const width = 30
+		filled := width
+		if total > 0 {
+			filled = int(done * width / total)
+		}
+		fmt.Fprintf(os.Stderr, "\r%s [%s%s] %s / %s", name, strings.Repeat("=", filled),
+			strings.Repeat(" ", width-filled), formatBytes(done), formatBytes(total))
+		if done >= total {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+}
+
+// formatBytes formats a number of bytes e.g. "1.5 MB".
+func formatBytes(n int64) string {
+	size := float64(n)
+	for _, unit := range []string{"B", "KB", "MB", "GB"} {
+		if size < 1024 || unit == "GB" {
+			if unit == "B" {
+				return fmt.Sprintf("%d B", n)
+			}
+			return fmt.Sprintf("%.1f %s", size, unit)
+		}
+		size /= 1024
+	}
+	return ""
+}
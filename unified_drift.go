@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bitbucket.org/ecosse-hosting/unified/lib/output"
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"fmt"
+	"github.com/jawher/mow.cli"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// driftRow is a single field of a device which drifted, or a device which was added or removed.
+type driftRow struct {
+	Name       string `json:"name"`
+	MacAddress string `json:"mac"`
+	Status     string `json:"status"`
+	Field      string `json:"field,omitempty"`
+	Old        string `json:"old,omitempty"`
+	New        string `json:"new,omitempty"`
+	ChangedBy  string `json:"changed_by,omitempty"`
+}
+
+var driftColumns = []string{"Name", "MacAddress", "Status", "Field", "Old", "New", "ChangedBy"}
+
+// cmdDrift adds the drift command which snapshots the configuration of every device and reports what changed since
+// the last snapshot, or a named baseline.
+func cmdDrift(cmd *cli.Cmd) {
+	dir := cmd.String(cli.StringOpt{
+		Name:   "db",
+		Value:  filepath.Join(os.Getenv("HOME"), ".unified", "drift"),
+		Desc:   "The directory the snapshots are kept in.",
+		EnvVar: "UNIFIED_DRIFT_DB",
+	})
+	baseline := cmd.String(cli.StringOpt{
+		Name: "baseline",
+		Desc: "Compare against the named baseline rather than the last snapshot.",
+	})
+	save := cmd.String(cli.StringOpt{
+		Name: "save-baseline",
+		Desc: "Save the snapshot taken as the named baseline, replacing any of the same name.",
+	})
+	noSave := cmd.Bool(cli.BoolOpt{
+		Name: "no-save",
+		Desc: "Compare without recording the snapshot taken, so the next run compares against the same one.",
+	})
+	out := addOutputFlags(cmd, output.Table)
+
+	cmd.Action = func() {
+		out.banner("unified drift")
+		store := openSnapshots(*dir)
+		defer store.Close()
+
+		devices, _, err := cx.Devices.List(ctx, nil)
+		fatalIf(err)
+		current := unified.NewSnapshot(*cx.SiteName, devices, time.Now())
+
+		var previous *unified.Snapshot
+		if *baseline != "" {
+			previous, err = store.Baseline(*cx.SiteName, *baseline)
+		} else {
+			previous, err = store.Latest(*cx.SiteName)
+		}
+		fatalIf(err)
+
+		if !*noSave {
+			current.Baseline = *save
+			fatalIf(store.Save(current))
+		}
+		if previous == nil {
+			if out.isText() {
+				fmt.Printf("First snapshot of %d devices taken. Run again to see what has changed since.\n",
+					len(current.Devices))
+			}
+			return
+		}
+
+		drifts := unified.Diff(previous, current)
+		var admins []string
+		if len(drifts) > 0 {
+			admins = driftAdmins(drifts, previous, current)
+		}
+		if out.isText() {
+			fmt.Printf("Changes since %s\n\n", describeSnapshot(previous))
+			if len(drifts) == 0 {
+				fmt.Println("No drift.")
+				return
+			}
+		}
+		out.render(driftRows(drifts), driftColumns...)
+		if out.isText() && len(admins) > 0 {
+			fmt.Printf("\nAdmins active in this period: %s\n", strings.Join(admins, ", "))
+		}
+	}
+
+	cmd.Command("baselines", "Lists the baselines saved for the site.", func(cmd2 *cli.Cmd) {
+		out := addOutputFlags(cmd2, output.Table)
+		cmd2.Action = func() {
+			out.banner("unified drift baselines")
+			store := openSnapshots(*dir)
+			defer store.Close()
+
+			baselines, err := store.Baselines(*cx.SiteName)
+			fatalIf(err)
+			type baselineRow struct {
+				Baseline string    `json:"baseline"`
+				Taken    time.Time `json:"taken"`
+				Devices  int       `json:"devices"`
+			}
+			rows := make([]baselineRow, 0, len(baselines))
+			for _, b := range baselines {
+				rows = append(rows, baselineRow{b.Baseline, b.Taken, len(b.Devices)})
+			}
+			out.render(rows)
+		}
+	})
+}
+
+func openSnapshots(dir string) *unified.SnapshotStore {
+	fatalIf(os.MkdirAll(dir, 0700))
+	store, err := unified.OpenSnapshotStore(dir)
+	fatalIf(err)
+	return store
+}
+
+// driftAdmins fetches the events between two snapshots to find who made the changes found.
+func driftAdmins(drifts []unified.Drift, previous, current *unified.Snapshot) []string {
+	hours := int(math.Ceil(current.Taken.Sub(previous.Taken).Hours()))
+	events, _, err := cx.Events.List(ctx, &unified.QueryOptions{
+		Within: hours,
+		Filter: unified.ListFilter{Since: previous.Taken},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to fetch the events to see who made the changes: %v\n", err)
+		return nil
+	}
+	return unified.Correlate(drifts, events, previous, current)
+}
+
+func describeSnapshot(snap *unified.Snapshot) string {
+	if snap.Baseline != "" {
+		return fmt.Sprintf("baseline %q taken %s", snap.Baseline, formatTime(snap.Taken))
+	}
+	return "the last snapshot taken " + formatTime(snap.Taken)
+}
+
+func driftRows(drifts []unified.Drift) []driftRow {
+	var rows []driftRow
+	for _, d := range drifts {
+		row := driftRow{Name: d.Name, MacAddress: d.MacAddress, Status: d.Status, ChangedBy: strings.Join(d.ChangedBy, ",")}
+		if len(d.Fields) == 0 {
+			rows = append(rows, row)
+			continue
+		}
+		for _, f := range d.Fields {
+			row.Field, row.Old, row.New = f.Field, f.Old, f.New
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
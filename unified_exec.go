@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bitbucket.org/ecosse-hosting/unified/lib/playbook"
+	"bitbucket.org/ecosse-hosting/unified/lib/remote"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/jawher/mow.cli"
+	"os"
+	"time"
+)
+
+// execResult is the outcome of running a command on a device as rendered for -o json, yaml, csv and the like.
+type execResult struct {
+	Name       string `json:"name"`
+	MacAddress string `json:"mac"`
+	IP         string `json:"ip"`
+	ExitCode   int    `json:"exit_code"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	Duration   string `json:"duration"`
+	Error      string `json:"error,omitempty"`
+}
+
+func cmdExec(cmd *cli.Cmd) {
+	cmd.Spec = "[OPTIONS] [DEVICE...] [COMMAND]"
+	bulk := addDeviceListFlags(cmd)
+	login := addSSHFlags(cmd)
+	audited := addAuditFlags(cmd)
+	command := cmd.StringArg("COMMAND", "", "The command to run e.g. 'cat /etc/version'. Quote it to pass arguments. "+
+		"Not given with --playbook.")
+	timeout := cmd.String(cli.StringOpt{
+		Name:  "t timeout",
+		Value: "30s",
+		Desc: "Kill the command on any device where it is still running after this long e.g. 2m. 0 waits forever. " +
+			"Playbooks give their own timeouts.",
+	})
+	playbookPath := cmd.String(cli.StringOpt{
+		Name: "p playbook",
+		Desc: "Run the steps of an expect-style YAML playbook in a shell on each device instead of a command.",
+	})
+	vars := cmd.Strings(cli.StringsOpt{
+		Name: "var",
+		Desc: "Set a variable of the playbook e.g. --var radio=wifi1. May be repeated.",
+	})
+
+	cmd.Action = func() {
+		// DEVICE... takes every argument, so without a playbook the last one is the command.
+		if names := *bulk.names; *playbookPath == "" && *command == "" && len(names) > 0 {
+			*command, *bulk.names = names[len(names)-1], names[:len(names)-1]
+		}
+		var book *playbook.Playbook
+		what := fmt.Sprintf("%q", *command)
+		switch {
+		case *playbookPath != "":
+			var err error
+			book, err = playbook.Load(*playbookPath)
+			fatalIf(err)
+			what = "the playbook " + *playbookPath
+		case *command == "":
+			fatalIf(fmt.Errorf("give the command to run, or --playbook"))
+		}
+		limit, err := parseAge(*timeout)
+		fatalIf(err)
+		bulkTargets, err := bulk.targets()
+		fatalIf(err)
+		if *bulk.dryRun {
+			if bulk.out.isText() {
+				fmt.Printf("Would run %s on %d device(s).\n", what, len(bulkTargets))
+			}
+			bulk.out.render(bulkTargets, "Name", "MacAddress", "IP", "Type")
+			return
+		}
+		if len(bulkTargets) > *bulk.confirm && !*bulk.yes {
+			fatalIf(confirm(fmt.Sprintf("Run %s on %d devices?", what, len(bulkTargets))))
+		}
+		if book != nil {
+			runPlaybook(bulk, login, audited, book, *playbookPath, parseVars(*vars), bulkTargets)
+			return
+		}
+
+		targets := make([]remote.Target, len(bulkTargets))
+		for i, t := range bulkTargets {
+			targets[i] = remoteTarget(t)
+		}
+		text := bulk.out.isText()
+		// Each session is logged before connecting to the device, so it is known to have run even if unified is
+		// interrupted before it finishes.
+		sessions := make([]*auditSession, len(targets))
+		start := func(i int) {
+			sessions[i] = audited.begin("exec", targets[i], *command, time.Now(), 80, 24)
+		}
+		results := login.config().ExecAll(targets, *command, limit, *bulk.workers, start, func(i int, r remote.Result) {
+			sessions[i].result(r)
+			if text && len(targets) > 1 {
+				printExecResult(r)
+			}
+		})
+
+		if len(results) == 1 && text {
+			// A single device behaves like ssh, passing the output through and exiting with the command's code.
+			r := results[0]
+			os.Stdout.Write(r.Stdout)
+			os.Stderr.Write(r.Stderr)
+			fatalIf(r.Err)
+			if r.ExitCode != 0 {
+				cli.Exit(r.ExitCode)
+			}
+			return
+		}
+
+		failed := 0
+		rows := make([]execResult, len(results))
+		for i, r := range results {
+			rows[i] = execResult{
+				Name:       r.Target.Name,
+				MacAddress: r.Target.MacAddress,
+				IP:         r.Target.IP,
+				ExitCode:   r.ExitCode,
+				Stdout:     string(r.Stdout),
+				Stderr:     string(r.Stderr),
+				Duration:   r.Duration.Round(time.Millisecond).String(),
+			}
+			if r.Err != nil {
+				rows[i].Error = r.Err.Error()
+			}
+			if r.Err != nil || r.ExitCode != 0 {
+				failed++
+			}
+		}
+		if text {
+			fmt.Printf("\n%d succeeded, %d failed.\n", len(results)-failed, failed)
+		} else {
+			bulk.out.render(rows, "Name", "MacAddress", "ExitCode", "Duration", "Error")
+		}
+		if failed > 0 {
+			cli.Exit(1)
+		}
+	}
+}
+
+// printExecResult prints the output of a command on a device under a heading, stderr in red, so the output of
+// devices running the command at the same time is not interleaved.
+func printExecResult(r remote.Result) {
+	status := fmt.Sprintf("exit %d", r.ExitCode)
+	heading := color.New(color.Bold)
+	switch {
+	case r.Err != nil:
+		status, heading = r.Err.Error(), color.New(color.Bold, color.FgRed)
+	case r.ExitCode != 0:
+		heading = color.New(color.Bold, color.FgYellow)
+	}
+	heading.Printf("==> %s %s in %s <==\n", r.Target, status, r.Duration.Round(time.Millisecond))
+	os.Stdout.Write(r.Stdout)
+	if len(r.Stderr) > 0 {
+		color.New(color.FgRed).Print(string(r.Stderr))
+	}
+	if n := len(r.Stdout); n > 0 && r.Stdout[n-1] != '\n' {
+		fmt.Println()
+	}
+}
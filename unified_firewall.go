@@ -0,0 +1,530 @@
+package main
+
+import (
+	"bitbucket.org/ecosse-hosting/unified/lib/output"
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/jawher/mow.cli"
+	"os"
+	"strings"
+)
+
+// firewallRow is a firewall rule as listed by firewall ls, with groups and networks given by name.
+type firewallRow struct {
+	Ruleset     string `json:"ruleset"`
+	Index       int    `json:"rule_index"`
+	Name        string `json:"name"`
+	Action      string `json:"action"`
+	Protocol    string `json:"protocol"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	States      string `json:"states"`
+	Enabled     bool   `json:"enabled"`
+	ID          string `json:"_id"`
+}
+
+var firewallColumns = []string{"Ruleset", "Index", "Name", "Action", "Protocol", "Source", "Destination", "Enabled"}
+
+// firewallGroupRow is a firewall group as listed by firewall group ls.
+type firewallGroupRow struct {
+	Name    string `json:"name"`
+	Type    string `json:"group_type"`
+	Members string `json:"group_members"`
+	ID      string `json:"_id"`
+}
+
+// firewallData holds the rules, groups and networks of the site, which rules are displayed and checked against.
+type firewallData struct {
+	rules    []unified.FirewallRule
+	groups   []unified.FirewallGroup
+	networks []unified.RestObject
+}
+
+func fetchFirewall() *firewallData {
+	var f firewallData
+	var err error
+	f.rules, _, err = cx.Firewall.ListRules(ctx)
+	fatalIf(err)
+	f.groups, _, err = cx.Firewall.ListGroups(ctx)
+	fatalIf(err)
+	f.networks, _, err = cx.Rest.List(ctx, "networkconf")
+	fatalIf(err)
+	return &f
+}
+
+// cmdFirewall adds the firewall sub-commands which manage the firewall rules and groups of the site.
+func cmdFirewall(cmd *cli.Cmd) {
+	cmd.Command("ls", "Lists the firewall rules in the order they are matched.", func(cmd2 *cli.Cmd) {
+		ruleset := cmd2.String(cli.StringOpt{
+			Name: "r ruleset",
+			Desc: "Only list the rules of a ruleset e.g. LAN_IN.",
+		})
+		out := addOutputFlags(cmd2, output.Table)
+		cmd2.Action = func() {
+			out.banner("unified firewall ls")
+			f := fetchFirewall()
+			rows := make([]firewallRow, 0, len(f.rules))
+			for _, r := range f.rules {
+				if *ruleset == "" || strings.EqualFold(r.Ruleset, *ruleset) {
+					rows = append(rows, f.row(r))
+				}
+			}
+			out.render(rows, firewallColumns...)
+		}
+	})
+
+	cmd.Command("inspect", "Displays all the fields of a firewall rule.", func(cmd2 *cli.Cmd) {
+		cmd2.Spec = "[OPTIONS] RULE"
+		query := cmd2.StringArg("RULE", "", ruleArgDesc)
+		out := addOutputFlags(cmd2, output.JSON)
+		cmd2.Action = func() {
+			rules, _, err := cx.Firewall.ListRules(ctx)
+			fatalIf(err)
+			rule, err := unified.ResolveRule(*query, rules)
+			fatalIf(err)
+			out.render(rule)
+		}
+	})
+
+	cmd.Command("add", "Adds a firewall rule, by default after the existing rules of its ruleset.", func(cmd2 *cli.Cmd) {
+		cmd2.Spec = "[OPTIONS]"
+		flags := addRuleFlags(cmd2, true)
+		cmd2.Action = func() {
+			f := fetchFirewall()
+			rule := &unified.FirewallRule{IsEnabled: true}
+			fatalIf(flags.apply(rule, f))
+			if !flags.set["index"] {
+				rule.RuleIndex = unified.NextRuleIndex(f.rules, rule.Ruleset)
+			}
+			created, _, err := cx.Firewall.CreateRule(ctx, rule)
+			fatalIf(err)
+			fmt.Printf("Added %s:%d %q (%s)\n", created.Ruleset, created.RuleIndex, created.Name, created.ID)
+			f.warnShadowed(append(f.rules, *created))
+		}
+	})
+
+	cmd.Command("update", "Changes the given fields of a firewall rule.", func(cmd2 *cli.Cmd) {
+		cmd2.Spec = "[OPTIONS] RULE"
+		flags := addRuleFlags(cmd2, false)
+		query := cmd2.StringArg("RULE", "", ruleArgDesc)
+		cmd2.Action = func() {
+			f := fetchFirewall()
+			rule, err := unified.ResolveRule(*query, f.rules)
+			fatalIf(err)
+			fatalIf(flags.apply(rule, f))
+			_, _, err = cx.Firewall.UpdateRule(ctx, rule)
+			fatalIf(err)
+			fmt.Printf("Updated %s:%d %q\n", rule.Ruleset, rule.RuleIndex, rule.Name)
+			f.warnShadowed(f.rules)
+		}
+	})
+
+	cmd.Command("delete", "Deletes a firewall rule.", func(cmd2 *cli.Cmd) {
+		cmd2.Spec = "[--yes] RULE"
+		yes := cmd2.Bool(cli.BoolOpt{
+			Name: "yes",
+			Desc: "Delete the rule without asking for confirmation.",
+		})
+		query := cmd2.StringArg("RULE", "", ruleArgDesc)
+		cmd2.Action = func() {
+			rules, _, err := cx.Firewall.ListRules(ctx)
+			fatalIf(err)
+			rule, err := unified.ResolveRule(*query, rules)
+			fatalIf(err)
+			if !*yes {
+				fatalIf(confirm(fmt.Sprintf("Delete %s:%d %q?", rule.Ruleset, rule.RuleIndex, rule.Name)))
+			}
+			_, err = cx.Firewall.DeleteRule(ctx, rule.ID)
+			fatalIf(err)
+			fmt.Printf("Deleted %s:%d %q\n", rule.Ruleset, rule.RuleIndex, rule.Name)
+		}
+	})
+
+	cmd.Command("move", "Moves a firewall rule within its ruleset.", func(cmd2 *cli.Cmd) {
+		cmd2.Spec = "RULE (--before=<RULE> | --after=<RULE> | --top | --bottom)"
+		query := cmd2.StringArg("RULE", "", ruleArgDesc)
+		before := cmd2.String(cli.StringOpt{Name: "before", Desc: "Move the rule before this one."})
+		after := cmd2.String(cli.StringOpt{Name: "after", Desc: "Move the rule after this one."})
+		top := cmd2.Bool(cli.BoolOpt{Name: "top", Desc: "Move the rule to the start of its ruleset."})
+		bottom := cmd2.Bool(cli.BoolOpt{Name: "bottom", Desc: "Move the rule to the end of its ruleset."})
+		cmd2.Action = func() {
+			f := fetchFirewall()
+			rule, err := unified.ResolveRule(*query, f.rules)
+			fatalIf(err)
+
+			var ruleset []unified.FirewallRule
+			for _, r := range f.rules {
+				if r.Ruleset == rule.Ruleset {
+					ruleset = append(ruleset, r)
+				}
+			}
+			position := 0
+			switch {
+			case *top:
+			case *bottom:
+				position = len(ruleset) - 1
+			default:
+				other := *before
+				if other == "" {
+					other = *after
+				}
+				target, err := unified.ResolveRule(other, ruleset)
+				fatalIf(err)
+				// Taking the rule out from ahead of the target moves the target up one place.
+				position = positionOf(ruleset, target.ID)
+				from := positionOf(ruleset, rule.ID)
+				if *after != "" && position < from {
+					position++
+				} else if *before != "" && position > from {
+					position--
+				}
+			}
+
+			updates, err := unified.MoveRule(f.rules, rule.ID, position)
+			fatalIf(err)
+			for i := range updates {
+				_, _, err := cx.Firewall.UpdateRule(ctx, &updates[i])
+				fatalIf(err)
+			}
+			if len(updates) == 0 {
+				fmt.Printf("%s:%d %q is already there\n", rule.Ruleset, rule.RuleIndex, rule.Name)
+				return
+			}
+			final := updates[len(updates)-1]
+			fmt.Printf("Moved %q to %s:%d\n", final.Name, final.Ruleset, final.RuleIndex)
+		}
+	})
+
+	cmd.Command("check", "Warns of firewall rules which can never match as an earlier rule covers them.", func(cmd2 *cli.Cmd) {
+		cmd2.Action = func() {
+			f := fetchFirewall()
+			if !f.warnShadowed(f.rules) {
+				fmt.Println("No shadowed rules.")
+				return
+			}
+			cli.Exit(1)
+		}
+	})
+
+	cmd.Command("group", "Manages the address and port groups firewall rules can match.", cmdFirewallGroup)
+}
+
+const ruleArgDesc = "The firewall rule, by ID, name or rule index optionally prefixed with its ruleset e.g. LAN_IN:2001."
+
+func positionOf(rules []unified.FirewallRule, id string) int {
+	for i, r := range rules {
+		if r.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// warnShadowed prints the rules which can never match, reporting whether there were any.
+func (f *firewallData) warnShadowed(rules []unified.FirewallRule) bool {
+	shadows := unified.FindShadowed(rules, f.groups, unified.Subnets(f.networks))
+	for _, s := range shadows {
+		color.New(color.FgYellow).Fprintf(os.Stderr, "Warning: %s\n", s)
+	}
+	return len(shadows) > 0
+}
+
+func (f *firewallData) row(r unified.FirewallRule) firewallRow {
+	return firewallRow{
+		Ruleset:  r.Ruleset,
+		Index:    r.RuleIndex,
+		Name:     r.Name,
+		Action:   r.Action,
+		Protocol: r.Protocol,
+		Source: f.describe(r.SrcFirewallGroupIds, r.SrcAddress, r.SrcMacAddress, r.SrcNetworkConfId,
+			r.SrcNetworkConfType, r.SrcPort),
+		Destination: f.describe(r.DstFirewallGroupIds, r.DstAddress, "", r.DstNetworkConfId,
+			r.DstNetworkConfType, r.DstPort),
+		States:  strings.Join(r.States(), ","),
+		Enabled: r.IsEnabled,
+		ID:      r.ID,
+	}
+}
+
+// describe summarises the source or destination of a rule e.g. "Servers:Web" or "LAN (network)".
+func (f *firewallData) describe(groupIDs []string, address, mac, networkID, networkType, port string) string {
+	var parts []string
+	for _, id := range groupIDs {
+		name := id
+		for _, g := range f.groups {
+			if g.ID == id {
+				name = g.Name
+			}
+		}
+		parts = append(parts, name)
+	}
+	if address != "" {
+		parts = append(parts, address)
+	}
+	if mac != "" {
+		parts = append(parts, mac)
+	}
+	if networkID != "" {
+		name := networkID
+		for _, n := range f.networks {
+			if n.ID() == networkID {
+				name = n.Name()
+			}
+		}
+		if networkType == "ADDRv4" {
+			parts = append(parts, name+" (gateway)")
+		} else {
+			parts = append(parts, name+" (network)")
+		}
+	}
+	if port != "" {
+		parts = append(parts, "port "+port)
+	}
+	if len(parts) == 0 {
+		return "any"
+	}
+	return strings.Join(parts, " ")
+}
+
+func (f *firewallData) groupID(name string) (string, error) {
+	g, err := unified.ResolveGroup(name, f.groups)
+	if err != nil {
+		return "", err
+	}
+	return g.ID, nil
+}
+
+func (f *firewallData) networkID(name string) (string, error) {
+	for _, n := range f.networks {
+		if n.ID() == name || strings.EqualFold(n.Name(), name) {
+			return n.ID(), nil
+		}
+	}
+	return "", &unified.NotFoundError{Kind: "network", Query: name}
+}
+
+// ruleFlags holds the options of firewall add and update, set records which were given so update only changes
+// those.
+type ruleFlags struct {
+	ruleset, name, action, protocol  *string
+	src, srcMac, srcNetwork, srcPort *string
+	dst, dstNetwork, dstPort, states *string
+	srcGroups, dstGroups             *[]string
+	index                            *int
+	log, disabled, gateway           *bool
+	set                              map[string]bool
+	setBy                            map[string]*bool
+}
+
+func addRuleFlags(cmd *cli.Cmd, adding bool) *ruleFlags {
+	f := &ruleFlags{setBy: make(map[string]*bool)}
+	str := func(name, desc string) *string {
+		f.setBy[name] = new(bool)
+		return cmd.String(cli.StringOpt{Name: name, Desc: desc, SetByUser: f.setBy[name]})
+	}
+	strs := func(name, desc string) *[]string {
+		f.setBy[name] = new(bool)
+		return cmd.Strings(cli.StringsOpt{Name: name, Desc: desc, SetByUser: f.setBy[name]})
+	}
+	boolean := func(name, desc string) *bool {
+		f.setBy[name] = new(bool)
+		return cmd.Bool(cli.BoolOpt{Name: name, Desc: desc, SetByUser: f.setBy[name]})
+	}
+
+	f.ruleset = str("ruleset", "The ruleset of the rule, one of "+strings.Join(unified.Rulesets, ", ")+".")
+	f.name = str("name", "The name of the rule.")
+	f.action = str("action", "What to do with matching traffic: accept, drop or reject.")
+	f.protocol = str("protocol", "The protocol to match e.g. all, tcp, udp, tcp_udp or icmp.")
+	f.src = str("src", "The source address, CIDR or range to match.")
+	f.srcMac = str("src-mac", "The source MAC address to match.")
+	f.srcNetwork = str("src-network", "The source network to match, by name.")
+	f.srcGroups = strs("src-group", "A source address or port group to match, by name. Repeat for several.")
+	f.srcPort = str("src-port", "The source ports to match e.g. 1024-65535.")
+	f.dst = str("dst", "The destination address, CIDR or range to match.")
+	f.dstNetwork = str("dst-network", "The destination network to match, by name.")
+	f.dstGroups = strs("dst-group", "A destination address or port group to match, by name. Repeat for several.")
+	f.dstPort = str("dst-port", "The destination ports to match e.g. 80,443 or 8000-8080.")
+	f.gateway = boolean("gateway", "Match the gateway address of --src-network and --dst-network rather than the "+
+		"whole subnet.")
+	f.states = str("state", "The connection states to match e.g. new,established. Empty matches all.")
+	f.log = boolean("log", "Log the traffic matched.")
+	f.disabled = boolean("disabled", "Disable the rule.")
+	f.setBy["index"] = new(bool)
+	f.index = cmd.Int(cli.IntOpt{Name: "index", Desc: "The rule_index of the rule, 2000-2999 to match before the " +
+		"predefined rules or 4000 and above to match after them.", SetByUser: f.setBy["index"]})
+	if adding {
+		*f.protocol = "all"
+		*f.action = "drop"
+	}
+	return f
+}
+
+// apply sets the fields of rule given by the options.
+func (f *ruleFlags) apply(rule *unified.FirewallRule, data *firewallData) error {
+	f.set = make(map[string]bool)
+	for name, set := range f.setBy {
+		f.set[name] = *set
+	}
+	if f.set["ruleset"] || rule.Ruleset == "" {
+		rule.Ruleset = strings.ToUpper(*f.ruleset)
+		rule.Ruleset = strings.Replace(rule.Ruleset, "V6", "v6", 1)
+	}
+	if f.set["name"] || rule.Name == "" {
+		rule.Name = *f.name
+	}
+	if f.set["action"] || rule.Action == "" {
+		rule.Action = strings.ToLower(*f.action)
+	}
+	if f.set["protocol"] || rule.Protocol == "" {
+		rule.Protocol = strings.ToLower(*f.protocol)
+	}
+	if f.set["src"] {
+		rule.SrcAddress = *f.src
+	}
+	if f.set["src-mac"] {
+		rule.SrcMacAddress = *f.srcMac
+	}
+	if f.set["src-port"] {
+		rule.SrcPort = *f.srcPort
+	}
+	if f.set["dst"] {
+		rule.DstAddress = *f.dst
+	}
+	if f.set["dst-port"] {
+		rule.DstPort = *f.dstPort
+	}
+	if f.set["index"] {
+		rule.RuleIndex = *f.index
+	}
+	if f.set["log"] {
+		rule.IsLogging = *f.log
+	}
+	if f.set["disabled"] {
+		rule.IsEnabled = !*f.disabled
+	}
+	if f.set["state"] {
+		if err := rule.SetStates(strings.Split(*f.states, ",")); err != nil {
+			return err
+		}
+	}
+
+	networkType := "NETv4"
+	if *f.gateway {
+		networkType = "ADDRv4"
+	}
+	for _, n := range []struct {
+		flag     string
+		name     *string
+		id, kind *string
+	}{
+		{"src-network", f.srcNetwork, &rule.SrcNetworkConfId, &rule.SrcNetworkConfType},
+		{"dst-network", f.dstNetwork, &rule.DstNetworkConfId, &rule.DstNetworkConfType},
+	} {
+		if !f.set[n.flag] {
+			continue
+		}
+		*n.id, *n.kind = "", networkType
+		if *n.name != "" {
+			id, err := data.networkID(*n.name)
+			if err != nil {
+				return err
+			}
+			*n.id = id
+		}
+	}
+	for _, g := range []struct {
+		flag  string
+		names *[]string
+		ids   *[]string
+	}{
+		{"src-group", f.srcGroups, &rule.SrcFirewallGroupIds},
+		{"dst-group", f.dstGroups, &rule.DstFirewallGroupIds},
+	} {
+		if !f.set[g.flag] {
+			continue
+		}
+		*g.ids = []string{}
+		for _, name := range *g.names {
+			if name == "" {
+				continue
+			}
+			id, err := data.groupID(name)
+			if err != nil {
+				return err
+			}
+			*g.ids = append(*g.ids, id)
+		}
+	}
+	return rule.Validate()
+}
+
+// cmdFirewallGroup adds the firewall group sub-commands.
+func cmdFirewallGroup(cmd *cli.Cmd) {
+	cmd.Command("ls", "Lists the firewall groups.", func(cmd2 *cli.Cmd) {
+		out := addOutputFlags(cmd2, output.Table)
+		cmd2.Action = func() {
+			out.banner("unified firewall group ls")
+			groups, _, err := cx.Firewall.ListGroups(ctx)
+			fatalIf(err)
+			rows := make([]firewallGroupRow, 0, len(groups))
+			for _, g := range groups {
+				rows = append(rows, firewallGroupRow{g.Name, g.GroupType, strings.Join(g.GroupMembers, ","), g.ID})
+			}
+			out.render(rows, "Name", "Type", "Members")
+		}
+	})
+
+	cmd.Command("add", "Adds a firewall group.", func(cmd2 *cli.Cmd) {
+		cmd2.Spec = "--type=<TYPE> NAME [MEMBER...]"
+		groupType := cmd2.String(cli.StringOpt{
+			Name: "type",
+			Desc: "The type of group: " + unified.AddressGroup + ", " + unified.IPv6AddressGroup + " or " +
+				unified.PortGroup + ".",
+		})
+		name := cmd2.StringArg("NAME", "", "The name of the group.")
+		members := cmd2.StringsArg("MEMBER", nil, "The addresses, CIDRs or ports of the group.")
+		cmd2.Action = func() {
+			group := &unified.FirewallGroup{Name: *name, GroupType: *groupType, GroupMembers: *members}
+			created, _, err := cx.Firewall.CreateGroup(ctx, group)
+			fatalIf(err)
+			fmt.Printf("Added %s %q (%s)\n", created.GroupType, created.Name, created.ID)
+		}
+	})
+
+	cmd.Command("update", "Replaces the members of a firewall group.", func(cmd2 *cli.Cmd) {
+		cmd2.Spec = "GROUP [MEMBER...]"
+		query := cmd2.StringArg("GROUP", "", "The group, by ID or name.")
+		members := cmd2.StringsArg("MEMBER", nil, "The addresses, CIDRs or ports of the group.")
+		cmd2.Action = func() {
+			groups, _, err := cx.Firewall.ListGroups(ctx)
+			fatalIf(err)
+			group, err := unified.ResolveGroup(*query, groups)
+			fatalIf(err)
+			group.GroupMembers = *members
+			_, _, err = cx.Firewall.UpdateGroup(ctx, group)
+			fatalIf(err)
+			fmt.Printf("Updated %s %q\n", group.GroupType, group.Name)
+		}
+	})
+
+	cmd.Command("delete", "Deletes a firewall group which no rule uses.", func(cmd2 *cli.Cmd) {
+		cmd2.Spec = "GROUP"
+		query := cmd2.StringArg("GROUP", "", "The group, by ID or name.")
+		cmd2.Action = func() {
+			f := fetchFirewall()
+			group, err := unified.ResolveGroup(*query, f.groups)
+			fatalIf(err)
+			for _, r := range f.rules {
+				for _, id := range append(append([]string{}, r.SrcFirewallGroupIds...), r.DstFirewallGroupIds...) {
+					if id == group.ID {
+						fatalIf(fmt.Errorf("%q is used by the rule %s:%d %q", group.Name, r.Ruleset, r.RuleIndex, r.Name))
+					}
+				}
+			}
+			_, err = cx.Firewall.DeleteGroup(ctx, group.ID)
+			fatalIf(err)
+			fmt.Printf("Deleted %s %q\n", group.GroupType, group.Name)
+		}
+	})
+}
@@ -1,25 +1,22 @@
 package main
 
 import (
+	"bitbucket.org/ecosse-hosting/unified/lib/output"
 	shell "bitbucket.org/ecosse-hosting/unified/lib/shell"
 	tftp "bitbucket.org/ecosse-hosting/unified/lib/tftp"
 	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
 	"bytes"
 	"context"
 	"crypto/tls"
-	"encoding/json"
 	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"github.com/abiosoft/ishell"
 	"github.com/fatih/color"
-	"github.com/fatih/structs"
-	yaml2 "github.com/ghodss/yaml"
 	"github.com/jawher/mow.cli"
-	"github.com/olekukonko/tablewriter"
 	"net/http"
 	"net/url"
 	"os"
-	"strconv"
+	"sort"
 	"strings"
 	"time"
 	"os/exec"
@@ -31,6 +28,9 @@ import (
 var (
 	ctx = context.TODO()
 	cx  *unified.UniFiClient
+
+	// The timezone times are displayed in, set with --tz.
+	displayLocation = time.Local
 )
 
 // Simple structure representing the information needed to create a remote SSH Terminal session.
@@ -44,9 +44,6 @@ type SSHConnection struct {
 var ssh_portOption bool
 var ssh_hostOption bool
 var ssh_userOption bool
-var table_output bool
-var json_output bool
-var yaml_output bool
 var username bool
 var password bool
 var useDBOption bool
@@ -67,7 +64,9 @@ var pluginMap = map[string]plugin.Plugin{
 	"tftpclient": &spi.TFTPClientPlugin{},
 }
 
-func init() {
+// startTFTPClient launches the tftpclient plugin. It is called by main rather than from init so the tests of this
+// package can run without the plugin installed.
+func startTFTPClient() {
 	// We're a host! Start by launching the plugin process.
 	client := plugin.NewClient(&plugin.ClientConfig{
 		HandshakeConfig: handshakeConfig,
@@ -96,10 +95,47 @@ func init() {
 	tftpClient.Connect("127.0.0.1", 69)
 }
 
+// connectController logs in to the UniFi Controller at address, its host and optionally port, as user, returning
+// why when it cannot.
+func connectController(
+	address string,
+	o *unified.UnifiedOptions,
+	user, pass, site *string) (*unified.UniFiClient, error) {
+
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	client := &http.Client{Timeout: time.Second * 300, Transport: tr}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("https://")
+	buffer.WriteString(address)
+	buffer.WriteString("/api/s/")
+	cont_addr := buffer.String()
+	base_url, err := url.Parse(cont_addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := unified.NewUniFiClient(client, o)
+	c.BaseURL = base_url
+
+	c.UserName = user
+	c.Password = pass
+	c.SiteName = site
+	if _, _, err := c.Authentication.Login(ctx, *user, *pass); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
 func main() {
+	startTFTPClient()
+
 	app := cli.App("unified", "Unified CLI for Ubiquiti UniFi")
 	app.Version("v version", "unified 0.0.1")
-	app.Spec = "-u -p -c ([-b -x]) [-s]"
+	app.Spec = "-u -p -c ([-b -x]) [-s] [--tz]"
 
 	var (
 		useDB = app.Bool(
@@ -168,16 +204,27 @@ func main() {
 				EnvVar: "UNIFIED_SITE",
 			},
 		)
+
+		tz = app.String(
+			cli.StringOpt{
+				Name:   "tz",
+				Value:  "Local",
+				Desc:   "Set the timezone times are displayed in e.g. UTC or Europe/London.",
+				EnvVar: "UNIFIED_TZ",
+			},
+		)
 	)
 
 	app.Before = func() {
 		// Only log the warning severity or above.
 		log.SetLevel(log.WarnLevel)
 
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		loc, err := time.LoadLocation(*tz)
+		if err != nil {
+			fmt.Println("Unknown timezone " + *tz + "!")
+			cli.Exit(999)
 		}
-		client := &http.Client{Timeout: time.Second * 300, Transport: tr}
+		displayLocation = loc
 
 		d := &unified.UnifiedDBOptions{
 			DbUsageEnabled: *useDB,
@@ -189,24 +236,9 @@ func main() {
 		}
 
 		if *controller != "" {
-			var buffer bytes.Buffer
-			buffer.WriteString("https://")
-			buffer.WriteString(*controller)
-			buffer.WriteString("/api/s/")
-			cont_addr := buffer.String()
-			base_url, err := url.Parse(cont_addr)
-
-			if err != nil {
-				panic(err)
-			}
-
-			cx = unified.NewUniFiClient(client, o)
-			cx.BaseURL = base_url
-
-			cx.UserName = user
-			cx.Password = pass
-			cx.SiteName = site
-			cx.Authentication.Login(ctx, *user, *pass)
+			var err error
+			cx, err = connectController(*controller, o, user, pass, site)
+			fatalIf(err)
 		} else {
 			fmt.Println("No UniFi Controller specified!")
 			cli.Exit(999)
@@ -214,15 +246,27 @@ func main() {
 	}
 
 	app.Command("client", "Network client commands on the UniFi Controller.", func(cmd *cli.Cmd) {
+		cmd.Command(
+			"ls",
+			"Displays a list of the clients connected to the network.",
+			func(cmd3 *cli.Cmd) {
+				out := addOutputFlags(cmd3, output.Table)
+				watch := addWatchFlags(cmd3)
+				cmd3.Action = func() {
+					watch.list(out, "unified client ls", "mac", func() (interface{}, error) {
+						clients, _, err := cx.Users.ListActive(ctx, nil)
+						return clients, err
+					}, clientColumns...)
+				}
+			})
 		cmd.Command(
 			"authorize-guest",
 			"Authorizes a client network device. " +
 				"i.e. The device can use the network, is connected and visible in the Controller.",
 			func(cmd3 *cli.Cmd) {
-				cmd3.Spec = "([-a -m -d -u -t])"
 				apMacAddress := cmd3.String(cli.StringOpt{
 					Name:      "a apMac",
-					Desc:      "AP MAC address to which client is connected. " +
+					Desc:      "AP to which client is connected, by name, IP or MAC address. " +
 						"(Should result in faster authorization)",
 					Value: "",
 				})
@@ -246,15 +290,18 @@ func main() {
 					Desc:      "Cap the upload speed of the client network device.",
 					Value: "",
 				})
-				clientMacAddress := cmd3.StringArg("MAC_ADDRESS", "",
-					"The MAC address of the uap device to target.")
+				bulk := addClientBulkFlags(cmd3)
 				cmd3.Action = func() {
-					fmt.Println("\nunified client unauthorize-guest MAC_ADDRESS\n")
-					cmdResp, _, err := cx.ClientDevice.AuthorizeGuest(
-						ctx, *clientMacAddress, *time, *upSpeed,
-						*downSpeed, *mBytes, *apMacAddress)
-					if err != nil {}
-					fmt.Println(cmdResp.Meta.Status)
+					bulk.out.banner("unified client authorize-guest CLIENT")
+					apMac := *apMacAddress
+					if apMac != "" {
+						apMac = resolveDevice(apMac).MacAddress
+					}
+					bulk.run("authorize", func(t bulkTarget) (string, error) {
+						return cmdStatus(cx.ClientDevice.AuthorizeGuest(
+							ctx, t.MacAddress, *time, *upSpeed,
+							*downSpeed, *mBytes, apMac))
+					})
 				}
 			})
 		cmd.Command(
@@ -262,13 +309,12 @@ func main() {
 			"Unauthorizes a client network device. " +
 				"The device cannot use the network but is connected and visible in the Controller.",
 			func(cmd3 *cli.Cmd) {
-				clientMacAddress := cmd3.StringArg("MAC_ADDRESS", "",
-					"The MAC address of the uap device to target.")
+				bulk := addClientBulkFlags(cmd3)
 				cmd3.Action = func() {
-					fmt.Println("\nunified client unauthorize-guest MAC_ADDRESS\n")
-					cmdResp, _, err := cx.ClientDevice.UnauthorizeGuest(ctx, *clientMacAddress)
-					if err != nil {}
-					fmt.Println(cmdResp.Meta.Status)
+					bulk.out.banner("unified client unauthorize-guest CLIENT")
+					bulk.run("unauthorize", func(t bulkTarget) (string, error) {
+						return cmdStatus(cx.ClientDevice.UnauthorizeGuest(ctx, t.MacAddress))
+					})
 				}
 			})
 		cmd.Command(
@@ -276,26 +322,24 @@ func main() {
 			"Blocks a client device from joining the network. " +
 				"The device is not visible on the network when blocked",
 			func(cmd3 *cli.Cmd) {
-				macAddress := cmd3.StringArg("MAC_ADDRESS", "",
-					"The MAC address of the client device to target.")
+				bulk := addClientBulkFlags(cmd3)
 				cmd3.Action = func() {
-					fmt.Println("\nunified client block MAC_ADDRESS\n")
-					cmdResp, _, err := cx.ClientDevice.BlockClient(ctx, *macAddress, true)
-					if err != nil {}
-					fmt.Println(cmdResp.Meta.Status)
+					bulk.out.banner("unified client block CLIENT")
+					bulk.run("block", func(t bulkTarget) (string, error) {
+						return cmdStatus(cx.ClientDevice.BlockClient(ctx, t.MacAddress, true))
+					})
 				}
 			})
 		cmd.Command(
 			"unblock",
 			"Unblocks a previously blocked client network device.",
 			func(cmd3 *cli.Cmd) {
-				macAddress := cmd3.StringArg("MAC_ADDRESS", "",
-					"The MAC address of the client device to target.")
+				bulk := addClientBulkFlags(cmd3)
 				cmd3.Action = func() {
-					fmt.Println("\nunified client unblock MAC_ADDRESS\n")
-					cmdResp, _, err := cx.ClientDevice.BlockClient(ctx, *macAddress, false)
-					if err != nil {}
-					fmt.Println(cmdResp.Meta.Status)
+					bulk.out.banner("unified client unblock CLIENT")
+					bulk.run("unblock", func(t bulkTarget) (string, error) {
+						return cmdStatus(cx.ClientDevice.BlockClient(ctx, t.MacAddress, false))
+					})
 				}
 			})
 	})
@@ -309,33 +353,81 @@ func main() {
 					"ls",
 					"Displays a list of alarms from the Controller.",
 					func(cmd3 *cli.Cmd) {
+						active := cmd3.Bool(cli.BoolOpt{
+							Name: "a active",
+							Desc: "Only display alarms which have not been archived.",
+						})
+						query := addQueryFlags(cmd3)
+						out := addOutputFlags(cmd3, output.Table)
+						watch := addWatchFlags(cmd3)
 						cmd3.Action = func() {
-							fmt.Println("\nunified controller alarms ls\n")
-							alarms, _, err := cx.Alarms.List(ctx, nil)
-							if err != nil {
-
+							watch.list(out, "unified controller alarms ls", "_id", func() (interface{}, error) {
+								opt, err := query.options()
+								if err != nil {
+									return nil, err
+								}
+								if *active {
+									archived := false
+									opt.Archived = &archived
+								}
+								alarms, _, err := cx.Alarms.List(ctx, opt)
+								return sortAlarms(alarms), err
+							}, alarmColumns...)
+						}
+					})
+				cmd2.Command(
+					"archive",
+					"Archives alarms on the Controller, marking them as handled.",
+					func(cmd3 *cli.Cmd) {
+						cmd3.Spec = "[-n] (ID | --all | [--key] [--older-than])"
+						id := cmd3.StringArg("ID", "", "The UUID of the alarm to archive.")
+						all := cmd3.Bool(cli.BoolOpt{
+							Name: "all",
+							Desc: "Archives every alarm.",
+						})
+						key := cmd3.String(cli.StringOpt{
+							Name: "k key",
+							Desc: "Archives the alarms with a matching key e.g. EVT_AP_Lost_Contact. Wildcards (*) are allowed.",
+						})
+						olderThan := cmd3.String(cli.StringOpt{
+							Name: "older-than",
+							Desc: "Archives the alarms older than a duration e.g. 12h or 7d.",
+						})
+						dryRun := cmd3.Bool(cli.BoolOpt{
+							Name: "n dry-run",
+							Desc: "Lists the alarms which would be archived without archiving them.",
+						})
+						out := addOutputFlags(cmd3, output.Table)
+						cmd3.Action = func() {
+							out.banner("unified controller alarms archive")
+							switch {
+							case *id != "" && !*dryRun:
+								cmdResp, _, err := cx.Alarms.Archive(ctx, *id)
+								fatalIf(err)
+								fmt.Println(cmdResp.Meta.Status)
+								return
+							case *all && !*dryRun:
+								cmdResp, _, err := cx.Alarms.ArchiveAll(ctx)
+								fatalIf(err)
+								fmt.Println(cmdResp.Meta.Status)
+								return
 							}
-							for _, v := range alarms {
-								table := tablewriter.NewWriter(os.Stdout)
-								fieldNames := structs.Names(&v)
-								table.SetHeader(fieldNames)
 
-								fieldValues := structs.Values(&v)
-								valuesArray := make([]string, len(fieldValues))
-								for k, w := range fieldValues {
-									switch x := w.(type) {
-									case string:
-										valuesArray[k] = x
-									case bool:
-										valuesArray[k] = strconv.FormatBool(x)
-									case int:
-										valuesArray[k] = strconv.Itoa(x)
-									}
+							alarms, err := alarmsToArchive(ctx, cx.Alarms, *id, *all, *key, *olderThan, time.Now())
+							fatalIf(err)
+							if *dryRun {
+								if out.isText() {
+									fmt.Printf("%d alarm(s) would be archived.\n", len(alarms))
 								}
-								table.Append(valuesArray)
-								table.Render() // Send output
+								out.render(sortAlarms(alarms), alarmColumns...)
+								return
 							}
-
+							for _, alarm := range alarms {
+								cmdResp, _, err := cx.Alarms.Archive(ctx, alarm.UUID)
+								fatalIf(err)
+								fmt.Println(alarm.UUID, cmdResp.Meta.Status)
+							}
+							fmt.Printf("%d alarm(s) archived.\n", len(alarms))
 						}
 					})
 			})
@@ -347,38 +439,35 @@ func main() {
 					"ls",
 					"Displays a list of events from the Controller.",
 					func(cmd3 *cli.Cmd) {
+						query := addQueryFlags(cmd3)
+						out := addOutputFlags(cmd3, output.Table)
+						watch := addWatchFlags(cmd3)
 						cmd3.Action = func() {
-							fmt.Println("\nunified controller events ls\n")
-							alarms, _, err := cx.Events.List(ctx, nil)
-							if err != nil {
-
-							}
-							for _, v := range alarms {
-								table := tablewriter.NewWriter(os.Stdout)
-								fieldNames := structs.Names(&v)
-								table.SetHeader(fieldNames)
-
-								fieldValues := structs.Values(&v)
-								valuesArray := make([]string, len(fieldValues))
-								for k, w := range fieldValues {
-									switch x := w.(type) {
-									case string:
-										valuesArray[k] = x
-									case bool:
-										valuesArray[k] = strconv.FormatBool(x)
-									case int:
-										valuesArray[k] = strconv.Itoa(x)
-									}
+							watch.list(out, "unified controller events ls", "_id", func() (interface{}, error) {
+								opt, err := query.options()
+								if err != nil {
+									return nil, err
 								}
-								table.Append(valuesArray)
-								table.Render() // Send output
-							}
-
+								events, _, err := cx.Events.List(ctx, opt)
+								return sortEvents(events), err
+							}, eventColumns...)
 						}
 					})
 			})
 	})
 
+	app.Command("config", "Exports, plans and applies the configuration of a site as YAML.", cmdConfig)
+
+	app.Command("drift", "Reports the configuration changes made to devices since the last run or a baseline.", cmdDrift)
+
+	app.Command("topology", "Displays how the devices and clients of the site are connected.", cmdTopology)
+
+	app.Command("firewall", "Manages the firewall rules and groups of the site.", cmdFirewall)
+
+	app.Command("site", "Commands relating to a Site.", cmdSite)
+
+	app.Command("top", "Displays a full screen dashboard of the devices, clients, events and alarms of the site.", cmdTop)
+
 	app.Command("db", "Manages the Unified DB if enabled.", func(cmd *cli.Cmd) {
 		cmd.Command(
 			"clean",
@@ -425,55 +514,47 @@ func main() {
 			"ls",
 			"Displays a list of known UniFi devices (of all types).",
 			func(cmd2 *cli.Cmd) {
-				cmd2.Spec = "-tjy"
-				tableo := cmd2.Bool(cli.BoolOpt{
-					Name:      "t table",
-					Value:     true,
-					Desc:      "Displays device short data in a table on the console.",
-					SetByUser: &table_output,
-				})
-				jsono := cmd2.Bool(cli.BoolOpt{
-					Name:      "j json",
-					Desc:      "Displays device short data in JSON on the console.",
-					SetByUser: &json_output,
-				})
-				yamlo := cmd2.Bool(cli.BoolOpt{
-					Name:      "y yaml",
-					Desc:      "Displays device short data in YAML on the console.",
-					SetByUser: &yaml_output,
-				})
+				out := addOutputFlags(cmd2, output.Table)
+				watch := addWatchFlags(cmd2)
 				cmd2.Action = func() {
-					fmt.Println("\nunified devices ls\n")
-					devices, _, err := cx.Devices.ListShort(ctx, "all", nil)
-					if err != nil {
-					}
-					if *yamlo {
-						devices = OutputDeviceArrayToYAML(devices)
-					} else {
-						if *jsono {
-							devices = DeviceArrayToJSON(devices)
-						} else {
-							if *tableo {
-								outputDevicesToTable(devices)
-							}
-						}
-					}
+					watch.list(out, "unified devices ls", "mac", func() (interface{}, error) {
+						devices, _, err := cx.Devices.ListShort(ctx, "all", nil)
+						return devices, err
+					})
 				}
 			})
 		cmd.Command(
 			"inspect",
 			"View detailed configuration of a running Unifi Device.",
 			func(cmd2 *cli.Cmd) {
-				macAddress := cmd2.StringArg("MAC_ADDRESS", "", "The MAC address of the device to inspect.")
+				macAddress := cmd2.StringArg("DEVICE", "", deviceArgDesc)
+				out := addOutputFlags(cmd2, output.JSON)
 				cmd2.Action = func() {
-					fmt.Println("\nunified devices inspect\n")
-					device, _, err := cx.Devices.GetByMac(ctx, *macAddress)
-					if err != nil {
-
-					}
-					DeviceToJSON(device)
+					out.banner("unified devices inspect")
+					device := resolveDevice(*macAddress)
+					out.render(device, deviceColumns...)
 				}
 			})
+		cmd.Command(
+			"restart",
+			"Restarts i.e. reboots, one or more UniFi Devices of any type.",
+			func(cmd2 *cli.Cmd) {
+				bulk := addDeviceBulkFlags(cmd2, "")
+				cmd2.Action = func() {
+					bulk.out.banner("unified devices restart DEVICE")
+					bulk.run("restart", func(t bulkTarget) (string, error) {
+						return cmdStatus(cx.Devices.Restart(ctx, t.MacAddress))
+					})
+				}
+			})
+		cmd.Command(
+			"support-bundle",
+			"Collects diagnostics from a device and the Controller into a tar.gz to attach to a support ticket.",
+			cmdDeviceSupportBundle)
+		cmd.Command(
+			"migrate",
+			"Points devices at another Controller with set-inform over SSH and waits for them to check in to it.",
+			cmdDeviceMigrate)
 		cmd.Command(
 			"ugw",
 			"Commands relating to a UniFi Security Gateway (UGW) aka USG.",
@@ -482,56 +563,29 @@ func main() {
 					"ls",
 					"Displays a list of known UniFi USGs.",
 					func(cmd3 *cli.Cmd) {
-						cmd3.Spec = "-tjy"
-						tableo := cmd3.Bool(cli.BoolOpt{
-							Name:      "t table",
-							Value:     true,
-							Desc:      "Displays device short data in a table on the console.",
-							SetByUser: &table_output,
-						})
-						jsono := cmd3.Bool(cli.BoolOpt{
-							Name:      "j json",
-							Desc:      "Displays device short data in JSON on the console.",
-							SetByUser: &json_output,
-						})
-						yamlo := cmd2.Bool(cli.BoolOpt{
-							Name:      "y yaml",
-							Desc:      "Displays device short data in YAML on the console.",
-							SetByUser: &yaml_output,
-						})
+						out := addOutputFlags(cmd3, output.Table)
+						watch := addWatchFlags(cmd3)
 						cmd3.Action = func() {
-							fmt.Println("\nunified devices ugw ls\n")
-							devices, _, err := cx.Devices.ListShort(ctx, "ugw", nil)
-							if err != nil {
-							}
-							if *yamlo {
-								devices = OutputDeviceArrayToYAML(devices)
-							} else {
-								if *jsono {
-									devices = DeviceArrayToJSON(devices)
-								} else {
-									if *tableo {
-										outputDevicesToTable(devices)
-									}
-								}
-							}
+							watch.list(out, "unified devices ugw ls", "mac", func() (interface{}, error) {
+								devices, _, err := cx.Devices.ListShort(ctx, "ugw", nil)
+								return devices, err
+							})
 						}
 					})
 				cmd2.Command(
 					"inspect",
 					"View configuration of a running Unifi USG.",
 					func(cmd3 *cli.Cmd) {
-						macAddress := cmd3.StringArg("MAC_ADDRESS", "",
-							"The MAC address of the device to inspect.")
+						macAddress := cmd3.StringArg("DEVICE", "", deviceArgDesc)
+						out := addOutputFlags(cmd3, output.JSON)
 						cmd3.Action = func() {
-							fmt.Println("\nunified devices ugw inspect MAC_ADDRESS\n")
-							device, _, err := cx.Devices.GetByMac(ctx, *macAddress)
-							if err != nil {
-
-							}
-							DeviceToJSON(device)
+							out.banner("unified devices ugw inspect DEVICE")
+							device := resolveDevice(*macAddress)
+							out.render(device, deviceColumns...)
 						}
 					})
+				cmd2.Command("portforward", "Manages the port forwards of the gateway.", cmdUGWPortForward)
+				cmd2.Command("route", "Manages the static routes of the gateway.", cmdUGWRoute)
 			})
 		cmd.Command(
 			"uap",
@@ -541,54 +595,25 @@ func main() {
 					"ls",
 					"Displays a list of known UniFi UAPs.",
 					func(cmd3 *cli.Cmd) {
-						cmd3.Spec = "-tjy"
-						tableo := cmd3.Bool(cli.BoolOpt{
-							Name:      "t table",
-							Value:     true,
-							Desc:      "Displays device short data in a table on the console.",
-							SetByUser: &table_output,
-						})
-						jsono := cmd3.Bool(cli.BoolOpt{
-							Name:      "j json",
-							Desc:      "Displays device short data in JSON on the console.",
-							SetByUser: &json_output,
-						})
-						yamlo := cmd2.Bool(cli.BoolOpt{
-							Name:      "y yaml",
-							Desc:      "Displays device short data in YAML on the console.",
-							SetByUser: &yaml_output,
-						})
+						out := addOutputFlags(cmd3, output.Table)
+						watch := addWatchFlags(cmd3)
 						cmd3.Action = func() {
-							fmt.Println("\nunified devices uap ls\n")
-							devices, _, err := cx.Devices.ListShort(ctx, "uap", nil)
-							if err != nil {
-							}
-							if *yamlo {
-								devices = OutputDeviceArrayToYAML(devices)
-							} else {
-								if *jsono {
-									devices = DeviceArrayToJSON(devices)
-								} else {
-									if *tableo {
-										outputDevicesToTable(devices)
-									}
-								}
-							}
+							watch.list(out, "unified devices uap ls", "mac", func() (interface{}, error) {
+								devices, _, err := cx.Devices.ListShort(ctx, "uap", nil)
+								return devices, err
+							})
 						}
 					})
 				cmd2.Command(
 					"inspect",
 					"View configuration of a running Unifi UAP.",
 					func(cmd3 *cli.Cmd) {
-						macAddress := cmd3.StringArg("MAC_ADDRESS", "",
-							"The MAC address of the device to inspect.")
+						macAddress := cmd3.StringArg("DEVICE", "", deviceArgDesc)
+						out := addOutputFlags(cmd3, output.JSON)
 						cmd3.Action = func() {
-							fmt.Println("\nunified devices uap inspect MAC_ADDRESS\n")
-							device, _, err := cx.Devices.GetByMac(ctx, *macAddress)
-							if err != nil {
-
-							}
-							DeviceToJSON(device)
+							out.banner("unified devices uap inspect DEVICE")
+							device := resolveDevice(*macAddress)
+							out.render(device, deviceColumns...)
 						}
 					})
 				cmd2.Command(
@@ -599,74 +624,60 @@ func main() {
 							"locateOn",
 							"Enables the LED on a UAP to help with locating it.",
 							func(cmd3 *cli.Cmd) {
-								macAddress := cmd3.StringArg("MAC_ADDRESS", "",
-									"The MAC address of the uap device to target.")
+								bulk := addDeviceBulkFlags(cmd3, "uap")
 								cmd3.Action = func() {
-									fmt.Println("\nunified device uap cmd set-locate MAC_ADDRESS\n")
-									cmdResp, _, err := cx.UAP.SetLocate(ctx, *macAddress, true)
-									if err != nil {
-									}
-									fmt.Println(cmdResp.Meta.Status)
+									bulk.out.banner("unified device uap cmd set-locate DEVICE")
+									bulk.run("start locating", func(t bulkTarget) (string, error) {
+										return cmdStatus(cx.UAP.SetLocate(ctx, t.MacAddress, true))
+									})
 								}
 							})
 						cmd2.Command(
 							"locateOff",
 							"Disables the LED on a UAP to help with locating it.",
 							func(cmd3 *cli.Cmd) {
-								macAddress := cmd3.StringArg("MAC_ADDRESS", "",
-									"The MAC address of the uap device to target.")
+								bulk := addDeviceBulkFlags(cmd3, "uap")
 								cmd3.Action = func() {
-									fmt.Println("\nunified device uap cmd unset-locate MAC_ADDRESS\n")
-									cmdResp, _, err := cx.UAP.SetLocate(ctx, *macAddress, false)
-									if err != nil {
-
-									}
-									fmt.Println(cmdResp.Meta.Status)
+									bulk.out.banner("unified device uap cmd unset-locate DEVICE")
+									bulk.run("stop locating", func(t bulkTarget) (string, error) {
+										return cmdStatus(cx.UAP.SetLocate(ctx, t.MacAddress, false))
+									})
 								}
 							})
 						cmd2.Command(
 							"disable",
 							"Disables the UAP.",
 							func(cmd3 *cli.Cmd) {
-								macAddress := cmd3.StringArg("MAC_ADDRESS", "",
-									"The MAC address of the uap device to target.")
+								bulk := addDeviceBulkFlags(cmd3, "uap")
 								cmd3.Action = func() {
-									fmt.Println("\nunified device uap cmd disable MAC_ADDRESS\n")
-									cmdResp, _, err := cx.UAP.DisableAP(ctx, *macAddress, true)
-									if err != nil {
-
-									}
-									fmt.Println(cmdResp.Meta.Status)
+									bulk.out.banner("unified device uap cmd disable DEVICE")
+									bulk.run("disable", func(t bulkTarget) (string, error) {
+										return cmdStatus(cx.UAP.DisableAP(ctx, t.MacAddress, true))
+									})
 								}
 							})
 						cmd2.Command(
 							"enable",
 							"Reenables a previously disabled UAP.",
 							func(cmd3 *cli.Cmd) {
-								macAddress := cmd3.StringArg("MAC_ADDRESS", "",
-									"The MAC address of the uap device to target.")
+								bulk := addDeviceBulkFlags(cmd3, "uap")
 								cmd3.Action = func() {
-									fmt.Println("\nunified device uap cmd enable MAC_ADDRESS\n")
-									cmdResp, _, err := cx.UAP.DisableAP(ctx, *macAddress, false)
-									if err != nil {
-
-									}
-									fmt.Println(cmdResp.Meta.Status)
+									bulk.out.banner("unified device uap cmd enable DEVICE")
+									bulk.run("enable", func(t bulkTarget) (string, error) {
+										return cmdStatus(cx.UAP.DisableAP(ctx, t.MacAddress, false))
+									})
 								}
 							})
 						cmd2.Command(
 							"restart",
 							"Restarts a UAP.",
 							func(cmd3 *cli.Cmd) {
-								macAddress := cmd3.StringArg("MAC_ADDRESS", "",
-									"The MAC address of the uap device to target.")
+								bulk := addDeviceBulkFlags(cmd3, "uap")
 								cmd3.Action = func() {
-									fmt.Println("\nunified device uap cmd restartr MAC_ADDRESS\n")
-									cmdResp, _, err := cx.UAP.RestartAP(ctx, *macAddress)
-									if err != nil {
-
-									}
-									fmt.Println(cmdResp.Meta.Status)
+									bulk.out.banner("unified device uap cmd restartr DEVICE")
+									bulk.run("restart", func(t bulkTarget) (string, error) {
+										return cmdStatus(cx.UAP.RestartAP(ctx, t.MacAddress))
+									})
 								}
 							})
 					})
@@ -679,102 +690,38 @@ func main() {
 					"ls",
 					"Displays a list of known UniFi USWs.",
 					func(cmd3 *cli.Cmd) {
-						cmd3.Spec = "-tjy"
-						tableo := cmd3.Bool(cli.BoolOpt{
-							Name:      "t table",
-							Value:     true,
-							Desc:      "Displays device short data in a table on the console.",
-							SetByUser: &table_output,
-						})
-						jsono := cmd3.Bool(cli.BoolOpt{
-							Name:      "j json",
-							Desc:      "Displays device short data in JSON on the console.",
-							SetByUser: &json_output,
-						})
-						yamlo := cmd3.Bool(cli.BoolOpt{
-							Name:      "y yaml",
-							Desc:      "Displays device short data in YAML on the console.",
-							SetByUser: &yaml_output,
-						})
+						out := addOutputFlags(cmd3, output.Table)
+						watch := addWatchFlags(cmd3)
 						cmd3.Action = func() {
-							fmt.Println("\nunified devices usw ls\n")
-							devices, _, err := cx.Devices.ListShort(ctx, "usw", nil)
-							if err != nil {
-							}
-							if *yamlo {
-								devices = OutputDeviceArrayToYAML(devices)
-							} else {
-								if *jsono {
-									devices = DeviceArrayToJSON(devices)
-								} else {
-									if *tableo {
-										outputDevicesToTable(devices)
-									}
-								}
-							}
+							watch.list(out, "unified devices usw ls", "mac", func() (interface{}, error) {
+								devices, _, err := cx.Devices.ListShort(ctx, "usw", nil)
+								return devices, err
+							})
 						}
 					})
 				cmd2.Command(
 					"inspect",
 					"View configuration of a running Unifi USW.",
 					func(cmd3 *cli.Cmd) {
-						macAddress := cmd3.StringArg("MAC_ADDRESS", "",
-							"The MAC address of the device to inspect.")
+						macAddress := cmd3.StringArg("DEVICE", "", deviceArgDesc)
+						out := addOutputFlags(cmd3, output.JSON)
 						cmd3.Action = func() {
-							fmt.Println("\nunified devices usw inspect MAC_ADDRESS\n")
-							device, _, err := cx.Devices.GetByMac(ctx, *macAddress)
-							if err != nil {
-
-							}
-							DeviceToJSON(device)
+							out.banner("unified devices usw inspect DEVICE")
+							device := resolveDevice(*macAddress)
+							out.render(device, deviceColumns...)
 						}
 					})
 			})
 	})
 
-	app.Command("exec", "Open a remote SSH Shell.", func(cmd *cli.Cmd) {
-		cmd.Spec = "MAC_ADDRESS (-U [-P])"
-		macAddress := cmd.StringArg("MAC_ADDRESS", "",
-			"The MAC address of the device to ssh to.")
-		ssh_user := cmd.String(cli.StringOpt{
-			Name:      "U sshuser",
-			Desc:      "Connects via SSH using the -U SSH_USERNAME supplied.",
-			EnvVar:    "UNIFIED_SSH_USERNAME",
-			SetByUser: &ssh_userOption,
-		})
-		/*
-			cmd.String(cli.StringOpt{
-				Name: "P sshpass",
-				Desc: "Connects via SSH using the -P SSH_PASSWORD supplied.",
-				EnvVar:    "UNIFIED_SSH_PASSWORD",
-				SetByUser: &sshpass,
-			})
-		*/
-		ssh_port := cmd.Int(cli.IntOpt{
-			Name:      "P ssh_port",
-			Desc:      "Connects via SSH using the supplied port or defaults to 22.",
-			Value:     22,
-			EnvVar:    "UNIFIED_SSH_PORT",
-			SetByUser: &ssh_portOption,
-		})
-		cmd.Action = func() {
-			ip_address, err := cx.Devices.GetIPFromMac(ctx, *macAddress)
-			if err != nil {
+	app.Command("exec", "Runs a command over SSH on one or more devices at once, printing the output of each.",
+		cmdExec)
 
-			}
-			_, session, err :=
-				unified.ConnectToSSHHost(*ssh_user, ip_address+":"+strconv.Itoa(*ssh_port))
-			if err != nil {
-				panic(err)
-			}
-			fmt.Println("Established SSH Connection as " + *ssh_user)
-			out, err := session.CombinedOutput(os.Args[3])
-			if err != nil {
-				panic(err)
-			}
-			fmt.Println(string(out))
-		}
-	})
+	app.Command("ssh", "Opens an interactive SSH session on a device, or runs a command on a terminal there.", cmdSSH)
+
+	app.Command("cp", "Copies files to and from devices, or the Controller, over SFTP or SCP.", cmdCp)
+	app.Command("tunnel", "Forwards ports through a device over SSH, like ssh -L, -R and -D.", cmdTunnel)
+	app.Command("audit", "Lists and replays the sessions opened on devices with ssh and exec.", cmdAudit)
 
 	app.Command("shell", "Starts a Unified Interactive Shell", func(cmd *cli.Cmd) {
 		cmd.Action = func() {
@@ -1534,67 +1481,36 @@ func main() {
 }
 */
 
-func CmdRespToJSON(resp *unified.UniFiCmdResp) {
-	enc := json.NewEncoder(os.Stdout)
-	enc.SetIndent("", "    ")
-	enc.Encode(resp)
-}
-
-func DeviceToJSON(device *unified.Device) {
-	enc := json.NewEncoder(os.Stdout)
-	enc.SetIndent("", "    ")
-	enc.Encode(device)
+func sortAlarms(alarms []unified.Alarm) []unified.Alarm {
+	sort.SliceStable(alarms, func(i, j int) bool {
+		return alarms[i].When().After(alarms[j].When())
+	})
+	return alarms
 }
 
-func OutputDeviceArrayToYAML(devices []unified.DeviceShort) []unified.DeviceShort {
-	table_output = false
-	devices, y := deviceArrayToYAMLString(devices)
-	fmt.Println(string(y))
-	return devices
+func sortEvents(events []unified.Event) []unified.Event {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].When().After(events[j].When())
+	})
+	return events
 }
 
-func deviceArrayToYAMLString(devices []unified.DeviceShort) ([]unified.DeviceShort, string) {
-	yaml := new(bytes.Buffer)
-	enc := json.NewEncoder(yaml)
-	enc.SetIndent("", "    ")
-	enc.Encode(devices)
-	y, err := yaml2.JSONToYAML(yaml.Bytes())
-	if err != nil {
-		fmt.Printf("err: %v\n", err)
+func filterAlarmsByUUID(alarms []unified.Alarm, uuid string) []unified.Alarm {
+	var matched []unified.Alarm
+	for _, alarm := range alarms {
+		if alarm.UUID == uuid {
+			matched = append(matched, alarm)
+		}
 	}
-	return devices, string(y)
-}
-
-func DeviceArrayToJSON(devices []unified.DeviceShort) []unified.DeviceShort {
-	table_output = false
-	enc := json.NewEncoder(os.Stdout)
-	enc.SetIndent("", "    ")
-	enc.Encode(devices)
-	return devices
+	return matched
 }
 
-func outputDevicesToTable(devices []unified.DeviceShort) {
-	table := tablewriter.NewWriter(os.Stdout)
-	for _, v := range devices {
-		fieldNames := structs.Names(&v)
-		table.SetHeader(fieldNames)
-
-		fieldValues := structs.Values(&v)
-		valuesArray := make([]string, len(fieldValues))
-		for k, w := range fieldValues {
-			switch x := w.(type) {
-			case string:
-				valuesArray[k] = x
-			case bool:
-				valuesArray[k] = strconv.FormatBool(x)
-			case int:
-				valuesArray[k] = strconv.Itoa(x)
-			}
-		}
-		table.Append(valuesArray)
+// fatalIf prints err in red on stderr and exits with a non-zero status when err is set.
+func fatalIf(err error) {
+	if err != nil {
+		color.New(color.FgRed).Fprintln(os.Stderr, err)
+		cli.Exit(1)
 	}
-	table.Render()
-	// Send output
 }
 
 func addShellCommands(shell *ishell.Shell) {
@@ -1614,9 +1530,9 @@ func addClientCommand() *ishell.Cmd {
 			"Deivce can connect to the network but send/receive is disabled. " +
 			"(It is visible in the UniFi Controller)",
 		Func: func(c *ishell.Context) {
-			var macAddress string
-			if len(c.Args) > 0 {
-				macAddress = strings.Join(c.Args, " ")
+			macAddress, ok := shellClient(c)
+			if !ok {
+				return
 			}
 			c.ProgressBar().Indeterminate(true)
 			c.ProgressBar().Start()
@@ -1636,9 +1552,9 @@ func addClientCommand() *ishell.Cmd {
 		Name: "unauthorize-guest",
 		Help: "Unauthorize a network client device.",
 		Func: func(c *ishell.Context) {
-			var macAddress string
-			if len(c.Args) > 0 {
-				macAddress = strings.Join(c.Args, " ")
+			macAddress, ok := shellClient(c)
+			if !ok {
+				return
 			}
 			c.ProgressBar().Indeterminate(true)
 			c.ProgressBar().Start()
@@ -1659,9 +1575,9 @@ func addClientCommand() *ishell.Cmd {
 		Help: "Block a network client device. Deivce cannot connect to the network." +
 			" (It is no longer visible in the UniFi Controller)",
 		Func: func(c *ishell.Context) {
-			var macAddress string
-			if len(c.Args) > 0 {
-				macAddress = strings.Join(c.Args, " ")
+			macAddress, ok := shellClient(c)
+			if !ok {
+				return
 			}
 			c.ProgressBar().Indeterminate(true)
 			c.ProgressBar().Start()
@@ -1681,9 +1597,9 @@ func addClientCommand() *ishell.Cmd {
 		Name: "unblock",
 		Help: "Unblock a previously blocked network client device.",
 		Func: func(c *ishell.Context) {
-			var macAddress string
-			if len(c.Args) > 0 {
-				macAddress = strings.Join(c.Args, " ")
+			macAddress, ok := shellClient(c)
+			if !ok {
+				return
 			}
 			c.ProgressBar().Indeterminate(true)
 			c.ProgressBar().Start()
@@ -1709,16 +1625,26 @@ func addDevicesCommand() *ishell.Cmd {
 	}
 	devicesCmd.AddCmd(&ishell.Cmd{
 		Name: "ls",
-		Help: "List all devices of all types.",
+		Help: "List all devices of all types. Takes the output options of the command line e.g. -o wide.",
 		Func: func(c *ishell.Context) {
+			out, ok := shellOutputFlags(c, output.Table)
+			if !ok {
+				return
+			}
 			c.ProgressBar().Indeterminate(true)
 			c.ProgressBar().Start()
 			devices, _, err := cx.Devices.ListShort(ctx, "all", nil)
 			c.ProgressBar().Stop()
 			if err != nil {
+				shellError(c, err)
+				return
+			}
+			text, err := out.sprint(devices, deviceColumns...)
+			if err != nil {
+				shellError(c, err)
+				return
 			}
-			_, yamlOut := deviceArrayToYAMLString(devices)
-			c.ShowPaged(yamlOut)
+			c.ShowPaged(text)
 		},
 	})
 
@@ -1850,13 +1776,13 @@ func devicesDisableAPCmd(name string, help string, device string, disabled bool)
 		Name: name,
 		Help: help,
 		Func: func(c *ishell.Context) {
-			var macAddress string
-			if len(c.Args) > 0 {
-				macAddress = strings.Join(c.Args, " ")
+			target, ok := shellDevice(c)
+			if !ok {
+				return
 			}
 			c.ProgressBar().Indeterminate(true)
 			c.ProgressBar().Start()
-			cmdResp, _, err := cx.UAP.DisableAP(ctx, macAddress, disabled)
+			cmdResp, _, err := cx.UAP.DisableAP(ctx, target.MacAddress, disabled)
 			if err != nil {
 			}
 			c.ProgressBar().Stop()
@@ -1877,13 +1803,13 @@ func devicesRestartAPCmd(name string, help string, device string) *ishell.Cmd {
 		Name: name,
 		Help: help,
 		Func: func(c *ishell.Context) {
-			var macAddress string
-			if len(c.Args) > 0 {
-				macAddress = strings.Join(c.Args, " ")
+			target, ok := shellDevice(c)
+			if !ok {
+				return
 			}
 			c.ProgressBar().Indeterminate(true)
 			c.ProgressBar().Start()
-			cmdResp, _, err := cx.UAP.RestartAP(ctx, macAddress)
+			cmdResp, _, err := cx.UAP.RestartAP(ctx, target.MacAddress)
 			if err != nil {
 			}
 			c.ProgressBar().Stop()
@@ -1904,13 +1830,13 @@ func devicesLocateCmd(name string, help string, device string, enabled bool) *is
 		Name: name,
 		Help: help,
 		Func: func(c *ishell.Context) {
-			var macAddress string
-			if len(c.Args) > 0 {
-				macAddress = strings.Join(c.Args, " ")
+			target, ok := shellDevice(c)
+			if !ok {
+				return
 			}
 			c.ProgressBar().Indeterminate(true)
 			c.ProgressBar().Start()
-			cmdResp, _, err := cx.UAP.SetLocate(ctx, macAddress, enabled)
+			cmdResp, _, err := cx.UAP.SetLocate(ctx, target.MacAddress, enabled)
 			if err != nil {
 			}
 			c.ProgressBar().Stop()
@@ -1931,6 +1857,10 @@ func devicesLsCmd(name string, help string, device string, paged bool) *ishell.C
 		Name: name,
 		Help: help,
 		Func: func(c *ishell.Context) {
+			out, ok := shellOutputFlags(c, output.Table)
+			if !ok {
+				return
+			}
 			c.ProgressBar().Indeterminate(true)
 			c.ProgressBar().Start()
 			devices, _, err := cx.Devices.ListShort(ctx, device, nil)
@@ -1940,12 +1870,17 @@ func devicesLsCmd(name string, help string, device string, paged bool) *ishell.C
 				msgParts := []string{"Error retrieving ", device, " devices from Unifi Controller."}
 				c.Println(strings.Join(msgParts, " "))
 				color.Set(color.FgWhite)
+				return
+			}
+			text, err := out.sprint(devices, deviceColumns...)
+			if err != nil {
+				shellError(c, err)
+				return
 			}
-			_, yamlOut := deviceArrayToYAMLString(devices)
 			if paged {
-				c.ShowPaged(yamlOut)
+				c.ShowPaged(text)
 			} else {
-				c.Println(yamlOut)
+				c.Print(text)
 			}
 		},
 	}
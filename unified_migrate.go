@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bitbucket.org/ecosse-hosting/unified/lib/remote"
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/jawher/mow.cli"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// The port devices send their informs to and the Controller serves its API on, when they are not given.
+const (
+	informPort     = "8080"
+	controllerPort = "8443"
+)
+
+// How often the new Controller is asked whether the devices have checked in.
+const migratePollInterval = 10 * time.Second
+
+// migrateResult is the outcome of migrating a device as rendered for -o json, yaml, csv and the like.
+type migrateResult struct {
+	Name       string `json:"name"`
+	MacAddress string `json:"mac"`
+	IP         string `json:"ip"`
+	Attempts   int    `json:"attempts"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+
+	adoptSent  bool
+	informSent time.Time
+}
+
+func cmdDeviceMigrate(cmd *cli.Cmd) {
+	cmd.Spec = "[OPTIONS] [DEVICE...]"
+	bulk := addDeviceListFlags(cmd)
+	login := addSSHFlags(cmd)
+	to := cmd.String(cli.StringOpt{
+		Name: "to",
+		Desc: "The inform URL of the new Controller e.g. http://new:8080/inform, or just its host.",
+	})
+	toController := cmd.String(cli.StringOpt{
+		Name: "to-controller",
+		Desc: "The address of the new Controller to watch for the devices. Defaults to the host of --to, port " +
+			controllerPort + ".",
+		EnvVar: "UNIFIED_TO_CONTROLLER",
+	})
+	toUser := cmd.String(cli.StringOpt{
+		Name:   "to-username",
+		Desc:   "The username to log in to the new Controller with. Defaults to that of this one.",
+		EnvVar: "UNIFIED_TO_USER",
+	})
+	toPassword := cmd.String(cli.StringOpt{
+		Name:   "to-password",
+		Desc:   "The password to log in to the new Controller with. Defaults to that of this one.",
+		EnvVar: "UNIFIED_TO_PASSWORD",
+	})
+	toSite := cmd.String(cli.StringOpt{
+		Name:   "to-site",
+		Desc:   "The site of the new Controller the devices will appear in. Defaults to the site of this one.",
+		EnvVar: "UNIFIED_TO_SITE",
+	})
+	adopt := cmd.Bool(cli.BoolOpt{
+		Name: "adopt",
+		Desc: "Adopt the devices once they appear on the new Controller.",
+	})
+	noWait := cmd.Bool(cli.BoolOpt{
+		Name: "no-wait",
+		Desc: "Only set the inform URL, without waiting for the devices to check in to the new Controller.",
+	})
+	wait := cmd.String(cli.StringOpt{
+		Name:  "wait",
+		Value: "5m",
+		Desc:  "How long to wait for the devices to check in before setting the inform URL again e.g. 10m.",
+	})
+	retries := cmd.Int(cli.IntOpt{
+		Name:  "retries",
+		Value: 2,
+		Desc:  "How many more times to set the inform URL of devices which have not checked in.",
+	})
+
+	cmd.Action = func() {
+		inform, err := informURL(*to)
+		fatalIf(err)
+		window, err := parseAge(*wait)
+		fatalIf(err)
+		bulkTargets, err := bulk.targets()
+		fatalIf(err)
+		if *bulk.dryRun {
+			if bulk.out.isText() {
+				fmt.Printf("Would point %d device(s) at %s.\n", len(bulkTargets), inform)
+			}
+			bulk.out.render(bulkTargets, "Name", "MacAddress", "IP", "Type")
+			return
+		}
+		if len(bulkTargets) > *bulk.confirm && !*bulk.yes {
+			fatalIf(confirm(fmt.Sprintf("Point %d devices at %s?", len(bulkTargets), inform)))
+		}
+
+		var target *unified.UniFiClient
+		address := *toController
+		if !*noWait {
+			if address == "" {
+				u, _ := url.Parse(inform)
+				address = net.JoinHostPort(u.Hostname(), controllerPort)
+			}
+			user, password, site := *toUser, *toPassword, *toSite
+			if user == "" {
+				user = *cx.UserName
+			}
+			if password == "" {
+				password = *cx.Password
+			}
+			if site == "" {
+				site = *cx.SiteName
+			}
+			var err error
+			// Logging in to the new Controller first means bad credentials fail before any device is moved.
+			target, err = connectController(address, &unified.UnifiedOptions{DbUsage: &unified.UnifiedDBOptions{}},
+				&user, &password, &site)
+			fatalIf(err)
+		}
+
+		text := bulk.out.isText()
+		results := make([]*migrateResult, len(bulkTargets))
+		pending := make(map[string]*migrateResult)
+		status := "not checked in"
+		if *noWait {
+			status = "inform URL not set"
+		}
+		for i, t := range bulkTargets {
+			results[i] = &migrateResult{Name: t.Name, MacAddress: t.MacAddress, IP: t.IP, Status: status}
+			pending[strings.ToLower(t.MacAddress)] = results[i]
+		}
+		config := login.config()
+		command := "mca-cli-op set-inform " + remote.ShellQuote(inform)
+
+		for attempt := 0; attempt <= *retries && len(pending) > 0; attempt++ {
+			var targets []remote.Target
+			for _, t := range bulkTargets {
+				if pending[strings.ToLower(t.MacAddress)] != nil {
+					targets = append(targets, remoteTarget(t))
+				}
+			}
+			sent := time.Now()
+			config.ExecAll(targets, command, time.Minute, *bulk.workers, nil, func(_ int, r remote.Result) {
+				row := pending[strings.ToLower(r.Target.MacAddress)]
+				row.Attempts++
+				row.Error = ""
+				switch {
+				case r.Err != nil:
+					row.Error = r.Err.Error()
+				case r.ExitCode != 0:
+					row.Error = fmt.Sprintf("set-inform exited with %d: %s", r.ExitCode,
+						strings.TrimSpace(string(r.Stderr)+string(r.Stdout)))
+				}
+				if row.Error == "" {
+					row.informSent = sent
+				}
+				if text && row.Error != "" {
+					color.New(color.FgRed).Fprintf(os.Stderr, "%s: %s\n", r.Target, row.Error)
+				} else if text {
+					fmt.Fprintf(os.Stderr, "%s: set-inform %s\n", r.Target, inform)
+				}
+			})
+			if *noWait {
+				for mac, row := range pending {
+					if row.Error == "" {
+						row.Status = "inform URL set"
+						delete(pending, mac)
+					}
+				}
+				continue
+			}
+			if text {
+				fmt.Fprintf(os.Stderr, "Waiting up to %s for %d device(s) to check in to %s...\n", window,
+					len(pending), address)
+			}
+			watchCheckIn(target, pending, window, *adopt, text)
+		}
+
+		rows := make([]migrateResult, len(results))
+		for i, r := range results {
+			rows[i] = *r
+		}
+		if !text {
+			bulk.out.render(rows, "Name", "MacAddress", "IP", "Attempts", "Status", "Error")
+		} else {
+			for _, r := range rows {
+				if pending[strings.ToLower(r.MacAddress)] != nil {
+					color.New(color.FgRed).Printf("%s (%s) %s after %d attempt(s)\n", r.Name, r.MacAddress, r.Status,
+						r.Attempts)
+				}
+			}
+			fmt.Printf("%d of %d device(s) migrated.\n", len(rows)-len(pending), len(rows))
+		}
+		if len(pending) > 0 {
+			cli.Exit(1)
+		}
+	}
+}
+
+// watchCheckIn polls the new Controller until every pending device has checked in, and been adopted if adopt, or
+// window has passed, removing those which have from pending.
+func watchCheckIn(target *unified.UniFiClient, pending map[string]*migrateResult, window time.Duration, adopt,
+	text bool) {
+	deadline := time.Now().Add(window)
+	for len(pending) > 0 {
+		devices, _, err := target.Devices.List(ctx, nil)
+		if err != nil {
+			warn(fmt.Errorf("cannot list the devices of the new Controller: %v", err))
+		}
+		for _, d := range devices {
+			mac := strings.ToLower(d.MacAddress)
+			row := pending[mac]
+			if row == nil || !checkedIn(d, row.informSent) {
+				continue
+			}
+			row.Status = "checked in, " + unified.StateName(d.State)
+			if adopt && !d.IsAdopted {
+				if !row.adoptSent {
+					if _, _, err := target.Devices.Adopt(ctx, d.MacAddress); err != nil {
+						row.Error = err.Error()
+					} else {
+						row.adoptSent = true
+					}
+				}
+				continue
+			}
+			if adopt {
+				row.Status = "adopted, " + unified.StateName(d.State)
+			}
+			row.Error = ""
+			delete(pending, mac)
+			if text {
+				color.New(color.FgGreen).Fprintf(os.Stderr, "%s (%s) %s\n", row.Name, row.MacAddress, row.Status)
+			}
+		}
+		if len(pending) == 0 || time.Now().Add(migratePollInterval).After(deadline) {
+			return
+		}
+		time.Sleep(migratePollInterval)
+	}
+}
+
+// checkedIn reports whether the new Controller has heard from d since set-inform was run on it at sent, as it is
+// connected or waiting to be adopted, or was last seen since. Being listed is not enough, as restoring a backup of
+// the site lists every device, disconnected, before any has checked in.
+func checkedIn(d unified.Device, sent time.Time) bool {
+	switch d.State {
+	case 1, 2: // connected, pending adoption
+		return true
+	}
+	return !sent.IsZero() && d.LastSeen.After(sent.Truncate(time.Second))
+}
+
+// informURL returns the inform URL given to --to, which may be just the host of the Controller, in full.
+func informURL(to string) (string, error) {
+	if to == "" {
+		return "", fmt.Errorf("give the inform URL of the new Controller with --to e.g. http://new:%s/inform",
+			informPort)
+	}
+	if !strings.Contains(to, "://") {
+		to = "http://" + to
+	}
+	u, err := url.Parse(to)
+	if err != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("invalid inform URL %q", to)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), informPort)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/inform"
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"testing"
+	"time"
+)
+
+func TestCheckedIn(t *testing.T) {
+	sent := time.Date(2018, 3, 1, 12, 0, 0, 500, time.UTC)
+	seen := func(d time.Duration) unified.Timestamp { return unified.Timestamp{Time: sent.Add(d)} }
+	tests := []struct {
+		name   string
+		device unified.Device
+		sent   time.Time
+		want   bool
+	}{
+		{"restored from a backup", unified.Device{State: 0, IsAdopted: true, LastSeen: seen(-24 * time.Hour)}, sent,
+			false},
+		{"restored and never seen", unified.Device{State: 0, IsAdopted: true}, sent, false},
+		{"connected", unified.Device{State: 1, IsAdopted: true}, sent, true},
+		{"pending adoption", unified.Device{State: 2}, sent, true},
+		{"provisioning since set-inform", unified.Device{State: 5, LastSeen: seen(5 * time.Second)}, sent, true},
+		{"heartbeat missed before set-inform", unified.Device{State: 6, LastSeen: seen(-time.Minute)}, sent, false},
+		{"seen but set-inform failed", unified.Device{State: 0, LastSeen: seen(time.Minute)}, time.Time{}, false},
+	}
+	for _, test := range tests {
+		if got := checkedIn(test.device, test.sent); got != test.want {
+			t.Errorf("%s: checkedIn() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
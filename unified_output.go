@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bitbucket.org/ecosse-hosting/unified/lib/output"
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/abiosoft/ishell"
+	"github.com/jawher/mow.cli"
+	"os"
+	"strings"
+	"time"
+)
+
+// The columns displayed by the table output of each type unless --columns is given. The wide output displays all.
+var (
+	alarmColumns  = []string{"Time", "Key", "SubSystem", "MacAddress", "Message", "Archived"}
+	eventColumns  = []string{"Time", "Key", "SubSystem", "Message"}
+	deviceColumns = []string{"Name", "Type", "Model", "MacAddress", "IP", "Version", "State"}
+	clientColumns = []string{"Name", "Hostname", "IP", "MacAddress", "IsWired", "Essid"}
+)
+
+// outputFlags holds the options every command displaying data shares to choose how it is rendered.
+type outputFlags struct {
+	format    *string
+	columns   *string
+	sortBy    *string
+	noHeaders *bool
+	json      *bool
+	yaml      *bool
+
+	// Styles the rows of table output, set by --watch to highlight what changed.
+	highlight func(row interface{}) func(string) string
+}
+
+// addOutputFlags registers the output options on cmd, rendering in defaultFormat unless told otherwise.
+func addOutputFlags(cmd *cli.Cmd, defaultFormat string) *outputFlags {
+	return &outputFlags{
+		format: cmd.String(cli.StringOpt{
+			Name:  "o output",
+			Value: defaultFormat,
+			Desc: "Output format. One of " + strings.Join(output.Formats, ", ") +
+				" e.g. -o csv, -o template='{{.Name}} {{.IP}}' or -o jsonpath='{.port_table[*].name}'.",
+		}),
+		columns: cmd.String(cli.StringOpt{
+			Name: "columns",
+			Desc: "Comma separated list of the columns to display e.g. name,ip,model.",
+		}),
+		sortBy: cmd.String(cli.StringOpt{
+			Name: "sort-by",
+			Desc: "Column to sort by. Prefix with - to sort in descending order e.g. -time.",
+		}),
+		noHeaders: cmd.Bool(cli.BoolOpt{
+			Name: "no-headers",
+			Desc: "Do not display the header row of table, csv and tsv output.",
+		}),
+		json: cmd.Bool(cli.BoolOpt{
+			Name: "j json",
+			Desc: "Shorthand for -o json.",
+		}),
+		yaml: cmd.Bool(cli.BoolOpt{
+			Name: "y yaml",
+			Desc: "Shorthand for -o yaml.",
+		}),
+	}
+}
+
+// shellOutputFlags parses the output options from the arguments of an ishell command, as addOutputFlags registers
+// them on the command line, printing why when they cannot be.
+func shellOutputFlags(c *ishell.Context, defaultFormat string) (*outputFlags, bool) {
+	f := &outputFlags{
+		format:    new(string),
+		columns:   new(string),
+		sortBy:    new(string),
+		noHeaders: new(bool),
+		json:      new(bool),
+		yaml:      new(bool),
+	}
+	var usage bytes.Buffer
+	fs := flag.NewFlagSet(c.Cmd.Name, flag.ContinueOnError)
+	fs.SetOutput(&usage)
+	for _, name := range []string{"o", "output"} {
+		fs.StringVar(f.format, name, defaultFormat, "Output format. One of "+strings.Join(output.Formats, ", ")+".")
+	}
+	fs.StringVar(f.columns, "columns", "", "Comma separated list of the columns to display e.g. name,ip,model.")
+	fs.StringVar(f.sortBy, "sort-by", "", "Column to sort by. Prefix with - to sort in descending order.")
+	fs.BoolVar(f.noHeaders, "no-headers", false, "Do not display the header row of table, csv and tsv output.")
+	for _, name := range []string{"j", "json"} {
+		fs.BoolVar(f.json, name, false, "Shorthand for -o json.")
+	}
+	for _, name := range []string{"y", "yaml"} {
+		fs.BoolVar(f.yaml, name, false, "Shorthand for -o yaml.")
+	}
+	if err := fs.Parse(c.Args); err != nil {
+		if err != flag.ErrHelp {
+			shellError(c, err)
+		}
+		c.Print(usage.String())
+		return nil, false
+	}
+	return f, true
+}
+
+// options converts the flags into the Options understood by the output package.
+func (f *outputFlags) options(defaultColumns ...string) (*output.Options, error) {
+	value := *f.format
+	switch {
+	case *f.json:
+		value = output.JSON
+	case *f.yaml:
+		value = output.YAML
+	}
+	format, arg, err := output.ParseFormat(value)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &output.Options{
+		Format:         format,
+		Template:       arg,
+		DefaultColumns: defaultColumns,
+		SortBy:         *f.sortBy,
+		NoHeaders:      *f.noHeaders,
+		TimeFormat:     formatTime,
+		Highlight:      f.highlight,
+	}
+	if *f.columns != "" {
+		opts.Columns = strings.Split(*f.columns, ",")
+	}
+	return opts, nil
+}
+
+// isText reports whether the output is meant to be read by a person rather than another program.
+func (f *outputFlags) isText() bool {
+	opts, err := f.options()
+	return err == nil && (opts.Format == output.Table || opts.Format == output.Wide)
+}
+
+// banner prints the command being run ahead of text output, keeping machine readable output clean.
+func (f *outputFlags) banner(command string) {
+	if f.isText() {
+		fmt.Println("\n" + command + "\n")
+	}
+}
+
+// render displays data on stdout, exiting when it cannot be rendered.
+func (f *outputFlags) render(data interface{}, defaultColumns ...string) {
+	opts, err := f.options(defaultColumns...)
+	fatalIf(err)
+	fatalIf(output.Render(os.Stdout, data, opts))
+}
+
+// sprint renders data as render does, returning it rather than displaying it, for the ishell commands.
+func (f *outputFlags) sprint(data interface{}, defaultColumns ...string) (string, error) {
+	opts, err := f.options(defaultColumns...)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = output.Render(&buf, data, opts)
+	return buf.String(), err
+}
+
+// formatTime renders t in the --tz timezone followed by how long ago it was
+// e.g. "2017-04-29 13:32:09 BST (5m ago)".
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(displayLocation).Format("2006-01-02 15:04:05 MST") + " (" + unified.Timestamp{Time: t}.Ago() + ")"
+}
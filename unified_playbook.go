@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bitbucket.org/ecosse-hosting/unified/lib/playbook"
+	"bitbucket.org/ecosse-hosting/unified/lib/remote"
+	"bytes"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/jawher/mow.cli"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long a shell is given to exit once a playbook has finished with it.
+const playbookExitWait = 10 * time.Second
+
+// playbookResult is the outcome of running a playbook on a device as rendered for -o json, yaml, csv and the like.
+type playbookResult struct {
+	Name       string            `json:"name"`
+	MacAddress string            `json:"mac"`
+	IP         string            `json:"ip"`
+	Status     string            `json:"status"`
+	Step       int               `json:"failed_step,omitempty"`
+	Vars       map[string]string `json:"vars"`
+	Output     string            `json:"output"`
+	Duration   string            `json:"duration"`
+	Error      string            `json:"error,omitempty"`
+
+	target remote.Target
+	given  map[string]string
+}
+
+// lockedBuffer is the transcript of a shell, written while the playbook reads it and read once it has finished.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// parseVars reads the KEY=VALUE pairs given by --var.
+func parseVars(pairs []string) map[string]string {
+	vars := make(map[string]string)
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			fatalIf(fmt.Errorf("invalid --var %q, want KEY=VALUE", pair))
+		}
+		vars[kv[0]] = kv[1]
+	}
+	return vars
+}
+
+// runPlaybook runs book in a shell on each of the targets, a few at a time, and reports how each went.
+func runPlaybook(bulk *bulkFlags, login *sshFlags, audited *auditFlags, book *playbook.Playbook, path string,
+	vars map[string]string, bulkTargets []bulkTarget) {
+	config := login.config()
+	text := bulk.out.isText()
+	results := make([]playbookResult, len(bulkTargets))
+	failed := 0
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan int)
+	workers := *bulk.workers
+	if workers < 1 {
+		workers = 1
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				r := runPlaybookOn(config, audited, book, path, vars, remoteTarget(bulkTargets[i]))
+				mu.Lock()
+				results[i] = r
+				if r.Error != "" {
+					failed++
+				}
+				if text {
+					printPlaybookResult(r)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range bulkTargets {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	if text {
+		if len(results) > 1 {
+			fmt.Printf("\n%d succeeded, %d failed.\n", len(results)-failed, failed)
+		}
+	} else {
+		bulk.out.render(results, "Name", "MacAddress", "Status", "Duration", "Error")
+	}
+	if failed > 0 {
+		cli.Exit(1)
+	}
+}
+
+// runPlaybookOn runs book in a shell on t, with the variables device, mac and ip set to those of t before those
+// given by --var, logging the session in the audit log.
+func runPlaybookOn(config remote.Config, audited *auditFlags, book *playbook.Playbook, path string,
+	vars map[string]string, t remote.Target) playbookResult {
+	start := time.Now()
+	inputs := map[string]string{"device": t.Name, "mac": t.MacAddress, "ip": t.IP}
+	for k, v := range vars {
+		inputs[k] = v
+	}
+	// What the variables were before the playbook ran, so those it captured can be told apart.
+	given := make(map[string]string)
+	for k, v := range book.Vars {
+		given[k] = v
+	}
+	for k, v := range inputs {
+		given[k] = v
+	}
+	r := playbookResult{Name: t.Name, MacAddress: t.MacAddress, IP: t.IP, Status: "ok", target: t, given: given}
+
+	session := audited.begin("exec", t, "playbook "+path, start, 512, 24)
+	var transcript lockedBuffer
+	code, err := func() (int, error) {
+		client, err := config.Dial(t)
+		if err != nil {
+			return -1, err
+		}
+		defer client.Close()
+		shell, err := remote.StartShell(client)
+		if err != nil {
+			return -1, err
+		}
+		defer shell.Close()
+		output := io.TeeReader(shell.Stdout, io.MultiWriter(&transcript, session.output()))
+		r.Vars, err = book.Run(shell.Stdin, output, inputs)
+		// The rest of the output must still be read for the shell to exit, such as after a final exit step, and is
+		// kept in the transcript until the connection is closed.
+		drained := make(chan bool)
+		go func() {
+			io.Copy(ioutil.Discard, output)
+			close(drained)
+		}()
+		code, werr := shell.Wait(playbookExitWait)
+		client.Close()
+		<-drained
+		if err == nil && werr != nil {
+			err = werr
+		}
+		return code, err
+	}()
+	session.end(code, err)
+
+	r.Output = strings.Replace(transcript.String(), "\r\n", "\n", -1)
+	r.Duration = time.Since(start).Round(time.Millisecond).String()
+	if err != nil {
+		r.Status, r.Error = "failed", err.Error()
+		if e, ok := err.(*playbook.StepError); ok {
+			r.Step = e.Step
+		}
+	}
+	return r
+}
+
+// printPlaybookResult prints the transcript of a playbook on a device under a heading, followed by the variables
+// it captured.
+func printPlaybookResult(r playbookResult) {
+	status := "ok"
+	heading := color.New(color.Bold)
+	if r.Error != "" {
+		status, heading = r.Error, color.New(color.Bold, color.FgRed)
+	}
+	heading.Printf("==> %s %s in %s <==\n", r.target, status, r.Duration)
+	fmt.Print(r.Output)
+	if n := len(r.Output); n > 0 && r.Output[n-1] != '\n' {
+		fmt.Println()
+	}
+	var names []string
+	for k, v := range r.Vars {
+		if in, ok := r.given[k]; !ok || in != v {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		color.New(color.FgCyan).Printf("%s=%s\n", k, r.Vars[k])
+	}
+}
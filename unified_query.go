@@ -0,0 +1,159 @@
+package main
+
+import (
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"context"
+	"fmt"
+	"github.com/jawher/mow.cli"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryFlags holds the options shared by the commands that list alarms or events.
+type queryFlags struct {
+	since     *string
+	until     *string
+	within    *int
+	limit     *int
+	key       *string
+	subSystem *string
+	mac       *string
+	essid     *string
+}
+
+// addQueryFlags registers the alarm & event query options on cmd.
+func addQueryFlags(cmd *cli.Cmd) *queryFlags {
+	return &queryFlags{
+		since: cmd.String(cli.StringOpt{
+			Name: "since",
+			Desc: "Only display results since a time (RFC3339 or YYYY-MM-DD) or for a duration ago e.g. 30m, 2h, 7d.",
+		}),
+		until: cmd.String(cli.StringOpt{
+			Name: "until",
+			Desc: "Only display results before a time (RFC3339 or YYYY-MM-DD) or a duration ago e.g. 30m, 2h, 7d.",
+		}),
+		within: cmd.Int(cli.IntOpt{
+			Name: "within",
+			Desc: "Ask the Controller for results from the last WITHIN hours only.",
+		}),
+		limit: cmd.Int(cli.IntOpt{
+			Name: "l limit",
+			Desc: "Display at most LIMIT results.",
+		}),
+		key: cmd.String(cli.StringOpt{
+			Name: "k key",
+			Desc: "Only display results with a matching key e.g. EVT_GW_WANTransition. Wildcards (*) are allowed.",
+		}),
+		subSystem: cmd.String(cli.StringOpt{
+			Name: "subsystem",
+			Desc: "Only display results for a subsystem e.g. wlan, lan or www.",
+		}),
+		mac: cmd.String(cli.StringOpt{
+			Name: "m mac",
+			Desc: "Only display results referring to the device or client with this MAC address.",
+		}),
+		essid: cmd.String(cli.StringOpt{
+			Name: "essid",
+			Desc: "Only display results for the wireless network with this ESSID.",
+		}),
+	}
+}
+
+// options converts the flags into the QueryOptions understood by the Alarms & Events services.
+func (f *queryFlags) options() (*unified.QueryOptions, error) {
+	now := time.Now()
+	opt := &unified.QueryOptions{
+		Within: *f.within,
+		Max:    *f.limit,
+		Filter: unified.ListFilter{
+			Key:        *f.key,
+			SubSystem:  *f.subSystem,
+			MacAddress: *f.mac,
+			Essid:      *f.essid,
+		},
+	}
+
+	var err error
+	if *f.since != "" {
+		if opt.Filter.Since, err = parseTimeFlag(*f.since, now); err != nil {
+			return nil, err
+		}
+		// Make sure the Controller looks back far enough to cover --since.
+		if opt.Within == 0 {
+			opt.Within = int(math.Ceil(now.Sub(opt.Filter.Since).Hours()))
+		}
+	}
+	if *f.until != "" {
+		if opt.Filter.Until, err = parseTimeFlag(*f.until, now); err != nil {
+			return nil, err
+		}
+	}
+	return opt, nil
+}
+
+// parseTimeFlag parses a point in time given either as a duration before now (30m, 2h, 7d, 2w) or as an
+// RFC3339 timestamp or a YYYY-MM-DD date in the local timezone.
+func parseTimeFlag(value string, now time.Time) (time.Time, error) {
+	if age, err := parseAge(value); err == nil {
+		return now.Add(-age), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: expected a duration such as 2h or 7d, RFC3339 or YYYY-MM-DD",
+		value)
+}
+
+// parseAge parses a duration as understood by time.ParseDuration with the addition of days (d) and weeks (w).
+func parseAge(value string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if strings.HasSuffix(value, suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSuffix(value, suffix), 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return d, nil
+}
+
+// alarmsToArchive lists the unarchived alarms selected by alarms archive: the alarm with the UUID id, every alarm
+// when all, or those with a matching key which were raised more than olderThan before now.
+func alarmsToArchive(ctx context.Context, s unified.AlarmsService, id string, all bool, key string, olderThan string,
+	now time.Time) ([]unified.Alarm, error) {
+	archived := false
+	opt := &unified.QueryOptions{Archived: &archived}
+	switch {
+	case id != "":
+		alarms, _, err := s.List(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+		return filterAlarmsByUUID(alarms, id), nil
+	case all:
+	case key != "" || olderThan != "":
+		opt.Filter.Key = key
+		if olderThan != "" {
+			age, err := parseAge(olderThan)
+			if err != nil {
+				return nil, err
+			}
+			opt.Filter.Until = now.Add(-age)
+		}
+	default:
+		return nil, fmt.Errorf("an alarm ID, --all, --key or --older-than is required")
+	}
+	alarms, _, err := s.List(ctx, opt)
+	return alarms, err
+}
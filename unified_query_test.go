@@ -0,0 +1,119 @@
+package main
+
+import (
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := map[string]time.Duration{
+		"0":      0,
+		"30m":    30 * time.Minute,
+		"1h30m":  90 * time.Minute,
+		"2d":     48 * time.Hour,
+		"1.5d":   36 * time.Hour,
+		"2w":     14 * 24 * time.Hour,
+		"0d":     0,
+		"500ms":  500 * time.Millisecond,
+		"0.5w":   84 * time.Hour,
+		"36h":    36 * time.Hour,
+		"1h0m0s": time.Hour,
+	}
+	for value, want := range tests {
+		if got, err := parseAge(value); err != nil || got != want {
+			t.Errorf("parseAge(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "d", "-1d", "-5m", "2x", "twod", "1d2h", "7"} {
+		if got, err := parseAge(value); err == nil {
+			t.Errorf("parseAge(%q) = %v, want an error", value, got)
+		}
+	}
+}
+
+func TestParseTimeFlag(t *testing.T) {
+	now := time.Date(2018, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Time{
+		"2h":                        now.Add(-2 * time.Hour),
+		"7d":                        now.Add(-7 * 24 * time.Hour),
+		"0s":                        now,
+		"2018-03-01T08:30:00Z":      time.Date(2018, 3, 1, 8, 30, 0, 0, time.UTC),
+		"2018-03-01T08:30:00+01:00": time.Date(2018, 3, 1, 7, 30, 0, 0, time.UTC),
+		"2018-03-01":                time.Date(2018, 3, 1, 0, 0, 0, 0, time.Local),
+	}
+	for value, want := range tests {
+		if got, err := parseTimeFlag(value, now); err != nil || !got.Equal(want) {
+			t.Errorf("parseTimeFlag(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "yesterday", "-2h", "2018-3-1", "2018-02-30", "01/03/2018", "08:30"} {
+		if got, err := parseTimeFlag(value, now); err == nil {
+			t.Errorf("parseTimeFlag(%q) = %v, want an error", value, got)
+		}
+	}
+}
+
+// fakeAlarms is an AlarmsService holding alarms, which records the options it was last listed with.
+type fakeAlarms struct {
+	unified.AlarmsService
+	alarms []unified.Alarm
+	opt    *unified.QueryOptions
+}
+
+func (f *fakeAlarms) List(ctx context.Context, opt *unified.QueryOptions) ([]unified.Alarm, *unified.Response, error) {
+	f.opt = opt
+	return f.alarms, nil, nil
+}
+
+func TestAlarmsToArchive(t *testing.T) {
+	now := time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		id             string
+		all            bool
+		key, olderThan string
+		uuids          []string
+		filter         unified.ListFilter
+		err            bool
+	}{
+		{name: "an ID", id: "2", uuids: []string{"2"}},
+		{name: "an unknown ID", id: "4", uuids: nil},
+		{name: "all", all: true, uuids: []string{"1", "2", "3"}},
+		{name: "a key", key: "EVT_AP_*", uuids: []string{"1", "2", "3"}, filter: unified.ListFilter{Key: "EVT_AP_*"}},
+		{name: "an age", olderThan: "7d", uuids: []string{"1", "2", "3"},
+			filter: unified.ListFilter{Until: now.Add(-7 * 24 * time.Hour)}},
+		{name: "a key and age", key: "EVT_GW_*", olderThan: "2h", uuids: []string{"1", "2", "3"},
+			filter: unified.ListFilter{Key: "EVT_GW_*", Until: now.Add(-2 * time.Hour)}},
+		{name: "an invalid age", olderThan: "7 days", err: true},
+		{name: "nothing", err: true},
+	}
+	for _, test := range tests {
+		s := &fakeAlarms{alarms: []unified.Alarm{{UUID: "1"}, {UUID: "2"}, {UUID: "3"}}}
+		alarms, err := alarmsToArchive(context.TODO(), s, test.id, test.all, test.key, test.olderThan, now)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: alarmsToArchive() should return an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: alarmsToArchive() returned error: %v", test.name, err)
+			continue
+		}
+		var uuids []string
+		for _, a := range alarms {
+			uuids = append(uuids, a.UUID)
+		}
+		if fmt.Sprint(uuids) != fmt.Sprint(test.uuids) {
+			t.Errorf("%s: alarmsToArchive() = %v, want %v", test.name, uuids, test.uuids)
+		}
+		if s.opt == nil || s.opt.Archived == nil || *s.opt.Archived {
+			t.Errorf("%s: alarmsToArchive() did not list only the unarchived alarms: %+v", test.name, s.opt)
+		} else if s.opt.Filter != test.filter {
+			t.Errorf("%s: alarmsToArchive() listed alarms with %+v, want %+v", test.name, s.opt.Filter, test.filter)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bitbucket.org/ecosse-hosting/unified/lib/remote"
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/jawher/mow.cli"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// The SSH username UniFi devices have before they are adopted, used when the Controller does not say otherwise.
+const defaultSSHUser = "ubnt"
+
+// sshFlags holds the options of the commands which log in to devices over SSH.
+type sshFlags struct {
+	user     *string
+	port     *int
+	identity *[]string
+	noAgent  *bool
+	known    *string
+	strict   *bool
+
+	hosts         *remote.KnownHosts
+	forDevices    *remote.Config
+	forController *remote.Config
+}
+
+// addSSHFlags registers the SSH login options on cmd.
+func addSSHFlags(cmd *cli.Cmd) *sshFlags {
+	return &sshFlags{
+		user: cmd.String(cli.StringOpt{
+			Name: "U user sshuser",
+			Desc: "The SSH username of the devices. Defaults to the one the Controller provisions them with, or " +
+				defaultSSHUser + ".",
+			EnvVar: "UNIFIED_SSH_USERNAME",
+		}),
+		port: cmd.Int(cli.IntOpt{
+			Name:   "P port ssh_port",
+			Value:  remote.DefaultPort,
+			Desc:   "The port the devices listen for SSH on.",
+			EnvVar: "UNIFIED_SSH_PORT",
+		}),
+		identity: cmd.Strings(cli.StringsOpt{
+			Name: "i identity",
+			Desc: "A private key file to log in with, asking for its passphrase if it has one. May be repeated. " +
+				"Defaults to those of ~/.ssh/id_ed25519, id_ecdsa and id_rsa without a passphrase.",
+			EnvVar: "UNIFIED_SSH_IDENTITY",
+		}),
+		noAgent: cmd.Bool(cli.BoolOpt{
+			Name: "no-agent",
+			Desc: "Do not offer the keys held by ssh-agent.",
+		}),
+		known: cmd.String(cli.StringOpt{
+			Name:   "known-hosts",
+			Value:  filepath.Join(os.Getenv("HOME"), ".unified", "known_hosts"),
+			Desc:   "The file the host keys of the devices are kept in, by MAC address.",
+			EnvVar: "UNIFIED_KNOWN_HOSTS",
+		}),
+		strict: cmd.Bool(cli.BoolOpt{
+			Name: "strict-host-keys",
+			Desc: "Refuse to connect to devices whose host key is not known yet, rather than trusting it on first " +
+				"use. Use unified ssh trust DEVICE to trust it.",
+		}),
+	}
+}
+
+// knownHosts opens the store of the host keys of the devices, once however many configs share it.
+func (f *sshFlags) knownHosts() *remote.KnownHosts {
+	if f.hosts != nil {
+		return f.hosts
+	}
+	hosts, err := remote.OpenKnownHosts(*f.known)
+	fatalIf(err)
+	hosts.TrustOnFirstUse = !*f.strict
+	hosts.Trusted = func(t remote.Target, key ssh.PublicKey) {
+		warn(fmt.Errorf("trusted the host key of %s on first use, %s", t, ssh.FingerprintSHA256(key)))
+	}
+	f.hosts = hosts
+	return hosts
+}
+
+// config returns how to log in to the devices. Keys from ssh-agent and the identity files are tried first, then
+// the password, which is taken from $UNIFIED_SSH_PASSWORD, the device SSH credentials of the site when the
+// Controller account may read them, or else asked for on the terminal the first time a device wants it.
+func (f *sshFlags) config() remote.Config {
+	if f.forDevices == nil {
+		c := f.build(true)
+		f.forDevices = &c
+	}
+	return *f.forDevices
+}
+
+// controllerConfig returns how to log in to the Controller itself, as the -U user or else the local user, which is
+// not given the device SSH credentials.
+func (f *sshFlags) controllerConfig() remote.Config {
+	if f.forController == nil {
+		c := f.build(false)
+		f.forController = &c
+	}
+	return *f.forController
+}
+
+func (f *sshFlags) build(devices bool) remote.Config {
+	var creds remote.Credentials
+	if !*f.noAgent {
+		signers, _, err := remote.AgentSigners()
+		if err != nil {
+			warn(err)
+		}
+		creds.Signers = signers
+	}
+	files, explicit := *f.identity, len(*f.identity) > 0
+	if !explicit {
+		files = remote.DefaultKeyFiles()
+	}
+	for _, file := range files {
+		// Default keys protected by a passphrase are skipped rather than asked about, as they are usually in the agent.
+		var passphrase func(string) ([]byte, error)
+		if explicit {
+			passphrase = func(path string) ([]byte, error) { return readSecret("Passphrase for " + path + ": ") }
+		}
+		signer, err := remote.LoadKey(file, passphrase)
+		if err != nil && explicit {
+			fatalIf(err)
+		}
+		if err == nil {
+			creds.Signers = append(creds.Signers, signer)
+		}
+	}
+
+	user := *f.user
+	if user == "" && !devices {
+		user = os.Getenv("USER")
+	}
+	var mgmt *unified.MgmtSetting
+	if devices && (user == "" || os.Getenv("UNIFIED_SSH_PASSWORD") == "") {
+		var err error
+		if mgmt, _, err = cx.Settings.Mgmt(ctx); err != nil {
+			warn(fmt.Errorf("cannot read the device SSH credentials from the Controller: %v", err))
+		}
+	}
+	if user == "" && mgmt != nil {
+		user = mgmt.SSHUsername
+	}
+	if user == "" {
+		user = defaultSSHUser
+	}
+	var once sync.Once
+	var password string
+	var passwordErr error
+	creds.Password = func() (string, error) {
+		once.Do(func() {
+			switch {
+			case os.Getenv("UNIFIED_SSH_PASSWORD") != "":
+				password = os.Getenv("UNIFIED_SSH_PASSWORD")
+			case mgmt != nil && mgmt.SSHPassword != "" && mgmt.SSHUsername == user:
+				password = mgmt.SSHPassword
+			default:
+				var secret []byte
+				secret, passwordErr = readSecret("SSH password for " + user + ": ")
+				password = string(secret)
+			}
+		})
+		return password, passwordErr
+	}
+
+	return remote.Config{User: user, Port: *f.port, Auth: creds.Methods(), HostKeys: f.knownHosts()}
+}
+
+// readSecret asks for a password or passphrase on the terminal without echoing it.
+func readSecret(prompt string) ([]byte, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("no terminal to ask for the secret on, see --help for other ways to give it")
+	}
+	defer tty.Close()
+	fmt.Fprint(tty, prompt)
+	secret, err := terminal.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+	return secret, err
+}
+
+// warn prints a problem which does not stop the command on stderr.
+func warn(err error) {
+	color.New(color.FgYellow).Fprintf(os.Stderr, "Warning: %v\n", err)
+}
+
+func remoteTarget(t bulkTarget) remote.Target {
+	return remote.Target{Name: t.Name, MacAddress: t.MacAddress, IP: t.IP}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"github.com/abiosoft/ishell"
+	"github.com/fatih/color"
+	"strings"
+)
+
+// Argument descriptions shared by every command taking a device or client.
+const (
+	deviceArgDesc = "The device to target, by name, IP, serial, MAC address or the last 4+ digits of its MAC."
+	clientArgDesc = "The client to target, by name, hostname, IP, MAC address or the last 4+ digits of its MAC."
+)
+
+// resolveDevice returns the device identified by query, exiting with the reason when there is not exactly one.
+func resolveDevice(query string) *unified.Device {
+	device, _, err := cx.Devices.Resolve(ctx, query)
+	fatalIf(err)
+	return device
+}
+
+// shellDevice resolves the device named by the arguments of an ishell command, printing why when it cannot.
+func shellDevice(c *ishell.Context) (*unified.Device, bool) {
+	device, _, err := cx.Devices.Resolve(ctx, strings.Join(c.Args, " "))
+	if err != nil {
+		shellError(c, err)
+		return nil, false
+	}
+	return device, true
+}
+
+// shellClient resolves the MAC address of the client named by the arguments of an ishell command, printing why
+// when it cannot.
+func shellClient(c *ishell.Context) (string, bool) {
+	client, _, err := cx.Users.Resolve(ctx, strings.Join(c.Args, " "))
+	if err != nil {
+		shellError(c, err)
+		return "", false
+	}
+	return client.MacAddress, true
+}
+
+func shellError(c *ishell.Context, err error) {
+	color.Set(color.FgRed)
+	c.Println(err.Error())
+	color.Set(color.FgWhite)
+}
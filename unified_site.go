@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bitbucket.org/ecosse-hosting/unified/lib/output"
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/jawher/mow.cli"
+	"strings"
+)
+
+// healthRow is a subsystem as listed by site health.
+type healthRow struct {
+	Subsystem string   `json:"subsystem"`
+	Status    string   `json:"status"`
+	State     string   `json:"state"`
+	Details   string   `json:"details"`
+	Problems  []string `json:"problems,omitempty"`
+}
+
+// siteHealth is everything site health reports, as rendered for -o json and -o yaml.
+type siteHealth struct {
+	State      string              `json:"state"`
+	Subsystems []healthRow         `json:"subsystems"`
+	Controller *unified.SysInfo    `json:"controller"`
+	Raw        []unified.Subsystem `json:"raw"`
+}
+
+// cmdSite adds the site sub-commands.
+func cmdSite(cmd *cli.Cmd) {
+	cmd.Command("health", "Summarises the health of the WAN, internet, WLAN, LAN and VPN of the site, exiting with "+
+		"1 (warning) or 2 (critical) when any are degraded.", cmdSiteHealth)
+}
+
+func cmdSiteHealth(cmd *cli.Cmd) {
+	nagios := cmd.Bool(cli.BoolOpt{
+		Name: "nagios",
+		Desc: "Print a single Nagios plugin status line with performance data instead of the table.",
+	})
+	maxLatency := cmd.Int(cli.IntOpt{
+		Name: "max-latency",
+		Desc: "Warn when the internet latency is above this many milliseconds.",
+	})
+	maxCPU := cmd.Int(cli.IntOpt{
+		Name: "max-cpu",
+		Desc: "Warn when the gateway CPU usage is above this percentage.",
+	})
+	maxMem := cmd.Int(cli.IntOpt{
+		Name: "max-mem",
+		Desc: "Warn when the gateway memory usage is above this percentage.",
+	})
+	out := addOutputFlags(cmd, output.Table)
+
+	cmd.Action = func() {
+		subsystems, _, err := cx.Health.Subsystems(ctx)
+		var info *unified.SysInfo
+		if err == nil {
+			info, _, err = cx.Health.SysInfo(ctx)
+		}
+		if err != nil && *nagios {
+			fmt.Printf("UNIFI %s - %v\n", unified.HealthUnknown, err)
+			cli.Exit(int(unified.HealthUnknown))
+		}
+		fatalIf(err)
+
+		assessments := unified.Assess(subsystems, unified.HealthThresholds{
+			Latency: float64(*maxLatency),
+			CPU:     float64(*maxCPU),
+			Mem:     float64(*maxMem),
+		})
+		worst := unified.Worst(assessments)
+		if *nagios {
+			printNagios(worst, assessments, subsystems, info)
+			cli.Exit(int(worst))
+		}
+
+		rows := make([]healthRow, 0, len(subsystems))
+		var problems []string
+		for i, s := range subsystems {
+			a := assessments[i]
+			rows = append(rows, healthRow{s.Name, s.Status, a.State.String(), s.Summary(), a.Problems})
+			problems = append(problems, a.Problems...)
+		}
+		if !out.isText() {
+			out.render(siteHealth{worst.String(), rows, info, subsystems})
+			exitHealth(worst)
+			return
+		}
+
+		out.banner("unified site health")
+		out.render(rows, "Subsystem", "Status", "State", "Details")
+		fmt.Printf("\nController %s %s (build %s), %s\n", info.Name, info.Version, info.Build, updateStatus(info))
+		for _, p := range problems {
+			color.New(color.FgYellow).Printf("Warning: %s\n", p)
+		}
+		exitHealth(worst)
+	}
+}
+
+// exitHealth exits with the Nagios exit code of state, unless everything is OK.
+func exitHealth(state unified.HealthState) {
+	if state != unified.HealthOK {
+		cli.Exit(int(state))
+	}
+}
+
+func updateStatus(info *unified.SysInfo) string {
+	switch {
+	case info.UpdateDownloaded:
+		return "an update is downloaded and ready to install"
+	case info.UpdateAvailable:
+		return "an update is available"
+	}
+	return "up to date"
+}
+
+// printNagios prints the status line of a Nagios plugin e.g.
+// "UNIFI WARNING - 1 wlan device(s) disconnected | latency=12ms cpu=5% mem=38% rx=1200B tx=300B clients=20".
+func printNagios(
+	worst unified.HealthState,
+	assessments []unified.Assessment,
+	subsystems []unified.Subsystem,
+	info *unified.SysInfo) {
+
+	var problems []string
+	for _, a := range assessments {
+		problems = append(problems, a.Problems...)
+	}
+	summary := strings.Join(problems, ", ")
+	if summary == "" {
+		summary = fmt.Sprintf("%d subsystems healthy, Controller %s %s", len(subsystems), info.Version,
+			updateStatus(info))
+	}
+
+	var perf []string
+	clients := 0
+	for _, s := range subsystems {
+		switch s.Name {
+		case "www":
+			perf = append(perf, fmt.Sprintf("latency=%gms", s.Latency))
+		case "wan":
+			perf = append(perf, fmt.Sprintf("cpu=%g%% mem=%g%%", s.GatewayStats.CPU, s.GatewayStats.Mem),
+				fmt.Sprintf("rx=%gB tx=%gB", s.RxBytesRate, s.TxBytesRate))
+		case "wlan", "lan":
+			clients += s.NumUser + s.NumGuest
+		}
+	}
+	perf = append(perf, fmt.Sprintf("clients=%d", clients))
+	fmt.Printf("UNIFI %s - %s | %s\n", worst, summary, strings.Join(perf, " "))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bitbucket.org/ecosse-hosting/unified/lib/remote"
+	"fmt"
+	"github.com/jawher/mow.cli"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"time"
+)
+
+func cmdSSH(cmd *cli.Cmd) {
+	cmd.Spec = "[OPTIONS] DEVICE [COMMAND]"
+	device := cmd.StringArg("DEVICE", "", deviceArgDesc+" Or trust DEVICE to trust the host key the device has "+
+		"now, or forget DEVICE to forget it.")
+	command := cmd.StringArg("COMMAND", "", "Run this command on a terminal instead of a login shell e.g. top.")
+	login := addSSHFlags(cmd)
+	audited := addAuditFlags(cmd)
+	yes := cmd.Bool(cli.BoolOpt{
+		Name: "yes",
+		Desc: "Do not ask before trust replaces the host key a device is known by.",
+	})
+
+	cmd.Action = func() {
+		// trust and forget are handled here as a command cannot have sub-commands as well as arguments.
+		switch {
+		case *device == "trust" && *command != "":
+			sshTrust(login, *command, *yes)
+			return
+		case *device == "forget" && *command != "":
+			sshForget(login, *command)
+			return
+		}
+
+		d := resolveDevice(*device)
+		target := remote.Target{Name: d.Name, MacAddress: d.MacAddress, IP: d.IP}
+		term := remote.LocalTerminal()
+		width, height := term.Size()
+		session := audited.begin("ssh", target, *command, time.Now(), width, height)
+		client, err := login.config().Dial(target)
+		if err != nil {
+			session.end(-1, err)
+			fatalIf(err)
+		}
+		defer client.Close()
+
+		term.Out = io.MultiWriter(term.Out, session.output())
+		term.Err = io.MultiWriter(term.Err, session.output())
+		code, err := term.Run(client, *command)
+		session.end(code, err)
+		fatalIf(err)
+		if code != 0 {
+			cli.Exit(code)
+		}
+	}
+}
+
+// sshTrust trusts the host key the device has now, which is how a device which has been re-imaged or replaced is
+// accepted again.
+func sshTrust(login *sshFlags, query string, yes bool) {
+	d := resolveDevice(query)
+	target := remote.Target{Name: d.Name, MacAddress: d.MacAddress, IP: d.IP}
+	key, err := login.config().HostKey(target)
+	fatalIf(err)
+
+	hosts := login.knownHosts()
+	fingerprint := ssh.FingerprintSHA256(key)
+	if known, ok := hosts.Lookup(d.MacAddress); ok {
+		if ssh.FingerprintSHA256(known) == fingerprint {
+			fmt.Printf("The host key of %s is already trusted, %s\n", target, fingerprint)
+			return
+		}
+		fmt.Printf("%s is known by %s\n", target, ssh.FingerprintSHA256(known))
+		if !yes {
+			fatalIf(confirm(fmt.Sprintf("Replace it with %s?", fingerprint)))
+		}
+	}
+	fatalIf(hosts.Add(d.MacAddress, key))
+	fmt.Printf("Trusted the host key of %s, %s\n", target, fingerprint)
+}
+
+// sshForget forgets the host key of the device, which may be named by MAC address alone when the Controller no
+// longer knows it.
+func sshForget(login *sshFlags, query string) {
+	mac := query
+	if _, err := net.ParseMAC(query); err != nil {
+		mac = resolveDevice(query).MacAddress
+	}
+	ok, err := login.knownHosts().Remove(mac)
+	fatalIf(err)
+	if !ok {
+		fmt.Printf("The host key of %s is not known\n", mac)
+		return
+	}
+	fmt.Printf("Forgot the host key of %s\n", mac)
+}
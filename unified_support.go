@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bitbucket.org/ecosse-hosting/unified/lib/remote"
+	"bitbucket.org/ecosse-hosting/unified/lib/support"
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/jawher/mow.cli"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// bundleManifest describes a support bundle, put in it as manifest.json.
+type bundleManifest struct {
+	Device     string          `json:"device"`
+	MacAddress string          `json:"mac"`
+	Model      string          `json:"model"`
+	Type       string          `json:"type"`
+	Version    string          `json:"version"`
+	Created    time.Time       `json:"created"`
+	Commands   []bundleCommand `json:"commands"`
+	Errors     []string        `json:"errors,omitempty"`
+}
+
+// bundleCommand is the outcome of running one of the diagnostic commands of a support bundle.
+type bundleCommand struct {
+	File     string `json:"file"`
+	Command  string `json:"command"`
+	ExitCode int    `json:"exit_code"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+func cmdDeviceSupportBundle(cmd *cli.Cmd) {
+	cmd.Spec = "[OPTIONS] DEVICE"
+	device := cmd.StringArg("DEVICE", "", deviceArgDesc)
+	login := addSSHFlags(cmd)
+	dir := cmd.String(cli.StringOpt{
+		Name:  "d dir",
+		Value: ".",
+		Desc:  "The directory to write the bundle to.",
+	})
+	since := cmd.String(cli.StringOpt{
+		Name:  "since",
+		Value: "24h",
+		Desc:  "Include the events of the device from this long ago e.g. 2h, 7d.",
+	})
+	timeout := cmd.String(cli.StringOpt{
+		Name:  "t timeout",
+		Value: "60s",
+		Desc:  "Give up on any command still running on the device after this long.",
+	})
+
+	cmd.Action = func() {
+		age, err := parseAge(*since)
+		fatalIf(err)
+		limit, err := parseAge(*timeout)
+		fatalIf(err)
+		d := resolveDevice(*device)
+
+		manifest := bundleManifest{Device: d.Name, MacAddress: d.MacAddress, Model: d.Model, Type: d.Type,
+			Version: d.Version, Created: time.Now()}
+		name := fmt.Sprintf("support-%s-%s", deviceDir(remote.Target{Name: d.Name, MacAddress: d.MacAddress}),
+			manifest.Created.Format("20060102-150405"))
+		path := filepath.Join(*dir, name+".tar.gz")
+		file, err := os.Create(path)
+		fatalIf(err)
+		bundle := support.NewWriter(file, name)
+		add := func(name string, data []byte) {
+			if err := bundle.Add(name, data); err != nil {
+				file.Close()
+				os.Remove(path)
+				fatalIf(err)
+			}
+		}
+		addJSON := func(name string, v interface{}) {
+			data, err := json.MarshalIndent(v, "", "  ")
+			fatalIf(err)
+			add(name, data)
+		}
+		// Whatever cannot be collected is noted in the manifest rather than failing the bundle, which is most useful
+		// when the device is misbehaving.
+		problem := func(err error) {
+			warn(err)
+			manifest.Errors = append(manifest.Errors, err.Error())
+		}
+
+		fmt.Printf("Collecting a support bundle for %s (%s)\n", d.Name, d.MacAddress)
+		addJSON("device.json", d)
+		events, _, err := cx.Events.List(ctx, &unified.QueryOptions{
+			Filter: unified.ListFilter{MacAddress: d.MacAddress, Since: time.Now().Add(-age)},
+		})
+		if err != nil {
+			problem(fmt.Errorf("cannot list the events of the device: %v", err))
+		}
+		addJSON("events.json", sortEvents(events))
+		alarms, _, err := cx.Alarms.List(ctx, nil)
+		if err != nil {
+			problem(fmt.Errorf("cannot list the alarms: %v", err))
+		}
+		addJSON("alarms.json", alarms)
+
+		client, err := login.config().Dial(remote.Target{Name: d.Name, MacAddress: d.MacAddress, IP: d.IP})
+		if err != nil {
+			problem(fmt.Errorf("cannot run the diagnostic commands: %v", err))
+		} else {
+			for _, c := range support.Commands(d.Type) {
+				r := remote.Run(client, c.Run, limit)
+				result := bundleCommand{File: c.Name, Command: c.Run, ExitCode: r.ExitCode,
+					Duration: r.Duration.Round(time.Millisecond).String()}
+				status := color.New(color.FgGreen).Sprint("ok")
+				switch {
+				case r.Err != nil:
+					result.Error = r.Err.Error()
+					status = color.New(color.FgRed).Sprint(result.Error)
+				case r.ExitCode != 0:
+					status = color.New(color.FgYellow).Sprintf("exit code %d", r.ExitCode)
+				}
+				fmt.Printf("  %-20s %s\n", c.Run, status)
+				manifest.Commands = append(manifest.Commands, result)
+				add(c.Name, append(r.Stdout, r.Stderr...))
+			}
+			client.Close()
+		}
+		addJSON("manifest.json", manifest)
+
+		err = bundle.Close()
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(path)
+			fatalIf(err)
+		}
+		fmt.Printf("Wrote %s, with the inform key, passwords, WPA keys and other secrets redacted.\n", path)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bitbucket.org/ecosse-hosting/unified/lib/top"
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"github.com/jawher/mow.cli"
+	"time"
+)
+
+// The number of the latest events displayed by top.
+const topEvents = 50
+
+// cmdTop adds the top command, a full screen dashboard of the site refreshing on an interval.
+func cmdTop(cmd *cli.Cmd) {
+	interval := cmd.String(cli.StringOpt{
+		Name:  "i interval",
+		Value: "5s",
+		Desc:  "How often to refresh e.g. 10s or 1m.",
+	})
+
+	cmd.Action = func() {
+		every, err := parseAge(*interval)
+		fatalIf(err)
+		if every < time.Second {
+			every = time.Second
+		}
+		actions := top.Actions{
+			Locate: func(mac string, on bool) error {
+				_, _, err := cx.UAP.SetLocate(ctx, mac, on)
+				return err
+			},
+			Restart: func(mac string) error {
+				_, _, err := cx.Devices.Restart(ctx, mac)
+				return err
+			},
+		}
+		fatalIf(top.New("unified top - "+*cx.SiteName, fetchTop, actions, every).Run())
+	}
+}
+
+// fetchTop fetches everything top displays, stopping at the first error.
+func fetchTop() *top.Data {
+	data := &top.Data{Fetched: time.Now()}
+	archived := false
+	steps := []func() error{
+		func() (err error) { data.Devices, _, err = cx.Devices.List(ctx, nil); return },
+		func() (err error) { data.Clients, _, err = cx.Users.ListActive(ctx, nil); return },
+		func() (err error) {
+			data.Events, _, err = cx.Events.List(ctx, &unified.QueryOptions{Limit: topEvents, Max: topEvents})
+			return
+		},
+		func() (err error) {
+			data.Alarms, _, err = cx.Alarms.List(ctx, &unified.QueryOptions{Archived: &archived})
+			return
+		},
+	}
+	for _, step := range steps {
+		if data.Err = step(); data.Err != nil {
+			break
+		}
+	}
+	return data
+}
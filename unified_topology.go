@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bitbucket.org/ecosse-hosting/unified/lib/topology"
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/jawher/mow.cli"
+	"os"
+	"strings"
+)
+
+// cmdTopology adds the topology command which displays how the devices and clients of the site are connected.
+func cmdTopology(cmd *cli.Cmd) {
+	format := cmd.String(cli.StringOpt{
+		Name:  "o output",
+		Value: topology.Tree,
+		Desc: "Output format. One of " + strings.Join(topology.Formats, ", ") +
+			" e.g. -o dot | dot -Tsvg > site.svg.",
+	})
+	noClients := cmd.Bool(cli.BoolOpt{
+		Name: "no-clients",
+		Desc: "Only display the UniFi devices, leaving out the clients connected to them.",
+	})
+
+	cmd.Action = func() {
+		devices, _, err := cx.Devices.List(ctx, nil)
+		fatalIf(err)
+		var clients []unified.User
+		if !*noClients {
+			clients, _, err = cx.Users.ListActive(ctx, nil)
+			fatalIf(err)
+		}
+
+		var highlight func(string) string
+		if *format == topology.Tree {
+			fmt.Print("\nunified topology\n\n")
+			red := color.New(color.FgRed).SprintFunc()
+			highlight = func(s string) string { return red(s) }
+		}
+		fatalIf(topology.Render(os.Stdout, topology.Build(devices, clients), *format, highlight))
+	}
+}
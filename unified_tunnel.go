@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bitbucket.org/ecosse-hosting/unified/lib/remote"
+	"fmt"
+	"github.com/jawher/mow.cli"
+	"golang.org/x/crypto/ssh"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// How often the device is checked on while tunnels are open, so a lost connection is noticed.
+const tunnelKeepAlive = 30 * time.Second
+
+func cmdTunnel(cmd *cli.Cmd) {
+	cmd.Spec = "[OPTIONS] DEVICE"
+	device := cmd.StringArg("DEVICE", "", deviceArgDesc)
+	login := addSSHFlags(cmd)
+	locals := cmd.Strings(cli.StringsOpt{
+		Name: "L local",
+		Desc: "Forward [BIND_ADDRESS:]PORT here to HOST:HOSTPORT as reached from the device e.g. 8080:10.0.0.5:80. " +
+			"May be repeated.",
+	})
+	remotes := cmd.Strings(cli.StringsOpt{
+		Name: "R remote",
+		Desc: "Forward [BIND_ADDRESS:]PORT on the device to HOST:HOSTPORT as reached from here e.g. 8080:localhost:80. " +
+			"May be repeated.",
+	})
+	dynamics := cmd.Strings(cli.StringsOpt{
+		Name: "D dynamic",
+		Desc: "Run a SOCKS5 proxy on [BIND_ADDRESS:]PORT here whose connections are made from the device e.g. 1080. " +
+			"May be repeated.",
+	})
+
+	cmd.Action = func() {
+		type spec struct {
+			kind  string
+			parse func(string) (remote.Forward, error)
+			open  func(*ssh.Client, remote.Forward) (*remote.Tunnel, error)
+			specs []string
+		}
+		kinds := []spec{
+			{"local", remote.ParseForward, remote.LocalForward, *locals},
+			{"remote", remote.ParseForward, remote.RemoteForward, *remotes},
+			{"SOCKS", remote.ParseDynamic, remote.DynamicForward, *dynamics},
+		}
+		type forward struct {
+			spec    spec
+			forward remote.Forward
+		}
+		var forwards []forward
+		for _, k := range kinds {
+			for _, s := range k.specs {
+				f, err := k.parse(s)
+				fatalIf(err)
+				forwards = append(forwards, forward{k, f})
+			}
+		}
+		if len(forwards) == 0 {
+			fatalIf(fmt.Errorf("give at least one tunnel with -L, -R or -D"))
+		}
+
+		d := resolveDevice(*device)
+		target := remote.Target{Name: d.Name, MacAddress: d.MacAddress, IP: d.IP}
+		client, err := login.config().Dial(target)
+		fatalIf(err)
+		defer client.Close()
+
+		var tunnels []*remote.Tunnel
+		closeAll := func() {
+			for _, t := range tunnels {
+				t.Close()
+			}
+		}
+		failed := make(chan error, len(forwards))
+		for _, f := range forwards {
+			t, err := f.spec.open(client, f.forward)
+			if err != nil {
+				closeAll()
+				fatalIf(err)
+			}
+			t.Errors = warn
+			tunnels = append(tunnels, t)
+			fmt.Printf("Forwarding %s %s through %s\n", f.spec.kind, f.forward, target)
+			go func() {
+				if err := t.Serve(); err != nil {
+					failed <- err
+				}
+			}()
+		}
+		go remote.KeepAlive(client, tunnelKeepAlive)
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+		defer signal.Stop(signals)
+		lost := make(chan error, 1)
+		go func() { lost <- client.Wait() }()
+
+		fmt.Println("Press Ctrl-C to close the tunnels.")
+		select {
+		case <-signals:
+		case err := <-failed:
+			closeAll()
+			fatalIf(err)
+		case <-lost:
+			closeAll()
+			fatalIf(fmt.Errorf("lost the connection to %s", target))
+		}
+		closeAll()
+		fmt.Printf("Closed %d tunnel(s).\n", len(tunnels))
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bitbucket.org/ecosse-hosting/unified/lib/output"
+	unified "bitbucket.org/ecosse-hosting/unified/lib/unifi"
+	"fmt"
+	"github.com/jawher/mow.cli"
+	"strings"
+)
+
+// portForwardRow is a port forward as listed by ugw portforward ls.
+type portForwardRow struct {
+	Name      string `json:"name"`
+	Enabled   bool   `json:"enabled"`
+	Interface string `json:"pfwd_interface"`
+	Protocol  string `json:"proto"`
+	Source    string `json:"src"`
+	Port      string `json:"dst_port"`
+	Forward   string `json:"forward"`
+	ID        string `json:"_id"`
+}
+
+// routeRow is a static route as listed by ugw route ls.
+type routeRow struct {
+	Name     string `json:"name"`
+	Enabled  bool   `json:"enabled"`
+	Network  string `json:"static-route_network"`
+	Type     string `json:"static-route_type"`
+	Target   string `json:"target"`
+	Distance int    `json:"static-route_distance"`
+	ID       string `json:"_id"`
+}
+
+func siteSubnets() map[string]string {
+	networks, _, err := cx.Rest.List(ctx, "networkconf")
+	fatalIf(err)
+	return unified.Subnets(networks)
+}
+
+// cmdUGWPortForward adds the ugw portforward sub-commands which manage the port forwards of the gateway.
+func cmdUGWPortForward(cmd *cli.Cmd) {
+	cmd.Command("ls", "Lists the port forwards.", func(cmd2 *cli.Cmd) {
+		out := addOutputFlags(cmd2, output.Table)
+		cmd2.Action = func() {
+			out.banner("unified device ugw portforward ls")
+			forwards, _, err := cx.PortForwards.List(ctx)
+			fatalIf(err)
+			rows := make([]portForwardRow, 0, len(forwards))
+			for _, f := range forwards {
+				rows = append(rows, portForwardRow{f.Name, f.IsEnabled, f.Interface, f.Protocol, f.Src, f.DstPort,
+					f.Fwd + ":" + f.FwdPort, f.ID})
+			}
+			out.render(rows, "Name", "Enabled", "Interface", "Protocol", "Source", "Port", "Forward")
+		}
+	})
+
+	cmd.Command("add", "Forwards a port of the WAN to a host on one of the networks of the site.", func(cmd2 *cli.Cmd) {
+		cmd2.Spec = "[OPTIONS] NAME PORT HOST"
+		name := cmd2.StringArg("NAME", "", "The name of the port forward.")
+		port := cmd2.StringArg("PORT", "", "The WAN port or ports to forward e.g. 443 or 8000-8010.")
+		host := cmd2.StringArg("HOST", "", "The address to forward to, optionally with a port e.g. 192.168.1.20:8443.")
+		protocol := cmd2.String(cli.StringOpt{
+			Name:  "protocol",
+			Value: "tcp_udp",
+			Desc:  "The protocol to forward: tcp, udp or tcp_udp.",
+		})
+		iface := cmd2.String(cli.StringOpt{
+			Name:  "interface",
+			Value: "wan",
+			Desc:  "The WAN interface to forward from: wan, wan2 or both.",
+		})
+		src := cmd2.String(cli.StringOpt{
+			Name:  "src",
+			Value: "any",
+			Desc:  "Only forward traffic from this address or CIDR.",
+		})
+		log := cmd2.Bool(cli.BoolOpt{Name: "log", Desc: "Log the traffic forwarded."})
+		disabled := cmd2.Bool(cli.BoolOpt{Name: "disabled", Desc: "Add the port forward disabled."})
+		cmd2.Action = func() {
+			forward := &unified.PortForward{
+				Name:      *name,
+				IsEnabled: !*disabled,
+				IsLogging: *log,
+				Interface: strings.ToLower(*iface),
+				Protocol:  strings.ToLower(*protocol),
+				Src:       *src,
+				DstPort:   *port,
+				Fwd:       *host,
+			}
+			if i := strings.LastIndex(*host, ":"); i >= 0 {
+				forward.Fwd, forward.FwdPort = (*host)[:i], (*host)[i+1:]
+			}
+			fatalIf(forward.Validate())
+			forwards, _, err := cx.PortForwards.List(ctx)
+			fatalIf(err)
+			fatalIf(unified.CheckPortForward(*forward, forwards, siteSubnets()))
+
+			created, _, err := cx.PortForwards.Create(ctx, forward)
+			fatalIf(err)
+			fmt.Printf("Added %q forwarding %s port %s to %s:%s (%s)\n",
+				created.Name, created.Protocol, created.DstPort, created.Fwd, created.FwdPort, created.ID)
+		}
+	})
+
+	cmd.Command("remove", "Removes a port forward.", func(cmd2 *cli.Cmd) {
+		cmd2.Spec = "[--yes] FORWARD"
+		yes := cmd2.Bool(cli.BoolOpt{
+			Name: "yes",
+			Desc: "Remove the port forward without asking for confirmation.",
+		})
+		query := cmd2.StringArg("FORWARD", "", portForwardArgDesc)
+		cmd2.Action = func() {
+			forward := resolvePortForward(*query)
+			if !*yes {
+				fatalIf(confirm(fmt.Sprintf("Remove the port forward %q?", forward.Name)))
+			}
+			_, err := cx.PortForwards.Delete(ctx, forward.ID)
+			fatalIf(err)
+			fmt.Printf("Removed %q\n", forward.Name)
+		}
+	})
+
+	for _, enable := range []bool{true, false} {
+		enable := enable
+		verb, desc := "enable", "Enables a port forward, checking it does not conflict with those already enabled."
+		if !enable {
+			verb, desc = "disable", "Disables a port forward."
+		}
+		cmd.Command(verb, desc, func(cmd2 *cli.Cmd) {
+			query := cmd2.StringArg("FORWARD", "", portForwardArgDesc)
+			cmd2.Action = func() {
+				forwards, _, err := cx.PortForwards.List(ctx)
+				fatalIf(err)
+				forward, err := unified.ResolvePortForward(*query, forwards)
+				fatalIf(err)
+				forward.IsEnabled = enable
+				if enable {
+					fatalIf(unified.CheckPortForward(*forward, forwards, siteSubnets()))
+				}
+				_, _, err = cx.PortForwards.Update(ctx, forward)
+				fatalIf(err)
+				fmt.Printf("%sd %q\n", strings.Title(verb), forward.Name)
+			}
+		})
+	}
+}
+
+const portForwardArgDesc = "The port forward, by ID, name or WAN port."
+
+func resolvePortForward(query string) *unified.PortForward {
+	forwards, _, err := cx.PortForwards.List(ctx)
+	fatalIf(err)
+	forward, err := unified.ResolvePortForward(query, forwards)
+	fatalIf(err)
+	return forward
+}
+
+// cmdUGWRoute adds the ugw route sub-commands which manage the static routes of the gateway.
+func cmdUGWRoute(cmd *cli.Cmd) {
+	cmd.Command("ls", "Lists the static routes.", func(cmd2 *cli.Cmd) {
+		out := addOutputFlags(cmd2, output.Table)
+		cmd2.Action = func() {
+			out.banner("unified device ugw route ls")
+			routes, _, err := cx.Routes.List(ctx)
+			fatalIf(err)
+			rows := make([]routeRow, 0, len(routes))
+			for _, r := range routes {
+				rows = append(rows, routeRow{r.Name, r.IsEnabled, r.Network, r.RouteType, r.Target(), r.Distance, r.ID})
+			}
+			out.render(rows, "Name", "Enabled", "Network", "Type", "Target", "Distance")
+		}
+	})
+
+	cmd.Command("add", "Adds a static route.", func(cmd2 *cli.Cmd) {
+		cmd2.Spec = "[OPTIONS] NAME NETWORK (--via=<ADDRESS> | --interface=<INTERFACE> | --blackhole)"
+		name := cmd2.StringArg("NAME", "", "The name of the route.")
+		network := cmd2.StringArg("NETWORK", "", "The network to route e.g. 10.1.0.0/16.")
+		via := cmd2.String(cli.StringOpt{
+			Name: "via",
+			Desc: "Route the network to this next hop, which must be on one of the networks of the site.",
+		})
+		iface := cmd2.String(cli.StringOpt{
+			Name: "interface",
+			Desc: "Route the network out of this interface e.g. WAN, WAN2 or the name of a network.",
+		})
+		blackhole := cmd2.Bool(cli.BoolOpt{Name: "blackhole", Desc: "Drop the traffic for the network."})
+		distance := cmd2.Int(cli.IntOpt{
+			Name:  "distance",
+			Value: 1,
+			Desc:  "The administrative distance of the route, 1-255. The lowest distance for a network wins.",
+		})
+		disabled := cmd2.Bool(cli.BoolOpt{Name: "disabled", Desc: "Add the route disabled."})
+		cmd2.Action = func() {
+			route := &unified.Route{
+				Name:      *name,
+				IsEnabled: !*disabled,
+				Network:   *network,
+				Distance:  *distance,
+			}
+			networks, _, err := cx.Rest.List(ctx, "networkconf")
+			fatalIf(err)
+			switch {
+			case *blackhole:
+				route.RouteType = unified.BlackholeRoute
+			case *iface != "":
+				route.RouteType, route.Interface = unified.InterfaceRoute, *iface
+				for _, n := range networks {
+					if strings.EqualFold(n.Name(), *iface) {
+						route.Interface = n.ID()
+					}
+				}
+			default:
+				route.RouteType, route.NextHop = unified.NextHopRoute, *via
+			}
+			fatalIf(route.Validate())
+			routes, _, err := cx.Routes.List(ctx)
+			fatalIf(err)
+			fatalIf(unified.CheckRoute(*route, routes, unified.Subnets(networks)))
+
+			created, _, err := cx.Routes.Create(ctx, route)
+			fatalIf(err)
+			fmt.Printf("Added %q routing %s to %s (%s)\n", created.Name, created.Network, created.Target(), created.ID)
+		}
+	})
+
+	cmd.Command("remove", "Removes a static route.", func(cmd2 *cli.Cmd) {
+		cmd2.Spec = "[--yes] ROUTE"
+		yes := cmd2.Bool(cli.BoolOpt{
+			Name: "yes",
+			Desc: "Remove the route without asking for confirmation.",
+		})
+		query := cmd2.StringArg("ROUTE", "", "The route, by ID, name or network.")
+		cmd2.Action = func() {
+			routes, _, err := cx.Routes.List(ctx)
+			fatalIf(err)
+			route, err := unified.ResolveRoute(*query, routes)
+			fatalIf(err)
+			if !*yes {
+				fatalIf(confirm(fmt.Sprintf("Remove the route %q to %s?", route.Name, route.Network)))
+			}
+			_, err = cx.Routes.Delete(ctx, route.ID)
+			fatalIf(err)
+			fmt.Printf("Removed %q\n", route.Name)
+		}
+	})
+}
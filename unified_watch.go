@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bitbucket.org/ecosse-hosting/unified/lib/output"
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/jawher/mow.cli"
+	"os"
+	"time"
+)
+
+// watchFlags holds the options of the list commands which can re-run their query on an interval.
+type watchFlags struct {
+	watch    *bool
+	interval *string
+	deltas   *bool
+}
+
+// addWatchFlags registers the --watch options on cmd.
+func addWatchFlags(cmd *cli.Cmd) *watchFlags {
+	return &watchFlags{
+		watch: cmd.Bool(cli.BoolOpt{
+			Name: "w watch",
+			Desc: "Re-run the query every --interval, redrawing in place and highlighting the rows which appeared " +
+				"(green), disappeared (red) or changed (yellow) since the previous refresh.",
+		}),
+		interval: cmd.String(cli.StringOpt{
+			Name:  "interval",
+			Value: "2s",
+			Desc:  "How often --watch re-runs the query e.g. 10s or 1m.",
+		}),
+		deltas: cmd.Bool(cli.BoolOpt{
+			Name: "deltas",
+			Desc: "Watch, printing only the rows added, removed or changed as newline delimited JSON. Every row is " +
+				"printed as added by the first refresh.",
+		}),
+	}
+}
+
+// list renders what query returns, once or, when watching, every interval until interrupted. Rows are identified
+// between refreshes by the column key, and compared on the columns displayed.
+func (f *watchFlags) list(
+	out *outputFlags,
+	command, key string,
+	query func() (interface{}, error),
+	columns ...string) {
+
+	if !*f.watch && !*f.deltas {
+		out.banner(command)
+		data, err := query()
+		fatalIf(err)
+		out.render(data, columns...)
+		return
+	}
+
+	every, err := parseAge(*f.interval)
+	fatalIf(err)
+	opts, err := out.options(columns...)
+	fatalIf(err)
+	compared := opts.Columns
+	if len(compared) == 0 && opts.Format == output.Table {
+		compared = columns
+	}
+
+	watcher := output.NewWatcher(key)
+	styles := make(map[string]func(string) string)
+	for change, c := range map[string]color.Attribute{
+		output.Added:   color.FgGreen,
+		output.Removed: color.FgRed,
+		output.Changed: color.FgYellow,
+	} {
+		sprint := color.New(c).SprintFunc()
+		styles[change] = func(s string) string { return sprint(s) }
+	}
+	out.highlight = watcher.Highlight(styles)
+
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		data, err := query()
+		now := time.Now()
+		if err != nil {
+			// Keep watching through the errors of a Controller restarting or a network blip.
+			color.New(color.FgRed).Fprintf(os.Stderr, "%s %v\n", now.Format("15:04:05"), err)
+			time.Sleep(every)
+			continue
+		}
+		merged, deltas, err := watcher.Refresh(data, compared, now)
+		fatalIf(err)
+		switch {
+		case *f.deltas:
+			for _, d := range deltas {
+				fatalIf(enc.Encode(d))
+			}
+		case out.isText():
+			fmt.Print("\033[H\033[2J")
+			fmt.Printf("Every %s: %s    %s\n\n", every, command, now.In(displayLocation).Format("15:04:05"))
+			out.render(merged, columns...)
+		default:
+			out.render(merged, columns...)
+		}
+		time.Sleep(every)
+	}
+}